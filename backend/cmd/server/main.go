@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -13,18 +16,33 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 
 	"github.com/gecogreen/backend/internal/auth"
+	"github.com/gecogreen/backend/internal/cache"
 	"github.com/gecogreen/backend/internal/config"
 	"github.com/gecogreen/backend/internal/database"
+	"github.com/gecogreen/backend/internal/geo"
 	"github.com/gecogreen/backend/internal/handlers"
 	"github.com/gecogreen/backend/internal/middleware"
+	"github.com/gecogreen/backend/internal/models"
 	"github.com/gecogreen/backend/internal/moderation"
+	"github.com/gecogreen/backend/internal/oidc"
+	"github.com/gecogreen/backend/internal/ratelimit"
 	"github.com/gecogreen/backend/internal/repository"
 	"github.com/gecogreen/backend/internal/services"
 	"github.com/gecogreen/backend/internal/storage"
+	"github.com/gecogreen/backend/internal/trees"
+)
+
+// Request body limits: evidence uploads carry videos, every other route gets the default
+const (
+	defaultBodyLimit  = 10 * 1024 * 1024
+	evidenceBodyLimit = models.MaxEvidenceVideoSize + 1024*1024 // Video plus multipart overhead
 )
 
 func main() {
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("❌ Invalid configuration: %v", err)
+	}
 
 	log.Printf("🌿 GecoGreen API Starting...")
 	log.Printf("   Environment: %s", cfg.AppEnv)
@@ -49,14 +67,25 @@ func main() {
 	userRepo := repository.NewUserRepository(db.Pool)
 	productRepo := repository.NewProductRepository(db.Pool)
 	imageReviewRepo := repository.NewImageReviewRepository(db.Pool)
+	imageHashRepo := repository.NewImageHashRepository(db.Pool)
+	uploadSessionRepo := repository.NewUploadSessionRepository(db.Pool)
+	sessionRepo := repository.NewSessionRepository(db.Pool)
+	twoFactorRepo := repository.NewTwoFactorRepository(db.Pool)
+	auditRepo := repository.NewAuditRepository(db.Pool)
+	privacyRepo := repository.NewPrivacyRepository(db.Pool)
 	leaderboardRepo := repository.NewLeaderboardRepository(db.Pool)
 	orderRepo := repository.NewOrderRepository(db.Pool)
+	sellerRepo := repository.NewSellerRepository(db.Pool)
+	geoRepo := repository.NewGeoRepository(db.Pool)
 
 	// JWT
 	jwtManager := auth.NewJWTManager(cfg.JWTSecret)
 
 	// Category repository
 	categoryRepo := repository.NewCategoryRepository(db.Pool)
+	impactRepo := repository.NewImpactRepository(db.Pool)
+	rewardRepo := repository.NewRewardRepository(db.Pool)
+	treeRepo := repository.NewTreeRepository(db.Pool)
 
 	// Stripe Service
 	stripeService := services.NewStripeService(cfg)
@@ -82,30 +111,85 @@ func main() {
 
 	// Handlers
 	healthHandler := handlers.NewHealthHandler(db)
-	authHandler := handlers.NewAuthHandler(userRepo, jwtManager)
-	productHandler := handlers.NewProductHandler(productRepo)
+	// Two-factor authentication (TOTP secrets encrypted at rest)
+	secretBox, err := auth.NewSecretBox(cfg.TwoFactorKey)
+	if err != nil {
+		log.Fatalf("❌ Failed to init 2FA encryption: %v", err)
+	}
+	twoFactorService := services.NewTwoFactorService(twoFactorRepo, secretBox)
+
+	authHandler := handlers.NewAuthHandler(userRepo, sessionRepo, jwtManager, emailService, twoFactorService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService, sessionRepo, cfg.Require2FAForAdmins)
+	oidcProviders := newOIDCProviders(cfg)
+	oidcHandler := handlers.NewOIDCHandler(authHandler, oidc.NewRedisStore(db.Redis), frontendURL, oidcProviders...)
+	for _, p := range oidcProviders {
+		log.Printf("🔑 Social login enabled: %s", p.Name())
+	}
 	categoryHandler := handlers.NewCategoryHandler(categoryRepo)
-	adminHandler := handlers.NewAdminHandler(userRepo, imageReviewRepo)
-	leaderboardHandler := handlers.NewLeaderboardHandler(leaderboardRepo, userRepo)
-	orderHandler := handlers.NewOrderHandler(orderRepo, productRepo, userRepo, stripeService, emailService, frontendURL)
-
-	// Optional: R2 Storage (for image uploads)
+	impactHandler := handlers.NewImpactHandler(impactRepo)
+	rewardHandler := handlers.NewRewardHandler(rewardRepo)
+	adminHandler := handlers.NewAdminHandler(userRepo, imageReviewRepo, imageHashRepo)
+	auditHandler := handlers.NewAuditHandler(auditRepo)
+	leaderboardHandler := handlers.NewLeaderboardHandler(leaderboardRepo, userRepo, rewardRepo)
+	orderHandler := handlers.NewOrderHandler(orderRepo, productRepo, userRepo, impactRepo, stripeService, emailService, frontendURL)
+
+	// File storage: R2, S3/MinIO or local disk (for image uploads)
 	var uploadHandler *handlers.UploadHandler
-	var profileHandler *handlers.ProfileHandler
-	var r2Storage *storage.R2Storage
+	var fileHandler *handlers.FileHandler
 
-	if cfg.R2AccountID != "" && cfg.R2AccessKeyID != "" {
-		r2Storage, err = storage.NewR2Storage(cfg.R2AccountID, cfg.R2AccessKeyID, cfg.R2SecretKey, cfg.R2BucketName, cfg.R2PublicURL)
-		if err != nil {
-			log.Printf("⚠️  R2 Storage not configured: %v", err)
-		} else {
-			uploadHandler = handlers.NewUploadHandler(r2Storage, productRepo)
-			profileHandler = handlers.NewProfileHandler(userRepo, r2Storage)
-			log.Println("✅ Connected to Cloudflare R2")
+	fileStore, err := newFileStore(cfg)
+	if err != nil {
+		log.Printf("⚠️  File storage not configured: %v", err)
+	}
+	if fileStore != nil {
+		uploadHandler = handlers.NewUploadHandler(fileStore, productRepo, uploadSessionRepo)
+		orderHandler.SetEvidenceStorage(fileStore)
+
+		// Delete never-finalized uploads and images of deleted products
+		services.NewUploadSweeper(uploadSessionRepo, productRepo, fileStore, time.Hour, time.Hour).Start(ctx)
+
+		// Local disk files are served by the API itself
+		if localStore, ok := fileStore.(*storage.LocalStorage); ok {
+			fileHandler = handlers.NewFileHandler(localStore)
 		}
 	} else {
-		log.Println("⚠️  R2 Storage not configured (uploads disabled)")
-		profileHandler = handlers.NewProfileHandler(userRepo, nil)
+		log.Println("⚠️  File storage not configured (uploads disabled)")
+	}
+	profileHandler := handlers.NewProfileHandler(userRepo, fileStore)
+	privacyHandler := handlers.NewPrivacyHandler(privacyRepo, sessionRepo, services.NewDataExporter(privacyRepo, fileStore), emailService, cfg.AccountDeletionGrace)
+
+	// Anonymise accounts at the end of their deletion grace period
+	services.NewAccountPurger(privacyRepo, fileStore, time.Hour).Start(ctx)
+
+	// Fill in the coordinates of seller locations and products for geo search
+	geocoder := geo.Chain{geo.NewOffline(geoRepo)}
+	if cfg.Geocoder == "nominatim" {
+		geocoder = geo.Chain{geo.NewNominatim(cfg.GeocoderURL, cfg.GeocoderUserAgent), geo.NewOffline(geoRepo)}
+	}
+	services.NewGeocodeWorker(geoRepo, geocoder, time.Minute).Start(ctx)
+
+	// Impact ledger: post credits of completed orders, reverse refunded ones
+	impactPoster := services.NewImpactPoster(impactRepo, 5*time.Minute)
+	impactPoster.Start(ctx)
+	orderHandler.SetImpactPoster(impactPoster)
+	services.NewCreditsReconciler(impactRepo, 6*time.Hour).Start(ctx)
+	services.NewCreditsExpirer(impactRepo, emailService, cfg.EcoCreditsLifetime, cfg.EcoCreditsExpiryWarning, time.Hour).Start(ctx)
+	leaderboardHandler.SetCreditExpiry(impactRepo, cfg.EcoCreditsLifetime)
+
+	// Plant the trees donated with EcoCredits
+	if treeProvider := newTreeProvider(cfg, frontendURL); treeProvider != nil {
+		services.NewTreePlanter(treeRepo, treeProvider, emailService, 10*time.Minute).Start(ctx)
+	}
+
+	productHandler := handlers.NewProductHandler(productRepo, fileStore)
+	productHandler.SetFacetCache(cache.NewRedisStore(db.Redis))
+	sellerHandler := handlers.NewSellerHandler(userRepo, sellerRepo, productRepo, orderRepo)
+
+	// Perceptual-hash duplicate detection (stdlib only, always on)
+	if uploadHandler != nil {
+		duplicateDetector := moderation.NewDuplicateDetector(imageHashRepo, imageReviewRepo)
+		uploadHandler.SetDuplicateDetector(duplicateDetector)
+		profileHandler.SetDuplicateDetector(duplicateDetector)
 	}
 
 	// Optional: Google Cloud Vision OCR
@@ -128,12 +212,14 @@ func main() {
 
 	// Fiber app
 	app := fiber.New(fiber.Config{
-		AppName:      "GecoGreen API v0.2.0",
-		ErrorHandler: customErrorHandler,
-		BodyLimit:    10 * 1024 * 1024,
+		AppName:           "GecoGreen API v0.2.0",
+		ErrorHandler:      customErrorHandler,
+		BodyLimit:         evidenceBodyLimit, // Largest body of any route, each route is narrowed by middleware.BodyLimit
+		StreamRequestBody: true,              // Lets middleware.BodyLimit reject bodies before reading them
 	})
 
 	app.Use(recover.New())
+	app.Use(middleware.BodyLimit(defaultBodyLimit, isEvidenceUpload))
 	app.Use(logger.New(logger.Config{
 		Format: "[${time}] ${status} - ${latency} ${method} ${path}\n",
 	}))
@@ -152,10 +238,26 @@ func main() {
 		}(),
 		AllowMethods: "GET,POST,PUT,DELETE,PATCH,OPTIONS",
 		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		ExposeHeaders: "Retry-After,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy",
 	}))
 
 	authMiddleware := middleware.AuthMiddleware(jwtManager, userRepo)
-	adminMiddleware := middleware.AdminOnly(userRepo)
+	optionalAuth := middleware.OptionalAuth(jwtManager, userRepo)
+	staffMiddleware := middleware.StaffOnly(cfg.Require2FAForAdmins)
+	verifiedMiddleware := middleware.VerifiedEmailOnly(cfg.RequireVerifiedEmail)
+
+	// Rate limiting and login lockout (Redis, shared across instances; per instance in memory while Redis is down)
+	limitStore := ratelimit.NewFallbackStore(ratelimit.NewRedisStore(db.Redis), ratelimit.NewMemoryStore())
+	limiter := ratelimit.NewLimiter(limitStore)
+	rateLimit := func(name string, limit config.RateLimit, key ratelimit.KeyFunc) fiber.Handler {
+		if !cfg.RateLimitEnabled {
+			return func(c *fiber.Ctx) error { return c.Next() }
+		}
+		return middleware.RateLimit(limiter, ratelimit.Policy{Name: name, Limit: limit.Requests, Window: limit.Window, Key: key})
+	}
+	if cfg.RateLimitEnabled {
+		authHandler.SetLockout(ratelimit.NewLockout(limitStore, cfg.LoginLockoutThreshold, cfg.LoginLockoutBase, cfg.LoginLockoutMax))
+	}
 
 	// Routes
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -164,25 +266,63 @@ func main() {
 	app.Get("/ping", healthHandler.Ping)
 	app.Get("/health", healthHandler.Check)
 
-	v1 := app.Group("/api/v1")
+	// Local storage files (only with the local disk backend)
+	if fileHandler != nil {
+		files := app.Group("/files")
+		files.Static("/public", fileStore.(*storage.LocalStorage).PublicDir())
+		files.Get("/private/*", fileHandler.ServePrivate)
+		files.Put("/upload/*", fileHandler.ReceiveUpload)
+	}
+
+	v1 := app.Group("/api/v1", middleware.Audit(auditRepo)) // Writes the audit records of successful requests
 	v1.Get("/health", healthHandler.Check)
 
 	// Auth
 	authRoutes := v1.Group("/auth")
-	authRoutes.Post("/register", authHandler.Register)
-	authRoutes.Post("/login", authHandler.Login)
+	authRoutes.Post("/register", rateLimit("register", cfg.RateLimitRegister, ratelimit.ByIP), authHandler.Register)
+	authRoutes.Post("/login",
+		rateLimit("login-ip", cfg.RateLimitLoginIP, ratelimit.ByIP),
+		rateLimit("login-email", cfg.RateLimitLoginEmail, ratelimit.ByEmail),
+		authHandler.Login)
 	authRoutes.Post("/refresh", authHandler.Refresh)
+	authRoutes.Post("/2fa/verify", rateLimit("2fa-ip", cfg.RateLimitLoginIP, ratelimit.ByIP), authHandler.VerifyTwoFactor) // Second login step
+	authRoutes.Get("/2fa", authMiddleware, twoFactorHandler.GetStatus)
+	authRoutes.Post("/2fa/setup", authMiddleware, twoFactorHandler.Setup)
+	authRoutes.Post("/2fa/enable", authMiddleware, twoFactorHandler.Enable)
+	authRoutes.Post("/2fa/disable", authMiddleware, twoFactorHandler.Disable)
+	authRoutes.Post("/2fa/recovery-codes", authMiddleware, twoFactorHandler.RegenerateRecoveryCodes)
+	authRoutes.Get("/oidc/providers", oidcHandler.ListProviders)
+	authRoutes.Get("/oidc/:provider/start", rateLimit("oidc-ip", cfg.RateLimitLoginIP, ratelimit.ByIP), oidcHandler.Start)
+	authRoutes.Get("/oidc/:provider/callback", oidcHandler.Callback)
+	authRoutes.Post("/oidc/:provider/callback", oidcHandler.Callback) // Apple uses form_post
+	authRoutes.Post("/oidc/exchange", oidcHandler.Exchange)
+	authRoutes.Post("/oidc/complete", rateLimit("register", cfg.RateLimitRegister, ratelimit.ByIP), oidcHandler.Complete) // First social login
+	authRoutes.Post("/verify-email", rateLimit("verify-email", cfg.RateLimitAuthToken, ratelimit.ByIP), authHandler.VerifyEmail)
+	authRoutes.Post("/resend-verification", authMiddleware, rateLimit("resend-verification", cfg.RateLimitAuthEmail, ratelimit.ByUser), authHandler.ResendVerification)
+	authRoutes.Post("/forgot-password",
+		rateLimit("forgot-password-ip", cfg.RateLimitAuthEmail, ratelimit.ByIP),
+		rateLimit("forgot-password-email", cfg.RateLimitAuthEmail, ratelimit.ByEmail),
+		authHandler.ForgotPassword)
+	authRoutes.Post("/reset-password", rateLimit("reset-password", cfg.RateLimitAuthToken, ratelimit.ByIP), authHandler.ResetPassword)
 	authRoutes.Get("/me", authMiddleware, authHandler.Me)
+	authRoutes.Post("/logout", authMiddleware, authHandler.Logout)
+	authRoutes.Post("/logout-all", authMiddleware, authHandler.LogoutAll)
+	authRoutes.Get("/sessions", authMiddleware, authHandler.ListSessions)        // My active devices
+	authRoutes.Delete("/sessions/:id", authMiddleware, authHandler.RevokeSession) // Log out a device
 
 	// Profile
 	profile := v1.Group("/profile", authMiddleware)
 	profile.Get("/", profileHandler.GetProfile)
 	profile.Put("/", profileHandler.UpdateProfile)
+	profile.Post("/account-type", profileHandler.SwitchAccountType) // PRIVATE ↔ BUSINESS, preview unless confirmed
 	profile.Get("/locations", profileHandler.GetLocations)
 	profile.Post("/locations", profileHandler.CreateLocation)
 	profile.Put("/locations/:id", profileHandler.UpdateLocation)
 	profile.Delete("/locations/:id", profileHandler.DeleteLocation)
-	if r2Storage != nil {
+	profile.Get("/export", rateLimit("data-export", cfg.RateLimitDataExport, ratelimit.ByUser), privacyHandler.ExportData) // GDPR data export (ZIP)
+	profile.Post("/deletion", privacyHandler.RequestDeletion)                                                        // Delete account after grace period
+	profile.Delete("/deletion", privacyHandler.CancelDeletion)
+	if fileStore != nil {
 		profile.Post("/avatar", profileHandler.UploadAvatar)
 		profile.Post("/business-photos", profileHandler.UploadBusinessPhoto)
 	}
@@ -190,32 +330,81 @@ func main() {
 	// Categories (public - no auth required)
 	categories := v1.Group("/categories")
 	categories.Get("/", categoryHandler.List)
+	categories.Get("/tree", categoryHandler.Tree)
 	categories.Get("/:id", categoryHandler.GetByID)
 
 	// Products
 	products := v1.Group("/products")
 	products.Get("/", productHandler.List)
+	products.Get("/map", productHandler.Map)
 	products.Get("/:id", productHandler.Get)
-	products.Post("/", authMiddleware, productHandler.Create)
+	products.Post("/", authMiddleware, verifiedMiddleware, productHandler.Create)
 	products.Put("/:id", authMiddleware, productHandler.Update)
 	products.Delete("/:id", authMiddleware, productHandler.Delete)
+	products.Delete("/:id/images", authMiddleware, productHandler.DeleteImage)
+	products.Put("/:id/images/order", authMiddleware, productHandler.ReorderImages)
+	products.Put("/:id/images/cover", authMiddleware, productHandler.SetCoverImage)
 	products.Get("/seller/my", authMiddleware, productHandler.MyProducts)
 
+	// Seller storefronts (public; contacts shown to buyers with a paid order)
+	sellers := v1.Group("/sellers")
+	sellers.Get("/:id", optionalAuth, sellerHandler.GetSeller)
+	sellers.Get("/:id/products", sellerHandler.GetSellerProducts)
+	v1.Get("/stores/:slug", optionalAuth, sellerHandler.GetStorefront)
+
 	// Upload (only if R2 configured)
 	if uploadHandler != nil {
 		upload := v1.Group("/upload")
 		upload.Post("/product/:product_id/image", authMiddleware, uploadHandler.UploadProductImage)
 		upload.Post("/product/:product_id/expiry-photo", authMiddleware, uploadHandler.UploadExpiryPhoto)
 		upload.Post("/presign", authMiddleware, uploadHandler.GetPresignedURL)
+		upload.Post("/sessions/:id/finalize", authMiddleware, uploadHandler.FinalizeUpload)
 	}
 
 	// Admin routes
-	admin := v1.Group("/admin", authMiddleware, adminMiddleware)
-	admin.Get("/reviews", adminHandler.GetPendingReviews)
-	admin.Get("/reviews/stats", adminHandler.GetReviewStats)
-	admin.Get("/reviews/:id", adminHandler.GetReviewDetail)
-	admin.Post("/reviews/:id/approve", adminHandler.ApproveReview)
-	admin.Post("/reviews/:id/reject", adminHandler.RejectReview)
+	admin := v1.Group("/admin", authMiddleware, staffMiddleware)
+	canReviewImages := middleware.RequirePermission(models.PermImagesReview)
+	admin.Get("/reviews", canReviewImages, adminHandler.GetPendingReviews)
+	admin.Get("/reviews/stats", canReviewImages, adminHandler.GetReviewStats)
+	admin.Get("/reviews/:id", canReviewImages, adminHandler.GetReviewDetail)
+	admin.Post("/reviews/:id/approve", canReviewImages, adminHandler.ApproveReview)
+	admin.Post("/reviews/:id/reject", canReviewImages, adminHandler.RejectReview)
+	admin.Get("/images/duplicates", canReviewImages, adminHandler.GetDuplicateClusters)
+	canModerateReviews := middleware.RequirePermission(models.PermReviewsModerate)
+	admin.Get("/order-reviews", canModerateReviews, orderHandler.ListReviewsForModeration)
+	admin.Put("/order-reviews/:id", canModerateReviews, orderHandler.ModerateReview)
+	canManageUsers := middleware.RequirePermission(models.PermUsersManage)
+	admin.Get("/staff", canManageUsers, adminHandler.ListStaff)
+	admin.Put("/users/:id/roles", canManageUsers, adminHandler.SetUserRoles)
+	admin.Put("/users/:id/status", canManageUsers, adminHandler.SetUserStatus) // Ban, suspend, reactivate
+	canReadAudit := middleware.RequirePermission(models.PermAuditRead)
+	admin.Get("/audit", canReadAudit, auditHandler.Search)
+	admin.Get("/audit/verify", canReadAudit, auditHandler.Verify)
+	admin.Get("/eco-credits/drift", canReadAudit, impactHandler.CreditDrift)
+
+	// Admin category tree
+	adminCategories := admin.Group("/categories", middleware.RequirePermission(models.PermCategoriesManage))
+	adminCategories.Get("/", categoryHandler.AdminTree)
+	adminCategories.Post("/", categoryHandler.AdminCreate)
+	adminCategories.Put("/order", categoryHandler.AdminReorder)
+	adminCategories.Put("/:id", categoryHandler.AdminUpdate)
+	adminCategories.Put("/:id/parent", categoryHandler.AdminMove)
+	adminCategories.Post("/:id/merge", categoryHandler.AdminMerge)
+	adminCategories.Delete("/:id", categoryHandler.AdminDelete)
+
+	// Admin impact factors
+	adminImpact := admin.Group("/impact-factors", middleware.RequirePermission(models.PermImpactFactorsManage))
+	adminImpact.Get("/", impactHandler.List)
+	adminImpact.Get("/:category_id/history", impactHandler.History)
+	adminImpact.Put("/:category_id", impactHandler.Set)
+	adminImpact.Delete("/:category_id", impactHandler.Clear)
+
+	// Admin EcoCredits reward catalogue
+	adminRewards := admin.Group("/rewards", middleware.RequirePermission(models.PermRewardsManage))
+	adminRewards.Get("/", rewardHandler.AdminList)
+	adminRewards.Post("/", rewardHandler.AdminCreate)
+	adminRewards.Put("/:id", rewardHandler.AdminUpdate)
+	adminRewards.Delete("/:id", rewardHandler.AdminDelete)
 
 	// Leaderboard routes (public)
 	leaderboard := v1.Group("/leaderboard")
@@ -223,14 +412,17 @@ func main() {
 	leaderboard.Get("/hall-of-fame", leaderboardHandler.GetHallOfFame)
 	leaderboard.Get("/community-stats", leaderboardHandler.GetCommunityStats)
 	leaderboard.Get("/featured", leaderboardHandler.GetFeaturedAwards)
+	leaderboard.Get("/rewards", leaderboardHandler.ListRewards)
 	// Leaderboard routes (authenticated)
 	leaderboard.Get("/my-rank", authMiddleware, leaderboardHandler.GetMyRank)
 	leaderboard.Get("/my-awards", authMiddleware, leaderboardHandler.GetMyAwards)
 	leaderboard.Get("/my-impact", authMiddleware, leaderboardHandler.GetMyImpactHistory)
+	leaderboard.Get("/my-credits/expiring", authMiddleware, leaderboardHandler.GetMyCreditExpirations)
+	leaderboard.Get("/my-rewards", authMiddleware, leaderboardHandler.GetMyRewards)
 	leaderboard.Post("/redeem", authMiddleware, leaderboardHandler.RedeemReward)
 
 	// Admin Awards/Tasks routes
-	adminAwards := admin.Group("/awards")
+	adminAwards := admin.Group("/awards", middleware.RequirePermission(models.PermAwardsManage))
 	adminAwards.Get("/tasks", leaderboardHandler.AdminGetTasks)
 	adminAwards.Post("/tasks", leaderboardHandler.AdminCreateTask)
 	adminAwards.Put("/tasks/:id", leaderboardHandler.AdminUpdateTask)
@@ -243,14 +435,18 @@ func main() {
 	orders := v1.Group("/orders", authMiddleware)
 	orders.Get("/", orderHandler.ListMyOrders)           // List my orders (as buyer)
 	orders.Get("/seller", orderHandler.ListSellerOrders) // List orders (as seller)
-	orders.Post("/", orderHandler.CreateOrder)           // Create new order
+	orders.Post("/", verifiedMiddleware, rateLimit("orders", cfg.RateLimitOrders, ratelimit.ByUser), orderHandler.CreateOrder) // Create new order
 	orders.Get("/:id", orderHandler.GetOrder)            // Get order details
 	orders.Put("/:id/status", orderHandler.UpdateOrderStatus) // Update status (seller)
 	orders.Post("/:id/cancel", orderHandler.CancelOrder) // Cancel order
 	orders.Get("/:id/qr", orderHandler.GetQRCode)        // Get QR code (buyer)
-	orders.Post("/confirm-pickup", orderHandler.ConfirmPickup) // Confirm pickup (seller scans QR)
+	orders.Post("/confirm-pickup", rateLimit("pickup", cfg.RateLimitPickup, ratelimit.ByUser), orderHandler.ConfirmPickup) // Confirm pickup (seller scans QR)
 	orders.Post("/:id/dispute", orderHandler.OpenDispute) // Open dispute
 	orders.Get("/:id/dispute", orderHandler.GetDispute)   // Get dispute
+	orders.Post("/:id/dispute/resolve", staffMiddleware, middleware.RequirePermission(models.PermDisputesResolve), orderHandler.ResolveDispute) // Resolve dispute (staff)
+	orders.Post("/:id/dispute/evidence", middleware.BodyLimit(evidenceBodyLimit, nil), orderHandler.UploadDisputeEvidence) // Upload evidence (buyer/seller)
+	orders.Get("/:id/dispute/evidence", orderHandler.ListDisputeEvidence)    // List evidence (signed URLs)
+	orders.Delete("/:id/dispute/evidence/:evidenceId", orderHandler.DeleteDisputeEvidence) // Delete unattached evidence
 	orders.Post("/:id/review", orderHandler.CreateReview) // Create review
 
 	// Stripe Webhook (no auth - verified by signature)
@@ -276,6 +472,114 @@ func main() {
 	}
 }
 
+// newOIDCProviders returns the social login providers that have a client ID configured
+func newOIDCProviders(cfg *config.Config) []*oidc.Provider {
+	apiURL := strings.TrimSuffix(cfg.APIURL, "/")
+	redirect := func(name string) string {
+		return apiURL + "/api/v1/auth/oidc/" + name + "/callback"
+	}
+
+	var providers []*oidc.Provider
+	if p := cfg.OIDCGoogle; p.ClientID != "" {
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name: "google", Issuer: p.Issuer, ClientID: p.ClientID, ClientSecret: p.ClientSecret,
+			RedirectURL: redirect("google"),
+		}))
+	}
+	if p := cfg.OIDCApple; p.ClientID != "" {
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name: "apple", Issuer: p.Issuer, ClientID: p.ClientID, ClientSecret: p.ClientSecret,
+			RedirectURL: redirect("apple"), Scopes: []string{"openid", "email", "name"}, ResponseMode: "form_post",
+		}))
+	}
+	if p := cfg.OIDCFacebook; p.ClientID != "" {
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name: "facebook", Issuer: p.Issuer, ClientID: p.ClientID, ClientSecret: p.ClientSecret,
+			RedirectURL: redirect("facebook"), Scopes: []string{"openid", "email"},
+		}))
+	}
+	return providers
+}
+
+// isEvidenceUpload matches the dispute evidence upload, the only route over defaultBodyLimit
+func isEvidenceUpload(c *fiber.Ctx) bool {
+	return c.Method() == fiber.MethodPost &&
+		strings.HasPrefix(c.Path(), "/api/v1/orders/") && strings.HasSuffix(c.Path(), "/dispute/evidence")
+}
+
+// newTreeProvider creates the tree partner selected by TREE_PROVIDER. In
+// production there is no fallback to the fake provider: without a real partner
+// it returns nil and donations stay PENDING until one is configured.
+func newTreeProvider(cfg *config.Config, frontendURL string) trees.Provider {
+	if cfg.TreeProvider == "treenation" && cfg.TreeNationToken != "" {
+		log.Println("🌳 Tree donations planted with Tree-Nation")
+		return trees.NewTreeNation(cfg.TreeNationURL, cfg.TreeNationToken, cfg.TreeNationSpeciesID)
+	}
+	if cfg.IsProduction() {
+		log.Println("⚠️  Tree planter disabled: donations stay pending (TREE_PROVIDER/TREE_NATION_TOKEN not set)")
+		return nil
+	}
+	return trees.NewFake(frontendURL + "/alberi")
+}
+
+// newFileStore creates the storage backend selected by STORAGE_DRIVER.
+// When unset it picks R2 if configured, then S3, then local disk (not in production).
+// Returns nil when no backend is available.
+func newFileStore(cfg *config.Config) (storage.Store, error) {
+	driver := cfg.StorageDriver
+	if driver == "" {
+		switch {
+		case cfg.R2AccountID != "" && cfg.R2AccessKeyID != "":
+			driver = "r2"
+		case cfg.S3AccessKeyID != "":
+			driver = "s3"
+		case !cfg.IsProduction():
+			driver = "local"
+		default:
+			return nil, nil
+		}
+	}
+
+	switch driver {
+	case "r2":
+		r2Storage, err := storage.NewR2Storage(cfg.R2AccountID, cfg.R2AccessKeyID, cfg.R2SecretKey, cfg.R2BucketName, cfg.R2PrivateBucketName, cfg.R2PublicURL)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("✅ Connected to Cloudflare R2")
+		return r2Storage, nil
+	case "s3":
+		s3Storage, err := storage.NewS3Storage(storage.S3Options{
+			Endpoint:          cfg.S3Endpoint,
+			Region:            cfg.S3Region,
+			AccessKeyID:       cfg.S3AccessKeyID,
+			SecretKey:         cfg.S3SecretKey,
+			BucketName:        cfg.S3BucketName,
+			PrivateBucketName: cfg.S3PrivateBucketName,
+			PublicURL:         cfg.S3PublicURL,
+			UsePathStyle:      cfg.S3UsePathStyle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Connected to S3 storage (%s)", cfg.S3Endpoint)
+		return s3Storage, nil
+	case "local":
+		baseURL := cfg.LocalStorageURL
+		if baseURL == "" {
+			baseURL = "http://localhost:" + cfg.Port + "/files"
+		}
+		localStorage, err := storage.NewLocalStorage(cfg.LocalStorageDir, baseURL, cfg.JWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using local disk storage (%s)", cfg.LocalStorageDir)
+		return localStorage, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
 func customErrorHandler(c *fiber.Ctx, err error) error {
 	code := fiber.StatusInternalServerError
 	message := "Internal Server Error"
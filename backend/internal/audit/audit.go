@@ -0,0 +1,99 @@
+// Package audit builds the audit records of a request.
+//
+// Sensitive actions (order overrides and refunds, dispute resolutions, bans,
+// role changes, moderation, staff edits, billing data) build their records
+// with Log and hand them to the repository method that performs the action,
+// which writes them in the same transaction: the action and its record commit
+// or roll back together.
+//
+// Other admin changes call Record; middleware.Audit writes those entries once
+// the handler has succeeded, after its change has committed. If that write
+// fails the request fails with 500, but the change stands without a record.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+// localsKey is where middleware.Audit stores the request's Trail
+const localsKey = "auditTrail"
+
+// Entry is a sensitive action on an entity; Before and After are
+// JSON-serializable snapshots (nil when not applicable)
+type Entry struct {
+	Action     string
+	EntityType string
+	EntityID   uuid.UUID
+	Before     interface{}
+	After      interface{}
+	Metadata   map[string]interface{}
+}
+
+// Trail holds the entries recorded during a request
+type Trail struct {
+	entries []Entry
+}
+
+// Attach gives the request a new trail and returns it
+func Attach(c *fiber.Ctx) *Trail {
+	t := &Trail{}
+	c.Locals(localsKey, t)
+	return t
+}
+
+// Entries returns the recorded entries in order
+func (t *Trail) Entries() []Entry {
+	return t.entries
+}
+
+// Log builds the audit record of e for the request: the actor, IP and user
+// agent come from c
+func Log(c *fiber.Ctx, e Entry) *models.AuditLog {
+	log := &models.AuditLog{
+		Action:     e.Action,
+		EntityType: e.EntityType,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+		OldValue:   marshalSnapshot(e.Before),
+		NewValue:   marshalSnapshot(e.After),
+	}
+	if user, ok := c.Locals("user").(*models.User); ok {
+		log.UserID = &user.ID
+	}
+	if e.EntityID != uuid.Nil {
+		id := e.EntityID
+		log.EntityID = &id
+	}
+	if len(e.Metadata) > 0 {
+		log.Metadata = marshalSnapshot(e.Metadata)
+	}
+	return log
+}
+
+// Record adds an entry to the request's trail, written by middleware.Audit
+// after the handler. Sensitive actions use Log instead.
+func Record(c *fiber.Ctx, e Entry) {
+	t, ok := c.Locals(localsKey).(*Trail)
+	if !ok {
+		fmt.Printf("⚠️ Audit %s on %s %s not recorded: audit middleware missing\n", e.Action, e.EntityType, e.EntityID)
+		return
+	}
+	t.entries = append(t.entries, e)
+}
+
+func marshalSnapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
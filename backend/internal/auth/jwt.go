@@ -17,13 +17,15 @@ var (
 type TokenType string
 
 const (
-	AccessToken  TokenType = "access"
-	RefreshToken TokenType = "refresh"
+	AccessToken TokenType = "access"
+	// TwoFactorChallenge proves the password step of a 2FA login; it grants no access
+	TwoFactorChallenge TokenType = "2fa_challenge"
 )
 
 // Claims represents the JWT claims
 type Claims struct {
 	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"sid"` // session family the token was issued for
 	Email     string    `json:"email"`
 	Role      string    `json:"role"`
 	TokenType TokenType `json:"token_type"`
@@ -35,6 +37,7 @@ type JWTManager struct {
 	secretKey          []byte
 	accessTokenExpiry  time.Duration
 	refreshTokenExpiry time.Duration
+	challengeExpiry    time.Duration
 }
 
 // NewJWTManager creates a new JWT manager
@@ -43,23 +46,26 @@ func NewJWTManager(secretKey string) *JWTManager {
 		secretKey:          []byte(secretKey),
 		accessTokenExpiry:  15 * time.Minute,      // Access token valid for 15 minutes
 		refreshTokenExpiry: 7 * 24 * time.Hour,    // Refresh token valid for 7 days
+		challengeExpiry:    5 * time.Minute,       // Time to type the 2FA code
 	}
 }
 
-// GenerateAccessToken generates a new access token
-func (m *JWTManager) GenerateAccessToken(userID uuid.UUID, email, role string) (string, error) {
-	return m.generateToken(userID, email, role, AccessToken, m.accessTokenExpiry)
+// GenerateAccessToken generates a new access token bound to a session.
+// Refresh tokens are opaque and stored server-side (see GenerateToken).
+func (m *JWTManager) GenerateAccessToken(userID, sessionID uuid.UUID, email, role string) (string, error) {
+	return m.generateToken(userID, sessionID, email, role, AccessToken, m.accessTokenExpiry)
 }
 
-// GenerateRefreshToken generates a new refresh token
-func (m *JWTManager) GenerateRefreshToken(userID uuid.UUID, email, role string) (string, error) {
-	return m.generateToken(userID, email, role, RefreshToken, m.refreshTokenExpiry)
+// GenerateChallengeToken generates the token exchanged for a session once the 2FA code is verified
+func (m *JWTManager) GenerateChallengeToken(userID uuid.UUID, email string) (string, error) {
+	return m.generateToken(userID, uuid.Nil, email, "", TwoFactorChallenge, m.challengeExpiry)
 }
 
-func (m *JWTManager) generateToken(userID uuid.UUID, email, role string, tokenType TokenType, expiry time.Duration) (string, error) {
+func (m *JWTManager) generateToken(userID, sessionID uuid.UUID, email, role string, tokenType TokenType, expiry time.Duration) (string, error) {
 	now := time.Now()
 	claims := Claims{
 		UserID:    userID,
+		SessionID: sessionID,
 		Email:     email,
 		Role:      role,
 		TokenType: tokenType,
@@ -104,3 +110,13 @@ func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 func (m *JWTManager) GetAccessTokenExpiry() int64 {
 	return int64(m.accessTokenExpiry.Seconds())
 }
+
+// GetChallengeExpiry returns challenge token expiry in seconds
+func (m *JWTManager) GetChallengeExpiry() int64 {
+	return int64(m.challengeExpiry.Seconds())
+}
+
+// GetRefreshTokenExpiry returns the lifetime of a refresh token
+func (m *JWTManager) GetRefreshTokenExpiry() time.Duration {
+	return m.refreshTokenExpiry
+}
@@ -1,7 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -21,16 +26,79 @@ type Config struct {
 	// JWT
 	JWTSecret string
 
+	// Two-factor authentication
+	Require2FAForAdmins bool
+	TwoFactorKey        string // encrypts TOTP secrets at rest
+
+	// OpenID Connect social login; a provider is enabled when its client ID is set
+	APIURL       string // public URL of this API, used to build the OIDC redirect URIs
+	OIDCGoogle   OIDCProvider
+	OIDCApple    OIDCProvider
+	OIDCFacebook OIDCProvider
+
+	// Block buying and selling until the email is verified
+	RequireVerifiedEmail bool
+
+	// GDPR: how long a deletion request can be cancelled before the account is anonymised
+	AccountDeletionGrace time.Duration
+
+	// EcoCredits expire this long after being earned (0 = never), with a warning email ahead
+	EcoCreditsLifetime      time.Duration
+	EcoCreditsExpiryWarning time.Duration
+
+	// Geocoding: "offline" (CAP/comune table only) or "nominatim" (street level, falls back to offline)
+	Geocoder          string
+	GeocoderURL       string
+	GeocoderUserAgent string
+
+	// Tree donations: "fake" (no partner, development) or "treenation"
+	TreeProvider        string
+	TreeNationURL       string
+	TreeNationToken     string
+	TreeNationSpeciesID int
+
+	// Rate limiting ("<requests>/<window>", e.g. "10/15m")
+	RateLimitEnabled      bool
+	RateLimitLoginIP      RateLimit
+	RateLimitLoginEmail   RateLimit
+	RateLimitRegister     RateLimit
+	RateLimitAuthEmail    RateLimit // forgot password, resend verification
+	RateLimitAuthToken    RateLimit // verify email, reset password
+	RateLimitOrders       RateLimit
+	RateLimitPickup       RateLimit
+	RateLimitDataExport   RateLimit
+	LoginLockoutThreshold int
+	LoginLockoutBase      time.Duration
+	LoginLockoutMax       time.Duration
+
 	// Stripe
 	StripeSecretKey string
 	StripeWebhookSecret string
 
+	// File storage: "r2", "s3", "local" (empty = auto-detect)
+	StorageDriver string
+
 	// Cloudflare R2
-	R2AccountID   string
-	R2AccessKeyID string
-	R2SecretKey   string
-	R2BucketName  string
-	R2PublicURL   string
+	R2AccountID         string
+	R2AccessKeyID       string
+	R2SecretKey         string
+	R2BucketName        string
+	R2PrivateBucketName string
+	R2PublicURL         string
+
+	// Generic S3 / MinIO
+	S3Endpoint          string
+	S3Region            string
+	S3AccessKeyID       string
+	S3SecretKey         string
+	S3BucketName        string
+	S3PrivateBucketName string
+	S3PublicURL         string
+	S3UsePathStyle      bool
+
+	// Local disk storage (dev/test)
+	LocalStorageDir string
+	LocalStorageURL string
 
 	// SMTP (Email)
 	SMTPHost     string
@@ -41,6 +109,16 @@ type Config struct {
 	FrontendURL  string
 }
 
+// Development defaults of the secrets, refused in production
+const (
+	devJWTSecret    = "dev_jwt_secret_change_in_production"
+	devTwoFactorKey = "dev_2fa_key_change_in_production"
+)
+
+// minSecretLength is the shortest JWT_SECRET / TWO_FACTOR_KEY accepted in production
+// (openssl rand -base64 32 gives 44 characters)
+const minSecretLength = 32
+
 // Load loads configuration from environment variables
 func Load() *Config {
 	// Load .env file in development
@@ -58,18 +136,81 @@ func Load() *Config {
 		RedisURL: getEnv("REDIS_URL", "redis://localhost:6379"),
 
 		// JWT
-		JWTSecret: getEnv("JWT_SECRET", "dev_jwt_secret_change_in_production"),
+		JWTSecret: getEnv("JWT_SECRET", devJWTSecret),
+
+		// Two-factor authentication
+		Require2FAForAdmins: getEnv("REQUIRE_2FA_FOR_ADMINS", "false") == "true",
+		TwoFactorKey:        getEnv("TWO_FACTOR_KEY", devTwoFactorKey),
+
+		// OpenID Connect
+		APIURL:       getEnv("API_URL", "http://localhost:8080"),
+		OIDCGoogle:   getEnvOIDC("GOOGLE", "https://accounts.google.com"),
+		OIDCApple:    getEnvOIDC("APPLE", "https://appleid.apple.com"),
+		OIDCFacebook: getEnvOIDC("FACEBOOK", "https://www.facebook.com"),
+
+		// Email verification policy
+		RequireVerifiedEmail: getEnv("REQUIRE_VERIFIED_EMAIL", "false") == "true",
+
+		// Account deletion
+		AccountDeletionGrace: getEnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+
+		// EcoCredits expiry
+		EcoCreditsLifetime:      getEnvDuration("ECO_CREDITS_LIFETIME", 365*24*time.Hour),
+		EcoCreditsExpiryWarning: getEnvDuration("ECO_CREDITS_EXPIRY_WARNING", 30*24*time.Hour),
+
+		// Geocoding
+		Geocoder:          getEnv("GEOCODER", "offline"),
+		GeocoderURL:       getEnv("GEOCODER_URL", "https://nominatim.openstreetmap.org"),
+		GeocoderUserAgent: getEnv("GEOCODER_USER_AGENT", "GecoGreen/1.0 (noreply@gecogreen.com)"),
+
+		// Tree donations
+		TreeProvider:        getEnv("TREE_PROVIDER", "fake"),
+		TreeNationURL:       getEnv("TREE_NATION_URL", "https://tree-nation.com/api"),
+		TreeNationToken:     getEnv("TREE_NATION_TOKEN", ""),
+		TreeNationSpeciesID: getEnvInt("TREE_NATION_SPECIES_ID", 0),
+
+		// Rate limiting
+		RateLimitEnabled:      getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+		RateLimitLoginIP:      getEnvRateLimit("RATE_LIMIT_LOGIN_IP", "20/15m"),
+		RateLimitLoginEmail:   getEnvRateLimit("RATE_LIMIT_LOGIN_EMAIL", "10/15m"),
+		RateLimitRegister:     getEnvRateLimit("RATE_LIMIT_REGISTER", "5/1h"),
+		RateLimitAuthEmail:    getEnvRateLimit("RATE_LIMIT_AUTH_EMAIL", "5/1h"),
+		RateLimitAuthToken:    getEnvRateLimit("RATE_LIMIT_AUTH_TOKEN", "20/15m"),
+		RateLimitOrders:       getEnvRateLimit("RATE_LIMIT_ORDERS", "10/1m"),
+		RateLimitPickup:       getEnvRateLimit("RATE_LIMIT_PICKUP", "10/1m"),
+		RateLimitDataExport:   getEnvRateLimit("RATE_LIMIT_DATA_EXPORT", "3/24h"),
+		LoginLockoutThreshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+		LoginLockoutBase:      getEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:       getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
 
 		// Stripe
 		StripeSecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
 		StripeWebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
 
+		// File storage
+		StorageDriver: getEnv("STORAGE_DRIVER", ""),
+
 		// Cloudflare R2
-		R2AccountID:   getEnv("R2_ACCOUNT_ID", ""),
-		R2AccessKeyID: getEnv("R2_ACCESS_KEY_ID", ""),
-		R2SecretKey:   getEnv("R2_SECRET_KEY", ""),
-		R2BucketName:  getEnv("R2_BUCKET_NAME", "gecogreen-uploads"),
-		R2PublicURL:   getEnv("R2_PUBLIC_URL", ""),
+		R2AccountID:         getEnv("R2_ACCOUNT_ID", ""),
+		R2AccessKeyID:       getEnv("R2_ACCESS_KEY_ID", ""),
+		R2SecretKey:         getEnv("R2_SECRET_KEY", ""),
+		R2BucketName:        getEnv("R2_BUCKET_NAME", "gecogreen-uploads"),
+		R2PrivateBucketName: getEnv("R2_PRIVATE_BUCKET_NAME", ""),
+		R2PublicURL:         getEnv("R2_PUBLIC_URL", ""),
+
+		// Generic S3 / MinIO
+		S3Endpoint:          getEnv("S3_ENDPOINT", ""),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3AccessKeyID:       getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretKey:         getEnv("S3_SECRET_KEY", ""),
+		S3BucketName:        getEnv("S3_BUCKET_NAME", "gecogreen-uploads"),
+		S3PrivateBucketName: getEnv("S3_PRIVATE_BUCKET_NAME", ""),
+		S3PublicURL:         getEnv("S3_PUBLIC_URL", ""),
+		S3UsePathStyle:      getEnv("S3_USE_PATH_STYLE", "true") == "true",
+
+		// Local disk storage
+		LocalStorageDir: getEnv("LOCAL_STORAGE_DIR", "./uploads"),
+		LocalStorageURL: getEnv("LOCAL_STORAGE_URL", ""),
 
 		// SMTP
 		SMTPHost:     getEnv("SMTP_HOST", "smtps.aruba.it"),
@@ -81,6 +222,49 @@ func Load() *Config {
 	}
 }
 
+// RateLimit allows Requests per Window
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// OIDCProvider holds the client credentials registered with an OpenID Connect provider
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // for Apple, the signed client secret JWT
+}
+
+// Validate refuses settings that are unsafe in production: default, placeholder
+// or short secrets, and the same value for JWT_SECRET and TWO_FACTOR_KEY
+func (c *Config) Validate() error {
+	if !c.IsProduction() {
+		return nil
+	}
+	if err := validateSecret("JWT_SECRET", c.JWTSecret, devJWTSecret); err != nil {
+		return err
+	}
+	if err := validateSecret("TWO_FACTOR_KEY", c.TwoFactorKey, devTwoFactorKey); err != nil {
+		return err
+	}
+	if c.JWTSecret == c.TwoFactorKey {
+		return errors.New("JWT_SECRET and TWO_FACTOR_KEY must be different")
+	}
+	return nil
+}
+
+func validateSecret(name, value, devDefault string) error {
+	switch {
+	case value == devDefault:
+		return fmt.Errorf("%s is the development default", name)
+	case strings.Contains(value, "CAMBIA_QUESTO"):
+		return fmt.Errorf("%s is the .env.example placeholder", name)
+	case len(value) < minSecretLength:
+		return fmt.Errorf("%s must be at least %d characters", name, minSecretLength)
+	}
+	return nil
+}
+
 // IsDevelopment returns true if running in development mode
 func (c *Config) IsDevelopment() bool {
 	return c.AppEnv == "development"
@@ -97,3 +281,51 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return defaultValue
+}
+
+// getEnvOIDC reads OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_ISSUER
+func getEnvOIDC(name, defaultIssuer string) OIDCProvider {
+	return OIDCProvider{
+		Issuer:       getEnv("OIDC_"+name+"_ISSUER", defaultIssuer),
+		ClientID:     getEnv("OIDC_"+name+"_CLIENT_ID", ""),
+		ClientSecret: getEnv("OIDC_"+name+"_CLIENT_SECRET", ""),
+	}
+}
+
+// getEnvRateLimit parses "<requests>/<window>", falling back to defaultValue if malformed
+func getEnvRateLimit(key, defaultValue string) RateLimit {
+	if limit, ok := parseRateLimit(getEnv(key, defaultValue)); ok {
+		return limit
+	}
+	limit, _ := parseRateLimit(defaultValue)
+	return limit
+}
+
+func parseRateLimit(value string) (RateLimit, bool) {
+	requests, window, found := strings.Cut(value, "/")
+	if !found {
+		return RateLimit{}, false
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return RateLimit{}, false
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return RateLimit{}, false
+	}
+	return RateLimit{Requests: n, Window: d}, true
+}
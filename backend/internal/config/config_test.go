@@ -0,0 +1,32 @@
+package config
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	strong := "0123456789abcdefghijklmnopqrstuvwxyz"
+	strong2 := "zyxwvutsrqponmlkjihgfedcba9876543210"
+
+	tests := []struct {
+		name      string
+		env       string
+		jwt       string
+		twoFactor string
+		wantErr   bool
+	}{
+		{"development defaults in development", "development", devJWTSecret, devTwoFactorKey, false},
+		{"strong secrets in production", "production", strong, strong2, false},
+		{"default JWT secret in production", "production", devJWTSecret, strong2, true},
+		{"default 2FA key in production", "production", strong, devTwoFactorKey, true},
+		{"placeholder JWT secret", "production", "CAMBIA_QUESTO_IN_PRODUZIONE_usa_openssl_rand_base64_32", strong2, true},
+		{"short JWT secret", "production", "secret", strong2, true},
+		{"short 2FA key", "production", strong, "short", true},
+		{"same secret for both", "production", strong, strong, true},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{AppEnv: tt.env, JWTSecret: tt.jwt, TwoFactorKey: tt.twoFactor}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err=%v, want error=%v", tt.name, err, tt.wantErr)
+		}
+	}
+}
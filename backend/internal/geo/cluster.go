@@ -0,0 +1,25 @@
+package geo
+
+import "math"
+
+// Map zoom levels accepted by the cluster endpoint (web map tiles)
+const (
+	MinZoom = 3
+	MaxZoom = 18
+)
+
+// clusterCellsPerTile is how many cluster cells fit along a 256px tile:
+// one marker every ~64px
+const clusterCellsPerTile = 4
+
+// ClusterCellSize returns the side, in degrees, of the grid cells markers are
+// grouped by at a zoom level. Each zoom level halves it.
+func ClusterCellSize(zoom int) float64 {
+	if zoom < MinZoom {
+		zoom = MinZoom
+	}
+	if zoom > MaxZoom {
+		zoom = MaxZoom
+	}
+	return 360 / math.Pow(2, float64(zoom)) / clusterCellsPerTile
+}
@@ -0,0 +1,127 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+)
+
+// Geocoder turns an address into coordinates. Implementations: the offline
+// CAP/comune table (Offline), Nominatim (OpenStreetMap), and Chain to combine them.
+type Geocoder interface {
+	// Geocode returns ErrNotFound when the address can't be located
+	Geocode(ctx context.Context, addr Address) (*Result, error)
+}
+
+// ErrNotFound is returned when an address can't be geocoded
+var ErrNotFound = errors.New("address not found")
+
+// Point is a WGS84 coordinate
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Address is what gets geocoded. Street is optional: without it the result is
+// at most as precise as the postal code.
+type Address struct {
+	Street     string
+	City       string
+	Province   string // 2-letter sigla, e.g. "MI"
+	PostalCode string // CAP
+	Country    string // ISO 3166-1, defaults to IT
+}
+
+// Normalized trims the fields and upper-cases the codes
+func (a Address) Normalized() Address {
+	a.Street = strings.TrimSpace(a.Street)
+	a.City = strings.TrimSpace(a.City)
+	a.Province = strings.ToUpper(strings.TrimSpace(a.Province))
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	if a.Country == "" {
+		a.Country = "IT"
+	}
+	return a
+}
+
+// Precision tells how close a result is to the actual address
+type Precision string
+
+const (
+	PrecisionAddress    Precision = "ADDRESS"     // street level
+	PrecisionPostalCode Precision = "POSTAL_CODE" // centre of the CAP area
+	PrecisionCity       Precision = "CITY"        // centre of the comune
+	PrecisionProvince   Precision = "PROVINCE"    // province capital
+)
+
+// Result is a geocoded address
+type Result struct {
+	Point     Point
+	Precision Precision
+	Source    string // geocoder that found it
+}
+
+// Chain tries each geocoder in order and returns the first result. Errors other
+// than ErrNotFound are skipped too, so a remote outage falls back to the next one.
+type Chain []Geocoder
+
+func (c Chain) Geocode(ctx context.Context, addr Address) (*Result, error) {
+	var lastErr error = ErrNotFound
+	for _, g := range c {
+		result, err := g.Geocode(ctx, addr)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm is the great-circle (haversine) distance between two points
+func DistanceKm(a, b Point) float64 {
+	dLat := radians(b.Lat - a.Lat)
+	dLng := radians(b.Lng - a.Lng)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(a.Lat))*math.Cos(radians(b.Lat))*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// Box is a latitude/longitude rectangle
+type Box struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// BoxAround returns the smallest box containing the circle of radiusKm around p,
+// used to prefilter on the coordinate indexes before computing distances
+func BoxAround(p Point, radiusKm float64) Box {
+	dLat := degrees(radiusKm / earthRadiusKm)
+	dLng := 180.0
+	if cos := math.Cos(radians(p.Lat)); cos > 1e-6 {
+		dLng = math.Min(degrees(radiusKm/(earthRadiusKm*cos)), 180)
+	}
+	return Box{
+		MinLat: math.Max(p.Lat-dLat, -90),
+		MaxLat: math.Min(p.Lat+dLat, 90),
+		MinLng: math.Max(p.Lng-dLng, -180),
+		MaxLng: math.Min(p.Lng+dLng, 180),
+	}
+}
+
+// Valid reports whether the box has its corners in order and within range
+func (b Box) Valid() bool {
+	return b.MinLat >= -90 && b.MaxLat <= 90 && b.MinLng >= -180 && b.MaxLng <= 180 &&
+		b.MinLat < b.MaxLat && b.MinLng < b.MaxLng
+}
+
+// ValidPoint reports whether lat/lng are within range
+func ValidPoint(p Point) bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
@@ -0,0 +1,129 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nominatimInterval is the minimum delay between requests: the public
+// OpenStreetMap instance allows one request per second
+const nominatimInterval = time.Second
+
+// Nominatim geocodes street addresses with a Nominatim server (OpenStreetMap)
+type Nominatim struct {
+	baseURL    string
+	userAgent  string
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	lastReq time.Time
+}
+
+// NewNominatim creates a Nominatim geocoder. userAgent must identify the
+// application (usage policy of the public instance).
+func NewNominatim(baseURL, userAgent string) *Nominatim {
+	return &Nominatim{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		userAgent:  userAgent,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type nominatimResult struct {
+	Lat     string `json:"lat"`
+	Lon     string `json:"lon"`
+	AddType string `json:"addresstype"`
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, addr Address) (*Result, error) {
+	addr = addr.Normalized()
+	if addr.City == "" && addr.PostalCode == "" {
+		return nil, ErrNotFound
+	}
+
+	params := url.Values{
+		"format":       {"jsonv2"},
+		"limit":        {"1"},
+		"countrycodes": {strings.ToLower(addr.Country)},
+	}
+	if addr.Street != "" {
+		params.Set("street", addr.Street)
+	}
+	if addr.City != "" {
+		params.Set("city", addr.City)
+	}
+	if addr.PostalCode != "" {
+		params.Set("postalcode", addr.PostalCode)
+	}
+
+	if err := n.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.baseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", n.userAgent)
+	req.Header.Set("Accept-Language", "it")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim: status %d", resp.StatusCode)
+	}
+
+	var results []nominatimResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("nominatim: %w", err)
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+
+	lat, err1 := strconv.ParseFloat(results[0].Lat, 64)
+	lng, err2 := strconv.ParseFloat(results[0].Lon, 64)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("nominatim: invalid coordinates %q, %q", results[0].Lat, results[0].Lon)
+	}
+
+	precision := PrecisionAddress
+	switch results[0].AddType {
+	case "postcode":
+		precision = PrecisionPostalCode
+	case "city", "town", "village", "municipality", "hamlet", "suburb":
+		precision = PrecisionCity
+	}
+	if addr.Street == "" && precision == PrecisionAddress {
+		precision = PrecisionCity
+	}
+
+	return &Result{Point: Point{Lat: lat, Lng: lng}, Precision: precision, Source: "nominatim"}, nil
+}
+
+// wait spaces out the requests by nominatimInterval
+func (n *Nominatim) wait(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if d := nominatimInterval - time.Since(n.lastReq); d > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+	n.lastReq = time.Now()
+	return nil
+}
@@ -0,0 +1,78 @@
+package geo
+
+import (
+	"context"
+	"errors"
+)
+
+// Place is a row of the offline CAP/comune table (geo_places)
+type Place struct {
+	PostalCode string
+	Comune     string
+	Province   string
+	Point      Point
+}
+
+// PlaceLookup reads the offline table; every method returns ErrNotFound when
+// nothing matches. Implemented by repository.GeoRepository.
+type PlaceLookup interface {
+	// ByPostalCode finds a CAP; with comune set, only that comune's row
+	ByPostalCode(ctx context.Context, postalCode, comune string) (*Place, error)
+	// ByComune finds a comune by name (case-insensitive); province may be empty
+	ByComune(ctx context.Context, comune, province string) (*Place, error)
+	// ProvinceCapital finds the capital of a province (sigla)
+	ProvinceCapital(ctx context.Context, province string) (*Place, error)
+}
+
+// Offline geocodes Italian addresses with the CAP/comune table, without network
+// calls. Results are at most CAP-precise: street addresses need a remote geocoder.
+type Offline struct {
+	places PlaceLookup
+}
+
+func NewOffline(places PlaceLookup) *Offline {
+	return &Offline{places: places}
+}
+
+// Geocode tries, in order: CAP and comune together, comune and province, CAP alone,
+// then the province capital
+func (o *Offline) Geocode(ctx context.Context, addr Address) (*Result, error) {
+	addr = addr.Normalized()
+	if addr.Country != "IT" {
+		return nil, ErrNotFound
+	}
+
+	steps := []struct {
+		enabled   bool
+		precision Precision
+		lookup    func() (*Place, error)
+	}{
+		{addr.PostalCode != "" && addr.City != "", PrecisionPostalCode, func() (*Place, error) {
+			return o.places.ByPostalCode(ctx, addr.PostalCode, addr.City)
+		}},
+		{addr.City != "", PrecisionCity, func() (*Place, error) {
+			return o.places.ByComune(ctx, addr.City, addr.Province)
+		}},
+		{addr.PostalCode != "", PrecisionPostalCode, func() (*Place, error) {
+			return o.places.ByPostalCode(ctx, addr.PostalCode, "")
+		}},
+		{addr.Province != "", PrecisionProvince, func() (*Place, error) {
+			return o.places.ProvinceCapital(ctx, addr.Province)
+		}},
+	}
+
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+		place, err := step.lookup()
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Point: place.Point, Precision: step.precision, Source: "offline"}, nil
+	}
+	return nil, ErrNotFound
+}
@@ -7,19 +7,23 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/gecogreen/backend/internal/audit"
 	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/moderation"
 	"github.com/gecogreen/backend/internal/repository"
 )
 
 type AdminHandler struct {
 	userRepo        *repository.UserRepository
 	imageReviewRepo *repository.ImageReviewRepository
+	imageHashRepo   *repository.ImageHashRepository
 }
 
-func NewAdminHandler(userRepo *repository.UserRepository, imageReviewRepo *repository.ImageReviewRepository) *AdminHandler {
+func NewAdminHandler(userRepo *repository.UserRepository, imageReviewRepo *repository.ImageReviewRepository, imageHashRepo *repository.ImageHashRepository) *AdminHandler {
 	return &AdminHandler{
 		userRepo:        userRepo,
 		imageReviewRepo: imageReviewRepo,
+		imageHashRepo:   imageHashRepo,
 	}
 }
 
@@ -81,7 +85,18 @@ func (h *AdminHandler) ApproveReview(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := h.imageReviewRepo.Approve(ctx, reviewID, admin.ID); err != nil {
+	review, err := h.imageReviewRepo.GetByID(ctx, reviewID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Review non trovata"})
+	}
+
+	entry := audit.Log(c, audit.Entry{
+		Action: models.AuditImageApproved, EntityType: "image_review", EntityID: reviewID,
+		Before:   fiber.Map{"status": review.Status},
+		After:    fiber.Map{"status": "APPROVED"},
+		Metadata: map[string]interface{}{"user_id": review.UserID, "image_url": review.ImageURL},
+	})
+	if err := h.imageReviewRepo.Approve(ctx, reviewID, admin.ID, entry); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore approvazione"})
 	}
 
@@ -107,7 +122,18 @@ func (h *AdminHandler) RejectReview(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := h.imageReviewRepo.Reject(ctx, reviewID, admin.ID, req.Reason); err != nil {
+	review, err := h.imageReviewRepo.GetByID(ctx, reviewID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Review non trovata"})
+	}
+
+	entry := audit.Log(c, audit.Entry{
+		Action: models.AuditImageRejected, EntityType: "image_review", EntityID: reviewID,
+		Before:   fiber.Map{"status": review.Status},
+		After:    fiber.Map{"status": "REJECTED"},
+		Metadata: map[string]interface{}{"user_id": review.UserID, "image_url": review.ImageURL, "reason": req.Reason},
+	})
+	if err := h.imageReviewRepo.Reject(ctx, reviewID, admin.ID, req.Reason, entry); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore rifiuto"})
 	}
 
@@ -137,3 +163,158 @@ func (h *AdminHandler) GetReviewDetail(c *fiber.Ctx) error {
 		"user":   user,
 	})
 }
+
+// GetDuplicateClusters lists groups of matching images uploaded by different users
+// GET /api/v1/admin/images/duplicates?max_distance=10&limit=50
+func (h *AdminHandler) GetDuplicateClusters(c *fiber.Ctx) error {
+	maxDistance := c.QueryInt("max_distance", moderation.DuplicateThreshold)
+	limit := c.QueryInt("limit", 50)
+
+	if maxDistance < 0 || maxDistance > 20 {
+		maxDistance = moderation.DuplicateThreshold
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 15*time.Second)
+	defer cancel()
+
+	clusters, err := h.imageHashRepo.GetDuplicateClusters(ctx, maxDistance, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore caricamento duplicati"})
+	}
+
+	return c.JSON(fiber.Map{
+		"clusters":     clusters,
+		"total":        len(clusters),
+		"max_distance": maxDistance,
+	})
+}
+
+// ListStaff returns the users with a staff role
+// GET /api/v1/admin/staff
+func (h *AdminHandler) ListStaff(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	staff, err := h.userRepo.ListStaff(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore caricamento"})
+	}
+
+	return c.JSON(fiber.Map{"staff": staff})
+}
+
+// SetUserRoles replaces the staff roles of a user (ADMIN, MODERATOR, SUPPORT)
+// PUT /api/v1/admin/users/:id/roles
+func (h *AdminHandler) SetUserRoles(c *fiber.Ctx) error {
+	admin := c.Locals("user").(*models.User)
+
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	var req models.SetRolesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+	for _, role := range req.Roles {
+		if !models.IsStaffRole(role) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Ruolo non valido: " + string(role)})
+		}
+	}
+
+	// An admin can't lock themselves out
+	if userID == admin.ID {
+		keepsAdmin := false
+		for _, role := range req.Roles {
+			keepsAdmin = keepsAdmin || role == models.RoleAdmin
+		}
+		if !keepsAdmin {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Non puoi rimuovere il tuo ruolo di amministratore"})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	target, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Utente non trovato"})
+	}
+
+	roles, err := h.userRepo.SetStaffRoles(ctx, userID, req.Roles, func(roles []models.Role) []*models.AuditLog {
+		return []*models.AuditLog{audit.Log(c, audit.Entry{
+			Action: models.AuditUserRolesChanged, EntityType: "user", EntityID: userID,
+			Before: fiber.Map{"roles": target.Roles}, After: fiber.Map{"roles": roles},
+		})}
+	})
+	if err != nil {
+		if err == repository.ErrUserNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Utente non trovato"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nell'aggiornamento"})
+	}
+
+	return c.JSON(fiber.Map{
+		"roles":       roles,
+		"permissions": models.PermissionsFor(roles),
+	})
+}
+
+// SetUserStatus bans, suspends or reactivates an account.
+// Banned and suspended users are logged out of every device.
+// PUT /api/v1/admin/users/:id/status
+func (h *AdminHandler) SetUserStatus(c *fiber.Ctx) error {
+	admin := c.Locals("user").(*models.User)
+
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+	if userID == admin.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Non puoi modificare lo stato del tuo account"})
+	}
+
+	var req models.SetUserStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	var action string
+	switch req.Status {
+	case models.UserStatusBanned:
+		action = models.AuditUserBanned
+	case models.UserStatusSuspended:
+		action = models.AuditUserSuspended
+	case models.UserStatusActive:
+		action = models.AuditUserReactivated
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Stato non valido"})
+	}
+	if req.Status != models.UserStatusActive && req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Motivazione obbligatoria"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	target, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Utente non trovato"})
+	}
+
+	entry := audit.Log(c, audit.Entry{
+		Action: action, EntityType: "user", EntityID: userID,
+		Before:   fiber.Map{"status": target.Status},
+		After:    fiber.Map{"status": req.Status},
+		Metadata: map[string]interface{}{"reason": req.Reason},
+	})
+	if err := h.userRepo.SetStatus(ctx, userID, req.Status, entry); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nell'aggiornamento"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "status": req.Status})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// AuditHandler lets admins explore the audit log
+type AuditHandler struct {
+	auditRepo *repository.AuditRepository
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditRepo *repository.AuditRepository) *AuditHandler {
+	return &AuditHandler{auditRepo: auditRepo}
+}
+
+// Search returns audit records, newest first.
+// Filters: action, entity_type, entity_id, user_id (actor), from, to (RFC 3339 or YYYY-MM-DD), q (free text)
+// GET /api/v1/admin/audit
+func (h *AuditHandler) Search(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	perPage := c.QueryInt("per_page", 50)
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 200 {
+		perPage = 50
+	}
+
+	filter := models.AuditFilter{
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		Query:      c.Query("q"),
+		Limit:      perPage,
+		Offset:     (page - 1) * perPage,
+	}
+
+	for param, dst := range map[string]**uuid.UUID{"entity_id": &filter.EntityID, "user_id": &filter.UserID} {
+		if v := c.Query(param); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido: " + param})
+			}
+			*dst = &id
+		}
+	}
+
+	for param, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(param); v != "" {
+			t, err := parseAuditTime(v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Data non valida: " + param})
+			}
+			*dst = &t
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	logs, total, err := h.auditRepo.Search(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore caricamento"})
+	}
+
+	return c.JSON(fiber.Map{
+		"logs":        logs,
+		"total":       total,
+		"page":        page,
+		"per_page":    perPage,
+		"total_pages": (total + perPage - 1) / perPage,
+	})
+}
+
+// Verify recomputes the hash chain and reports the first tampered record, if any
+// GET /api/v1/admin/audit/verify
+func (h *AuditHandler) Verify(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 60*time.Second)
+	defer cancel()
+
+	result, err := h.auditRepo.Verify(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore verifica"})
+	}
+
+	return c.JSON(result)
+}
+
+// parseAuditTime accepts a full timestamp or a date (midnight UTC)
+func parseAuditTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -2,23 +2,40 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 
 	"github.com/gecogreen/backend/internal/auth"
 	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/ratelimit"
 	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/services"
 )
 
 type AuthHandler struct {
-	userRepo   *repository.UserRepository
-	jwtManager *auth.JWTManager
+	userRepo     *repository.UserRepository
+	sessionRepo  *repository.SessionRepository
+	jwtManager   *auth.JWTManager
+	emailService *services.EmailService
+	twoFactor    *services.TwoFactorService
+	lockout      *ratelimit.Lockout
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository, jwtManager *auth.JWTManager) *AuthHandler {
-	return &AuthHandler{userRepo: userRepo, jwtManager: jwtManager}
+// Email token lifetimes and resend cooldown
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+	emailResendCooldown  = time.Minute
+)
+
+func NewAuthHandler(userRepo *repository.UserRepository, sessionRepo *repository.SessionRepository, jwtManager *auth.JWTManager, emailService *services.EmailService, twoFactor *services.TwoFactorService) *AuthHandler {
+	return &AuthHandler{userRepo: userRepo, sessionRepo: sessionRepo, jwtManager: jwtManager, emailService: emailService, twoFactor: twoFactor}
 }
 
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
@@ -120,13 +137,18 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		_ = h.userRepo.CreateLocation(ctx, loc)
 	}
 
+	// Don't fail registration if the email can't be sent: the user can ask to resend
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		fmt.Printf("⚠️ Verification email for %s not sent: %v\n", user.ID, err)
+	}
+
 	// Generate tokens
-	accessToken, _ := h.jwtManager.GenerateAccessToken(user.ID, user.Email, string(user.AccountType))
-	refreshToken, _ := h.jwtManager.GenerateRefreshToken(user.ID, user.Email, string(user.AccountType))
+	resp, err := h.startSession(ctx, c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
 
-	return c.Status(fiber.StatusCreated).JSON(models.AuthResponse{
-		User: *user, AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: h.jwtManager.GetAccessTokenExpiry(),
-	})
+	return c.Status(fiber.StatusCreated).JSON(resp)
 }
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
@@ -140,8 +162,17 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
+	if h.lockout != nil {
+		if wait, err := h.lockout.Locked(ctx, req.Email); err == nil && wait > 0 {
+			minutes := int(math.Ceil(wait.Minutes()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": fmt.Sprintf("Troppi tentativi falliti. Riprova tra %d minuti", minutes)})
+		}
+	}
+
 	user, err := h.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
+		h.loginFailed(ctx, req.Email)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Email o password non corretti"})
 	}
 
@@ -150,54 +181,421 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	if !auth.CheckPassword(req.Password, user.PasswordHash) {
+		h.loginFailed(ctx, req.Email)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Email o password non corretti"})
 	}
 
-	_ = h.userRepo.UpdateLastLogin(ctx, user.ID)
+	// With 2FA, failures are kept until the code is verified,
+	// so wrong codes count towards the lockout
+	if h.lockout != nil && !user.TOTPEnabled {
+		_ = h.lockout.Reset(ctx, req.Email)
+	}
 
-	accessToken, _ := h.jwtManager.GenerateAccessToken(user.ID, user.Email, string(user.AccountType))
-	refreshToken, _ := h.jwtManager.GenerateRefreshToken(user.ID, user.Email, string(user.AccountType))
+	resp, err := h.completeLogin(ctx, c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
 
-	return c.JSON(models.AuthResponse{
-		User: *user, AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: h.jwtManager.GetAccessTokenExpiry(),
-	})
+	return c.JSON(resp)
 }
 
-func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
-	var req models.RefreshRequest
-	if err := c.BodyParser(&req); err != nil {
+// VerifyTwoFactor completes a 2FA login with a TOTP or recovery code
+// POST /api/v1/auth/2fa/verify
+func (h *AuthHandler) VerifyTwoFactor(c *fiber.Ctx) error {
+	var req models.TwoFactorLoginRequest
+	if err := c.BodyParser(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
 	}
 
-	claims, err := h.jwtManager.ValidateToken(req.RefreshToken)
+	claims, err := h.jwtManager.ValidateToken(req.ChallengeToken)
+	if err != nil || claims.TokenType != auth.TwoFactorChallenge {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Sessione di accesso scaduta, effettua di nuovo il login"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if h.lockout != nil {
+		if wait, err := h.lockout.Locked(ctx, claims.Email); err == nil && wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": fmt.Sprintf("Troppi tentativi falliti. Riprova tra %d minuti", int(math.Ceil(wait.Minutes())))})
+		}
+	}
+
+	user, err := h.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Utente non trovato"})
+	}
+
+	if !user.IsActive() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account non attivo"})
+	}
+
+	usedRecovery, err := h.twoFactor.Verify(ctx, user.ID, req.Code)
+	if err != nil {
+		if err == services.ErrInvalidTwoFactorCode {
+			h.loginFailed(ctx, user.Email)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Codice non valido"})
+		}
+		if err == services.ErrTwoFactorNotEnabled {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Sessione di accesso scaduta, effettua di nuovo il login"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	if usedRecovery {
+		fmt.Printf("⚠️ User %s logged in with a recovery code\n", user.ID)
+	}
+
+	if h.lockout != nil {
+		_ = h.lockout.Reset(ctx, user.Email)
+	}
+	_ = h.userRepo.UpdateLastLogin(ctx, user.ID)
+
+	resp, err := h.startSession(ctx, c, user)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token non valido"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
 	}
 
-	if claims.TokenType != auth.RefreshToken {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token type non valido"})
+	return c.JSON(resp)
+}
+
+// Refresh rotates the refresh token: the presented one is revoked and a new pair issued.
+// Reusing a rotated-out token revokes every token of that login.
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
 	}
 
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
-	user, err := h.userRepo.GetByID(ctx, claims.UserID)
+	refreshToken, hash, err := auth.GenerateToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	session := &models.Session{
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.jwtManager.GetRefreshTokenExpiry()),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IPAddress: c.IP(),
+	}
+	err = h.sessionRepo.Rotate(ctx, auth.HashToken(req.RefreshToken), session)
+	if err != nil {
+		switch err {
+		case repository.ErrSessionReused:
+			fmt.Printf("⚠️ Refresh token reuse detected, session revoked\n")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Sessione revocata per sicurezza, effettua di nuovo l'accesso"})
+		case repository.ErrSessionNotFound:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token non valido"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	user, err := h.userRepo.GetByID(ctx, session.UserID)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Utente non trovato"})
 	}
 
 	if !user.IsActive() {
+		_ = h.sessionRepo.RevokeFamily(ctx, user.ID, session.FamilyID)
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account non attivo"})
 	}
 
-	accessToken, _ := h.jwtManager.GenerateAccessToken(user.ID, user.Email, string(user.AccountType))
-	refreshToken, _ := h.jwtManager.GenerateRefreshToken(user.ID, user.Email, string(user.AccountType))
+	accessToken, err := h.jwtManager.GenerateAccessToken(user.ID, session.FamilyID, user.Email, string(user.AccountType))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
 
 	return c.JSON(models.AuthResponse{
 		User: *user, AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: h.jwtManager.GetAccessTokenExpiry(),
 	})
 }
 
+// Logout revokes the current session.
+// Access tokens already issued stay valid until they expire (15 minutes).
+// POST /api/v1/auth/logout
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	sessionID := c.Locals("sessionID").(uuid.UUID)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.sessionRepo.RevokeFamily(ctx, user.ID, sessionID); err != nil && err != repository.ErrSessionNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// LogoutAll revokes every session of the user, on all devices
+// POST /api/v1/auth/logout-all
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.sessionRepo.RevokeAll(ctx, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// ListSessions lists the devices the user is logged in on
+// GET /api/v1/auth/sessions
+func (h *AuthHandler) ListSessions(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	sessionID := c.Locals("sessionID").(uuid.UUID)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	devices, err := h.sessionRepo.ListActive(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	for i := range devices {
+		devices[i].Current = devices[i].ID == sessionID
+	}
+
+	return c.JSON(fiber.Map{"sessions": devices})
+}
+
+// RevokeSession logs out a single device
+// DELETE /api/v1/auth/sessions/:id
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.sessionRepo.RevokeFamily(ctx, user.ID, id); err != nil {
+		if err == repository.ErrSessionNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sessione non trovata"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// SetLockout enables progressive lockout after failed logins
+func (h *AuthHandler) SetLockout(lockout *ratelimit.Lockout) {
+	h.lockout = lockout
+}
+
+// VerifyEmail confirms the email address with the emailed token
+// POST /api/v1/auth/verify-email
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req models.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.userRepo.VerifyEmail(ctx, auth.HashToken(req.Token)); err != nil {
+		if err == repository.ErrInvalidEmailToken {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Link non valido o scaduto"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Email verificata"})
+}
+
+// ResendVerification sends a new verification email (at most once a minute)
+// POST /api/v1/auth/resend-verification
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	if user.EmailVerified {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email già verificata"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		if err == repository.ErrEmailSentRecently {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Attendi un minuto prima di richiedere un nuovo invio"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Email di verifica inviata"})
+}
+
+// ForgotPassword emails a password reset link.
+// Always answers the same way, so it can't be used to probe registered emails.
+// POST /api/v1/auth/forgot-password
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req models.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	response := fiber.Map{"success": true, "message": "Se l'email è registrata riceverai un link per reimpostare la password"}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil || !user.IsActive() {
+		return c.JSON(response)
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	err = h.userRepo.SetPasswordResetToken(ctx, user.ID, hash, time.Now().Add(passwordResetTTL), emailResendCooldown)
+	if err != nil {
+		if err != repository.ErrEmailSentRecently {
+			fmt.Printf("⚠️ Password reset token for %s not saved: %v\n", user.ID, err)
+		}
+		return c.JSON(response)
+	}
+
+	go func() {
+		if err := h.emailService.SendPasswordReset(user.Email, user.FirstName, token); err != nil {
+			fmt.Printf("Error sending password reset email: %v\n", err)
+		}
+	}()
+
+	return c.JSON(response)
+}
+
+// ResetPassword sets a new password with the single-use token and logs out every device
+// POST /api/v1/auth/reset-password
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req models.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	if !auth.ValidatePassword(req.Password) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password deve essere almeno 8 caratteri"})
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, err := h.userRepo.ResetPassword(ctx, auth.HashToken(req.Token), hashedPassword)
+	if err != nil {
+		if err == repository.ErrInvalidEmailToken {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Link non valido o scaduto"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	// Whoever knew the old password must not stay logged in
+	if _, err := h.sessionRepo.RevokeAll(ctx, userID); err != nil {
+		fmt.Printf("⚠️ Failed to revoke sessions after password reset for %s: %v\n", userID, err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Password aggiornata. Accedi con la nuova password."})
+}
+
+// sendVerificationEmail issues a new verification token and emails it in the background
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	if err := h.userRepo.SetEmailVerificationToken(ctx, user.ID, hash, time.Now().Add(emailVerificationTTL), emailResendCooldown); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := h.emailService.SendEmailVerification(user.Email, user.FirstName, token); err != nil {
+			fmt.Printf("Error sending verification email: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// loginFailed counts a failed login towards the account lockout
+func (h *AuthHandler) loginFailed(ctx context.Context, email string) {
+	if h.lockout == nil {
+		return
+	}
+	lock, err := h.lockout.Fail(ctx, email)
+	if err != nil {
+		fmt.Printf("⚠️ Login lockout unavailable: %v\n", err)
+		return
+	}
+	if lock > 0 {
+		fmt.Printf("⚠️ Login locked for %s after repeated failures\n", lock)
+	}
+}
+
+// completeLogin finishes a login whose first factor was verified (password or OIDC):
+// with 2FA it returns a challenge (tokens are issued by VerifyTwoFactor), otherwise a new session
+func (h *AuthHandler) completeLogin(ctx context.Context, c *fiber.Ctx, user *models.User) (interface{}, error) {
+	if user.TOTPEnabled {
+		challenge, err := h.jwtManager.GenerateChallengeToken(user.ID, user.Email)
+		if err != nil {
+			return nil, err
+		}
+		return &models.TwoFactorChallengeResponse{
+			TwoFactorRequired: true, ChallengeToken: challenge, ExpiresIn: h.jwtManager.GetChallengeExpiry(),
+		}, nil
+	}
+
+	_ = h.userRepo.UpdateLastLogin(ctx, user.ID)
+	return h.startSession(ctx, c, user)
+}
+
+// startSession opens a new server-side session and issues its token pair
+func (h *AuthHandler) startSession(ctx context.Context, c *fiber.Ctx, user *models.User) (*models.AuthResponse, error) {
+	refreshToken, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.jwtManager.GetRefreshTokenExpiry()),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IPAddress: c.IP(),
+	}
+	if err := h.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := h.jwtManager.GenerateAccessToken(user.ID, session.FamilyID, user.Email, string(user.AccountType))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		User: *user, AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: h.jwtManager.GetAccessTokenExpiry(),
+	}, nil
+}
+
 func (h *AuthHandler) Me(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
 	return c.JSON(user)
@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/gecogreen/backend/internal/audit"
 	"github.com/gecogreen/backend/internal/models"
 	"github.com/gecogreen/backend/internal/repository"
 )
@@ -57,3 +62,269 @@ func (h *CategoryHandler) GetByID(c *fiber.Ctx) error {
 
 	return c.JSON(category)
 }
+
+// Tree returns the active categories with their subcategories nested and the
+// number of active products in each subtree
+// GET /api/v1/categories/tree
+func (h *CategoryHandler) Tree(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	tree, err := h.categoryRepo.Tree(ctx, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore recupero categorie"})
+	}
+	return c.JSON(tree)
+}
+
+// AdminTree returns the whole category tree, inactive categories included
+// GET /api/v1/admin/categories
+func (h *CategoryHandler) AdminTree(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	tree, err := h.categoryRepo.Tree(ctx, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore recupero categorie"})
+	}
+	return c.JSON(tree)
+}
+
+// AdminCreate adds a category at the end of its siblings
+// POST /api/v1/admin/categories
+func (h *CategoryHandler) AdminCreate(c *fiber.Ctx) error {
+	var req models.CreateCategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	category := &models.Category{
+		Name:        strings.TrimSpace(req.Name),
+		Slug:        strings.TrimSpace(req.Slug),
+		Description: strings.TrimSpace(req.Description),
+		Icon:        strings.TrimSpace(req.Icon),
+		ParentID:    req.ParentID,
+	}
+	if msg := validateCategory(category); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.categoryRepo.Create(ctx, category); err != nil {
+		return categoryError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditCategoryCreated, EntityType: "category", EntityID: category.ID, After: category})
+
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+// AdminUpdate edits the name, slug, description, icon or active flag of a category
+// PUT /api/v1/admin/categories/:id
+func (h *CategoryHandler) AdminUpdate(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	var req models.UpdateCategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	before, err := h.categoryRepo.GetByID(ctx, id)
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	category := *before
+	if req.Name != nil {
+		category.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Slug != nil {
+		category.Slug = strings.TrimSpace(*req.Slug)
+	}
+	if req.Description != nil {
+		category.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Icon != nil {
+		category.Icon = strings.TrimSpace(*req.Icon)
+	}
+	if req.IsActive != nil {
+		category.IsActive = *req.IsActive
+	}
+	if category.Slug == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Slug obbligatorio"})
+	}
+	if msg := validateCategory(&category); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.categoryRepo.Update(ctx, &category); err != nil {
+		return categoryError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditCategoryUpdated, EntityType: "category", EntityID: id, Before: before, After: category})
+
+	return c.JSON(category)
+}
+
+// AdminMove moves a category, with its subcategories, under another parent
+// (at the end of its children) or to the root level
+// PUT /api/v1/admin/categories/:id/parent
+func (h *CategoryHandler) AdminMove(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	var req models.MoveCategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	before, err := h.categoryRepo.GetByID(ctx, id)
+	if err != nil {
+		return categoryError(c, err)
+	}
+	if err := h.categoryRepo.Move(ctx, id, req.ParentID); err != nil {
+		return categoryError(c, err)
+	}
+	category, err := h.categoryRepo.GetByID(ctx, id)
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{
+		Action: models.AuditCategoryMoved, EntityType: "category", EntityID: id,
+		Before: fiber.Map{"parent_id": before.ParentID, "sort_order": before.SortOrder},
+		After:  fiber.Map{"parent_id": category.ParentID, "sort_order": category.SortOrder},
+	})
+
+	return c.JSON(category)
+}
+
+// AdminReorder sets the order of all the children of a parent (null for the roots)
+// PUT /api/v1/admin/categories/order
+func (h *CategoryHandler) AdminReorder(c *fiber.Ctx) error {
+	var req models.ReorderCategoriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.categoryRepo.Reorder(ctx, req.ParentID, req.IDs); err != nil {
+		return categoryError(c, err)
+	}
+
+	entry := audit.Entry{Action: models.AuditCategoriesReordered, EntityType: "category", After: req}
+	if req.ParentID != nil {
+		entry.EntityID = *req.ParentID
+	}
+	audit.Record(c, entry)
+
+	return c.JSON(fiber.Map{"message": "Ordine aggiornato"})
+}
+
+// AdminMerge moves the products and subcategories of a category into another
+// one, then deletes it
+// POST /api/v1/admin/categories/:id/merge
+func (h *CategoryHandler) AdminMerge(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	var req models.MergeCategoriesRequest
+	if err := c.BodyParser(&req); err != nil || req.TargetID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Categoria di destinazione obbligatoria"})
+	}
+	if req.TargetID == id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Una categoria non può essere unita a se stessa"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 30*time.Second)
+	defer cancel()
+
+	source, err := h.categoryRepo.GetByID(ctx, id)
+	if err != nil {
+		return categoryError(c, err)
+	}
+	result, err := h.categoryRepo.Merge(ctx, id, req.TargetID)
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditCategoriesMerged, EntityType: "category", EntityID: id, Before: source, After: result})
+
+	return c.JSON(result)
+}
+
+// AdminDelete deletes a category without products or subcategories
+// DELETE /api/v1/admin/categories/:id
+func (h *CategoryHandler) AdminDelete(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	before, err := h.categoryRepo.GetByID(ctx, id)
+	if err != nil {
+		return categoryError(c, err)
+	}
+	if err := h.categoryRepo.Delete(ctx, id); err != nil {
+		return categoryError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditCategoryDeleted, EntityType: "category", EntityID: id, Before: before})
+
+	return c.JSON(fiber.Map{"message": "Categoria eliminata"})
+}
+
+// validateCategory checks the editable fields, returning the error message or ""
+func validateCategory(category *models.Category) string {
+	if category.Name == "" || len(category.Name) > 100 {
+		return "Nome obbligatorio (massimo 100 caratteri)"
+	}
+	if category.Slug != "" && !categorySlugRe.MatchString(category.Slug) {
+		return "Slug non valido: solo lettere minuscole, numeri e trattini"
+	}
+	if len(category.Icon) > 50 {
+		return "Icona troppo lunga (massimo 50 caratteri)"
+	}
+	return ""
+}
+
+var categorySlugRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// categoryError maps the category tree errors to responses
+func categoryError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrCategoryNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Categoria non trovata"})
+	case errors.Is(err, repository.ErrCategorySlugTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Slug già in uso"})
+	case errors.Is(err, repository.ErrCategoryCycle):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Una categoria non può finire sotto una sua sottocategoria"})
+	case errors.Is(err, repository.ErrCategoryTooDeep):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Le categorie possono avere al massimo %d livelli", models.MaxCategoryDepth)})
+	case errors.Is(err, repository.ErrCategoryNotEmpty):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "La categoria contiene prodotti o sottocategorie: uniscila a un'altra"})
+	case errors.Is(err, repository.ErrCategoryOrderMismatch):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "L'elenco deve contenere tutte le sottocategorie, una volta sola"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore aggiornamento categorie"})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/gecogreen/backend/internal/storage"
+)
+
+// FileHandler serves files for the local disk storage backend
+type FileHandler struct {
+	store *storage.LocalStorage
+}
+
+// NewFileHandler creates a new file handler
+func NewFileHandler(store *storage.LocalStorage) *FileHandler {
+	return &FileHandler{store: store}
+}
+
+// ServePrivate handles GET /files/private/*?expires=&signature=
+func (h *FileHandler) ServePrivate(c *fiber.Ctx) error {
+	key := c.Params("*")
+	expires := int64(c.QueryInt("expires", 0))
+
+	if !h.store.VerifySignature("GET", key, expires, c.Query("signature")) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Link scaduto o non valido"})
+	}
+
+	file, err := h.store.OpenPrivate(key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File non trovato"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore lettura file"})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore lettura file"})
+	}
+
+	if contentType := mime.TypeByExtension(filepath.Ext(key)); contentType != "" {
+		c.Set(fiber.HeaderContentType, contentType)
+	}
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Send(data)
+}
+
+// ReceiveUpload handles PUT /files/upload/*?expires=&signature=
+// Target of the presigned URLs generated by LocalStorage.Presign
+func (h *FileHandler) ReceiveUpload(c *fiber.Ctx) error {
+	key := c.Params("*")
+	expires := int64(c.QueryInt("expires", 0))
+
+	if !h.store.VerifySignature("PUT", key, expires, c.Query("signature")) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Link scaduto o non valido"})
+	}
+
+	if len(c.Body()) > storage.MaxFileSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "File troppo grande. Massimo 5MB"})
+	}
+
+	if err := h.store.SavePublic(key, bytes.NewReader(c.Body())); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel caricamento"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
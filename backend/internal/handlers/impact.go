@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/audit"
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// defaultImpactFactor is the :category_id of the platform default factor
+const defaultImpactFactor = "default"
+
+type ImpactHandler struct {
+	impactRepo *repository.ImpactRepository
+}
+
+func NewImpactHandler(impactRepo *repository.ImpactRepository) *ImpactHandler {
+	return &ImpactHandler{
+		impactRepo: impactRepo,
+	}
+}
+
+// List returns the platform default and every category with the factor it uses
+// GET /api/v1/admin/impact-factors
+func (h *ImpactHandler) List(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	factors, err := h.impactRepo.ListCurrent(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore recupero fattori di impatto"})
+	}
+
+	return c.JSON(fiber.Map{"factors": factors})
+}
+
+// History returns every version of a category's own factor
+// GET /api/v1/admin/impact-factors/:category_id/history
+func (h *ImpactHandler) History(c *fiber.Ctx) error {
+	categoryID, ok := parseImpactCategory(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID categoria non valido"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	factors, err := h.impactRepo.History(ctx, categoryID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore recupero storico"})
+	}
+
+	return c.JSON(fiber.Map{"versions": factors})
+}
+
+// Set saves a new version of a category's factor (or of the platform default).
+// Orders already placed keep the version they were computed with.
+// PUT /api/v1/admin/impact-factors/:category_id
+func (h *ImpactHandler) Set(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	categoryID, ok := parseImpactCategory(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID categoria non valido"})
+	}
+
+	var req models.SetImpactFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	factor := &models.ImpactFactor{
+		CategoryID:  categoryID,
+		CO2Kg:       req.CO2Kg,
+		WaterL:      req.WaterL,
+		WasteKg:     req.WasteKg,
+		ReferenceKg: 1,
+		Note:        strings.TrimSpace(req.Note),
+		CreatedBy:   &user.ID,
+	}
+	if req.ReferenceKg != nil {
+		factor.ReferenceKg = *req.ReferenceKg
+	}
+	if factor.CO2Kg < 0 || factor.WaterL < 0 || factor.WasteKg < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "I valori di impatto non possono essere negativi"})
+	}
+	if factor.ReferenceKg <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Il peso di riferimento deve essere maggiore di zero"})
+	}
+	if len(factor.Note) > 500 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nota troppo lunga (max 500 caratteri)"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.impactRepo.SetFactor(ctx, factor); err != nil {
+		if errors.Is(err, repository.ErrCategoryNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Categoria non trovata"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore salvataggio fattore di impatto"})
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditImpactFactorSet, EntityType: "impact_factor", EntityID: factor.ID, After: factor})
+
+	return c.JSON(factor)
+}
+
+// Clear removes a category's own factor, so it inherits its parent's (or the
+// platform default) again
+// DELETE /api/v1/admin/impact-factors/:category_id
+func (h *ImpactHandler) Clear(c *fiber.Ctx) error {
+	categoryID, ok := parseImpactCategory(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID categoria non valido"})
+	}
+	if categoryID == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Il fattore predefinito non può essere rimosso"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.impactRepo.ClearFactor(ctx, *categoryID); err != nil {
+		if errors.Is(err, repository.ErrImpactFactorNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "La categoria non ha un fattore proprio"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore rimozione fattore di impatto"})
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditImpactFactorCleared, EntityType: "category", EntityID: *categoryID})
+
+	return c.JSON(fiber.Map{"message": "Fattore rimosso, la categoria usa quello ereditato"})
+}
+
+// parseImpactCategory reads :category_id, which is nil for the platform default
+func parseImpactCategory(c *fiber.Ctx) (*uuid.UUID, bool) {
+	param := c.Params("category_id")
+	if param == defaultImpactFactor {
+		return nil, true
+	}
+	id, err := uuid.Parse(param)
+	if err != nil {
+		return nil, false
+	}
+	return &id, true
+}
+
+// CreditDrift returns the users whose EcoCredits balance differs from the
+// ledger, as found by the last reconciliation run
+// GET /api/v1/admin/eco-credits/drift
+func (h *ImpactHandler) CreditDrift(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	drift, err := h.impactRepo.ListCreditDrift(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore recupero riconciliazione"})
+	}
+
+	return c.JSON(fiber.Map{"drift": drift})
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/gecogreen/backend/internal/audit"
 	"github.com/gecogreen/backend/internal/models"
 	"github.com/gecogreen/backend/internal/repository"
 )
@@ -14,15 +16,26 @@ import (
 type LeaderboardHandler struct {
 	leaderboardRepo *repository.LeaderboardRepository
 	userRepo        *repository.UserRepository
+	rewardRepo      *repository.RewardRepository
+	impactRepo      *repository.ImpactRepository
+	creditsLifetime time.Duration
 }
 
-func NewLeaderboardHandler(leaderboardRepo *repository.LeaderboardRepository, userRepo *repository.UserRepository) *LeaderboardHandler {
+func NewLeaderboardHandler(leaderboardRepo *repository.LeaderboardRepository, userRepo *repository.UserRepository, rewardRepo *repository.RewardRepository) *LeaderboardHandler {
 	return &LeaderboardHandler{
 		leaderboardRepo: leaderboardRepo,
 		userRepo:        userRepo,
+		rewardRepo:      rewardRepo,
 	}
 }
 
+// SetCreditExpiry enables the upcoming expirations endpoint; credits expire
+// lifetime after being earned (0 = never)
+func (h *LeaderboardHandler) SetCreditExpiry(impactRepo *repository.ImpactRepository, lifetime time.Duration) {
+	h.impactRepo = impactRepo
+	h.creditsLifetime = lifetime
+}
+
 // GetLeaderboard returns the leaderboard for a given period
 // GET /api/leaderboard?period=WEEKLY|MONTHLY|YEARLY|ALLTIME
 func (h *LeaderboardHandler) GetLeaderboard(c *fiber.Ctx) error {
@@ -167,66 +180,135 @@ func (h *LeaderboardHandler) GetMyImpactHistory(c *fiber.Ctx) error {
 	})
 }
 
-// RedeemReward allows users to redeem eco-credits for rewards
-// POST /api/leaderboard/redeem
-func (h *LeaderboardHandler) RedeemReward(c *fiber.Ctx) error {
+// GetMyCreditExpirations returns when the current user's EcoCredits expire,
+// by day. Spending uses the credits that expire first.
+// GET /api/leaderboard/my-credits/expiring
+func (h *LeaderboardHandler) GetMyCreditExpirations(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
 
-	var req models.RedeemRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	// The balance is read now, not taken from the user loaded by the auth middleware
+	if h.impactRepo == nil || h.creditsLifetime <= 0 {
+		current, err := h.userRepo.GetByID(ctx, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero scadenze"})
+		}
+		return c.JSON(fiber.Map{
+			"expirations": []models.CreditExpiration{},
+			"eco_credits": current.EcoCredits,
+		})
 	}
 
-	// Define reward costs
-	rewardCosts := map[string]int{
-		"BOOST_24H":    100,
-		"BOOST_7D":     500,
-		"TOP_CATEGORY": 200,
-		"TREE":         300,
-		"BADGE":        150,
+	balance, expirations, err := h.impactRepo.CreditExpirations(ctx, user.ID, h.creditsLifetime)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero scadenze"})
 	}
 
-	cost, valid := rewardCosts[req.RewardType]
-	if !valid {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tipo premio non valido"})
+	return c.JSON(fiber.Map{
+		"expirations":   expirations,
+		"eco_credits":   balance,
+		"lifetime_days": int(h.creditsLifetime.Hours() / 24),
+	})
+}
+
+// ListRewards returns the active reward catalogue
+// GET /api/leaderboard/rewards
+func (h *LeaderboardHandler) ListRewards(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	rewards, err := h.rewardRepo.List(ctx, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero premi"})
 	}
 
-	// Check if user has enough credits
-	if user.EcoCredits < cost {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":           "EcoCredits insufficienti",
-			"required":        cost,
-			"current_balance": user.EcoCredits,
-		})
+	return c.JSON(fiber.Map{"rewards": rewards})
+}
+
+// GetMyRewards returns the rewards redeemed by the current user
+// GET /api/leaderboard/my-rewards
+func (h *LeaderboardHandler) GetMyRewards(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	rewards, err := h.rewardRepo.ListRedeemed(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero premi"})
+	}
+
+	return c.JSON(fiber.Map{"rewards": rewards})
+}
+
+// RedeemReward allows users to redeem eco-credits for a reward of the
+// catalogue, chosen by reward_id or by code (reward_type)
+// POST /api/leaderboard/redeem
+func (h *LeaderboardHandler) RedeemReward(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req models.RedeemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
 	}
 
 	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
 	defer cancel()
 
-	// Create impact log for redemption
-	impactLog := &models.ImpactLog{
-		UserID:          user.ID,
-		ActionType:      getRedeemActionType(req.RewardType),
-		EcoCreditsSpent: cost,
-		Description:     "Riscatto: " + req.RewardType,
+	var reward *models.EcoReward
+	var err error
+	switch {
+	case req.RewardID != nil:
+		reward, err = h.rewardRepo.GetByID(ctx, *req.RewardID)
+	case req.RewardType != "":
+		reward, err = h.rewardRepo.GetByCode(ctx, req.RewardType)
+	default:
+		err = repository.ErrRewardNotFound
+	}
+	if errors.Is(err, repository.ErrRewardNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tipo premio non valido"})
 	}
-
-	err := h.leaderboardRepo.AddImpactLog(ctx, impactLog)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel riscatto"})
 	}
 
-	response := models.RedeemResponse{
-		Success:      true,
-		Message:      getRedeemMessage(req.RewardType),
-		CreditsSpent: cost,
-		NewBalance:   impactLog.EcoCreditsBalance,
+	// The balance is checked by the ledger, not against user.EcoCredits
+	// (read at the start of the request)
+	redeemed, balance, err := h.rewardRepo.Redeem(ctx, user.ID, reward.ID, req.ProductID)
+	switch {
+	case errors.Is(err, repository.ErrInsufficientCredits):
+		balance := user.EcoCredits
+		if current, err := h.userRepo.GetByID(ctx, user.ID); err == nil {
+			balance = current.EcoCredits
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":           "EcoCredits insufficienti",
+			"required":        reward.Cost,
+			"current_balance": balance,
+		})
+	case errors.Is(err, repository.ErrRewardNotFound), errors.Is(err, repository.ErrRewardUnavailable):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Premio non disponibile"})
+	case errors.Is(err, repository.ErrRewardOutOfStock):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Premio esaurito"})
+	case errors.Is(err, repository.ErrRewardProductRequired):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Seleziona il prodotto a cui applicare il premio"})
+	case errors.Is(err, repository.ErrRewardProductInvalid):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Il premio si applica solo a un tuo prodotto attivo (con categoria, per la vetrina di categoria)"})
+	case errors.Is(err, repository.ErrRewardAlreadyOwned):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Hai già questo badge"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel riscatto"})
 	}
 
-	// TODO: Handle specific reward logic (boost product, plant tree, etc.)
-	// For trees, we would call Tree-Nation API and set TreeCertURL
-
-	return c.JSON(response)
+	return c.JSON(models.RedeemResponse{
+		Success:      true,
+		Message:      getRedeemMessage(reward.RewardType),
+		CreditsSpent: reward.Cost,
+		NewBalance:   balance,
+		Reward:       redeemed,
+	})
 }
 
 // GetFeaturedAwards returns featured awards for public display
@@ -258,11 +340,6 @@ func (h *LeaderboardHandler) GetFeaturedAwards(c *fiber.Ctx) error {
 // AdminGetTasks returns all admin tasks
 // GET /api/admin/awards/tasks
 func (h *LeaderboardHandler) AdminGetTasks(c *fiber.Ctx) error {
-	user := c.Locals("user").(*models.User)
-	if !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
-	}
-
 	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
 	defer cancel()
 
@@ -277,11 +354,6 @@ func (h *LeaderboardHandler) AdminGetTasks(c *fiber.Ctx) error {
 // AdminCreateAward creates a new award
 // POST /api/admin/awards
 func (h *LeaderboardHandler) AdminCreateAward(c *fiber.Ctx) error {
-	user := c.Locals("user").(*models.User)
-	if !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
-	}
-
 	var req models.CreateAwardRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
@@ -329,17 +401,14 @@ func (h *LeaderboardHandler) AdminCreateAward(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nella creazione premio"})
 	}
 
+	audit.Record(c, audit.Entry{Action: models.AuditAwardCreated, EntityType: "award", EntityID: award.ID, After: award})
+
 	return c.Status(fiber.StatusCreated).JSON(award)
 }
 
 // AdminUpdateAward updates an existing award
 // PUT /api/admin/awards/:id
 func (h *LeaderboardHandler) AdminUpdateAward(c *fiber.Ctx) error {
-	user := c.Locals("user").(*models.User)
-	if !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
-	}
-
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
@@ -353,6 +422,8 @@ func (h *LeaderboardHandler) AdminUpdateAward(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
+	before, _ := h.leaderboardRepo.GetAwardByID(ctx, id)
+
 	err = h.leaderboardRepo.UpdateAward(ctx, id, &req)
 	if err != nil {
 		if err == repository.ErrAwardNotFound {
@@ -363,17 +434,13 @@ func (h *LeaderboardHandler) AdminUpdateAward(c *fiber.Ctx) error {
 
 	// Return updated award
 	award, _ := h.leaderboardRepo.GetAwardByID(ctx, id)
+	audit.Record(c, audit.Entry{Action: models.AuditAwardUpdated, EntityType: "award", EntityID: id, Before: before, After: award})
 	return c.JSON(award)
 }
 
 // AdminGetAward returns a single award
 // GET /api/admin/awards/:id
 func (h *LeaderboardHandler) AdminGetAward(c *fiber.Ctx) error {
-	user := c.Locals("user").(*models.User)
-	if !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
-	}
-
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
@@ -396,11 +463,6 @@ func (h *LeaderboardHandler) AdminGetAward(c *fiber.Ctx) error {
 // AdminUpdateTask updates a task
 // PUT /api/admin/awards/tasks/:id
 func (h *LeaderboardHandler) AdminUpdateTask(c *fiber.Ctx) error {
-	user := c.Locals("user").(*models.User)
-	if !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
-	}
-
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
@@ -414,6 +476,8 @@ func (h *LeaderboardHandler) AdminUpdateTask(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
+	before, _ := h.leaderboardRepo.GetTaskByID(ctx, id)
+
 	err = h.leaderboardRepo.UpdateTask(ctx, id, &req)
 	if err != nil {
 		if err == repository.ErrTaskNotFound {
@@ -423,6 +487,7 @@ func (h *LeaderboardHandler) AdminUpdateTask(c *fiber.Ctx) error {
 	}
 
 	task, _ := h.leaderboardRepo.GetTaskByID(ctx, id)
+	audit.Record(c, audit.Entry{Action: models.AuditTaskUpdated, EntityType: "task", EntityID: id, Before: before, After: task})
 	return c.JSON(task)
 }
 
@@ -430,10 +495,6 @@ func (h *LeaderboardHandler) AdminUpdateTask(c *fiber.Ctx) error {
 // POST /api/admin/awards/tasks/:id/complete
 func (h *LeaderboardHandler) AdminCompleteTask(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
-	if !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
-	}
-
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
@@ -450,17 +511,17 @@ func (h *LeaderboardHandler) AdminCompleteTask(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel completamento"})
 	}
 
+	audit.Record(c, audit.Entry{
+		Action: models.AuditTaskCompleted, EntityType: "task", EntityID: id,
+		Metadata: map[string]interface{}{"notes": req.Notes},
+	})
+
 	return c.JSON(fiber.Map{"success": true, "message": "Task completato"})
 }
 
 // AdminCreateTask creates a new manual task
 // POST /api/admin/awards/tasks
 func (h *LeaderboardHandler) AdminCreateTask(c *fiber.Ctx) error {
-	user := c.Locals("user").(*models.User)
-	if !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
-	}
-
 	var task models.AdminContentTask
 	if err := c.BodyParser(&task); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
@@ -478,35 +539,24 @@ func (h *LeaderboardHandler) AdminCreateTask(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nella creazione"})
 	}
 
+	audit.Record(c, audit.Entry{Action: models.AuditTaskCreated, EntityType: "task", EntityID: task.ID, After: task})
+
 	return c.Status(fiber.StatusCreated).JSON(task)
 }
 
 // Helper functions
-func getRedeemActionType(rewardType string) models.ImpactActionType {
-	switch rewardType {
-	case "BOOST_24H", "BOOST_7D":
-		return models.ImpactRedeemBoost
-	case "TREE":
-		return models.ImpactRedeemTree
-	case "BADGE":
-		return models.ImpactRedeemBadge
-	default:
-		return models.ImpactRedeemBoost
-	}
-}
-
-func getRedeemMessage(rewardType string) string {
+func getRedeemMessage(rewardType models.RewardType) string {
 	switch rewardType {
-	case "BOOST_24H":
-		return "Boost 24h attivato! Il tuo prodotto avrà più visibilità."
-	case "BOOST_7D":
-		return "Boost 7 giorni attivato! Massima visibilità per una settimana."
-	case "TOP_CATEGORY":
+	case models.RewardVisibilityBoost:
+		return "Boost attivato! Il tuo prodotto avrà più visibilità."
+	case models.RewardTopCategory:
 		return "Il tuo prodotto è ora in evidenza nella categoria!"
-	case "TREE":
+	case models.RewardTreeDonation:
 		return "Grazie! Stiamo piantando un albero a tuo nome. Riceverai il certificato via email."
-	case "BADGE":
+	case models.RewardBadge:
 		return "Badge esclusivo sbloccato! Visibile sul tuo profilo."
+	case models.RewardCommissionWaiver:
+		return "Commissione azzerata sulla tua prossima vendita!"
 	default:
 		return "Premio riscattato con successo!"
 	}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/oidc"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+const (
+	oidcStateTTL      = 10 * time.Minute // browser round trip to the provider
+	oidcResultTTL     = 2 * time.Minute  // callback redirect to the frontend exchange
+	oidcOnboardingTTL = 30 * time.Minute // filling in the onboarding form
+)
+
+// oidcState is saved when the login starts and consumed by the callback
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// oidcIdentity is a verified provider identity waiting to be turned into an account.
+// EmailVerified tells whether the provider vouched for the email.
+type oidcIdentity struct {
+	Provider      string `json:"provider"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	AvatarURL     string `json:"avatar_url"`
+}
+
+// oidcResult is what the callback hands to the frontend through a one-time code
+type oidcResult struct {
+	UserID          uuid.UUID     `json:"user_id,omitempty"`
+	OnboardingToken string        `json:"onboarding_token,omitempty"`
+	Identity        *oidcIdentity `json:"identity,omitempty"`
+}
+
+// OIDCHandler signs users in with OpenID Connect providers (Google, Apple, Facebook).
+// The callback never puts tokens in a URL: it redirects the browser to the frontend
+// with a one-time code, which the frontend exchanges for tokens via POST.
+type OIDCHandler struct {
+	auth        *AuthHandler
+	providers   map[string]*oidc.Provider
+	store       oidc.Store
+	frontendURL string
+}
+
+// NewOIDCHandler creates a new OIDC handler
+func NewOIDCHandler(auth *AuthHandler, store oidc.Store, frontendURL string, providers ...*oidc.Provider) *OIDCHandler {
+	h := &OIDCHandler{
+		auth:        auth,
+		providers:   make(map[string]*oidc.Provider),
+		store:       store,
+		frontendURL: strings.TrimSuffix(frontendURL, "/"),
+	}
+	for _, p := range providers {
+		h.providers[p.Name()] = p
+	}
+	return h
+}
+
+// ListProviders returns the enabled providers
+// GET /api/v1/auth/oidc/providers
+func (h *OIDCHandler) ListProviders(c *fiber.Ctx) error {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return c.JSON(fiber.Map{"providers": names})
+}
+
+// Start redirects the browser to the provider's login page
+// GET /api/v1/auth/oidc/:provider/start
+func (h *OIDCHandler) Start(c *fiber.Ctx) error {
+	provider, ok := h.providers[c.Params("provider")]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Provider non supportato"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err1 != nil || err2 != nil || err3 != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	if err := h.save(ctx, "state:"+state, oidcState{
+		Provider: provider.Name(), Nonce: nonce, CodeVerifier: verifier,
+	}, oidcStateTTL); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		fmt.Printf("⚠️ OIDC %s: %v\n", provider.Name(), err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Provider non raggiungibile"})
+	}
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback receives the authorization code (query string, or form post for Apple),
+// signs in or links the account and redirects to the frontend with a one-time code
+// GET|POST /api/v1/auth/oidc/:provider/callback
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	provider, ok := h.providers[c.Params("provider")]
+	if !ok {
+		return h.redirectError(c, "unsupported_provider")
+	}
+
+	param := func(key string) string {
+		if v := c.FormValue(key); v != "" {
+			return v
+		}
+		return c.Query(key)
+	}
+
+	if param("error") != "" {
+		// User cancelled or the provider refused
+		return h.redirectError(c, "access_denied")
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 15*time.Second)
+	defer cancel()
+
+	var state oidcState
+	if err := h.take(ctx, "state:"+param("state"), &state); err != nil || state.Provider != provider.Name() {
+		return h.redirectError(c, "invalid_state")
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, param("code"), state.CodeVerifier)
+	if err != nil {
+		fmt.Printf("⚠️ OIDC %s exchange failed: %v\n", provider.Name(), err)
+		return h.redirectError(c, "exchange_failed")
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, state.Nonce)
+	if err != nil {
+		fmt.Printf("⚠️ OIDC %s: %v\n", provider.Name(), err)
+		return h.redirectError(c, "invalid_token")
+	}
+
+	identity := &oidcIdentity{
+		Provider:      provider.Name(),
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+		AvatarURL:     claims.Picture,
+	}
+	// Apple sends the name only on the first login, in the form rather than the ID token
+	if appleUser := c.FormValue("user"); appleUser != "" && identity.FirstName == "" {
+		var u struct {
+			Name struct {
+				FirstName string `json:"firstName"`
+				LastName  string `json:"lastName"`
+			} `json:"name"`
+		}
+		if json.Unmarshal([]byte(appleUser), &u) == nil {
+			identity.FirstName, identity.LastName = u.Name.FirstName, u.Name.LastName
+		}
+	}
+
+	result, errCode := h.resolve(ctx, identity)
+	if errCode != "" {
+		return h.redirectError(c, errCode)
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		return h.redirectError(c, "server_error")
+	}
+	if err := h.save(ctx, "result:"+code, result, oidcResultTTL); err != nil {
+		return h.redirectError(c, "server_error")
+	}
+
+	return c.Redirect(h.frontendURL+"/auth/oidc/callback?code="+url.QueryEscape(code), fiber.StatusFound)
+}
+
+// resolve finds the account for a verified identity:
+// by provider subject, then by email (linking, only if the provider verified it),
+// otherwise it prepares the onboarding of a new account, which has to verify
+// its email like a password registration when the provider didn't.
+// Returns an error code for the frontend on failure.
+func (h *OIDCHandler) resolve(ctx context.Context, identity *oidcIdentity) (*oidcResult, string) {
+	userRepo := h.auth.userRepo
+
+	userID, err := userRepo.GetIDByOAuth(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		return &oidcResult{UserID: userID}, ""
+	}
+	if err != repository.ErrUserNotFound {
+		return nil, "server_error"
+	}
+
+	if identity.Email == "" {
+		return nil, "email_required"
+	}
+
+	user, err := userRepo.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !identity.EmailVerified {
+			// Linking on an unverified address would hand the account to whoever controls the provider login
+			return nil, "email_not_verified"
+		}
+		if !user.EmailVerified {
+			// Whoever registered this address never proved owning it: drop their password and sessions
+			if err := userRepo.ClearPassword(ctx, user.ID); err != nil {
+				return nil, "server_error"
+			}
+			if _, err := h.auth.sessionRepo.RevokeAll(ctx, user.ID); err != nil {
+				return nil, "server_error"
+			}
+		}
+		if err := userRepo.LinkOAuth(ctx, user.ID, identity.Provider, identity.Subject, identity.AvatarURL, true); err != nil {
+			return nil, "server_error"
+		}
+		return &oidcResult{UserID: user.ID}, ""
+
+	case err == repository.ErrUserNotFound:
+		token, err := oidc.RandomString()
+		if err != nil {
+			return nil, "server_error"
+		}
+		if err := h.save(ctx, "onboarding:"+token, identity, oidcOnboardingTTL); err != nil {
+			return nil, "server_error"
+		}
+		return &oidcResult{OnboardingToken: token, Identity: identity}, ""
+	}
+
+	return nil, "server_error"
+}
+
+// Exchange redeems the one-time code from the callback.
+// Returns tokens, a 2FA challenge, or the onboarding data for a new account.
+// POST /api/v1/auth/oidc/exchange
+func (h *OIDCHandler) Exchange(c *fiber.Ctx) error {
+	var req models.OIDCExchangeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	var result oidcResult
+	if err := h.take(ctx, "result:"+req.Code, &result); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Codice non valido o scaduto"})
+	}
+
+	if result.OnboardingToken != "" {
+		return c.JSON(models.OIDCOnboardingResponse{
+			OnboardingRequired: true,
+			OnboardingToken:    result.OnboardingToken,
+			Provider:           result.Identity.Provider,
+			Email:              result.Identity.Email,
+			FirstName:          result.Identity.FirstName,
+			LastName:           result.Identity.LastName,
+		})
+	}
+
+	user, err := h.auth.userRepo.GetByID(ctx, result.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Account non trovato"})
+	}
+	if !user.IsActive() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account non attivo"})
+	}
+
+	resp, err := h.auth.completeLogin(ctx, c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(resp)
+}
+
+// Complete creates the account of a first social login with the fields the provider
+// doesn't supply (the city is required) and signs it in
+// POST /api/v1/auth/oidc/complete
+func (h *OIDCHandler) Complete(c *fiber.Ctx) error {
+	var req models.OIDCCompleteRequest
+	if err := c.BodyParser(&req); err != nil || req.OnboardingToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	req.FirstName = strings.TrimSpace(req.FirstName)
+	req.LastName = strings.TrimSpace(req.LastName)
+	req.City = strings.TrimSpace(req.City)
+	if req.FirstName == "" || req.LastName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nome e cognome sono obbligatori"})
+	}
+	if req.City == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Città obbligatoria"})
+	}
+	if req.AccountType == "" {
+		req.AccountType = models.AccountPrivate
+	}
+	if req.AccountType != models.AccountPrivate && req.AccountType != models.AccountBusiness {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tipo account non valido"})
+	}
+	if req.AccountType == models.AccountBusiness {
+		if req.BusinessName == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Ragione sociale obbligatoria per account aziendali"})
+		}
+		if req.VATNumber == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Partita IVA obbligatoria per account aziendali"})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	var identity oidcIdentity
+	if err := h.take(ctx, "onboarding:"+req.OnboardingToken, &identity); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Sessione di registrazione scaduta, accedi di nuovo"})
+	}
+
+	// No password: the account signs in through its provider until one is set via password reset
+	user := &models.User{
+		Email:                identity.Email,
+		FirstName:            req.FirstName,
+		LastName:             req.LastName,
+		AccountType:          req.AccountType,
+		BusinessName:         req.BusinessName,
+		VATNumber:            req.VATNumber,
+		HasMultipleLocations: req.HasMultipleLocations,
+		City:                 req.City,
+		Province:             req.Province,
+		PostalCode:           req.PostalCode,
+	}
+
+	if err := h.auth.userRepo.Create(ctx, user); err != nil {
+		if err == repository.ErrEmailAlreadyExists {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email già registrata"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nella creazione account"})
+	}
+
+	if err := h.auth.userRepo.LinkOAuth(ctx, user.ID, identity.Provider, identity.Subject, identity.AvatarURL, identity.EmailVerified); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nella creazione account"})
+	}
+
+	user, err := h.auth.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	// Don't fail the sign up if the email can't be sent: the user can ask to resend
+	if !user.EmailVerified {
+		if err := h.auth.sendVerificationEmail(ctx, user); err != nil {
+			fmt.Printf("⚠️ Verification email for %s not sent: %v\n", user.ID, err)
+		}
+	}
+
+	resp, err := h.auth.completeLogin(ctx, c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+func (h *OIDCHandler) redirectError(c *fiber.Ctx, code string) error {
+	return c.Redirect(h.frontendURL+"/auth/oidc/callback?error="+url.QueryEscape(code), fiber.StatusFound)
+}
+
+func (h *OIDCHandler) save(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return h.store.Save(ctx, key, data, ttl)
+}
+
+func (h *OIDCHandler) take(ctx context.Context, key string, v interface{}) error {
+	data, err := h.store.Take(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
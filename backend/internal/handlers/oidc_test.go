@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/auth"
+	"github.com/gecogreen/backend/internal/config"
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/oidc"
+	"github.com/gecogreen/backend/internal/oidc/oidctest"
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/services"
+)
+
+const (
+	testAPIURL      = "http://api.test"
+	testFrontendURL = "http://app.test"
+)
+
+// oidcTestEnv is an OIDCHandler wired to a mock provider, mounted as in main.go
+type oidcTestEnv struct {
+	handler  *OIDCHandler
+	provider *oidctest.Server
+	app      *fiber.App
+}
+
+// newOIDCTestEnv registers "google" and "apple" on the same mock provider.
+// authHandler may have no repositories for the paths that never reach the database.
+func newOIDCTestEnv(t *testing.T, authHandler *AuthHandler) *oidcTestEnv {
+	t.Helper()
+
+	server := oidctest.NewServer("gecogreen-test", "secret")
+	t.Cleanup(server.Close)
+
+	provider := func(name string) *oidc.Provider {
+		return oidc.NewProvider(oidc.Config{
+			Name: name, Issuer: server.Issuer(), ClientID: server.ClientID, ClientSecret: server.ClientSecret,
+			RedirectURL: testAPIURL + "/api/v1/auth/oidc/" + name + "/callback",
+		})
+	}
+
+	h := NewOIDCHandler(authHandler, oidc.NewMemoryStore(), testFrontendURL, provider("google"), provider("apple"))
+
+	app := fiber.New()
+	routes := app.Group("/api/v1/auth/oidc")
+	routes.Get("/providers", h.ListProviders)
+	routes.Get("/:provider/start", h.Start)
+	routes.Get("/:provider/callback", h.Callback)
+	routes.Post("/:provider/callback", h.Callback)
+	routes.Post("/exchange", h.Exchange)
+	routes.Post("/complete", h.Complete)
+
+	return &oidcTestEnv{handler: h, provider: server, app: app}
+}
+
+// do runs a request against the app and returns the response and its body
+func (e *oidcTestEnv) do(t *testing.T, method, target string, body interface{}) (*http.Response, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = strings.NewReader(string(data))
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+// start begins a login and returns the provider authorization URL
+func (e *oidcTestEnv) start(t *testing.T, provider string) *url.URL {
+	t.Helper()
+
+	resp, _ := e.do(t, "GET", "/api/v1/auth/oidc/"+provider+"/start", nil)
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("start: status %d, want 302", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// authorize sends the browser to the provider and returns the callback it redirects to
+// (path and query, relative to the API)
+func (e *oidcTestEnv) authorize(t *testing.T, authURL *url.URL) string {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, want 302", resp.StatusCode)
+	}
+
+	callback := resp.Header.Get("Location")
+	if !strings.HasPrefix(callback, testAPIURL) {
+		t.Fatalf("authorize redirected to %q, want the API callback", callback)
+	}
+	return strings.TrimPrefix(callback, testAPIURL)
+}
+
+// callback runs the callback and returns the query of the frontend redirect
+func (e *oidcTestEnv) callback(t *testing.T, target string) url.Values {
+	t.Helper()
+
+	resp, _ := e.do(t, "GET", target, nil)
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("callback: status %d, want 302", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testFrontendURL+"/auth/oidc/callback" {
+		t.Fatalf("callback redirected to %q, want the frontend callback", got)
+	}
+	return location.Query()
+}
+
+// withQuery replaces query parameters of a path
+func withQuery(t *testing.T, target string, params map[string]string) string {
+	t.Helper()
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestOIDCListProviders(t *testing.T) {
+	env := newOIDCTestEnv(t, &AuthHandler{})
+
+	_, body := env.do(t, "GET", "/api/v1/auth/oidc/providers", nil)
+
+	var got struct {
+		Providers []string `json:"providers"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got.Providers, ",") != "apple,google" {
+		t.Errorf("providers = %v, want [apple google]", got.Providers)
+	}
+}
+
+func TestOIDCStart(t *testing.T) {
+	env := newOIDCTestEnv(t, &AuthHandler{})
+
+	resp, _ := env.do(t, "GET", "/api/v1/auth/oidc/unknown/start", nil)
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("unknown provider: status %d, want 404", resp.StatusCode)
+	}
+
+	authURL := env.start(t, "google")
+	if got := authURL.Scheme + "://" + authURL.Host + authURL.Path; got != env.provider.URL+"/authorize" {
+		t.Fatalf("redirected to %q, want the provider authorization endpoint", got)
+	}
+
+	q := authURL.Query()
+	tests := []struct {
+		param string
+		want  string
+	}{
+		{"response_type", "code"},
+		{"client_id", "gecogreen-test"},
+		{"redirect_uri", testAPIURL + "/api/v1/auth/oidc/google/callback"},
+		{"code_challenge_method", "S256"},
+	}
+	for _, tt := range tests {
+		if got := q.Get(tt.param); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.param, got, tt.want)
+		}
+	}
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if q.Get(param) == "" {
+			t.Errorf("%s missing", param)
+		}
+	}
+
+	// Every login gets its own state
+	if other := env.start(t, "google").Query().Get("state"); other == q.Get("state") {
+		t.Error("two logins got the same state")
+	}
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	env := newOIDCTestEnv(t, &AuthHandler{})
+
+	tests := []struct {
+		name     string
+		callback func(t *testing.T) string
+		wantErr  string
+	}{
+		{
+			name:     "unknown provider",
+			callback: func(t *testing.T) string { return "/api/v1/auth/oidc/unknown/callback?code=x&state=y" },
+			wantErr:  "unsupported_provider",
+		},
+		{
+			name:     "user cancelled at the provider",
+			callback: func(t *testing.T) string { return "/api/v1/auth/oidc/google/callback?error=access_denied&state=y" },
+			wantErr:  "access_denied",
+		},
+		{
+			name: "unknown state",
+			callback: func(t *testing.T) string {
+				callback := env.authorize(t, env.start(t, "google"))
+				return withQuery(t, callback, map[string]string{"state": "forged"})
+			},
+			wantErr: "invalid_state",
+		},
+		{
+			name: "state issued for another provider",
+			callback: func(t *testing.T) string {
+				callback := env.authorize(t, env.start(t, "apple"))
+				return strings.Replace(callback, "/apple/", "/google/", 1)
+			},
+			wantErr: "invalid_state",
+		},
+		{
+			name: "code rejected by the provider",
+			callback: func(t *testing.T) string {
+				callback := env.authorize(t, env.start(t, "google"))
+				return withQuery(t, callback, map[string]string{"code": "forged"})
+			},
+			wantErr: "exchange_failed",
+		},
+		{
+			name: "ID token for another login (nonce mismatch)",
+			callback: func(t *testing.T) string {
+				callback := env.authorize(t, env.start(t, "google"))
+				u, _ := url.Parse(callback)
+				key := "state:" + u.Query().Get("state")
+
+				var state oidcState
+				if err := env.handler.take(context.Background(), key, &state); err != nil {
+					t.Fatal(err)
+				}
+				state.Nonce = "another-login"
+				if err := env.handler.save(context.Background(), key, state, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+				return callback
+			},
+			wantErr: "invalid_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := env.callback(t, tt.callback(t))
+			if got := q.Get("error"); got != tt.wantErr {
+				t.Errorf("error = %q, want %q", got, tt.wantErr)
+			}
+			if q.Get("code") != "" {
+				t.Error("failed callback handed out a code")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackStateIsSingleUse(t *testing.T) {
+	env := newOIDCTestEnv(t, &AuthHandler{})
+
+	// The first attempt fails at the provider, but consumes the state all the same
+	callback := withQuery(t, env.authorize(t, env.start(t, "google")), map[string]string{"code": "forged"})
+	if got := env.callback(t, callback).Get("error"); got != "exchange_failed" {
+		t.Fatalf("first callback: error = %q, want exchange_failed", got)
+	}
+	if got := env.callback(t, callback).Get("error"); got != "invalid_state" {
+		t.Errorf("replayed callback: error = %q, want invalid_state", got)
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	env := newOIDCTestEnv(t, &AuthHandler{})
+	ctx := context.Background()
+
+	identity := &oidcIdentity{Provider: "google", Subject: "sub-1", Email: "mario.rossi@example.com", FirstName: "Mario", LastName: "Rossi"}
+	if err := env.handler.save(ctx, "result:onboarding-code", oidcResult{OnboardingToken: "onboarding-token", Identity: identity}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+	}{
+		{"missing code", fiber.Map{}, fiber.StatusBadRequest},
+		{"unknown code", fiber.Map{"code": "forged"}, fiber.StatusUnauthorized},
+		{"first social login", fiber.Map{"code": "onboarding-code"}, fiber.StatusOK},
+		{"code already used", fiber.Map{"code": "onboarding-code"}, fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		resp, body := env.do(t, "POST", "/api/v1/auth/oidc/exchange", tt.body)
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, resp.StatusCode, tt.wantStatus, body)
+			continue
+		}
+		if tt.wantStatus != fiber.StatusOK {
+			continue
+		}
+
+		var got models.OIDCOnboardingResponse
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := models.OIDCOnboardingResponse{
+			OnboardingRequired: true, OnboardingToken: "onboarding-token", Provider: "google",
+			Email: "mario.rossi@example.com", FirstName: "Mario", LastName: "Rossi",
+		}
+		if got != want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
+
+func TestOIDCCompleteValidation(t *testing.T) {
+	env := newOIDCTestEnv(t, &AuthHandler{})
+
+	valid := func(change func(r *models.OIDCCompleteRequest)) models.OIDCCompleteRequest {
+		r := models.OIDCCompleteRequest{OnboardingToken: "expired", FirstName: "Mario", LastName: "Rossi", City: "Milano"}
+		change(&r)
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		body       models.OIDCCompleteRequest
+		wantStatus int
+	}{
+		{"missing onboarding token", valid(func(r *models.OIDCCompleteRequest) { r.OnboardingToken = "" }), fiber.StatusBadRequest},
+		{"missing first name", valid(func(r *models.OIDCCompleteRequest) { r.FirstName = "  " }), fiber.StatusBadRequest},
+		{"missing last name", valid(func(r *models.OIDCCompleteRequest) { r.LastName = "" }), fiber.StatusBadRequest},
+		{"missing city", valid(func(r *models.OIDCCompleteRequest) { r.City = "" }), fiber.StatusBadRequest},
+		{"unknown account type", valid(func(r *models.OIDCCompleteRequest) { r.AccountType = "ADMIN" }), fiber.StatusBadRequest},
+		{"business without name", valid(func(r *models.OIDCCompleteRequest) {
+			r.AccountType, r.VATNumber = models.AccountBusiness, "12345678901"
+		}), fiber.StatusBadRequest},
+		{"business without VAT number", valid(func(r *models.OIDCCompleteRequest) {
+			r.AccountType, r.BusinessName = models.AccountBusiness, "Forno Rossi"
+		}), fiber.StatusBadRequest},
+		{"expired onboarding", valid(func(r *models.OIDCCompleteRequest) {}), fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		resp, body := env.do(t, "POST", "/api/v1/auth/oidc/complete", tt.body)
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, resp.StatusCode, tt.wantStatus, body)
+		}
+	}
+}
+
+// TestOIDCFlowWithDatabase drives start, callback, exchange and complete end to end.
+// It needs TEST_DATABASE_URL pointing to a database with every migration applied.
+func TestOIDCFlowWithDatabase(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	userRepo := repository.NewUserRepository(pool)
+	authHandler := NewAuthHandler(userRepo, repository.NewSessionRepository(pool),
+		auth.NewJWTManager("test-secret"), services.NewEmailService(&config.Config{}), nil)
+	env := newOIDCTestEnv(t, authHandler)
+
+	run := uuid.NewString()[:8]
+	email := fmt.Sprintf("oidc-%s@example.com", run)
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), `DELETE FROM users WHERE email = ANY($1)`,
+			[]string{email, "taken-" + email})
+	})
+
+	login := func(t *testing.T) url.Values {
+		return env.callback(t, env.authorize(t, env.start(t, "google")))
+	}
+	exchange := func(t *testing.T, code string) (int, []byte) {
+		resp, body := env.do(t, "POST", "/api/v1/auth/oidc/exchange", fiber.Map{"code": code})
+		return resp.StatusCode, body
+	}
+
+	t.Run("first login onboards a new account", func(t *testing.T) {
+		// Unverified email (like Facebook): the account is created but must verify it
+		env.provider.SetIdentity(oidctest.Identity{Subject: "sub-" + run, Email: email, GivenName: "Mario", FamilyName: "Rossi"})
+
+		q := login(t)
+		if q.Get("error") != "" {
+			t.Fatalf("callback error %q", q.Get("error"))
+		}
+		status, body := exchange(t, q.Get("code"))
+		if status != fiber.StatusOK {
+			t.Fatalf("exchange: status %d (%s)", status, body)
+		}
+		var onboarding models.OIDCOnboardingResponse
+		json.Unmarshal(body, &onboarding)
+		if !onboarding.OnboardingRequired || onboarding.Email != email || onboarding.FirstName != "Mario" {
+			t.Fatalf("exchange: got %+v, want the onboarding of %s", onboarding, email)
+		}
+
+		resp, body := env.do(t, "POST", "/api/v1/auth/oidc/complete", models.OIDCCompleteRequest{
+			OnboardingToken: onboarding.OnboardingToken, FirstName: "Mario", LastName: "Rossi", City: "Milano",
+		})
+		if resp.StatusCode != fiber.StatusCreated {
+			t.Fatalf("complete: status %d (%s)", resp.StatusCode, body)
+		}
+		var authResp models.AuthResponse
+		json.Unmarshal(body, &authResp)
+		if authResp.AccessToken == "" || authResp.RefreshToken == "" {
+			t.Error("complete: no tokens")
+		}
+		if authResp.User.Email != email || authResp.User.EmailVerified {
+			t.Errorf("complete: user %s verified=%v, want %s unverified", authResp.User.Email, authResp.User.EmailVerified, email)
+		}
+
+		// The onboarding token is single-use
+		resp, _ = env.do(t, "POST", "/api/v1/auth/oidc/complete", models.OIDCCompleteRequest{
+			OnboardingToken: onboarding.OnboardingToken, FirstName: "Mario", LastName: "Rossi", City: "Milano",
+		})
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("second complete: status %d, want 401", resp.StatusCode)
+		}
+	})
+
+	t.Run("returning login signs in by subject", func(t *testing.T) {
+		q := login(t)
+		status, body := exchange(t, q.Get("code"))
+		if status != fiber.StatusOK {
+			t.Fatalf("exchange: status %d (%s)", status, body)
+		}
+		var authResp models.AuthResponse
+		json.Unmarshal(body, &authResp)
+		if authResp.AccessToken == "" || authResp.User.Email != email {
+			t.Errorf("exchange: got user %q, want a session for %s", authResp.User.Email, email)
+		}
+	})
+
+	t.Run("unverified email never links an existing account", func(t *testing.T) {
+		taken := &models.User{Email: "taken-" + email, PasswordHash: "x", FirstName: "Luigi", LastName: "Verdi", AccountType: models.AccountPrivate}
+		if err := userRepo.Create(ctx, taken); err != nil {
+			t.Fatal(err)
+		}
+		env.provider.SetIdentity(oidctest.Identity{Subject: "other-" + run, Email: taken.Email})
+
+		if got := login(t).Get("error"); got != "email_not_verified" {
+			t.Errorf("error = %q, want email_not_verified", got)
+		}
+	})
+}
@@ -1,40 +1,64 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/stripe/stripe-go/v76"
 
+	"github.com/gecogreen/backend/internal/audit"
 	"github.com/gecogreen/backend/internal/models"
 	"github.com/gecogreen/backend/internal/repository"
 	"github.com/gecogreen/backend/internal/services"
+	"github.com/gecogreen/backend/internal/storage"
 )
 
 type OrderHandler struct {
 	orderRepo     *repository.OrderRepository
 	productRepo   *repository.ProductRepository
 	userRepo      *repository.UserRepository
+	impactRepo    *repository.ImpactRepository
 	stripeService *services.StripeService
 	emailService  *services.EmailService
 	frontendURL   string
+	evidenceStore storage.Store
+	impactPoster  *services.ImpactPoster
 }
 
-func NewOrderHandler(orderRepo *repository.OrderRepository, productRepo *repository.ProductRepository, userRepo *repository.UserRepository, stripeService *services.StripeService, emailService *services.EmailService, frontendURL string) *OrderHandler {
+func NewOrderHandler(orderRepo *repository.OrderRepository, productRepo *repository.ProductRepository, userRepo *repository.UserRepository, impactRepo *repository.ImpactRepository, stripeService *services.StripeService, emailService *services.EmailService, frontendURL string) *OrderHandler {
 	return &OrderHandler{
 		orderRepo:     orderRepo,
 		productRepo:   productRepo,
 		userRepo:      userRepo,
+		impactRepo:    impactRepo,
 		stripeService: stripeService,
 		emailService:  emailService,
 		frontendURL:   frontendURL,
 	}
 }
 
+// SetEvidenceStorage enables dispute evidence uploads (private storage)
+func (h *OrderHandler) SetEvidenceStorage(store storage.Store) {
+	h.evidenceStore = store
+}
+
+// SetImpactPoster posts the order credits and impact as soon as an order is
+// completed or refunded (otherwise they're posted by the periodic run)
+func (h *OrderHandler) SetImpactPoster(poster *services.ImpactPoster) {
+	h.impactPoster = poster
+}
+
 // CreateOrder creates a new order and returns checkout URL
 // POST /api/v1/orders
 func (h *OrderHandler) CreateOrder(c *fiber.Ctx) error {
@@ -92,9 +116,14 @@ func (h *OrderHandler) CreateOrder(c *fiber.Ctx) error {
 	}
 	totalAmount := (unitPrice * float64(req.Quantity)) + shippingCost
 
-	// Calculate eco impact (using category estimates)
-	co2Saved := 2.0 * float64(req.Quantity)    // Default 2kg per item
-	waterSaved := 500.0 * float64(req.Quantity) // Default 500L per item
+	// Calculate eco impact from the category's impact factor (or the platform
+	// default, which always exists): an order is never saved without its impact
+	factor, err := h.impactRepo.FactorFor(ctx, product.CategoryID)
+	if err != nil {
+		fmt.Printf("⚠️ Impact factor lookup failed for product %s: %v\n", product.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore creazione ordine, riprova"})
+	}
+	impact := factor.Scale(float64(req.Quantity), product.QuantityUnit)
 
 	// EcoCredits: 10 per euro spent
 	ecoCreditsBuyer := int(totalAmount * 10)
@@ -122,14 +151,18 @@ func (h *OrderHandler) CreateOrder(c *fiber.Ctx) error {
 		PickupLocationID: req.PickupLocationID,
 
 		// Impact
-		CO2Saved:         co2Saved,
-		WaterSaved:       waterSaved,
+		CO2Saved:         impact.CO2Kg,
+		WaterSaved:       impact.WaterL,
+		WasteSaved:       impact.WasteKg,
 		EcoCreditsBuyer:  ecoCreditsBuyer,
 		EcoCreditsSeller: ecoCreditsSeller,
 
 		BuyerNotes: req.BuyerNotes,
 	}
 
+	order.ImpactFactorID = &factor.ID
+	order.ImpactFactorVersion = factor.Version
+
 	// If pickup, get location details
 	if req.DeliveryType == models.DeliveryPickup && req.PickupLocationID != nil {
 		location, err := h.userRepo.GetLocationByID(ctx, *req.PickupLocationID)
@@ -212,7 +245,7 @@ func (h *OrderHandler) GetOrder(c *fiber.Ctx) error {
 	}
 
 	// Only buyer, seller, or admin can see order
-	if order.BuyerID != user.ID && order.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermOrdersReadAny, order.BuyerID, order.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
 	}
 
@@ -309,19 +342,12 @@ func (h *OrderHandler) UpdateOrderStatus(c *fiber.Ctx) error {
 	}
 
 	// Only seller can update
-	if order.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermOrdersOverrideStatus, order.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
 	}
 
-	// Update tracking if shipping
-	if req.TrackingNumber != "" {
-		err = h.orderRepo.UpdateTracking(ctx, id, req.TrackingNumber, req.TrackingURL, req.ShippingCarrier)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore aggiornamento tracking"})
-		}
-	}
-
-	// Update status if provided
+	// Validate status transition if provided
+	statusForced := false
 	if req.Status != "" {
 		// Validate status transition
 		allowedTransitions := map[models.OrderStatus][]models.OrderStatus{
@@ -341,18 +367,46 @@ func (h *OrderHandler) UpdateOrderStatus(c *fiber.Ctx) error {
 			}
 		}
 
-		if !allowed && !user.IsAdmin {
+		statusForced = !allowed
+		if !allowed && !user.Can(models.PermOrdersOverrideStatus) {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":          "Transizione stato non permessa",
 				"current_status": order.Status,
 				"requested":      req.Status,
 			})
 		}
+	}
 
-		err = h.orderRepo.UpdateStatus(ctx, id, req.Status)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore aggiornamento stato"})
+	// Staff acting on someone else's order, forced transitions and refunds are audited
+	var entries []*models.AuditLog
+	if order.SellerID != user.ID || statusForced || req.Status == models.OrderRefunded {
+		action := models.AuditOrderStatusOverride
+		if req.Status == models.OrderRefunded {
+			action = models.AuditOrderRefunded
+		}
+		after := fiber.Map{"status": order.Status, "tracking_number": order.TrackingNumber}
+		if req.Status != "" {
+			after["status"] = req.Status
+		}
+		if req.TrackingNumber != "" {
+			after["tracking_number"] = req.TrackingNumber
 		}
+		entries = append(entries, audit.Log(c, audit.Entry{
+			Action: action, EntityType: "order", EntityID: id,
+			Before: fiber.Map{"status": order.Status, "tracking_number": order.TrackingNumber},
+			After:  after,
+		}))
+	}
+
+	// Update tracking and status together with their audit records
+	err = h.orderRepo.UpdateFulfillment(ctx, id, req.Status, req.TrackingNumber, req.TrackingURL, req.ShippingCarrier, entries...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore aggiornamento stato"})
+	}
+
+	// Post EcoCredits and impact (or reverse them on refund)
+	if req.Status != "" && h.impactPoster != nil {
+		go h.impactPoster.Settle(context.Background(), id, req.Status)
 	}
 
 	// Return updated order
@@ -377,16 +431,27 @@ func (h *OrderHandler) ConfirmPickup(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
-	order, err := h.orderRepo.ConfirmPickup(ctx, req.QRCodeToken)
+	errNotSeller := errors.New("Solo il seller può confermare")
+	order, err := h.orderRepo.ConfirmPickup(ctx, req.QRCodeToken, func(orderID, sellerID uuid.UUID) ([]*models.AuditLog, error) {
+		// Verify seller before the order changes
+		if !user.CanAccess(models.PermOrdersOverrideStatus, sellerID) {
+			return nil, errNotSeller
+		}
+		if sellerID == user.ID {
+			return nil, nil
+		}
+		return []*models.AuditLog{audit.Log(c, audit.Entry{
+			Action: models.AuditOrderPickupOverride, EntityType: "order", EntityID: orderID,
+			After: fiber.Map{"status": models.OrderDelivered},
+		})}, nil
+	})
+	if errors.Is(err, errNotSeller) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Verify seller
-	if order.SellerID != user.ID && !user.IsAdmin {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Solo il seller può confermare"})
-	}
-
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Ritiro confermato! Payout in 48 ore.",
@@ -419,11 +484,21 @@ func (h *OrderHandler) CancelOrder(c *fiber.Ctx) error {
 	}
 
 	// Only buyer, seller, or admin can cancel
-	if order.BuyerID != user.ID && order.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermOrdersOverrideStatus, order.BuyerID, order.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
 	}
 
-	err = h.orderRepo.CancelOrder(ctx, id, user.ID, body.Reason)
+	var entries []*models.AuditLog
+	if order.BuyerID != user.ID && order.SellerID != user.ID {
+		entries = append(entries, audit.Log(c, audit.Entry{
+			Action: models.AuditOrderCancelOverride, EntityType: "order", EntityID: id,
+			Before:   fiber.Map{"status": order.Status},
+			After:    fiber.Map{"status": models.OrderCancelled},
+			Metadata: map[string]interface{}{"reason": body.Reason},
+		}))
+	}
+
+	err = h.orderRepo.CancelOrder(ctx, id, user.ID, body.Reason, entries...)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -472,12 +547,22 @@ func (h *OrderHandler) OpenDispute(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Non puoi aprire disputa per questo ordine"})
 	}
 
+	// At least one photo is required when evidence uploads are available
+	if h.evidenceStore != nil {
+		photos, err := h.orderRepo.CountDisputeEvidence(ctx, id, evidencePartyBuyer, evidencePhoto)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore verifica prove"})
+		}
+		if photos == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Carica almeno una foto come prova"})
+		}
+	}
+
 	dispute := &models.Dispute{
-		OrderID:      id,
-		OpenedBy:     user.ID,
-		Reason:       req.Reason,
-		Description:  req.Description,
-		EvidenceURLs: req.EvidenceURLs,
+		OrderID:     id,
+		OpenedBy:    user.ID,
+		Reason:      req.Reason,
+		Description: req.Description,
 	}
 
 	err = h.orderRepo.CreateDispute(ctx, dispute)
@@ -512,7 +597,7 @@ func (h *OrderHandler) GetDispute(c *fiber.Ctx) error {
 	}
 
 	// Only buyer, seller, or admin can see dispute
-	if order.BuyerID != user.ID && order.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermDisputesResolve, order.BuyerID, order.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
 	}
 
@@ -524,9 +609,341 @@ func (h *OrderHandler) GetDispute(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore"})
 	}
 
+	if h.evidenceStore != nil {
+		evidence, err := h.signedEvidence(ctx, id)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore caricamento prove"})
+		}
+		dispute.Evidence = evidence
+	}
+
 	return c.JSON(dispute)
 }
 
+// ResolveDispute closes a dispute with staff's decision and settles the order:
+// a full refund refunds it, any other outcome completes it
+// POST /api/v1/orders/:id/dispute/resolve
+func (h *OrderHandler) ResolveDispute(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	var req models.ResolveDisputeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+	if !req.Status.IsFinal() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Esito non valido"})
+	}
+	if strings.TrimSpace(req.ResolutionNotes) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Motivazione obbligatoria"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	order, err := h.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Ordine non trovato"})
+	}
+
+	dispute, err := h.orderRepo.GetDisputeByOrderID(ctx, id)
+	if err != nil {
+		if err == repository.ErrDisputeNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Nessuna disputa"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore"})
+	}
+	if dispute.Status.IsFinal() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Disputa già chiusa"})
+	}
+
+	// Amounts follow from the outcome; only partial refunds and splits take them from the request
+	refund, payout := 0.0, 0.0
+	orderStatus := models.OrderCompleted
+	switch req.Status {
+	case models.DisputeResolvedRefundFull:
+		refund = order.TotalAmount
+		orderStatus = models.OrderRefunded
+	case models.DisputeResolvedPayoutSeller:
+		payout = order.SellerPayout
+	case models.DisputeResolvedRefundPartial, models.DisputeResolvedSplit:
+		refund, payout = req.RefundAmount, req.SellerPayoutAmount
+		if refund <= 0 || refund >= order.TotalAmount {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Importo rimborso non valido"})
+		}
+		if payout < 0 || payout > order.SellerPayout || refund+payout > order.TotalAmount ||
+			(req.Status == models.DisputeResolvedSplit && payout == 0) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Importo al venditore non valido"})
+		}
+	}
+
+	before := fiber.Map{"dispute_status": dispute.Status, "order_status": order.Status}
+	dispute.Status = req.Status
+	dispute.ResolvedBy = &user.ID
+	dispute.ResolutionNotes = strings.TrimSpace(req.ResolutionNotes)
+	dispute.RefundAmount = refund
+	dispute.SellerPayoutAmount = payout
+
+	entry := audit.Log(c, audit.Entry{
+		Action: models.AuditDisputeResolved, EntityType: "dispute", EntityID: dispute.ID,
+		Before: before,
+		After: fiber.Map{
+			"dispute_status": dispute.Status, "order_status": orderStatus,
+			"refund_amount": refund, "seller_payout_amount": payout,
+		},
+		Metadata: map[string]interface{}{"order_id": id, "notes": dispute.ResolutionNotes},
+	})
+
+	if err := h.orderRepo.ResolveDispute(ctx, dispute, orderStatus, entry); err != nil {
+		if err == repository.ErrDisputeFinal {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Disputa già chiusa"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore chiusura disputa"})
+	}
+
+	// Post EcoCredits and impact (or reverse them on refund)
+	if h.impactPoster != nil {
+		go h.impactPoster.Settle(context.Background(), id, orderStatus)
+	}
+
+	return c.JSON(dispute)
+}
+
+// Evidence parties and media types (match the dispute_evidence CHECK constraints)
+const (
+	evidencePartyBuyer  = "BUYER"
+	evidencePartySeller = "SELLER"
+	evidencePhoto       = "PHOTO"
+	evidenceVideo       = "VIDEO"
+)
+
+// allowedEvidenceVideoTypes are the accepted video formats
+var allowedEvidenceVideoTypes = map[string]bool{
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/quicktime": true,
+}
+
+// UploadDisputeEvidence uploads a photo or video as dispute evidence.
+// Files are stored privately with their SHA-256, for later verification.
+// POST /api/v1/orders/:id/dispute/evidence
+func (h *OrderHandler) UploadDisputeEvidence(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	if h.evidenceStore == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Upload non configurato"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 60*time.Second)
+	defer cancel()
+
+	order, err := h.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Ordine non trovato"})
+	}
+
+	// Buyer collects evidence before opening the dispute, seller only once it's open
+	var party string
+	switch user.ID {
+	case order.BuyerID:
+		party = evidencePartyBuyer
+		if order.Status != models.OrderDelivered && order.Status != models.OrderPaid && order.Status != models.OrderDisputed {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Non puoi caricare prove per questo ordine"})
+		}
+	case order.SellerID:
+		party = evidencePartySeller
+		if order.Status != models.OrderDisputed {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Nessuna disputa aperta per questo ordine"})
+		}
+	default:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "File non trovato"})
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore lettura file"})
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, models.MaxEvidenceVideoSize+1))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore lettura file"})
+	}
+
+	// Trust the content, not the declared header
+	contentType := http.DetectContentType(data)
+	if contentType == "application/octet-stream" {
+		contentType = storage.DetectVideoType(data)
+	}
+
+	var mediaType string
+	switch {
+	case storage.IsValidImageType(contentType):
+		mediaType = evidencePhoto
+		if len(data) > storage.MaxFileSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Foto troppo grande. Massimo 5MB"})
+		}
+	case allowedEvidenceVideoTypes[contentType]:
+		mediaType = evidenceVideo
+		if order.TotalAmount <= models.EvidenceVideoMinOrderTotal {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Video ammesso solo per ordini superiori a 200€"})
+		}
+		if len(data) > models.MaxEvidenceVideoSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Video troppo grande. Massimo 50MB"})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tipo file non supportato. Usa JPEG, PNG, WebP, MP4, WebM o MOV"})
+	}
+
+	maxFiles, limitMsg := models.MaxEvidencePhotos, fmt.Sprintf("Massimo %d foto per parte", models.MaxEvidencePhotos)
+	if mediaType == evidenceVideo {
+		maxFiles, limitMsg = models.MaxEvidenceVideos, "Puoi caricare un solo video"
+	}
+
+	// Cheap early check; AddDisputeEvidence repeats it atomically with the insert
+	count, err := h.orderRepo.CountDisputeEvidence(ctx, id, party, mediaType)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore verifica prove"})
+	}
+	if count >= maxFiles {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": limitMsg})
+	}
+
+	sum := sha256.Sum256(data)
+
+	folder := fmt.Sprintf("disputes/%s/%s", id, strings.ToLower(party))
+	key, err := h.evidenceStore.UploadPrivate(ctx, bytes.NewReader(data), file.Filename, contentType, folder)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel caricamento"})
+	}
+
+	evidence := &models.DisputeEvidence{
+		OrderID:     id,
+		UploadedBy:  user.ID,
+		Party:       party,
+		MediaType:   mediaType,
+		StorageKey:  key,
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+	if err := h.orderRepo.AddDisputeEvidence(ctx, evidence, maxFiles); err != nil {
+		h.evidenceStore.DeletePrivate(ctx, key)
+		if errors.Is(err, repository.ErrEvidenceLimit) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": limitMsg})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore salvataggio prova"})
+	}
+
+	if url, err := h.evidenceStore.SignedURL(ctx, key, storage.SignedURLExpiry); err == nil {
+		evidence.URL = url
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(evidence)
+}
+
+// ListDisputeEvidence lists the evidence of an order with short-lived signed URLs
+// GET /api/v1/orders/:id/dispute/evidence
+func (h *OrderHandler) ListDisputeEvidence(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	if h.evidenceStore == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Upload non configurato"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	order, err := h.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Ordine non trovato"})
+	}
+
+	// Only buyer, seller, or admin can see evidence
+	if !user.CanAccess(models.PermDisputesResolve, order.BuyerID, order.SellerID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso negato"})
+	}
+
+	evidence, err := h.signedEvidence(ctx, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore caricamento prove"})
+	}
+
+	return c.JSON(fiber.Map{
+		"evidence":   evidence,
+		"expires_in": int(storage.SignedURLExpiry.Seconds()),
+	})
+}
+
+// DeleteDisputeEvidence deletes own evidence not yet attached to a dispute
+// DELETE /api/v1/orders/:id/dispute/evidence/:evidenceId
+func (h *OrderHandler) DeleteDisputeEvidence(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	if h.evidenceStore == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Upload non configurato"})
+	}
+
+	evidenceID, err := uuid.Parse(c.Params("evidenceId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	key, err := h.orderRepo.DeleteDisputeEvidence(ctx, evidenceID, user.ID)
+	if err != nil {
+		if err == repository.ErrEvidenceNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Prova non trovata o già allegata a una disputa"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore eliminazione prova"})
+	}
+
+	if err := h.evidenceStore.DeletePrivate(ctx, key); err != nil {
+		fmt.Printf("⚠️ Failed to delete evidence file %s: %v\n", key, err)
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// signedEvidence loads an order's evidence and signs a temporary URL for each file
+func (h *OrderHandler) signedEvidence(ctx context.Context, orderID uuid.UUID) ([]models.DisputeEvidence, error) {
+	evidence, err := h.orderRepo.GetDisputeEvidence(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range evidence {
+		url, err := h.evidenceStore.SignedURL(ctx, evidence[i].StorageKey, storage.SignedURLExpiry)
+		if err != nil {
+			return nil, err
+		}
+		evidence[i].URL = url
+	}
+
+	return evidence, nil
+}
+
 // CreateReview creates a review for an order
 // POST /api/v1/orders/:id/review
 func (h *OrderHandler) CreateReview(c *fiber.Ctx) error {
@@ -591,6 +1008,72 @@ func (h *OrderHandler) CreateReview(c *fiber.Ctx) error {
 	})
 }
 
+// ListReviewsForModeration lists the latest reviews, hidden ones included
+// GET /api/v1/admin/order-reviews?reviewed_id=...&limit=50
+func (h *OrderHandler) ListReviewsForModeration(c *fiber.Ctx) error {
+	var reviewedID *uuid.UUID
+	if v := c.Query("reviewed_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID utente non valido"})
+		}
+		reviewedID = &id
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	reviews, err := h.orderRepo.ListReviewsForModeration(ctx, reviewedID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore caricamento recensioni"})
+	}
+
+	return c.JSON(fiber.Map{"reviews": reviews})
+}
+
+// ModerateReview hides a review from the public profile and the rating, or restores it
+// PUT /api/v1/admin/order-reviews/:id
+func (h *OrderHandler) ModerateReview(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	var req models.ModerateReviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+	req.Notes = strings.TrimSpace(req.Notes)
+	if !req.Approved && req.Notes == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Motivazione obbligatoria per nascondere una recensione"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err = h.orderRepo.ModerateReview(ctx, id, req.Approved, req.Notes, func(before *models.OrderReview) []*models.AuditLog {
+		return []*models.AuditLog{audit.Log(c, audit.Entry{
+			Action: models.AuditReviewModerated, EntityType: "order_review", EntityID: id,
+			Before:   fiber.Map{"is_approved": before.IsApproved, "moderation_notes": before.ModerationNotes},
+			After:    fiber.Map{"is_approved": req.Approved, "moderation_notes": req.Notes},
+			Metadata: map[string]interface{}{"order_id": before.OrderID, "reviewed_id": before.ReviewedID},
+		})}
+	})
+	if err != nil {
+		if err == repository.ErrReviewNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Recensione non trovata"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore moderazione"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "is_approved": req.Approved})
+}
+
 // GetQRCode returns QR code data for pickup
 // GET /api/v1/orders/:id/qr
 func (h *OrderHandler) GetQRCode(c *fiber.Ctx) error {
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/gecogreen/backend/internal/audit"
+	"github.com/gecogreen/backend/internal/auth"
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/services"
+)
+
+// PrivacyHandler serves the GDPR self-service: data export and account deletion
+type PrivacyHandler struct {
+	privacyRepo   *repository.PrivacyRepository
+	sessionRepo   *repository.SessionRepository
+	exporter      *services.DataExporter
+	emailService  *services.EmailService
+	deletionGrace time.Duration
+}
+
+// NewPrivacyHandler creates a new privacy handler.
+// deletionGrace is how long a deletion request can be cancelled.
+func NewPrivacyHandler(privacyRepo *repository.PrivacyRepository, sessionRepo *repository.SessionRepository, exporter *services.DataExporter, emailService *services.EmailService, deletionGrace time.Duration) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyRepo:   privacyRepo,
+		sessionRepo:   sessionRepo,
+		exporter:      exporter,
+		emailService:  emailService,
+		deletionGrace: deletionGrace,
+	}
+}
+
+// ExportData downloads a ZIP with all the user's data and uploaded files
+// GET /api/v1/profile/export
+func (h *PrivacyHandler) ExportData(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 30*time.Second)
+	defer cancel()
+
+	export, err := h.exporter.Load(ctx, user.ID)
+	if err != nil {
+		fmt.Printf("⚠️ Data export %s failed: %v\n", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore esportazione dati"})
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditDataExported, EntityType: "user", EntityID: user.ID})
+
+	filename := fmt.Sprintf("gecogreen-dati-%s.zip", time.Now().Format("20060102"))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	// The archive is streamed after the handler returns: files are copied from storage one at a time
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		if err := h.exporter.Write(ctx, w, export); err != nil {
+			fmt.Printf("⚠️ Data export %s interrupted: %v\n", export.UserID, err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// RequestDeletion schedules the deletion of the account after the grace period.
+// The user is logged out everywhere; logging in again allows cancelling.
+// POST /api/v1/profile/deletion
+func (h *PrivacyHandler) RequestDeletion(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req models.DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	if user.DeletionScheduledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":                 "Cancellazione già richiesta",
+			"deletion_scheduled_at": user.DeletionScheduledAt,
+		})
+	}
+	if user.IsStaff() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Gli account dello staff vanno prima rimossi dallo staff da un amministratore"})
+	}
+
+	// Social-only accounts have no password: typing the email confirms the intent
+	if user.PasswordHash != "" {
+		if !auth.CheckPassword(req.Password, user.PasswordHash) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Password non corretta"})
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Digita la tua email per confermare"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	active, err := h.privacyRepo.CountActiveOrders(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+	if active > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":         "Completa o annulla gli ordini in corso prima di cancellare l'account",
+			"active_orders": active,
+		})
+	}
+
+	scheduledAt := time.Now().Add(h.deletionGrace)
+	if err := h.privacyRepo.RequestDeletion(ctx, user.ID, scheduledAt); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	if _, err := h.sessionRepo.RevokeAll(ctx, user.ID); err != nil {
+		fmt.Printf("⚠️ Failed to revoke sessions of %s after deletion request: %v\n", user.ID, err)
+	}
+
+	audit.Record(c, audit.Entry{
+		Action: models.AuditDeletionRequested, EntityType: "user", EntityID: user.ID,
+		Metadata: map[string]interface{}{"scheduled_at": scheduledAt.UTC().Format(time.RFC3339)},
+	})
+
+	go func() {
+		if err := h.emailService.SendAccountDeletionScheduled(user.Email, user.FirstName, scheduledAt); err != nil {
+			fmt.Printf("Error sending account deletion email: %v\n", err)
+		}
+	}()
+
+	return c.JSON(fiber.Map{"success": true, "deletion_scheduled_at": scheduledAt})
+}
+
+// CancelDeletion restores the account during the grace period
+// DELETE /api/v1/profile/deletion
+func (h *PrivacyHandler) CancelDeletion(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.privacyRepo.CancelDeletion(ctx, user.ID); err != nil {
+		if errors.Is(err, repository.ErrDeletionNotRequested) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Nessuna cancellazione in corso"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditDeletionCancelled, EntityType: "user", EntityID: user.ID})
+
+	return c.JSON(fiber.Map{"success": true})
+}
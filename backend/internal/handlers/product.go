@@ -2,32 +2,63 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/gecogreen/backend/internal/audit"
+	"github.com/gecogreen/backend/internal/cache"
+	"github.com/gecogreen/backend/internal/geo"
 	"github.com/gecogreen/backend/internal/models"
 	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/storage"
 )
 
 type ProductHandler struct {
 	productRepo *repository.ProductRepository
+	store       storage.Store
+	facetCache  cache.Store
 }
 
-func NewProductHandler(productRepo *repository.ProductRepository) *ProductHandler {
-	return &ProductHandler{productRepo: productRepo}
+// NewProductHandler creates a product handler; store may be nil when uploads are disabled
+func NewProductHandler(productRepo *repository.ProductRepository, store storage.Store) *ProductHandler {
+	return &ProductHandler{productRepo: productRepo, store: store}
 }
 
-func (h *ProductHandler) List(c *fiber.Ctx) error {
-	filters := models.ProductFilters{
-		Page:      c.QueryInt("page", 1),
-		PerPage:   c.QueryInt("per_page", 20),
-		SortBy:    c.Query("sort_by", "created_at"),
-		SortOrder: c.Query("sort_order", "desc"),
-	}
+// SetFacetCache caches the facet counts of the listing
+func (h *ProductHandler) SetFacetCache(store cache.Store) {
+	h.facetCache = store
+}
+
+// Radius search limits, in km
+const (
+	defaultRadiusKm = 25
+	maxRadiusKm     = 200
+)
+
+// mapClusterLimit bounds the clusters returned for a viewport
+const mapClusterLimit = 500
+
+// How long facet counts are cached: text and radius searches are rarely repeated,
+// so they are kept for less
+const (
+	facetCacheTTL       = time.Minute
+	facetSearchCacheTTL = 15 * time.Second
+)
+
+// productFilters reads the filters shared by the listing and the map from the query string
+func productFilters(c *fiber.Ctx) models.ProductFilters {
+	var filters models.ProductFilters
 
 	if search := c.Query("search"); search != "" {
 		filters.Search = &search
@@ -60,6 +91,43 @@ func (h *ProductHandler) List(c *fiber.Ctx) error {
 	if region := c.Query("region"); region != "" {
 		filters.Region = &region
 	}
+	if shippingMethod := c.Query("shipping_method"); shippingMethod != "" {
+		sm := models.ShippingMethod(shippingMethod)
+		filters.ShippingMethod = &sm
+	}
+
+	return filters
+}
+
+// List returns a page of products. With facets=all (or a comma-separated list of
+// category, province, listing_type, shipping_method, price) the response also
+// counts the products by each value of those facets.
+// GET /api/v1/products
+func (h *ProductHandler) List(c *fiber.Ctx) error {
+	facets, ok := parseFacets(c.Query("facets"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Facet non valido"})
+	}
+
+	filters := productFilters(c)
+	filters.Page = c.QueryInt("page", 1)
+	filters.PerPage = c.QueryInt("per_page", 20)
+	filters.SortBy = c.Query("sort_by") // created_at, or relevance/distance when searching by text/radius
+	filters.SortOrder = c.Query("sort_order", "desc")
+
+	// Radius search: lat, lng and optionally radius_km
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, errLng := strconv.ParseFloat(c.Query("lng"), 64)
+	if errLat == nil && errLng == nil {
+		if !geo.ValidPoint(geo.Point{Lat: lat, Lng: lng}) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coordinate non valide"})
+		}
+		filters.Lat, filters.Lng = &lat, &lng
+		filters.RadiusKm = defaultRadiusKm
+		if radius, err := strconv.ParseFloat(c.Query("radius_km"), 64); err == nil && radius > 0 {
+			filters.RadiusKm = math.Min(math.Max(radius, 1), maxRadiusKm)
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
 	defer cancel()
@@ -68,6 +136,130 @@ func (h *ProductHandler) List(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero prodotti"})
 	}
+
+	if len(facets) > 0 {
+		response.Facets = make(map[string][]models.FacetValue, len(facets))
+		for _, facet := range facets {
+			values, err := h.facet(ctx, filters, facet)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero prodotti"})
+			}
+			response.Facets[facet] = values
+		}
+	}
+	return c.JSON(response)
+}
+
+// parseFacets reads the facets parameter; "all" (or "true") selects every facet
+func parseFacets(param string) ([]string, bool) {
+	if param == "" {
+		return nil, true
+	}
+	if param == "all" || param == "true" {
+		return models.Facets, true
+	}
+
+	var facets []string
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(models.Facets, name) {
+			return nil, false
+		}
+		if !slices.Contains(facets, name) {
+			facets = append(facets, name)
+		}
+	}
+	return facets, true
+}
+
+// facet counts a facet under the other filters, through the cache when set.
+// The cache key only covers the filters the count depends on, so picking a
+// value of a facet doesn't invalidate that facet's own counts.
+func (h *ProductHandler) facet(ctx context.Context, filters models.ProductFilters, facet string) ([]models.FacetValue, error) {
+	filters = filters.WithoutFacet(facet)
+	if h.facetCache == nil {
+		return h.productRepo.Facet(ctx, filters, facet)
+	}
+
+	encoded, err := json.Marshal(filters)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(encoded)
+	key := "facets:" + facet + ":" + hex.EncodeToString(sum[:])
+
+	if cached, err := h.facetCache.Get(ctx, key); err == nil {
+		var values []models.FacetValue
+		if json.Unmarshal(cached, &values) == nil {
+			return values, nil
+		}
+	} else if !errors.Is(err, cache.ErrMiss) {
+		fmt.Printf("⚠️ Facet cache read failed: %v\n", err)
+	}
+
+	values, err := h.productRepo.Facet(ctx, filters, facet)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := facetCacheTTL
+	if filters.Search != nil || filters.Lat != nil {
+		ttl = facetSearchCacheTTL
+	}
+	if encoded, err := json.Marshal(values); err == nil {
+		if err := h.facetCache.Set(ctx, key, encoded, ttl); err != nil {
+			fmt.Printf("⚠️ Facet cache write failed: %v\n", err)
+		}
+	}
+	return values, nil
+}
+
+// Map returns the products in the viewport grouped into clusters, coarser at lower zoom.
+// Takes min_lat, min_lng, max_lat, max_lng, zoom and the listing filters.
+// GET /api/v1/products/map
+func (h *ProductHandler) Map(c *fiber.Ctx) error {
+	var box geo.Box
+	for _, f := range []struct {
+		name string
+		dst  *float64
+	}{{"min_lat", &box.MinLat}, {"min_lng", &box.MinLng}, {"max_lat", &box.MaxLat}, {"max_lng", &box.MaxLng}} {
+		v, err := strconv.ParseFloat(c.Query(f.name), 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Area della mappa non valida"})
+		}
+		*f.dst = v
+	}
+	if !box.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Area della mappa non valida"})
+	}
+
+	zoom := c.QueryInt("zoom", 10)
+	if zoom < geo.MinZoom {
+		zoom = geo.MinZoom
+	}
+	if zoom > geo.MaxZoom {
+		zoom = geo.MaxZoom
+	}
+
+	filters := productFilters(c)
+	filters.Bounds = &box
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	// One extra cluster tells whether the viewport holds more than the limit
+	clusters, err := h.productRepo.Clusters(ctx, filters, geo.ClusterCellSize(zoom), mapClusterLimit+1)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero prodotti"})
+	}
+
+	response := models.ProductMapResponse{Zoom: zoom, Clusters: clusters}
+	if len(clusters) > mapClusterLimit {
+		response.Clusters, response.Truncated = clusters[:mapClusterLimit], true
+	}
+	for _, cluster := range response.Clusters {
+		response.Total += cluster.Count
+	}
 	return c.JSON(response)
 }
 
@@ -191,7 +383,7 @@ func (h *ProductHandler) Update(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore"})
 	}
 
-	if product.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermProductsManageAny, product.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Non autorizzato"})
 	}
 
@@ -200,6 +392,8 @@ func (h *ProductHandler) Update(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
 	}
 
+	before := productAuditSnapshot(product)
+
 	if req.Title != nil {
 		product.Title = *req.Title
 	}
@@ -214,6 +408,12 @@ func (h *ProductHandler) Update(c *fiber.Ctx) error {
 		product.QuantityAvail = *req.Quantity
 	}
 	if req.Status != nil {
+		if *req.Status == models.ProductStatusActive && product.Status != models.ProductStatusActive &&
+			len(product.Images) < models.MinProductImages {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Servono almeno %d foto per pubblicare l'annuncio", models.MinProductImages),
+			})
+		}
 		product.Status = *req.Status
 	}
 	if req.ShippingMethod != nil {
@@ -223,7 +423,15 @@ func (h *ProductHandler) Update(c *fiber.Ctx) error {
 		product.ShippingCost = *req.ShippingCost
 	}
 
-	if err := h.productRepo.Update(ctx, product); err != nil {
+	var entries []*models.AuditLog
+	if product.SellerID != user.ID {
+		entries = append(entries, audit.Log(c, audit.Entry{
+			Action: models.AuditProductStaffUpdate, EntityType: "product", EntityID: product.ID,
+			Before: before, After: productAuditSnapshot(product),
+		}))
+	}
+
+	if err := h.productRepo.Update(ctx, product, entries...); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nell'aggiornamento"})
 	}
 
@@ -249,17 +457,200 @@ func (h *ProductHandler) Delete(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore"})
 	}
 
-	if product.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermProductsManageAny, product.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Non autorizzato"})
 	}
 
-	if err := h.productRepo.Delete(ctx, id, product.SellerID); err != nil {
+	var entries []*models.AuditLog
+	if product.SellerID != user.ID {
+		entries = append(entries, audit.Log(c, audit.Entry{
+			Action: models.AuditProductStaffDelete, EntityType: "product", EntityID: product.ID,
+			Before:   productAuditSnapshot(product),
+			Metadata: map[string]interface{}{"seller_id": product.SellerID},
+		}))
+	}
+
+	if err := h.productRepo.Delete(ctx, id, product.SellerID, entries...); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nell'eliminazione"})
 	}
 
 	return c.JSON(fiber.Map{"message": "Prodotto eliminato"})
 }
 
+// DeleteImage removes a photo from the gallery and from storage
+// DELETE /api/v1/products/:id/images
+func (h *ProductHandler) DeleteImage(c *fiber.Ctx) error {
+	var req models.ProductImageRequest
+	if err := c.BodyParser(&req); err != nil || req.URL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "URL immagine obbligatorio"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	product, errResp := h.getOwnedProduct(ctx, c)
+	if product == nil {
+		return errResp
+	}
+
+	if !containsImage(product.Images, req.URL) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Immagine non trovata"})
+	}
+
+	if product.Status == models.ProductStatusActive && len(product.Images) <= models.MinProductImages {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Un annuncio attivo deve avere almeno %d foto", models.MinProductImages),
+		})
+	}
+
+	if err := h.productRepo.RemoveImage(ctx, product.ID, req.URL); err != nil {
+		if err == repository.ErrImageNotFound {
+			// Removed or gallery shrunk concurrently
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Le foto sono state modificate, ricarica e riprova"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nell'eliminazione"})
+	}
+
+	if h.store != nil {
+		if err := h.store.Delete(ctx, req.URL); err != nil {
+			fmt.Printf("⚠️ Failed to delete image %s from storage: %v\n", req.URL, err)
+		}
+	}
+
+	images, _ := h.productRepo.GetImages(ctx, product.ID)
+	return c.JSON(fiber.Map{"images": images})
+}
+
+// ReorderImages sets the gallery order; the first image becomes the cover
+// PUT /api/v1/products/:id/images/order
+func (h *ProductHandler) ReorderImages(c *fiber.Ctx) error {
+	var req models.ReorderImagesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	product, errResp := h.getOwnedProduct(ctx, c)
+	if product == nil {
+		return errResp
+	}
+
+	// The new order must be a permutation of the current gallery
+	if !sameImages(product.Images, req.Images) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "L'ordine deve contenere esattamente le foto attuali"})
+	}
+
+	return h.saveImageOrder(ctx, c, product, req.Images)
+}
+
+// SetCoverImage moves a photo to the first position (used as MainImageURL)
+// PUT /api/v1/products/:id/images/cover
+func (h *ProductHandler) SetCoverImage(c *fiber.Ctx) error {
+	var req models.ProductImageRequest
+	if err := c.BodyParser(&req); err != nil || req.URL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "URL immagine obbligatorio"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	product, errResp := h.getOwnedProduct(ctx, c)
+	if product == nil {
+		return errResp
+	}
+
+	if !containsImage(product.Images, req.URL) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Immagine non trovata"})
+	}
+
+	images := []string{req.URL}
+	for _, img := range product.Images {
+		if img != req.URL {
+			images = append(images, img)
+		}
+	}
+
+	return h.saveImageOrder(ctx, c, product, images)
+}
+
+// getOwnedProduct loads the :id product and checks the user may edit it.
+// On failure it returns a nil product and the already-written error response.
+func (h *ProductHandler) getOwnedProduct(ctx context.Context, c *fiber.Ctx) (*models.Product, error) {
+	user := c.Locals("user").(*models.User)
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	product, err := h.productRepo.GetByID(ctx, id)
+	if err != nil {
+		if err == repository.ErrProductNotFound {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Prodotto non trovato"})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore"})
+	}
+
+	if !user.CanAccess(models.PermProductsManageAny, product.SellerID) {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Non autorizzato"})
+	}
+
+	return product, nil
+}
+
+func (h *ProductHandler) saveImageOrder(ctx context.Context, c *fiber.Ctx, product *models.Product, images []string) error {
+	if err := h.productRepo.SetImages(ctx, product.ID, product.Images, images); err != nil {
+		if err == repository.ErrImagesChanged {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Le foto sono state modificate, ricarica e riprova"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nell'aggiornamento"})
+	}
+
+	return c.JSON(fiber.Map{"images": images})
+}
+
+// productAuditSnapshot is the part of a product recorded in the audit log
+func productAuditSnapshot(p *models.Product) fiber.Map {
+	return fiber.Map{
+		"title":           p.Title,
+		"description":     p.Description,
+		"price":           p.Price,
+		"quantity":        p.Quantity,
+		"status":          p.Status,
+		"shipping_method": p.ShippingMethod,
+		"shipping_cost":   p.ShippingCost,
+	}
+}
+
+func containsImage(images []string, url string) bool {
+	for _, img := range images {
+		if img == url {
+			return true
+		}
+	}
+	return false
+}
+
+// sameImages reports whether b is a permutation of a
+func sameImages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, img := range a {
+		counts[img]++
+	}
+	for _, img := range b {
+		if counts[img] == 0 {
+			return false
+		}
+		counts[img]--
+	}
+	return true
+}
+
 func (h *ProductHandler) MyProducts(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
 
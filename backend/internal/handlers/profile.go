@@ -1,26 +1,36 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/gecogreen/backend/internal/audit"
 	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/moderation"
 	"github.com/gecogreen/backend/internal/repository"
 	"github.com/gecogreen/backend/internal/storage"
+	"github.com/gecogreen/backend/internal/validation"
 )
 
-var _ = storage.MaxFileSize // ensure storage import is used
-
 type ProfileHandler struct {
-	userRepo  *repository.UserRepository
-	r2Storage *storage.R2Storage
+	userRepo          *repository.UserRepository
+	store             storage.Store
+	duplicateDetector *moderation.DuplicateDetector
+}
+
+func NewProfileHandler(userRepo *repository.UserRepository, store storage.Store) *ProfileHandler {
+	return &ProfileHandler{userRepo: userRepo, store: store}
 }
 
-func NewProfileHandler(userRepo *repository.UserRepository, r2Storage *storage.R2Storage) *ProfileHandler {
-	return &ProfileHandler{userRepo: userRepo, r2Storage: r2Storage}
+// SetDuplicateDetector enables perceptual-hash duplicate detection (optional)
+func (h *ProfileHandler) SetDuplicateDetector(detector *moderation.DuplicateDetector) {
+	h.duplicateDetector = detector
 }
 
 // GetProfile returns the current user's full profile
@@ -51,10 +61,38 @@ func (h *ProfileHandler) UpdateProfile(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
 	}
 
+	if req.AccountType != nil && *req.AccountType != user.AccountType {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Per cambiare tipo di account usa POST /api/v1/profile/account-type"})
+	}
+	req.AccountType = nil
+
+	// Business accounts must keep valid invoicing data
+	if user.IsBusiness() {
+		data := user.BusinessData()
+		if applyBusinessUpdate(&data, &req) {
+			validation.NormalizeBusinessData(&data)
+			if errs := validation.BusinessData(data); errs != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati aziendali non validi", "fields": errs})
+			}
+			setBusinessUpdate(&req, data)
+		}
+	}
+
+	// Billing data ends up on invoices: keep track of who changed it
+	var entries []*models.AuditLog
+	data := user.BusinessData()
+	applyBusinessUpdate(&data, &req)
+	if before, after := billingAuditSnapshot(user), billingSnapshot(data); before != after {
+		entries = append(entries, audit.Log(c, audit.Entry{
+			Action: models.AuditBillingUpdated, EntityType: "user", EntityID: user.ID,
+			Before: before, After: after,
+		}))
+	}
+
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := h.userRepo.UpdateProfile(ctx, user.ID, &req); err != nil {
+	if err := h.userRepo.UpdateProfile(ctx, user.ID, &req, entries...); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nell'aggiornamento"})
 	}
 
@@ -69,7 +107,7 @@ func (h *ProfileHandler) UpdateProfile(c *fiber.Ctx) error {
 
 // UploadAvatar uploads user's avatar image
 func (h *ProfileHandler) UploadAvatar(c *fiber.Ctx) error {
-	if h.r2Storage == nil {
+	if h.store == nil {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Upload non disponibile"})
 	}
 
@@ -97,12 +135,17 @@ func (h *ProfileHandler) UploadAvatar(c *fiber.Ctx) error {
 	}
 	defer src.Close()
 
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore lettura file"})
+	}
+
 	ctx, cancel := context.WithTimeout(c.Context(), 30*time.Second)
 	defer cancel()
 
-	// Upload to R2
+	// Upload to storage
 	folder := "avatars/" + user.ID.String()
-	url, err := h.r2Storage.Upload(ctx, src, file.Filename, contentType, folder)
+	url, err := h.store.Upload(ctx, bytes.NewReader(data), file.Filename, contentType, folder)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore upload"})
 	}
@@ -112,12 +155,16 @@ func (h *ProfileHandler) UploadAvatar(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore salvataggio"})
 	}
 
+	if h.duplicateDetector != nil {
+		go detectDuplicates(h.duplicateDetector, data, user.ID, nil, url, "PROFILE")
+	}
+
 	return c.JSON(fiber.Map{"avatar_url": url})
 }
 
 // UploadBusinessPhoto uploads a business photo
 func (h *ProfileHandler) UploadBusinessPhoto(c *fiber.Ctx) error {
-	if h.r2Storage == nil {
+	if h.store == nil {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Upload non disponibile"})
 	}
 
@@ -145,12 +192,17 @@ func (h *ProfileHandler) UploadBusinessPhoto(c *fiber.Ctx) error {
 	}
 	defer src.Close()
 
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore lettura file"})
+	}
+
 	ctx, cancel := context.WithTimeout(c.Context(), 30*time.Second)
 	defer cancel()
 
-	// Upload to R2
+	// Upload to storage
 	folder := "business-photos/" + user.ID.String()
-	url, err := h.r2Storage.Upload(ctx, src, file.Filename, contentType, folder)
+	url, err := h.store.Upload(ctx, bytes.NewReader(data), file.Filename, contentType, folder)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore upload"})
 	}
@@ -160,9 +212,212 @@ func (h *ProfileHandler) UploadBusinessPhoto(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore salvataggio"})
 	}
 
+	if h.duplicateDetector != nil {
+		go detectDuplicates(h.duplicateDetector, data, user.ID, nil, url, "BUSINESS")
+	}
+
 	return c.JSON(fiber.Map{"photo_url": url})
 }
 
+// SwitchAccountType changes between PRIVATE and BUSINESS. Without "confirm" nothing
+// changes and the response lists the effects, so the client can ask for confirmation.
+// POST /api/v1/profile/account-type
+func (h *ProfileHandler) SwitchAccountType(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req models.SwitchAccountTypeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+	if req.AccountType != models.AccountPrivate && req.AccountType != models.AccountBusiness {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tipo di account non valido"})
+	}
+	if req.AccountType == user.AccountType {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "L'account è già di questo tipo"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	stats, err := h.userRepo.GetAccountSwitchStats(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	// Upgrading: the submitted fields complete the data kept from a previous BUSINESS period
+	data := user.BusinessData()
+	if req.AccountType == models.AccountBusiness {
+		mergeBusinessData(&data, req.BusinessData)
+		validation.NormalizeBusinessData(&data)
+		if errs := validation.BusinessData(data); errs != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati aziendali non validi", "fields": errs})
+		}
+	} else if stats.ActiveSellerOrders > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":         "Completa gli ordini in corso come venditore prima di passare ad account privato",
+			"active_orders": stats.ActiveSellerOrders,
+		})
+	}
+
+	if !req.Confirm {
+		return c.JSON(models.AccountSwitchResponse{
+			AccountType: req.AccountType,
+			Effects:     accountSwitchEffects(req.AccountType, stats),
+		})
+	}
+
+	unpublished, err := h.userRepo.SwitchAccountType(ctx, user.ID, req.AccountType, data, func(unpublished int64) []*models.AuditLog {
+		stats.ActiveListings = int(unpublished)
+		effects := accountSwitchEffects(req.AccountType, stats)
+		codes := make([]string, len(effects))
+		for i, e := range effects {
+			codes[i] = e.Code
+		}
+		return []*models.AuditLog{audit.Log(c, audit.Entry{
+			Action: models.AuditAccountTypeChanged, EntityType: "user", EntityID: user.ID,
+			Before:   accountTypeAuditSnapshot(user),
+			After:    accountTypeSnapshot{AccountType: req.AccountType, billingSnapshot: billingSnapshot(data)},
+			Metadata: map[string]interface{}{"effects": codes, "listings_unpublished": unpublished},
+		})}
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAccountTypeSame):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "L'account è già di questo tipo"})
+		case errors.Is(err, repository.ErrActiveOrders):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Completa gli ordini in corso come venditore prima di passare ad account privato"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel cambio tipo di account"})
+	}
+	stats.ActiveListings = int(unpublished)
+	effects := accountSwitchEffects(req.AccountType, stats)
+
+	updatedUser, err := h.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(models.AccountSwitchResponse{
+		AccountType: req.AccountType,
+		Applied:     true,
+		Effects:     effects,
+		User:        updatedUser,
+	})
+}
+
+// accountSwitchEffects describes what switching to target does
+func accountSwitchEffects(target models.AccountType, stats *models.AccountSwitchStats) []models.AccountSwitchEffect {
+	effects := []models.AccountSwitchEffect{}
+
+	if target == models.AccountBusiness {
+		effects = append(effects, models.AccountSwitchEffect{
+			Code:    models.EffectBusinessDataPublic,
+			Message: "Ragione sociale e partita IVA saranno visibili sul tuo profilo pubblico",
+		})
+		if stats.BusinessPhotos > 0 {
+			effects = append(effects, models.AccountSwitchEffect{
+				Code:    models.EffectBusinessPhotosShown,
+				Message: "Le foto aziendali torneranno visibili sul profilo",
+				Count:   stats.BusinessPhotos,
+			})
+		}
+		return effects
+	}
+
+	effects = append(effects, models.AccountSwitchEffect{
+		Code:    models.EffectBusinessDataHidden,
+		Message: "Ragione sociale e partita IVA non saranno più visibili; restano salvate se tornerai ad account aziendale",
+	})
+	if stats.BusinessPhotos > 0 {
+		effects = append(effects, models.AccountSwitchEffect{
+			Code:    models.EffectBusinessPhotosHidden,
+			Message: "Le foto aziendali saranno nascoste dal profilo",
+			Count:   stats.BusinessPhotos,
+		})
+	}
+	if stats.ActiveListings > 0 {
+		effects = append(effects, models.AccountSwitchEffect{
+			Code:    models.EffectListingsUnpublished,
+			Message: "Gli annunci attivi torneranno in bozza: ricontrollali e ripubblicali come privato",
+			Count:   stats.ActiveListings,
+		})
+	}
+	if stats.InvoicedOrders > 0 {
+		effects = append(effects, models.AccountSwitchEffect{
+			Code:    models.EffectInvoicesKept,
+			Message: "Lo storico di ordini e fatture resta invariato e consultabile",
+			Count:   stats.InvoicedOrders,
+		})
+	}
+	return effects
+}
+
+// mergeBusinessData overwrites the fields of data that are set in update
+func mergeBusinessData(data *models.BusinessData, update models.BusinessData) {
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&data.BusinessName, update.BusinessName)
+	set(&data.VATNumber, update.VATNumber)
+	set(&data.FiscalCode, update.FiscalCode)
+	set(&data.SDICode, update.SDICode)
+	set(&data.PECEmail, update.PECEmail)
+	set(&data.EUVatID, update.EUVatID)
+	set(&data.BillingAddress, update.BillingAddress)
+	set(&data.BillingCity, update.BillingCity)
+	set(&data.BillingProvince, update.BillingProvince)
+	set(&data.BillingPostalCode, update.BillingPostalCode)
+	set(&data.BillingCountry, update.BillingCountry)
+}
+
+// businessUpdateFields pairs the business fields of a profile update with BusinessData
+func businessUpdateFields(data *models.BusinessData, req *models.UpdateProfileRequest) []struct {
+	dst *string
+	src **string
+} {
+	return []struct {
+		dst *string
+		src **string
+	}{
+		{&data.BusinessName, &req.BusinessName},
+		{&data.VATNumber, &req.VATNumber},
+		{&data.FiscalCode, &req.FiscalCode},
+		{&data.SDICode, &req.SDICode},
+		{&data.PECEmail, &req.PECEmail},
+		{&data.EUVatID, &req.EUVatID},
+		{&data.BillingAddress, &req.BillingAddress},
+		{&data.BillingCity, &req.BillingCity},
+		{&data.BillingProvince, &req.BillingProvince},
+		{&data.BillingPostalCode, &req.BillingPostalCode},
+		{&data.BillingCountry, &req.BillingCountry},
+	}
+}
+
+// applyBusinessUpdate copies the business fields present in req into data;
+// it reports whether there were any
+func applyBusinessUpdate(data *models.BusinessData, req *models.UpdateProfileRequest) bool {
+	touched := false
+	for _, f := range businessUpdateFields(data, req) {
+		if *f.src != nil {
+			*f.dst = **f.src
+			touched = true
+		}
+	}
+	return touched
+}
+
+// setBusinessUpdate writes the normalized business data back into the update
+func setBusinessUpdate(req *models.UpdateProfileRequest, data models.BusinessData) {
+	for _, f := range businessUpdateFields(&data, req) {
+		if *f.src != nil {
+			v := *f.dst
+			*f.src = &v
+		}
+	}
+}
+
 // GetLocations returns user's pickup locations
 func (h *ProfileHandler) GetLocations(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
@@ -293,3 +548,44 @@ func (h *ProfileHandler) DeleteLocation(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"success": true})
 }
+
+// billingSnapshot is the billing data recorded in the audit log
+type billingSnapshot struct {
+	BusinessName      string `json:"business_name"`
+	VATNumber         string `json:"vat_number"`
+	FiscalCode        string `json:"fiscal_code"`
+	SDICode           string `json:"sdi_code"`
+	PECEmail          string `json:"pec_email"`
+	EUVatID           string `json:"eu_vat_id"`
+	BillingAddress    string `json:"billing_address"`
+	BillingCity       string `json:"billing_city"`
+	BillingProvince   string `json:"billing_province"`
+	BillingPostalCode string `json:"billing_postal_code"`
+	BillingCountry    string `json:"billing_country"`
+}
+
+// accountTypeSnapshot is recorded in the audit log when the account type changes
+type accountTypeSnapshot struct {
+	AccountType models.AccountType `json:"account_type"`
+	billingSnapshot
+}
+
+func accountTypeAuditSnapshot(u *models.User) accountTypeSnapshot {
+	return accountTypeSnapshot{AccountType: u.AccountType, billingSnapshot: billingAuditSnapshot(u)}
+}
+
+func billingAuditSnapshot(u *models.User) billingSnapshot {
+	return billingSnapshot{
+		BusinessName:      u.BusinessName,
+		VATNumber:         u.VATNumber,
+		FiscalCode:        u.FiscalCode,
+		SDICode:           u.SDICode,
+		PECEmail:          u.PECEmail,
+		EUVatID:           u.EUVatID,
+		BillingAddress:    u.BillingAddress,
+		BillingCity:       u.BillingCity,
+		BillingProvince:   u.BillingProvince,
+		BillingPostalCode: u.BillingPostalCode,
+		BillingCountry:    u.BillingCountry,
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/audit"
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+type RewardHandler struct {
+	rewardRepo *repository.RewardRepository
+}
+
+func NewRewardHandler(rewardRepo *repository.RewardRepository) *RewardHandler {
+	return &RewardHandler{
+		rewardRepo: rewardRepo,
+	}
+}
+
+// AdminList returns the whole reward catalogue, inactive rewards included
+// GET /api/v1/admin/rewards
+func (h *RewardHandler) AdminList(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	rewards, err := h.rewardRepo.List(ctx, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero premi"})
+	}
+
+	return c.JSON(fiber.Map{"rewards": rewards})
+}
+
+// AdminCreate adds a reward to the catalogue
+// POST /api/v1/admin/rewards
+func (h *RewardHandler) AdminCreate(c *fiber.Ctx) error {
+	var req models.CreateRewardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	reward := &models.EcoReward{
+		Code:        strings.ToUpper(strings.TrimSpace(req.Code)),
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Icon:        strings.TrimSpace(req.Icon),
+		Cost:        req.Cost,
+		RewardType:  req.RewardType,
+		Config:      req.Config,
+		IsActive:    true,
+		Stock:       req.Stock,
+		SortOrder:   req.SortOrder,
+	}
+	if req.IsActive != nil {
+		reward.IsActive = *req.IsActive
+	}
+	if msg := validateReward(reward); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.rewardRepo.Create(ctx, reward); err != nil {
+		return rewardError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditRewardCreated, EntityType: "reward", EntityID: reward.ID, After: reward})
+
+	return c.Status(fiber.StatusCreated).JSON(reward)
+}
+
+// AdminUpdate edits a reward. Rewards already redeemed keep the config they
+// were redeemed with.
+// PUT /api/v1/admin/rewards/:id
+func (h *RewardHandler) AdminUpdate(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID premio non valido"})
+	}
+
+	var req models.UpdateRewardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	reward, err := h.rewardRepo.GetByID(ctx, id)
+	if err != nil {
+		return rewardError(c, err)
+	}
+	before := *reward
+
+	if req.Code != nil {
+		reward.Code = strings.ToUpper(strings.TrimSpace(*req.Code))
+	}
+	if req.Name != nil {
+		reward.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		reward.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Icon != nil {
+		reward.Icon = strings.TrimSpace(*req.Icon)
+	}
+	if req.Cost != nil {
+		reward.Cost = *req.Cost
+	}
+	if req.Config != nil {
+		reward.Config = *req.Config
+	}
+	if req.IsActive != nil {
+		reward.IsActive = *req.IsActive
+	}
+	if req.UnlimitedStock {
+		reward.Stock = nil
+	} else if req.Stock != nil {
+		reward.Stock = req.Stock
+	}
+	if req.SortOrder != nil {
+		reward.SortOrder = *req.SortOrder
+	}
+	if msg := validateReward(reward); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := h.rewardRepo.Update(ctx, reward); err != nil {
+		return rewardError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditRewardUpdated, EntityType: "reward", EntityID: reward.ID, Before: before, After: reward})
+
+	return c.JSON(reward)
+}
+
+// AdminDelete removes a reward nobody redeemed yet
+// DELETE /api/v1/admin/rewards/:id
+func (h *RewardHandler) AdminDelete(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID premio non valido"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	reward, err := h.rewardRepo.GetByID(ctx, id)
+	if err != nil {
+		return rewardError(c, err)
+	}
+	if err := h.rewardRepo.Delete(ctx, id); err != nil {
+		return rewardError(c, err)
+	}
+
+	audit.Record(c, audit.Entry{Action: models.AuditRewardDeleted, EntityType: "reward", EntityID: id, Before: reward})
+
+	return c.JSON(fiber.Map{"message": "Premio eliminato"})
+}
+
+// validateReward checks a reward before saving it, returning the error message
+func validateReward(reward *models.EcoReward) string {
+	if !rewardCodeRe.MatchString(reward.Code) || len(reward.Code) > 50 {
+		return "Codice non valido: solo lettere maiuscole, numeri e underscore (massimo 50 caratteri)"
+	}
+	if reward.Name == "" || len(reward.Name) > 100 {
+		return "Nome obbligatorio (massimo 100 caratteri)"
+	}
+	if len(reward.Icon) > 50 {
+		return "Icona troppo lunga (massimo 50 caratteri)"
+	}
+	if !reward.RewardType.IsValid() {
+		return "Tipo premio non valido"
+	}
+	if reward.Cost <= 0 {
+		return "Il costo deve essere maggiore di zero"
+	}
+	if reward.Stock != nil && *reward.Stock < 0 {
+		return "Le scorte non possono essere negative"
+	}
+
+	config := reward.Config
+	switch reward.RewardType {
+	case models.RewardVisibilityBoost, models.RewardTopCategory:
+		if config.DurationHours <= 0 {
+			return "Indica la durata in ore"
+		}
+	case models.RewardBadge:
+		if strings.TrimSpace(config.BadgeName) == "" {
+			return "Indica il nome del badge"
+		}
+	case models.RewardCommissionWaiver:
+		if config.MaxAmount != nil && *config.MaxAmount <= 0 {
+			return "L'importo massimo deve essere maggiore di zero"
+		}
+		if config.ValidDays < 0 {
+			return "La validità non può essere negativa"
+		}
+	case models.RewardTreeDonation:
+		if config.TreeCount < 0 {
+			return "Il numero di alberi non può essere negativo"
+		}
+	}
+	return ""
+}
+
+var rewardCodeRe = regexp.MustCompile(`^[A-Z0-9_]+$`)
+
+// rewardError maps the reward catalogue errors to responses
+func rewardError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrRewardNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Premio non trovato"})
+	case errors.Is(err, repository.ErrRewardCodeTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Codice già in uso"})
+	case errors.Is(err, repository.ErrRewardInUse):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Il premio è già stato riscattato: disattivalo invece di eliminarlo"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore aggiornamento premi"})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/validation"
+)
+
+// storefrontReviews is how many recent reviews a storefront shows
+const storefrontReviews = 10
+
+// SellerHandler serves the public seller storefronts
+type SellerHandler struct {
+	userRepo    *repository.UserRepository
+	sellerRepo  *repository.SellerRepository
+	productRepo *repository.ProductRepository
+	orderRepo   *repository.OrderRepository
+}
+
+func NewSellerHandler(userRepo *repository.UserRepository, sellerRepo *repository.SellerRepository, productRepo *repository.ProductRepository, orderRepo *repository.OrderRepository) *SellerHandler {
+	return &SellerHandler{
+		userRepo:    userRepo,
+		sellerRepo:  sellerRepo,
+		productRepo: productRepo,
+		orderRepo:   orderRepo,
+	}
+}
+
+// GetSeller returns the storefront of a seller
+// GET /api/v1/sellers/:id
+func (h *SellerHandler) GetSeller(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+	return h.storefront(c, id)
+}
+
+// GetStorefront returns the storefront of a seller by its slug
+// GET /api/v1/stores/:slug
+func (h *SellerHandler) GetStorefront(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := h.userRepo.GetIDBySlug(ctx, strings.ToLower(c.Params("slug")))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Venditore non trovato"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+	return h.storefront(c, id)
+}
+
+// GetSellerProducts pages through the seller's active listings
+// GET /api/v1/sellers/:id/products
+func (h *SellerHandler) GetSellerProducts(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID non valido"})
+	}
+
+	filters := models.ProductFilters{
+		SellerID:  &id,
+		Page:      c.QueryInt("page", 1),
+		PerPage:   c.QueryInt("per_page", 20),
+		SortBy:    c.Query("sort_by", "created_at"),
+		SortOrder: c.Query("sort_order", "desc"),
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	response, err := h.productRepo.List(ctx, filters)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero prodotti"})
+	}
+	return c.JSON(response)
+}
+
+// storefront builds the public page of an active seller. Contact details are
+// revealed only to the seller and to buyers with a paid order from them.
+func (h *SellerHandler) storefront(c *fiber.Ctx, sellerID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	seller, err := h.userRepo.GetByID(ctx, sellerID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Venditore non trovato"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+	if !seller.IsActive() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Venditore non trovato"})
+	}
+
+	contactVisible := false
+	if viewer, ok := c.Locals("user").(*models.User); ok {
+		contactVisible = viewer.ID == seller.ID
+		if !contactVisible {
+			if contactVisible, err = h.sellerRepo.HasPaidOrder(ctx, viewer.ID, seller.ID); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+			}
+		}
+	}
+
+	ratings, err := h.sellerRepo.GetRatingBreakdown(ctx, seller.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+	reviews, err := h.orderRepo.GetReviewsForUser(ctx, seller.ID, storefrontReviews)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+	if reviews == nil {
+		reviews = []models.OrderReview{}
+	}
+	listings, err := h.productRepo.List(ctx, models.ProductFilters{SellerID: &seller.ID, Page: 1, PerPage: 20})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore nel recupero prodotti"})
+	}
+	areas, err := h.sellerRepo.GetPickupAreas(ctx, seller.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+	orders, items, err := h.sellerRepo.GetSalesTotals(ctx, seller.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+	rewardBadges, err := h.sellerRepo.GetRewardBadges(ctx, seller.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	profile := seller.ToFullProfile()
+	if !contactVisible {
+		profile.Phone = ""
+		profile.SocialLinks = models.SocialLinks{}
+	}
+
+	return c.JSON(models.SellerStorefront{
+		Profile: profile,
+		Slug:    seller.Slug,
+		Badges: models.SellerBadges{
+			Verified:         seller.EmailVerified,
+			VerifiedBusiness: seller.IsBusiness() && validation.BusinessData(seller.BusinessData()) == nil,
+			TopRated:         ratings.Count >= models.TopRatedMinReviews && ratings.Average >= models.TopRatedMinAverage,
+			Rewards:          rewardBadges,
+		},
+		Ratings:       *ratings,
+		RecentReviews: reviews,
+		Listings:      listings,
+		PickupAreas:   areas,
+		Impact: models.SellerImpact{
+			CO2Saved:        seller.TotalCO2Saved,
+			WaterSaved:      seller.TotalWaterSaved,
+			WasteSaved:      seller.TotalWasteSaved,
+			ItemsSold:       items,
+			OrdersCompleted: orders,
+		},
+		ContactVisible: contactVisible,
+	})
+}
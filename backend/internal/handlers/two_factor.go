@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/auth"
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/services"
+)
+
+// TwoFactorHandler manages TOTP enrolment for the logged-in user
+type TwoFactorHandler struct {
+	twoFactor        *services.TwoFactorService
+	sessionRepo      *repository.SessionRepository
+	requiredForAdmin bool
+}
+
+// NewTwoFactorHandler creates a new 2FA handler
+func NewTwoFactorHandler(twoFactor *services.TwoFactorService, sessionRepo *repository.SessionRepository, requiredForAdmin bool) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactor: twoFactor, sessionRepo: sessionRepo, requiredForAdmin: requiredForAdmin}
+}
+
+// GetStatus returns whether 2FA is enabled and how many recovery codes are left
+// GET /api/v1/auth/2fa
+func (h *TwoFactorHandler) GetStatus(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	remaining := 0
+	if user.TOTPEnabled {
+		var err error
+		remaining, err = h.twoFactor.RemainingRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":             user.TOTPEnabled,
+		"required":            user.IsStaff() && h.requiredForAdmin,
+		"recovery_codes_left": remaining,
+	})
+}
+
+// Setup generates a new TOTP secret to scan in an authenticator app
+// POST /api/v1/auth/2fa/setup
+func (h *TwoFactorHandler) Setup(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	secret, uri, err := h.twoFactor.Setup(ctx, user.ID, user.Email)
+	if err != nil {
+		if err == services.ErrTwoFactorAlreadyEnabled {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Autenticazione a due fattori già attiva"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	})
+}
+
+// Enable confirms the setup with a first code and returns the recovery codes (shown only once).
+// Other devices are logged out.
+// POST /api/v1/auth/2fa/enable
+func (h *TwoFactorHandler) Enable(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req models.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	codes, err := h.twoFactor.Enable(ctx, user.ID, req.Code)
+	if err != nil {
+		switch err {
+		case services.ErrInvalidTwoFactorCode:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Codice non valido"})
+		case services.ErrTwoFactorAlreadyEnabled:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Autenticazione a due fattori già attiva"})
+		case repository.ErrTOTPNotSetUp:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Avvia prima la configurazione"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	sessionID := c.Locals("sessionID").(uuid.UUID)
+	if err := h.sessionRepo.RevokeOthers(ctx, user.ID, sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":        true,
+		"recovery_codes": codes,
+	})
+}
+
+// Disable turns 2FA off; requires password and a current code
+// POST /api/v1/auth/2fa/disable
+func (h *TwoFactorHandler) Disable(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req models.DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	if user.IsStaff() && h.requiredForAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Autenticazione a due fattori obbligatoria per lo staff"})
+	}
+
+	if !auth.CheckPassword(req.Password, user.PasswordHash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Password non corretta"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.twoFactor.Verify(ctx, user.ID, req.Code); err != nil {
+		return twoFactorCodeError(c, err)
+	}
+
+	if err := h.twoFactor.Disable(ctx, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes; requires a current code
+// POST /api/v1/auth/2fa/recovery-codes
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req models.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Dati non validi"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.twoFactor.Verify(ctx, user.ID, req.Code); err != nil {
+		return twoFactorCodeError(c, err)
+	}
+
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+	}
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// twoFactorCodeError writes the response for a failed code verification
+func twoFactorCodeError(c *fiber.Ctx, err error) error {
+	switch err {
+	case services.ErrInvalidTwoFactorCode:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Codice non valido"})
+	case services.ErrTwoFactorNotEnabled:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Autenticazione a due fattori non attiva"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Errore del server"})
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,17 +19,20 @@ import (
 
 // UploadHandler handles file upload endpoints
 type UploadHandler struct {
-	storage         *storage.R2Storage
-	productRepo     *repository.ProductRepository
-	imageReviewRepo *repository.ImageReviewRepository
-	ocrService      *moderation.OCRService
+	storage           storage.Store
+	productRepo       *repository.ProductRepository
+	sessionRepo       *repository.UploadSessionRepository
+	imageReviewRepo   *repository.ImageReviewRepository
+	ocrService        *moderation.OCRService
+	duplicateDetector *moderation.DuplicateDetector
 }
 
 // NewUploadHandler creates a new upload handler
-func NewUploadHandler(storage *storage.R2Storage, productRepo *repository.ProductRepository) *UploadHandler {
+func NewUploadHandler(storage storage.Store, productRepo *repository.ProductRepository, sessionRepo *repository.UploadSessionRepository) *UploadHandler {
 	return &UploadHandler{
 		storage:     storage,
 		productRepo: productRepo,
+		sessionRepo: sessionRepo,
 	}
 }
 
@@ -36,6 +42,11 @@ func (h *UploadHandler) SetModerationServices(ocrService *moderation.OCRService,
 	h.imageReviewRepo = imageReviewRepo
 }
 
+// SetDuplicateDetector enables perceptual-hash duplicate detection (optional)
+func (h *UploadHandler) SetDuplicateDetector(detector *moderation.DuplicateDetector) {
+	h.duplicateDetector = detector
+}
+
 // UploadProductImage handles POST /api/v1/upload/product/:product_id/image
 func (h *UploadHandler) UploadProductImage(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
@@ -65,7 +76,7 @@ func (h *UploadHandler) UploadProductImage(c *fiber.Ctx) error {
 		})
 	}
 
-	if product.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermProductsManageAny, product.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Non sei autorizzato a modificare questo prodotto",
 		})
@@ -103,9 +114,23 @@ func (h *UploadHandler) UploadProductImage(c *fiber.Ctx) error {
 	}
 	defer src.Close()
 
-	// Upload to R2
+	if len(product.Images) >= models.MaxProductImages {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Massimo %d foto per annuncio", models.MaxProductImages),
+		})
+	}
+
+	// Keep the bytes: they are needed for the perceptual hash after upload
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Errore nella lettura del file",
+		})
+	}
+
+	// Upload to storage
 	folder := "products/" + productID.String()
-	imageURL, err := h.storage.Upload(ctx, src, file.Filename, contentType, folder)
+	imageURL, err := h.storage.Upload(ctx, bytes.NewReader(data), file.Filename, contentType, folder)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Errore nel caricamento del file",
@@ -121,11 +146,20 @@ func (h *UploadHandler) UploadProductImage(c *fiber.Ctx) error {
 	if err := h.productRepo.AddImage(ctx, productID, imageURL); err != nil {
 		// Try to delete the uploaded file
 		_ = h.storage.Delete(ctx, imageURL)
+		if err == repository.ErrImageLimitReached {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Massimo %d foto per annuncio", models.MaxProductImages),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Errore nel salvataggio dell'immagine",
 		})
 	}
 
+	if h.duplicateDetector != nil {
+		go detectDuplicates(h.duplicateDetector, data, user.ID, &productID, imageURL, "PRODUCT")
+	}
+
 	return c.JSON(fiber.Map{
 		"url": imageURL,
 	})
@@ -154,7 +188,7 @@ func (h *UploadHandler) UploadExpiryPhoto(c *fiber.Ctx) error {
 		})
 	}
 
-	if product.SellerID != user.ID && !user.IsAdmin {
+	if !user.CanAccess(models.PermProductsManageAny, product.SellerID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Non autorizzato",
 		})
@@ -202,22 +236,25 @@ func (h *UploadHandler) UploadExpiryPhoto(c *fiber.Ctx) error {
 }
 
 // GetPresignedURL handles POST /api/v1/upload/presign
-// Returns a presigned URL for direct client-side upload
+// Returns a presigned URL for direct client-side upload of a product image.
+// The client must PUT the file to upload_url, then call the finalize endpoint.
 func (h *UploadHandler) GetPresignedURL(c *fiber.Ctx) error {
-	_ = c.Locals("user").(*models.User)
-
-	var req struct {
-		Filename    string `json:"filename"`
-		ContentType string `json:"content_type"`
-		Folder      string `json:"folder"`
-	}
+	user := c.Locals("user").(*models.User)
 
+	var req models.PresignRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Dati non validi",
 		})
 	}
 
+	productID, err := uuid.Parse(req.ProductID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "ID prodotto non valido",
+		})
+	}
+
 	if !storage.IsValidImageType(req.ContentType) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Tipo di file non valido",
@@ -227,19 +264,180 @@ func (h *UploadHandler) GetPresignedURL(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
 	defer cancel()
 
-	presignedURL, publicURL, err := h.storage.GeneratePresignedURL(ctx, req.Filename, req.ContentType, req.Folder)
+	product, err := h.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Prodotto non trovato",
+		})
+	}
+
+	if !user.CanAccess(models.PermProductsManageAny, product.SellerID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Non autorizzato",
+		})
+	}
+
+	if len(product.Images) >= models.MaxProductImages {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Massimo %d foto per annuncio", models.MaxProductImages),
+		})
+	}
+
+	folder := "products/" + productID.String()
+	presignedURL, publicURL, err := h.storage.Presign(ctx, req.Filename, req.ContentType, folder)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Errore nella generazione dell'URL",
 		})
 	}
 
+	session := &models.UploadSession{
+		UserID:      user.ID,
+		ProductID:   &productID,
+		FileURL:     publicURL,
+		ContentType: req.ContentType,
+		ExpiresAt:   time.Now().Add(storage.PresignExpiry),
+	}
+	if err := h.sessionRepo.Create(ctx, session); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Errore nella creazione della sessione di upload",
+		})
+	}
+
 	return c.JSON(fiber.Map{
+		"session_id": session.ID,
 		"upload_url": presignedURL,
 		"public_url": publicURL,
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+// FinalizeUpload handles POST /api/v1/upload/sessions/:id/finalize
+// Checks the uploaded object (existence, size, real content type) and attaches it to the product
+func (h *UploadHandler) FinalizeUpload(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "ID sessione non valido",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 30*time.Second)
+	defer cancel()
+
+	session, err := h.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		if err == repository.ErrUploadSessionNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Sessione di upload non trovata",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Errore nel recupero della sessione",
+		})
+	}
+
+	if session.UserID != user.ID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Non autorizzato",
+		})
+	}
+
+	if session.Status != models.UploadSessionPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "Sessione di upload già chiusa",
+			"status": session.Status,
+		})
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "Sessione di upload scaduta",
+		})
+	}
+
+	info, err := h.storage.Stat(ctx, session.FileURL)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "File non ancora caricato",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Errore nella verifica del file",
+		})
+	}
+
+	if info.Size == 0 || info.Size > storage.MaxFileSize {
+		h.rejectUpload(ctx, session, "invalid size")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "File troppo grande. Massimo 5MB",
+		})
+	}
+
+	// Don't trust the declared type: sniff the actual bytes
+	src, err := h.storage.Get(ctx, session.FileURL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Errore nella lettura del file",
+		})
+	}
+	data, err := io.ReadAll(io.LimitReader(src, storage.MaxFileSize+1))
+	src.Close()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Errore nella lettura del file",
+		})
+	}
+
+	if !storage.IsValidImageType(http.DetectContentType(data)) {
+		h.rejectUpload(ctx, session, "invalid content type")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Tipo di file non valido. Usa JPEG, PNG, GIF o WebP",
+		})
+	}
+
+	// Claim the session first so two concurrent finalize calls can't attach twice
+	if err := h.sessionRepo.MarkFinalized(ctx, session.ID); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Sessione di upload già chiusa",
+		})
+	}
+
+	if session.ProductID != nil {
+		if err := h.productRepo.AddImage(ctx, *session.ProductID, session.FileURL); err != nil {
+			if err == repository.ErrImageLimitReached {
+				_ = h.storage.Delete(ctx, session.FileURL)
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("Massimo %d foto per annuncio", models.MaxProductImages),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Errore nel salvataggio dell'immagine",
+			})
+		}
+	}
+
+	if h.ocrService != nil && h.imageReviewRepo != nil {
+		go h.moderateImage(user.ID, session.ProductID, session.FileURL, "PRODUCT")
+	}
+	if h.duplicateDetector != nil {
+		go detectDuplicates(h.duplicateDetector, data, user.ID, session.ProductID, session.FileURL, "PRODUCT")
+	}
+
+	return c.JSON(fiber.Map{
+		"url": session.FileURL,
 	})
 }
 
+// rejectUpload deletes an object that failed validation and closes its session
+func (h *UploadHandler) rejectUpload(ctx context.Context, session *models.UploadSession, reason string) {
+	_ = h.storage.Delete(ctx, session.FileURL)
+	_ = h.sessionRepo.MarkRejected(ctx, session.ID, reason)
+}
+
 // moderateImage runs OCR on the uploaded image and queues it for review if suspicious
 func (h *UploadHandler) moderateImage(userID uuid.UUID, productID *uuid.UUID, imageURL string, imageType string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -268,6 +466,17 @@ func (h *UploadHandler) moderateImage(userID uuid.UUID, productID *uuid.UUID, im
 	}
 }
 
+// detectDuplicates hashes the image and flags it if another user uploaded the same photo
+func detectDuplicates(detector *moderation.DuplicateDetector, data []byte, userID uuid.UUID, productID *uuid.UUID, imageURL string, imageType string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := detector.Check(ctx, data, userID, productID, imageURL, imageType); err != nil {
+		// Log error but don't fail - moderation is optional
+		fmt.Printf("⚠️ Duplicate check failed for %s: %v\n", imageURL, err)
+	}
+}
+
 // UploadWithModeration uploads a file and runs moderation
 func (h *UploadHandler) UploadWithModeration(ctx context.Context, reader io.Reader, filename, contentType, folder string, userID uuid.UUID, productID *uuid.UUID, imageType string) (string, error) {
 	imageURL, err := h.storage.Upload(ctx, reader, filename, contentType, folder)
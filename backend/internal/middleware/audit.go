@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/gecogreen/backend/internal/audit"
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// Audit middleware - writes the entries recorded with audit.Record once the
+// handler has succeeded, together with the actor, IP and user agent.
+// Failed requests leave no record: the action didn't happen. The entries are
+// written after the handler's own transaction has committed: if they can't be
+// written the request fails with 500, but the change stands without its
+// record. Sensitive actions don't go through here: their repositories write
+// the records built with audit.Log in the action's transaction.
+func Audit(auditRepo *repository.AuditRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		trail := audit.Attach(c)
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() >= fiber.StatusBadRequest || len(trail.Entries()) == 0 {
+			return nil
+		}
+
+		entries := make([]*models.AuditLog, 0, len(trail.Entries()))
+		for _, e := range trail.Entries() {
+			entries = append(entries, audit.Log(c, e))
+		}
+
+		ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+		defer cancel()
+
+		if err := auditRepo.AppendAll(ctx, entries); err != nil {
+			for _, e := range entries {
+				fmt.Printf("❌ Audit log write failed (%s on %s): %v\n", e.Action, e.EntityType, err)
+			}
+			c.Response().ResetBody()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Operazione non registrata nel registro di audit: verifica l'esito prima di riprovare",
+			})
+		}
+		return nil
+	}
+}
@@ -50,16 +50,69 @@ func AuthMiddleware(jwtManager *auth.JWTManager, userRepo *repository.UserReposi
 
 		c.Locals("user", user)
 		c.Locals("userID", user.ID)
+		c.Locals("sessionID", claims.SessionID)
 		return c.Next()
 	}
 }
 
-// AdminOnly middleware - requires user to be an admin
-func AdminOnly(userRepo *repository.UserRepository) fiber.Handler {
+// OptionalAuth middleware - sets the user like AuthMiddleware when a valid access
+// token is sent, and lets anonymous requests through (public pages that show more
+// to logged-in users). An invalid token is treated as no token.
+func OptionalAuth(jwtManager *auth.JWTManager, userRepo *repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		parts := strings.Split(c.Get("Authorization"), " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return c.Next()
+		}
+
+		claims, err := jwtManager.ValidateToken(parts[1])
+		if err != nil || claims.TokenType != auth.AccessToken {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+		defer cancel()
+
+		user, err := userRepo.GetByID(ctx, claims.UserID)
+		if err != nil || !user.IsActive() {
+			return c.Next()
+		}
+
+		c.Locals("user", user)
+		c.Locals("userID", user.ID)
+		c.Locals("sessionID", claims.SessionID)
+		return c.Next()
+	}
+}
+
+// StaffOnly middleware - requires a staff role (admin, moderator, support).
+// With require2FA, staff must also have two-factor authentication enabled
+// (they log in with it, since 2FA applies to every login once enabled).
+func StaffOnly(require2FA bool) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		user := c.Locals("user").(*models.User)
-		if !user.IsAdmin {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Solo amministratori"})
+		if !user.IsStaff() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Accesso riservato allo staff"})
+		}
+		if require2FA && !user.TOTPEnabled {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Attiva l'autenticazione a due fattori per usare le funzioni di amministrazione",
+				"code":  "TWO_FACTOR_REQUIRED",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RequirePermission middleware - requires a permission granted by the user's roles
+func RequirePermission(perm models.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(*models.User)
+		if !user.Can(perm) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":      "Permesso negato",
+				"permission": perm,
+			})
 		}
 		return c.Next()
 	}
@@ -75,3 +128,17 @@ func BusinessOnly() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// VerifiedEmailOnly middleware - blocks unverified accounts when the policy is enabled
+func VerifiedEmailOnly(required bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(*models.User)
+		if required && !user.EmailVerified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Conferma il tuo indirizzo email per continuare",
+				"code":  "EMAIL_NOT_VERIFIED",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit middleware - rejects request bodies larger than limit bytes.
+// It needs fiber.Config.StreamRequestBody: the declared Content-Length is
+// checked before the body is read, chunked bodies are read up to the limit.
+// Requests for which skip returns true are let through (skip may be nil).
+func BodyLimit(limit int, skip func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if skip != nil && skip(c) {
+			return c.Next()
+		}
+
+		length := c.Request().Header.ContentLength()
+		if length > limit {
+			return bodyTooLarge(c)
+		}
+
+		// -1: chunked body of unknown size
+		if length == -1 {
+			if stream := c.Context().RequestBodyStream(); stream != nil {
+				body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Errore lettura richiesta"})
+				}
+				if len(body) > limit {
+					return bodyTooLarge(c)
+				}
+				c.Request().SetBody(body)
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// bodyTooLarge answers 413 and closes the connection, as the rest of the body is never read
+func bodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "Richiesta troppo grande"})
+}
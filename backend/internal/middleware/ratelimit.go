@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/gecogreen/backend/internal/ratelimit"
+)
+
+// RateLimit middleware - enforces a rate limit policy and sets the RateLimit-* headers.
+// Use a store that can't fail (ratelimit.FallbackStore): if it does, requests are let through.
+func RateLimit(limiter *ratelimit.Limiter, policy ratelimit.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := policy.Key(c)
+		if key == "" {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.Context(), time.Second)
+		defer cancel()
+
+		result, err := limiter.Allow(ctx, policy, key)
+		if err != nil {
+			fmt.Printf("⚠️ Rate limiter unavailable (%s): %v\n", policy.Name, err)
+			return c.Next()
+		}
+
+		reset := strconv.Itoa(ceilSeconds(result.Reset))
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", reset)
+		c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Window)))
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, reset)
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Troppe richieste, riprova più tardi"})
+		}
+
+		return c.Next()
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as the headers require
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/gecogreen/backend/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+	policy := ratelimit.Policy{Name: "test", Limit: 2, Window: time.Minute, Key: ratelimit.ByIP}
+
+	app := fiber.New()
+	app.Get("/", RateLimit(limiter, policy), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		request        int
+		wantStatus     int
+		wantRemaining  string
+		wantRetryAfter bool
+	}{
+		{1, fiber.StatusOK, "1", false},
+		{2, fiber.StatusOK, "0", false},
+		{3, fiber.StatusTooManyRequests, "0", true},
+	}
+
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatalf("request %d: %v", tt.request, err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("request %d: status=%d, want %d", tt.request, resp.StatusCode, tt.wantStatus)
+		}
+		if got := resp.Header.Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: RateLimit-Limit=%q, want 2", tt.request, got)
+		}
+		if got := resp.Header.Get("RateLimit-Remaining"); got != tt.wantRemaining {
+			t.Errorf("request %d: RateLimit-Remaining=%q, want %q", tt.request, got, tt.wantRemaining)
+		}
+		if got := resp.Header.Get("RateLimit-Policy"); got != "2;w=60" {
+			t.Errorf("request %d: RateLimit-Policy=%q, want 2;w=60", tt.request, got)
+		}
+		if hasRetry := resp.Header.Get(fiber.HeaderRetryAfter) != ""; hasRetry != tt.wantRetryAfter {
+			t.Errorf("request %d: Retry-After set=%v, want %v", tt.request, hasRetry, tt.wantRetryAfter)
+		}
+	}
+}
+
+func TestRateLimitSkipsEmptyKey(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+	policy := ratelimit.Policy{Name: "email", Limit: 1, Window: time.Minute, Key: ratelimit.ByEmail}
+
+	app := fiber.New()
+	app.Post("/", RateLimit(limiter, policy), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	// No email in the body: never counted
+	for i := 1; i <= 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("POST", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Errorf("request %d: status=%d, want 200", i, resp.StatusCode)
+		}
+	}
+}
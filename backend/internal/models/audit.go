@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions
+const (
+	AuditOrderStatusOverride = "ORDER_STATUS_OVERRIDE"
+	AuditOrderCancelOverride = "ORDER_CANCEL_OVERRIDE"
+	AuditOrderPickupOverride = "ORDER_PICKUP_OVERRIDE"
+	AuditOrderRefunded       = "ORDER_REFUNDED"
+	AuditDisputeResolved     = "DISPUTE_RESOLVED"
+	AuditReviewModerated     = "REVIEW_MODERATED"
+	AuditProductStaffUpdate  = "PRODUCT_STAFF_UPDATE"
+	AuditProductStaffDelete  = "PRODUCT_STAFF_DELETE"
+	AuditImageApproved       = "IMAGE_APPROVED"
+	AuditImageRejected       = "IMAGE_REJECTED"
+	AuditUserBanned          = "USER_BANNED"
+	AuditUserSuspended       = "USER_SUSPENDED"
+	AuditUserReactivated     = "USER_REACTIVATED"
+	AuditUserRolesChanged    = "USER_ROLES_CHANGED"
+	AuditAwardCreated        = "AWARD_CREATED"
+	AuditAwardUpdated        = "AWARD_UPDATED"
+	AuditTaskCreated         = "TASK_CREATED"
+	AuditTaskUpdated         = "TASK_UPDATED"
+	AuditTaskCompleted       = "TASK_COMPLETED"
+	AuditBillingUpdated      = "PROFILE_BILLING_UPDATED"
+	AuditAccountTypeChanged  = "ACCOUNT_TYPE_CHANGED"
+	AuditDeletionRequested   = "ACCOUNT_DELETION_REQUESTED"
+	AuditDeletionCancelled   = "ACCOUNT_DELETION_CANCELLED"
+	AuditAccountDeleted      = "ACCOUNT_DELETED"
+	AuditDataExported        = "ACCOUNT_DATA_EXPORTED"
+	AuditCategoryCreated     = "CATEGORY_CREATED"
+	AuditCategoryUpdated     = "CATEGORY_UPDATED"
+	AuditCategoryMoved       = "CATEGORY_MOVED"
+	AuditCategoriesReordered = "CATEGORIES_REORDERED"
+	AuditCategoriesMerged    = "CATEGORIES_MERGED"
+	AuditCategoryDeleted     = "CATEGORY_DELETED"
+	AuditImpactFactorSet     = "IMPACT_FACTOR_SET"
+	AuditImpactFactorCleared = "IMPACT_FACTOR_CLEARED"
+	AuditRewardCreated       = "REWARD_CREATED"
+	AuditRewardUpdated       = "REWARD_UPDATED"
+	AuditRewardDeleted       = "REWARD_DELETED"
+)
+
+// AuditLog is an append-only audit record.
+// Each record's Hash covers its content and the previous record's hash,
+// so editing or removing a record breaks the chain from that point on.
+type AuditLog struct {
+	ID         uuid.UUID       `json:"id"`
+	Seq        int64           `json:"seq"`
+	UserID     *uuid.UUID      `json:"user_id,omitempty"` // who did it
+	ActorEmail string          `json:"actor_email,omitempty"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type,omitempty"`
+	EntityID   *uuid.UUID      `json:"entity_id,omitempty"`
+	OldValue   json.RawMessage `json:"old_value,omitempty"`
+	NewValue   json.RawMessage `json:"new_value,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows an audit log search; zero values are ignored
+type AuditFilter struct {
+	Action     string
+	EntityType string
+	EntityID   *uuid.UUID
+	UserID     *uuid.UUID
+	From       *time.Time
+	To         *time.Time
+	Query      string // free text on old/new values and metadata
+	Limit      int
+	Offset     int
+}
+
+// AuditVerification is the result of checking the hash chain
+type AuditVerification struct {
+	Valid       bool   `json:"valid"`
+	Checked     int64  `json:"checked"`
+	BrokenAtSeq *int64 `json:"broken_at_seq,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
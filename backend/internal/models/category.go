@@ -0,0 +1,55 @@
+package models
+
+import "github.com/google/uuid"
+
+// MaxCategoryDepth is how many levels the category tree may have (roots are level 1)
+const MaxCategoryDepth = 3
+
+// CategoryNode is a category with its subcategories
+type CategoryNode struct {
+	Category
+	ProductCount int             `json:"product_count"` // active products in the category and below
+	Children     []*CategoryNode `json:"children"`
+}
+
+// CreateCategoryRequest adds a category at the end of its siblings
+type CreateCategoryRequest struct {
+	Name        string     `json:"name"`
+	Slug        string     `json:"slug,omitempty"` // generated from the name when empty
+	Description string     `json:"description,omitempty"`
+	Icon        string     `json:"icon,omitempty"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"` // empty for a root category
+}
+
+// UpdateCategoryRequest edits a category in place; nil fields are left unchanged
+type UpdateCategoryRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Slug        *string `json:"slug,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Icon        *string `json:"icon,omitempty"`
+	IsActive    *bool   `json:"is_active,omitempty"` // inactive categories and their children are hidden from the public tree
+}
+
+// MoveCategoryRequest moves a category, with its subtree, under another parent
+type MoveCategoryRequest struct {
+	ParentID *uuid.UUID `json:"parent_id"` // null to make it a root category
+}
+
+// ReorderCategoriesRequest sets the order of all the children of a parent
+type ReorderCategoriesRequest struct {
+	ParentID *uuid.UUID  `json:"parent_id"` // null for the root categories
+	IDs      []uuid.UUID `json:"ids"`
+}
+
+// MergeCategoriesRequest merges a category into another one
+type MergeCategoriesRequest struct {
+	TargetID uuid.UUID `json:"target_id"`
+}
+
+// CategoryMergeResult reports what a merge moved into the target category
+type CategoryMergeResult struct {
+	SourceID      uuid.UUID `json:"source_id"`
+	TargetID      uuid.UUID `json:"target_id"`
+	ProductsMoved int64     `json:"products_moved"`
+	ChildrenMoved int64     `json:"children_moved"`
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImpactFactor is a version of the impact avoided by saving one typical item of a
+// category, which weighs ReferenceKg (kg, or litres for liquids). A nil CategoryID
+// is the platform default, used by categories without a factor of their own or
+// of an ancestor.
+type ImpactFactor struct {
+	ID           uuid.UUID  `json:"id"`
+	CategoryID   *uuid.UUID `json:"category_id,omitempty"`
+	Version      int        `json:"version"`
+	CO2Kg        float64    `json:"co2_kg"`
+	WaterL       float64    `json:"water_l"`
+	WasteKg      float64    `json:"waste_kg"`
+	ReferenceKg  float64    `json:"reference_kg"`
+	Note         string     `json:"note,omitempty"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SupersededAt *time.Time `json:"superseded_at,omitempty"` // nil for the version in use
+}
+
+// Impact is the environmental impact avoided by an order
+type Impact struct {
+	CO2Kg   float64 `json:"co2_kg"`
+	WaterL  float64 `json:"water_l"`
+	WasteKg float64 `json:"waste_kg"`
+}
+
+// Scale returns the impact of quantity units of a product. Pieces (and custom
+// units) count as typical items; weights and volumes are divided by ReferenceKg.
+func (f *ImpactFactor) Scale(quantity float64, unit QuantityUnit) Impact {
+	items := quantity
+	if f.ReferenceKg > 0 {
+		switch unit {
+		case QuantityUnitKG, QuantityUnitL:
+			items = quantity / f.ReferenceKg
+		case QuantityUnitG, QuantityUnitML:
+			items = quantity / 1000 / f.ReferenceKg
+		}
+	}
+	return Impact{
+		CO2Kg:   roundImpact(f.CO2Kg * items),
+		WaterL:  roundImpact(f.WaterL * items),
+		WasteKg: roundImpact(f.WasteKg * items),
+	}
+}
+
+// roundImpact rounds to the 2 decimals stored by orders and impact_logs
+func roundImpact(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// CategoryImpactFactor is a category with the factor it uses, which may be
+// inherited from an ancestor or the platform default
+type CategoryImpactFactor struct {
+	CategoryID   *uuid.UUID    `json:"category_id,omitempty"` // nil for the platform default
+	CategoryName string        `json:"category_name,omitempty"`
+	ParentID     *uuid.UUID    `json:"parent_id,omitempty"`
+	Factor       *ImpactFactor `json:"factor"`
+	Inherited    bool          `json:"inherited"` // Factor belongs to an ancestor or the default
+}
+
+// SetImpactFactorRequest creates a new version of a category's factor
+type SetImpactFactorRequest struct {
+	CO2Kg       float64  `json:"co2_kg"`
+	WaterL      float64  `json:"water_l"`
+	WasteKg     float64  `json:"waste_kg"`
+	ReferenceKg *float64 `json:"reference_kg,omitempty"` // defaults to 1
+	Note        string   `json:"note,omitempty"`
+}
+
+// EcoCredits bonuses posted with a completed order (docs/07_IMPACT_SYSTEM.md)
+const (
+	FirstPurchaseBonus  = 100
+	FirstSaleBonus      = 100
+	PickupBonus         = 50
+	LastChanceBonusRate = 0.30
+	LastChanceWindow    = 24 * time.Hour
+)
+
+// OrderPosting is a completed order as seen by the impact ledger
+type OrderPosting struct {
+	OrderID          uuid.UUID
+	BuyerID          uuid.UUID
+	SellerID         uuid.UUID
+	ProductTitle     string
+	DeliveryType     DeliveryType
+	CO2Saved         float64
+	WaterSaved       float64
+	WasteSaved       float64
+	EcoCreditsBuyer  int
+	EcoCreditsSeller int
+	OrderedAt        time.Time
+	ExpiryDate       *time.Time // product expiry date, if any
+	FirstPurchase    bool       // the buyer has no other purchase posted
+	FirstSale        bool       // the seller has no other sale posted
+}
+
+// Entries returns the impact_logs entries of the order: the buyer's PURCHASE and
+// the seller's SALE, both carrying the order impact, then the bonuses that apply
+func (p *OrderPosting) Entries() []ImpactLog {
+	orderID := p.OrderID
+	entry := func(userID uuid.UUID, action ImpactActionType, credits int, description string) ImpactLog {
+		return ImpactLog{
+			UserID:           userID,
+			OrderID:          &orderID,
+			ActionType:       action,
+			EcoCreditsEarned: credits,
+			Description:      description,
+		}
+	}
+
+	purchase := entry(p.BuyerID, ImpactPurchase, p.EcoCreditsBuyer, "Acquisto: "+p.ProductTitle)
+	sale := entry(p.SellerID, ImpactSale, p.EcoCreditsSeller, "Vendita: "+p.ProductTitle)
+	for _, e := range []*ImpactLog{&purchase, &sale} {
+		e.CO2Saved, e.WaterSaved, e.WasteSaved = p.CO2Saved, p.WaterSaved, p.WasteSaved
+	}
+	entries := []ImpactLog{purchase, sale}
+
+	if p.FirstPurchase {
+		entries = append(entries, entry(p.BuyerID, ImpactFirstPurchase, FirstPurchaseBonus, "Bonus primo acquisto"))
+	}
+	if p.DeliveryType == DeliveryPickup {
+		entries = append(entries, entry(p.BuyerID, ImpactPickupBonus, PickupBonus, "Bonus ritiro a mano"))
+	}
+	if p.IsLastChance() {
+		bonus := int(math.Round(float64(p.EcoCreditsBuyer) * LastChanceBonusRate))
+		if bonus > 0 {
+			entries = append(entries, entry(p.BuyerID, ImpactLastChanceBonus, bonus, "Bonus Last Chance"))
+		}
+	}
+	if p.FirstSale {
+		entries = append(entries, entry(p.SellerID, ImpactFirstSale, FirstSaleBonus, "Bonus prima vendita"))
+	}
+	return entries
+}
+
+// IsLastChance reports whether the product was ordered less than
+// LastChanceWindow before the end of its expiry day
+func (p *OrderPosting) IsLastChance() bool {
+	if p.ExpiryDate == nil {
+		return false
+	}
+	endOfDay := p.ExpiryDate.AddDate(0, 0, 1)
+	left := endOfDay.Sub(p.OrderedAt)
+	return left > 0 && left <= LastChanceWindow
+}
+
+// Reversal returns the entry that cancels l after a refund: impact negated,
+// credits earned taken back (and credits spent given back)
+func (l *ImpactLog) Reversal() ImpactLog {
+	id := l.ID
+	return ImpactLog{
+		UserID:           l.UserID,
+		OrderID:          l.OrderID,
+		ActionType:       ImpactOrderReversal,
+		CO2Saved:         -l.CO2Saved,
+		WaterSaved:       -l.WaterSaved,
+		WasteSaved:       -l.WasteSaved,
+		EcoCreditsEarned: l.EcoCreditsSpent,
+		EcoCreditsSpent:  l.EcoCreditsEarned,
+		Description:      "Storno per rimborso: " + l.Description,
+		ReversesID:       &id,
+	}
+}
+
+// CreditDrift is a user whose cached EcoCredits balance (users.eco_credits)
+// differs from the ledger (the sum of their impact_logs)
+type CreditDrift struct {
+	UserID          uuid.UUID `json:"user_id"`
+	Email           string    `json:"email"`
+	FirstName       string    `json:"first_name"`
+	LastName        string    `json:"last_name"`
+	LedgerBalance   int       `json:"ledger_balance"`
+	StoredBalance   int       `json:"stored_balance"`
+	Drift           int       `json:"drift"` // stored - ledger
+	FirstDetectedAt time.Time `json:"first_detected_at"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// CreditExpiration is the amount of a user's EcoCredits expiring on a day
+type CreditExpiration struct {
+	ExpiresOn time.Time `json:"expires_on"`
+	Credits   int       `json:"credits"`
+}
+
+// CreditExpiryNotice is a user to warn about credits about to expire; the
+// oldest of them was earned at EarnedAt
+type CreditExpiryNotice struct {
+	UserID    uuid.UUID
+	Email     string
+	FirstName string
+	Credits   int
+	EarnedAt  time.Time
+}
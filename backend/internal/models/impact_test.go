@@ -0,0 +1,213 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestImpactFactorScale(t *testing.T) {
+	perItem := ImpactFactor{CO2Kg: 2, WaterL: 100, WasteKg: 0.5}
+	perHalfKg := ImpactFactor{CO2Kg: 2, WaterL: 100, WasteKg: 0.5, ReferenceKg: 0.5}
+
+	tests := []struct {
+		name     string
+		factor   ImpactFactor
+		quantity float64
+		unit     QuantityUnit
+		want     Impact
+	}{
+		{"pieces", perHalfKg, 3, QuantityUnitPiece, Impact{CO2Kg: 6, WaterL: 300, WasteKg: 1.5}},
+		{"custom unit counts as items", perHalfKg, 2, QuantityUnitCustom, Impact{CO2Kg: 4, WaterL: 200, WasteKg: 1}},
+		{"kilograms", perHalfKg, 2, QuantityUnitKG, Impact{CO2Kg: 8, WaterL: 400, WasteKg: 2}},
+		{"litres", perHalfKg, 1.5, QuantityUnitL, Impact{CO2Kg: 6, WaterL: 300, WasteKg: 1.5}},
+		{"grams", perHalfKg, 250, QuantityUnitG, Impact{CO2Kg: 1, WaterL: 50, WasteKg: 0.25}},
+		{"millilitres", perHalfKg, 750, QuantityUnitML, Impact{CO2Kg: 3, WaterL: 150, WasteKg: 0.75}},
+		{"no reference weight", perItem, 2, QuantityUnitKG, Impact{CO2Kg: 4, WaterL: 200, WasteKg: 1}},
+		{"no reference weight, grams", perItem, 500, QuantityUnitG, Impact{CO2Kg: 1000, WaterL: 50000, WasteKg: 250}},
+		{"rounded to two decimals", ImpactFactor{CO2Kg: 1, WaterL: 1, WasteKg: 1, ReferenceKg: 3}, 1, QuantityUnitKG, Impact{CO2Kg: 0.33, WaterL: 0.33, WasteKg: 0.33}},
+		{"zero quantity", perHalfKg, 0, QuantityUnitKG, Impact{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.factor.Scale(tt.quantity, tt.unit); got != tt.want {
+				t.Errorf("Scale(%v, %s) = %+v, want %+v", tt.quantity, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderPostingIsLastChance(t *testing.T) {
+	expiry := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiry    *time.Time
+		orderedAt time.Time
+		want      bool
+	}{
+		{"no expiry date", nil, expiry, false},
+		{"two days before", &expiry, expiry.Add(-48 * time.Hour), false},
+		{"just outside the window", &expiry, expiry.Add(-time.Second), false},
+		{"start of the expiry day", &expiry, expiry, true},
+		{"last second of the expiry day", &expiry, expiry.Add(24*time.Hour - time.Second), true},
+		{"after the expiry day", &expiry, expiry.Add(24 * time.Hour), false},
+		{"already expired", &expiry, expiry.Add(72 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := OrderPosting{ExpiryDate: tt.expiry, OrderedAt: tt.orderedAt}
+			if got := p.IsLastChance(); got != tt.want {
+				t.Errorf("IsLastChance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderPostingEntries(t *testing.T) {
+	buyer, seller := uuid.New(), uuid.New()
+	expiry := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	lastChance := expiry.Add(12 * time.Hour)
+	early := expiry.Add(-72 * time.Hour)
+
+	type entry struct {
+		user    uuid.UUID
+		action  ImpactActionType
+		credits int
+	}
+	base := []entry{
+		{buyer, ImpactPurchase, 25},
+		{seller, ImpactSale, 10},
+	}
+
+	tests := []struct {
+		name          string
+		firstPurchase bool
+		firstSale     bool
+		delivery      DeliveryType
+		orderedAt     time.Time
+		creditsBuyer  int
+		want          []entry
+	}{
+		{
+			name: "no bonus", delivery: DeliverySellerShips, orderedAt: early, creditsBuyer: 25,
+			want: base,
+		},
+		{
+			name: "first purchase", firstPurchase: true, delivery: DeliverySellerShips, orderedAt: early, creditsBuyer: 25,
+			want: append(base[:2:2], entry{buyer, ImpactFirstPurchase, FirstPurchaseBonus}),
+		},
+		{
+			name: "pickup", delivery: DeliveryPickup, orderedAt: early, creditsBuyer: 25,
+			want: append(base[:2:2], entry{buyer, ImpactPickupBonus, PickupBonus}),
+		},
+		{
+			name: "last chance", delivery: DeliveryBuyerArranges, orderedAt: lastChance, creditsBuyer: 25,
+			want: append(base[:2:2], entry{buyer, ImpactLastChanceBonus, 8}),
+		},
+		{
+			name: "last chance with no buyer credits", delivery: DeliverySellerShips, orderedAt: lastChance, creditsBuyer: 1,
+			want: []entry{{buyer, ImpactPurchase, 1}, {seller, ImpactSale, 10}},
+		},
+		{
+			name: "first sale", firstSale: true, delivery: DeliverySellerShips, orderedAt: early, creditsBuyer: 25,
+			want: append(base[:2:2], entry{seller, ImpactFirstSale, FirstSaleBonus}),
+		},
+		{
+			name: "every bonus", firstPurchase: true, firstSale: true, delivery: DeliveryPickup, orderedAt: lastChance, creditsBuyer: 25,
+			want: append(base[:2:2],
+				entry{buyer, ImpactFirstPurchase, FirstPurchaseBonus},
+				entry{buyer, ImpactPickupBonus, PickupBonus},
+				entry{buyer, ImpactLastChanceBonus, 8},
+				entry{seller, ImpactFirstSale, FirstSaleBonus},
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := OrderPosting{
+				OrderID:          uuid.New(),
+				BuyerID:          buyer,
+				SellerID:         seller,
+				ProductTitle:     "Pane",
+				DeliveryType:     tt.delivery,
+				CO2Saved:         1.5,
+				WaterSaved:       20,
+				WasteSaved:       0.4,
+				EcoCreditsBuyer:  tt.creditsBuyer,
+				EcoCreditsSeller: 10,
+				OrderedAt:        tt.orderedAt,
+				ExpiryDate:       &expiry,
+				FirstPurchase:    tt.firstPurchase,
+				FirstSale:        tt.firstSale,
+			}
+
+			entries := p.Entries()
+			got := make([]entry, len(entries))
+			for i, e := range entries {
+				got[i] = entry{e.UserID, e.ActionType, e.EcoCreditsEarned}
+				if e.OrderID == nil || *e.OrderID != p.OrderID {
+					t.Errorf("entry %d (%s): order_id = %v, want %s", i, e.ActionType, e.OrderID, p.OrderID)
+				}
+				if e.EcoCreditsSpent != 0 {
+					t.Errorf("entry %d (%s): credits spent = %d, want 0", i, e.ActionType, e.EcoCreditsSpent)
+				}
+
+				// Only the PURCHASE and SALE entries carry the order impact
+				carriesImpact := e.ActionType == ImpactPurchase || e.ActionType == ImpactSale
+				hasImpact := e.CO2Saved == p.CO2Saved && e.WaterSaved == p.WaterSaved && e.WasteSaved == p.WasteSaved
+				noImpact := e.CO2Saved == 0 && e.WaterSaved == 0 && e.WasteSaved == 0
+				if (carriesImpact && !hasImpact) || (!carriesImpact && !noImpact) {
+					t.Errorf("entry %d (%s): impact = %v/%v/%v", i, e.ActionType, e.CO2Saved, e.WaterSaved, e.WasteSaved)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Entries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImpactLogReversal(t *testing.T) {
+	orderID := uuid.New()
+
+	tests := []struct {
+		name string
+		log  ImpactLog
+	}{
+		{"earned credits", ImpactLog{ActionType: ImpactPurchase, CO2Saved: 1.5, WaterSaved: 20, WasteSaved: 0.4, EcoCreditsEarned: 25}},
+		{"spent credits", ImpactLog{ActionType: ImpactRedeemBoost, EcoCreditsSpent: 300}},
+		{"bonus without impact", ImpactLog{ActionType: ImpactFirstPurchase, EcoCreditsEarned: FirstPurchaseBonus}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.log
+			l.ID, l.UserID, l.OrderID, l.Description = uuid.New(), uuid.New(), &orderID, "Acquisto: Pane"
+
+			r := l.Reversal()
+			if r.ActionType != ImpactOrderReversal {
+				t.Errorf("action = %s, want %s", r.ActionType, ImpactOrderReversal)
+			}
+			if r.ReversesID == nil || *r.ReversesID != l.ID {
+				t.Errorf("reverses_id = %v, want %s", r.ReversesID, l.ID)
+			}
+			if r.UserID != l.UserID || r.OrderID != l.OrderID {
+				t.Errorf("user/order = %s/%v, want %s/%v", r.UserID, r.OrderID, l.UserID, l.OrderID)
+			}
+			if r.CO2Saved+l.CO2Saved != 0 || r.WaterSaved+l.WaterSaved != 0 || r.WasteSaved+l.WasteSaved != 0 {
+				t.Errorf("impact = %v/%v/%v, want the negation of %v/%v/%v",
+					r.CO2Saved, r.WaterSaved, r.WasteSaved, l.CO2Saved, l.WaterSaved, l.WasteSaved)
+			}
+			if r.EcoCreditsEarned != l.EcoCreditsSpent || r.EcoCreditsSpent != l.EcoCreditsEarned {
+				t.Errorf("credits earned/spent = %d/%d, want %d/%d",
+					r.EcoCreditsEarned, r.EcoCreditsSpent, l.EcoCreditsSpent, l.EcoCreditsEarned)
+			}
+		})
+	}
+}
@@ -181,6 +181,9 @@ const (
 	ImpactRedeemBadge     ImpactActionType = "REDEEM_BADGE"
 	ImpactPointsExpired   ImpactActionType = "POINTS_EXPIRED"
 	ImpactAdminAdjustment ImpactActionType = "ADMIN_ADJUSTMENT"
+	ImpactOrderReversal   ImpactActionType = "ORDER_REVERSAL"
+
+	ImpactRedeemCommissionWaiver ImpactActionType = "REDEEM_COMMISSION_WAIVER"
 )
 
 // ImpactLog represents a log entry for impact/credits
@@ -191,10 +194,12 @@ type ImpactLog struct {
 	ActionType        ImpactActionType `json:"action_type"`
 	CO2Saved          float64          `json:"co2_saved"`
 	WaterSaved        float64          `json:"water_saved"`
+	WasteSaved        float64          `json:"waste_saved"`
 	EcoCreditsEarned  int              `json:"eco_credits_earned"`
 	EcoCreditsSpent   int              `json:"eco_credits_spent"`
 	EcoCreditsBalance int              `json:"eco_credits_balance"`
 	Description       string           `json:"description,omitempty"`
+	ReversesID        *uuid.UUID       `json:"reverses_id,omitempty"` // entry negated by an ORDER_REVERSAL
 	CreatedAt         time.Time        `json:"created_at"`
 }
 
@@ -214,7 +219,9 @@ type HallOfFame struct {
 type CommunityStats struct {
 	TotalCO2Saved    float64 `json:"total_co2_saved"`
 	TotalWaterSaved  float64 `json:"total_water_saved"`
+	TotalWasteSaved  float64 `json:"total_waste_saved"`
 	TotalTreesPlanted int    `json:"total_trees_planted"`
+	TreesTarget      int     `json:"trees_target"` // next community milestone
 	TotalProducts    int     `json:"total_products_saved"`
 	TotalUsers       int     `json:"total_users"`
 }
@@ -276,14 +283,15 @@ type TaskStats struct {
 }
 
 type RedeemRequest struct {
-	RewardType string `json:"reward_type" validate:"required"` // "BOOST_24H", "BOOST_7D", "TREE", "TOP_CATEGORY", "BADGE"
-	ProductID  *uuid.UUID `json:"product_id,omitempty"` // For boosts
+	RewardID   *uuid.UUID `json:"reward_id,omitempty"`
+	RewardType string     `json:"reward_type,omitempty"` // catalogue code, e.g. "BOOST_24H" (when reward_id is not set)
+	ProductID  *uuid.UUID `json:"product_id,omitempty"`  // For boosts
 }
 
 type RedeemResponse struct {
-	Success         bool   `json:"success"`
-	Message         string `json:"message"`
-	CreditsSpent    int    `json:"credits_spent"`
-	NewBalance      int    `json:"new_balance"`
-	TreeCertURL     string `json:"tree_certificate_url,omitempty"`
+	Success         bool            `json:"success"`
+	Message         string          `json:"message"`
+	CreditsSpent    int             `json:"credits_spent"`
+	NewBalance      int             `json:"new_balance"`
+	Reward          *RedeemedReward `json:"reward,omitempty"`
 }
@@ -60,6 +60,16 @@ const (
 	DisputeClosed                DisputeStatus = "CLOSED"
 )
 
+// IsFinal reports whether the dispute has been resolved or closed by staff
+func (s DisputeStatus) IsFinal() bool {
+	switch s {
+	case DisputeResolvedRefundFull, DisputeResolvedRefundPartial, DisputeResolvedPayoutSeller,
+		DisputeResolvedSplit, DisputeClosed:
+		return true
+	}
+	return false
+}
+
 // Order represents a complete order
 type Order struct {
 	ID        uuid.UUID `json:"id"`
@@ -78,6 +88,8 @@ type Order struct {
 	StripeFee    float64 `json:"stripe_fee"`
 	SellerPayout float64 `json:"seller_payout"`
 
+	PlatformFeeWaived float64 `json:"platform_fee_waived,omitempty"` // covered by a COMMISSION_WAIVER reward
+
 	// Status
 	Status       OrderStatus  `json:"status"`
 	DeliveryType DeliveryType `json:"delivery_type"`
@@ -116,10 +128,13 @@ type Order struct {
 	PayoutHoldReason  string     `json:"payout_hold_reason,omitempty"`
 
 	// Impact
-	CO2Saved         float64 `json:"co2_saved"`
-	WaterSaved       float64 `json:"water_saved"`
-	EcoCreditsBuyer  int     `json:"eco_credits_buyer"`
-	EcoCreditsSeller int     `json:"eco_credits_seller"`
+	CO2Saved            float64    `json:"co2_saved"`
+	WaterSaved          float64    `json:"water_saved"`
+	WasteSaved          float64    `json:"waste_saved"`
+	ImpactFactorID      *uuid.UUID `json:"impact_factor_id,omitempty"`      // factor version the impact was computed with
+	ImpactFactorVersion int        `json:"impact_factor_version,omitempty"`
+	EcoCreditsBuyer     int        `json:"eco_credits_buyer"`
+	EcoCreditsSeller    int        `json:"eco_credits_seller"`
 
 	// Notes
 	BuyerNotes    string `json:"buyer_notes,omitempty"`
@@ -175,6 +190,35 @@ type Dispute struct {
 
 	SellerResponseDeadline *time.Time `json:"seller_response_deadline,omitempty"`
 	AdminReviewDeadline    *time.Time `json:"admin_review_deadline,omitempty"`
+
+	// Uploaded evidence with signed URLs (filled by the handler)
+	Evidence []DisputeEvidence `json:"evidence,omitempty"`
+}
+
+// Evidence limits per party
+const (
+	MaxEvidencePhotos          = 5
+	MaxEvidenceVideos          = 1
+	EvidenceVideoMinOrderTotal = 200.0            // video allowed only above this order total (€)
+	MaxEvidenceVideoSize       = 50 * 1024 * 1024 // 50MB
+)
+
+// DisputeEvidence is a privately stored file attached to a dispute
+type DisputeEvidence struct {
+	ID          uuid.UUID  `json:"id"`
+	OrderID     uuid.UUID  `json:"order_id"`
+	DisputeID   *uuid.UUID `json:"dispute_id,omitempty"`
+	UploadedBy  uuid.UUID  `json:"uploaded_by"`
+	Party       string     `json:"party"`      // BUYER, SELLER
+	MediaType   string     `json:"media_type"` // PHOTO, VIDEO
+	StorageKey  string     `json:"-"`
+	ContentType string     `json:"content_type"`
+	SizeBytes   int64      `json:"size_bytes"`
+	SHA256      string     `json:"sha256"`
+	UploadedAt  time.Time  `json:"uploaded_at"`
+
+	// Short-lived signed URL, never stored
+	URL string `json:"url,omitempty"`
 }
 
 // OrderReview represents a review for an order
@@ -188,6 +232,10 @@ type OrderReview struct {
 	Comment     string `json:"comment,omitempty"`
 	IsAnonymous bool   `json:"is_anonymous"`
 
+	// Moderation (staff only)
+	IsApproved      *bool  `json:"is_approved,omitempty"`
+	ModerationNotes string `json:"moderation_notes,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 
 	// Joined
@@ -260,17 +308,31 @@ type ConfirmPickupRequest struct {
 	QRCodeToken string `json:"qr_code_token" validate:"required"`
 }
 
-// OpenDisputeRequest for opening a dispute
+// OpenDisputeRequest for opening a dispute.
+// Evidence is uploaded beforehand via POST /orders/:id/dispute/evidence
+// and attached automatically.
 type OpenDisputeRequest struct {
 	Reason      DisputeReason `json:"reason" validate:"required"`
 	Description string        `json:"description" validate:"required,min=50"`
-	EvidenceURLs []string     `json:"evidence_urls,omitempty"`
 }
 
 // RespondDisputeRequest for seller response
 type RespondDisputeRequest struct {
-	Response     string   `json:"response" validate:"required,min=50"`
-	EvidenceURLs []string `json:"evidence_urls,omitempty"`
+	Response string `json:"response" validate:"required,min=50"`
+}
+
+// ResolveDisputeRequest for staff closing a dispute
+type ResolveDisputeRequest struct {
+	Status             DisputeStatus `json:"status" validate:"required"`
+	ResolutionNotes    string        `json:"resolution_notes" validate:"required"`
+	RefundAmount       float64       `json:"refund_amount,omitempty"`        // RESOLVED_REFUND_PARTIAL, RESOLVED_SPLIT
+	SellerPayoutAmount float64       `json:"seller_payout_amount,omitempty"` // RESOLVED_SPLIT
+}
+
+// ModerateReviewRequest for staff hiding or restoring an order review
+type ModerateReviewRequest struct {
+	Approved bool   `json:"approved"`
+	Notes    string `json:"notes,omitempty"`
 }
 
 // CreateReviewRequest for leaving a review
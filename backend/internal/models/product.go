@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/geo"
 )
 
 // ProductStatus represents the status of a product (matches DB enum)
@@ -17,6 +19,12 @@ const (
 	ProductStatusDeleted ProductStatus = "DELETED"
 )
 
+// Photo limits per listing (see docs/03_USER_FLOWS.md)
+const (
+	MinProductImages = 3  // required before a listing can go ACTIVE
+	MaxProductImages = 10 // hard cap on the gallery size
+)
+
 // ListingType represents the type of listing (matches DB enum)
 type ListingType string
 
@@ -103,16 +111,39 @@ type Product struct {
 	// Relations (populated when needed)
 	Seller   *UserProfile `json:"seller,omitempty"`
 	Category *Category    `json:"category,omitempty"`
+
+	// Set in search results
+	Highlight  *ProductHighlight `json:"highlight,omitempty"`
+	DistanceKm *float64          `json:"distance_km,omitempty"` // from the lat/lng filter
+	Boosted    bool              `json:"boosted,omitempty"`     // visibility boost redeemed with EcoCredits
+}
+
+// ProductHighlight shows why a product matched a search. Title and Description are
+// HTML-escaped with <mark> around the matched words, empty when nothing matched
+// exactly (typo-tolerant matches).
+type ProductHighlight struct {
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Rank        float64 `json:"rank"`
 }
 
+// Sort options that need a filter (ProductFilters.SortBy): relevance orders search
+// results by rank, distance orders by distance from lat/lng
+const (
+	SortRelevance = "relevance"
+	SortDistance  = "distance"
+)
+
 // Category represents a product category
 type Category struct {
-	ID        uuid.UUID  `json:"id"`
-	Name      string     `json:"name"`
-	Slug      string     `json:"slug"`
-	Icon      string     `json:"icon,omitempty"`
-	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
-	SortOrder int        `json:"sort_order"`
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Slug        string     `json:"slug"`
+	Description string     `json:"description,omitempty"`
+	Icon        string     `json:"icon,omitempty"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"`
+	SortOrder   int        `json:"sort_order"` // position among siblings
+	IsActive    bool       `json:"is_active"`
 }
 
 // CreateProductRequest represents a request to create a product
@@ -155,31 +186,119 @@ type UpdateProductRequest struct {
 	ShippingCost       *float64        `json:"shipping_cost,omitempty"`
 }
 
+// ReorderImagesRequest sets the full gallery order (first image is the cover)
+type ReorderImagesRequest struct {
+	Images []string `json:"images"`
+}
+
+// ProductImageRequest identifies one image of the gallery
+type ProductImageRequest struct {
+	URL string `json:"url"`
+}
+
 // ProductListResponse represents a paginated list of products
 type ProductListResponse struct {
-	Products   []Product `json:"products"`
-	Total      int       `json:"total"`
-	Page       int       `json:"page"`
-	PerPage    int       `json:"per_page"`
-	TotalPages int       `json:"total_pages"`
+	Products   []Product               `json:"products"`
+	Total      int                     `json:"total"`
+	Page       int                     `json:"page"`
+	PerPage    int                     `json:"per_page"`
+	TotalPages int                     `json:"total_pages"`
+	Facets     map[string][]FacetValue `json:"facets,omitempty"` // only with ?facets=
+}
+
+// ProductMapResponse is the map view of a viewport
+type ProductMapResponse struct {
+	Zoom      int          `json:"zoom"`
+	Total     int          `json:"total"`
+	Clusters  []MapCluster `json:"clusters"`
+	Truncated bool         `json:"truncated"` // more clusters than returned: zoom in
+}
+
+// MapCluster groups the products in a cell of the map grid, placed at their
+// average position. A cluster of one carries the product, to show it as a pin.
+type MapCluster struct {
+	Lat     float64     `json:"lat"`
+	Lng     float64     `json:"lng"`
+	Count   int         `json:"count"`
+	Product *MapProduct `json:"product,omitempty"`
+}
+
+// MapProduct is the summary shown on a map pin
+type MapProduct struct {
+	ID          uuid.UUID   `json:"id"`
+	Title       string      `json:"title"`
+	Price       float64     `json:"price"`
+	ListingType ListingType `json:"listing_type"`
+	Image       string      `json:"image,omitempty"`
+}
+
+// Facets the product listing can count, each under the other active filters
+const (
+	FacetCategory       = "category"
+	FacetProvince       = "province"
+	FacetListingType    = "listing_type"
+	FacetShippingMethod = "shipping_method"
+	FacetPrice          = "price"
+)
+
+// Facets lists every facet, in the order they are returned
+var Facets = []string{FacetCategory, FacetProvince, FacetListingType, FacetShippingMethod, FacetPrice}
+
+// FacetValue is one value of a facet with the number of matching products
+type FacetValue struct {
+	Value string   `json:"value"`
+	Label string   `json:"label,omitempty"` // category name
+	Count int      `json:"count"`
+	Min   *float64 `json:"min,omitempty"` // price buckets: min_price/max_price to filter on it
+	Max   *float64 `json:"max,omitempty"`
+}
+
+// WithoutFacet drops the filter a facet counts, so its values are counted
+// as if the user hadn't picked one yet. Pagination and sorting are cleared too.
+func (f ProductFilters) WithoutFacet(facet string) ProductFilters {
+	switch facet {
+	case FacetCategory:
+		f.CategoryID = nil
+	case FacetProvince:
+		f.Province = nil
+	case FacetListingType:
+		f.ListingType = nil
+	case FacetShippingMethod:
+		f.ShippingMethod = nil
+	case FacetPrice:
+		f.MinPrice, f.MaxPrice = nil, nil
+	}
+	f.Page, f.PerPage, f.SortBy, f.SortOrder = 0, 0, "", ""
+	return f
+}
+
+// GeocodeTarget is a seller location or product still waiting for coordinates
+type GeocodeTarget struct {
+	ID      uuid.UUID
+	Address geo.Address
 }
 
 // ProductFilters represents filters for product listing
 type ProductFilters struct {
-	CategoryID  *uuid.UUID
-	SellerID    *uuid.UUID
-	ListingType *ListingType
-	MinPrice    *float64
-	MaxPrice    *float64
-	City        *string
-	Province    *string
-	Region      *string
-	Status      *ProductStatus
-	Search      *string
-	Page        int
-	PerPage     int
-	SortBy      string
-	SortOrder   string
+	CategoryID     *uuid.UUID
+	SellerID       *uuid.UUID
+	ListingType    *ListingType
+	ShippingMethod *ShippingMethod
+	MinPrice       *float64
+	MaxPrice       *float64
+	City           *string
+	Province       *string
+	Region         *string
+	Status         *ProductStatus
+	Search         *string
+	Lat            *float64 // with Lng: only products within RadiusKm
+	Lng            *float64
+	RadiusKm       float64
+	Bounds         *geo.Box // map viewport
+	Page           int
+	PerPage        int
+	SortBy         string
+	SortOrder      string
 }
 
 // GetCurrentPrice calculates the current price considering Dutch Auction
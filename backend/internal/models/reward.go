@@ -0,0 +1,146 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RewardType selects how a reward is fulfilled
+type RewardType string
+
+const (
+	RewardVisibilityBoost  RewardType = "VISIBILITY_BOOST"  // product ranks first in listings
+	RewardTopCategory      RewardType = "TOP_CATEGORY"      // product ranks first in its category
+	RewardBadge            RewardType = "BADGE"             // badge on the profile
+	RewardCommissionWaiver RewardType = "COMMISSION_WAIVER" // no platform fee on the next sale
+	RewardTreeDonation     RewardType = "TREE_DONATION"     // a tree planted by a partner
+)
+
+// RewardTypes lists the reward types, in catalogue order
+var RewardTypes = []RewardType{
+	RewardVisibilityBoost, RewardTopCategory, RewardBadge, RewardCommissionWaiver, RewardTreeDonation,
+}
+
+// IsValid reports whether t is a known reward type
+func (t RewardType) IsValid() bool {
+	for _, known := range RewardTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsProduct reports whether redeeming the reward applies it to a product
+func (t RewardType) NeedsProduct() bool {
+	return t == RewardVisibilityBoost || t == RewardTopCategory
+}
+
+// ActionType is the ledger action of a redemption
+func (t RewardType) ActionType() ImpactActionType {
+	switch t {
+	case RewardBadge:
+		return ImpactRedeemBadge
+	case RewardTreeDonation:
+		return ImpactRedeemTree
+	case RewardCommissionWaiver:
+		return ImpactRedeemCommissionWaiver
+	default:
+		return ImpactRedeemBoost
+	}
+}
+
+// RewardConfig holds the parameters of a reward (eco_rewards.config); each
+// type uses its own fields
+type RewardConfig struct {
+	DurationHours int      `json:"duration_hours,omitempty"` // VISIBILITY_BOOST, TOP_CATEGORY
+	BadgeName     string   `json:"badge_name,omitempty"`     // BADGE
+	BadgeIcon     string   `json:"badge_icon,omitempty"`     // BADGE
+	MaxAmount     *float64 `json:"max_amount,omitempty"`     // COMMISSION_WAIVER: max fee waived (nil = whole fee)
+	ValidDays     int      `json:"valid_days,omitempty"`     // COMMISSION_WAIVER: 0 = no expiry
+	TreeCount     int      `json:"tree_count,omitempty"`     // TREE_DONATION
+}
+
+// EcoReward is a reward of the catalogue
+type EcoReward struct {
+	ID          uuid.UUID    `json:"id"`
+	Code        string       `json:"code"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Icon        string       `json:"icon,omitempty"`
+	Cost        int          `json:"eco_credits_cost"`
+	RewardType  RewardType   `json:"reward_type"`
+	Config      RewardConfig `json:"config"`
+	IsActive    bool         `json:"is_active"`
+	Stock       *int         `json:"stock,omitempty"` // nil = unlimited
+	SortOrder   int          `json:"sort_order"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// RedeemedRewardStatus is the state of a redemption
+type RedeemedRewardStatus string
+
+const (
+	RedeemedPending RedeemedRewardStatus = "PENDING" // awaiting fulfilment (tree donations)
+	RedeemedActive  RedeemedRewardStatus = "ACTIVE"  // in effect until ExpiresAt (a waiver may be reserved by a pending order)
+	RedeemedUsed    RedeemedRewardStatus = "USED"    // commission waiver applied to a paid order, tree planted
+	RedeemedExpired RedeemedRewardStatus = "EXPIRED"
+)
+
+// RedeemedReward is a reward redeemed by a user
+type RedeemedReward struct {
+	ID               uuid.UUID            `json:"id"`
+	UserID           uuid.UUID            `json:"user_id"`
+	RewardID         uuid.UUID            `json:"reward_id"`
+	Code             string               `json:"code"`
+	Name             string               `json:"name"`
+	Icon             string               `json:"icon,omitempty"`
+	RewardType       RewardType           `json:"reward_type"`
+	Config           RewardConfig         `json:"config"`
+	EcoCreditsSpent  int                  `json:"eco_credits_spent"`
+	Status           RedeemedRewardStatus `json:"status"`
+	ProductID        *uuid.UUID           `json:"product_id,omitempty"`
+	AppliedToOrderID *uuid.UUID           `json:"applied_to_order_id,omitempty"`
+	ExpiresAt        *time.Time           `json:"expires_at,omitempty"`
+	UsedAt           *time.Time           `json:"used_at,omitempty"`
+	CertificateURL   string               `json:"certificate_url,omitempty"` // TREE_DONATION, once planted
+	CreatedAt        time.Time            `json:"created_at"`
+}
+
+// ProfileBadge is a badge a user got with EcoCredits, shown on their profile
+type ProfileBadge struct {
+	Name      string    `json:"name"`
+	Icon      string    `json:"icon,omitempty"`
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// CreateRewardRequest adds a reward to the catalogue
+type CreateRewardRequest struct {
+	Code        string       `json:"code"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Icon        string       `json:"icon,omitempty"`
+	Cost        int          `json:"eco_credits_cost"`
+	RewardType  RewardType   `json:"reward_type"`
+	Config      RewardConfig `json:"config"`
+	IsActive    *bool        `json:"is_active,omitempty"` // defaults to true
+	Stock       *int         `json:"stock,omitempty"`
+	SortOrder   int          `json:"sort_order"`
+}
+
+// UpdateRewardRequest edits a reward; nil fields are left unchanged. The
+// reward type can't change once created.
+type UpdateRewardRequest struct {
+	Code           *string       `json:"code,omitempty"`
+	Name           *string       `json:"name,omitempty"`
+	Description    *string       `json:"description,omitempty"`
+	Icon           *string       `json:"icon,omitempty"`
+	Cost           *int          `json:"eco_credits_cost,omitempty"`
+	Config         *RewardConfig `json:"config,omitempty"`
+	IsActive       *bool         `json:"is_active,omitempty"`
+	Stock          *int          `json:"stock,omitempty"`
+	UnlimitedStock bool          `json:"unlimited_stock,omitempty"` // clears Stock
+	SortOrder      *int          `json:"sort_order,omitempty"`
+}
@@ -0,0 +1,128 @@
+package models
+
+import "github.com/google/uuid"
+
+// Role is a value of the user_role enum; a user can have several
+type Role string
+
+const (
+	RoleBuyer     Role = "BUYER"
+	RoleSeller    Role = "SELLER"
+	RoleModerator Role = "MODERATOR" // image and review moderation
+	RoleSupport   Role = "SUPPORT"   // customer care: orders and disputes
+	RoleAdmin     Role = "ADMIN"     // every permission
+)
+
+// StaffRoles are the roles that grant permissions and can be assigned by an admin
+var StaffRoles = []Role{RoleAdmin, RoleModerator, RoleSupport}
+
+// Permission is a single action on resources the user doesn't own
+type Permission string
+
+const (
+	PermImagesReview         Permission = "images:review"
+	PermReviewsModerate      Permission = "reviews:moderate"
+	PermProductsManageAny    Permission = "products:manage_any"
+	PermOrdersReadAny        Permission = "orders:read_any"
+	PermOrdersOverrideStatus Permission = "orders:override_status"
+	PermDisputesResolve      Permission = "disputes:resolve"
+	PermAwardsManage         Permission = "awards:manage"
+	PermUsersManage          Permission = "users:manage"
+	PermAuditRead            Permission = "audit:read"
+	PermCategoriesManage     Permission = "categories:manage"
+	PermImpactFactorsManage  Permission = "impact_factors:manage"
+	PermRewardsManage        Permission = "rewards:manage"
+)
+
+// rolePermissions lists what each staff role may do; ADMIN implicitly has everything
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {PermImagesReview, PermReviewsModerate},
+	RoleSupport:   {PermOrdersReadAny, PermDisputesResolve},
+}
+
+// allPermissions is the full list, in display order
+var allPermissions = []Permission{
+	PermImagesReview, PermReviewsModerate, PermProductsManageAny,
+	PermOrdersReadAny, PermOrdersOverrideStatus, PermDisputesResolve,
+	PermAwardsManage, PermUsersManage, PermAuditRead, PermCategoriesManage,
+	PermImpactFactorsManage, PermRewardsManage,
+}
+
+// IsStaffRole reports whether r can be assigned by an admin
+func IsStaffRole(r Role) bool {
+	for _, s := range StaffRoles {
+		if r == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionsFor returns the permissions granted by a set of roles
+func PermissionsFor(roles []Role) []Permission {
+	granted := make(map[Permission]bool)
+	for _, r := range roles {
+		if r == RoleAdmin {
+			return append([]Permission(nil), allPermissions...)
+		}
+		for _, p := range rolePermissions[r] {
+			granted[p] = true
+		}
+	}
+
+	perms := []Permission{}
+	for _, p := range allPermissions {
+		if granted[p] {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// SetRoles sets the roles and the fields derived from them
+func (u *User) SetRoles(roles []Role) {
+	u.Roles = roles
+	u.Permissions = PermissionsFor(roles)
+	u.IsAdmin = u.HasRole(RoleAdmin)
+}
+
+// HasRole reports whether the user has the role
+func (u *User) HasRole(role Role) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the user has any staff role
+func (u *User) IsStaff() bool {
+	for _, r := range u.Roles {
+		if IsStaffRole(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the user's roles grant the permission
+func (u *User) Can(perm Permission) bool {
+	for _, p := range u.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess is the ownership policy: the user is one of the owners of the
+// resource (e.g. buyer or seller of an order), or has the permission to act on any
+func (u *User) CanAccess(perm Permission, ownerIDs ...uuid.UUID) bool {
+	for _, id := range ownerIDs {
+		if id == u.ID {
+			return true
+		}
+	}
+	return u.Can(perm)
+}
@@ -0,0 +1,52 @@
+package models
+
+// SellerStorefront is the public page of a seller (GET /sellers/:id and /stores/:slug)
+type SellerStorefront struct {
+	// Phone and social links are empty unless ContactVisible
+	Profile        UserFullProfile      `json:"profile"`
+	Slug           string               `json:"slug"`
+	Badges         SellerBadges         `json:"badges"`
+	Ratings        RatingBreakdown      `json:"ratings"`
+	RecentReviews  []OrderReview        `json:"recent_reviews"`
+	Listings       *ProductListResponse `json:"listings"`
+	PickupAreas    []PickupArea         `json:"pickup_areas"`
+	Impact         SellerImpact         `json:"impact"`
+	ContactVisible bool                 `json:"contact_visible"` // the viewer has a paid order from this seller
+}
+
+// SellerBadges are the trust signals shown next to the seller's name
+type SellerBadges struct {
+	Verified         bool `json:"verified"`          // email confirmed
+	VerifiedBusiness bool `json:"verified_business"` // BUSINESS account with validated VAT number
+	TopRated         bool `json:"top_rated"`
+
+	Rewards []ProfileBadge `json:"rewards"` // redeemed with EcoCredits
+}
+
+// Top rated badge thresholds
+const (
+	TopRatedMinAverage = 4.5
+	TopRatedMinReviews = 10
+)
+
+// RatingBreakdown counts the approved reviews by number of stars
+type RatingBreakdown struct {
+	Average float64     `json:"average"`
+	Count   int         `json:"count"`
+	Stars   map[int]int `json:"stars"` // 1-5 → number of reviews
+}
+
+// PickupArea is where a seller offers pickup, without the street address
+type PickupArea struct {
+	City     string `json:"city"`
+	Province string `json:"province,omitempty"`
+}
+
+// SellerImpact is the environmental impact of a seller's completed sales
+type SellerImpact struct {
+	CO2Saved        float64 `json:"co2_saved"`
+	WaterSaved      float64 `json:"water_saved"`
+	WasteSaved      float64 `json:"waste_saved"`
+	ItemsSold       int     `json:"items_sold"`
+	OrdersCompleted int     `json:"orders_completed"`
+}
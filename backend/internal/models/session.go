@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a stored refresh token. All rotations of one login share a FamilyID.
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	TokenHash  string
+	ExpiresAt  time.Time
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// DeviceSession is an active login as shown in "my devices"
+type DeviceSession struct {
+	ID         uuid.UUID `json:"id"` // session family
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TreesTargetStep is how far the community trees target moves up once reached
+const TreesTargetStep = 100
+
+// TreeDonationStatus is the state of a tree donation
+type TreeDonationStatus string
+
+const (
+	TreeDonationPending   TreeDonationStatus = "PENDING"   // waiting to be sent to the partner
+	TreeDonationSubmitted TreeDonationStatus = "SUBMITTED" // sent, waiting for the certificate; never sent again
+	TreeDonationPlanted   TreeDonationStatus = "PLANTED"
+)
+
+// TreeDonation is a row of trees_planted: trees donated with a TREE_DONATION reward
+type TreeDonation struct {
+	ID               uuid.UUID          `json:"id"`
+	UserID           *uuid.UUID         `json:"user_id,omitempty"`
+	RedeemedRewardID *uuid.UUID         `json:"redeemed_reward_id,omitempty"`
+	TreesCount       int                `json:"trees_count"`
+	Status           TreeDonationStatus `json:"status"`
+	Provider         string             `json:"provider,omitempty"`
+	CertificateID    string             `json:"certificate_id,omitempty"`
+	CertificateURL   string             `json:"certificate_url,omitempty"`
+	Species          string             `json:"species,omitempty"`
+	Location         string             `json:"location,omitempty"`
+	Attempts         int                `json:"attempts"`
+	CreatedAt        time.Time          `json:"created_at"`
+	PlantedAt        *time.Time         `json:"planted_at,omitempty"`
+
+	// Recipient of the certificate
+	RecipientName  string `json:"-"`
+	RecipientEmail string `json:"-"`
+}
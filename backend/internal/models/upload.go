@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadSessionStatus represents the state of a presigned direct upload
+type UploadSessionStatus string
+
+const (
+	UploadSessionPending   UploadSessionStatus = "PENDING"
+	UploadSessionFinalized UploadSessionStatus = "FINALIZED"
+	UploadSessionRejected  UploadSessionStatus = "REJECTED"
+	UploadSessionExpired   UploadSessionStatus = "EXPIRED"
+)
+
+// UploadSession tracks a presigned upload from presign to finalize
+type UploadSession struct {
+	ID              uuid.UUID           `json:"id"`
+	UserID          uuid.UUID           `json:"user_id"`
+	ProductID       *uuid.UUID          `json:"product_id,omitempty"`
+	FileURL         string              `json:"file_url"`
+	ContentType     string              `json:"content_type"`
+	Status          UploadSessionStatus `json:"status"`
+	RejectionReason string              `json:"rejection_reason,omitempty"`
+	ExpiresAt       time.Time           `json:"expires_at"`
+	FinalizedAt     *time.Time          `json:"finalized_at,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+}
+
+// PresignRequest for POST /upload/presign
+type PresignRequest struct {
+	ProductID   string `json:"product_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -63,11 +64,18 @@ type User struct {
 	AvatarURL      string      `json:"avatar_url,omitempty"`
 	SocialLinks    SocialLinks `json:"social_links,omitempty"`
 	BusinessPhotos []string    `json:"business_photos,omitempty"`
+	Slug           string      `json:"slug,omitempty"` // Storefront address
 
-	// Status & Admin
-	Status        UserStatus `json:"status"`
-	EmailVerified bool       `json:"email_verified"`
-	IsAdmin       bool       `json:"is_admin"`
+	// Status & Roles (set with SetRoles; IsAdmin and Permissions are derived)
+	Status        UserStatus   `json:"status"`
+	EmailVerified bool         `json:"email_verified"`
+	Roles         []Role       `json:"roles"`
+	Permissions   []Permission `json:"permissions"`
+	IsAdmin       bool         `json:"is_admin"`
+	TOTPEnabled   bool         `json:"totp_enabled"`
+
+	// Set while a deletion request is in its grace period
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 
 	// Stripe
 	StripeCustomerID *string `json:"stripe_customer_id,omitempty"`
@@ -76,6 +84,7 @@ type User struct {
 	// Eco stats
 	TotalCO2Saved   float64 `json:"total_co2_saved"`
 	TotalWaterSaved float64 `json:"total_water_saved"`
+	TotalWasteSaved float64 `json:"total_waste_saved"`
 	EcoCredits      int     `json:"eco_credits"`
 	EcoLevel        string  `json:"eco_level"`
 
@@ -92,7 +101,48 @@ type User struct {
 func (u *User) IsBusiness() bool { return u.AccountType == AccountBusiness }
 func (u *User) IsActive() bool   { return u.Status == UserStatusActive }
 
-// UserProfile is the public-facing profile (shown after purchase)
+// BusinessData is the business and billing identity of a BUSINESS account.
+// PRIVATE accounts keep it (hidden) after a downgrade, ready for an upgrade.
+type BusinessData struct {
+	BusinessName      string `json:"business_name"`
+	VATNumber         string `json:"vat_number"`
+	FiscalCode        string `json:"fiscal_code"`
+	SDICode           string `json:"sdi_code"`
+	PECEmail          string `json:"pec_email"`
+	EUVatID           string `json:"eu_vat_id"`
+	BillingAddress    string `json:"billing_address"`
+	BillingCity       string `json:"billing_city"`
+	BillingProvince   string `json:"billing_province"`
+	BillingPostalCode string `json:"billing_postal_code"`
+	BillingCountry    string `json:"billing_country"`
+}
+
+// BusinessData returns the user's current business and billing data
+func (u *User) BusinessData() BusinessData {
+	return BusinessData{
+		BusinessName:      u.BusinessName,
+		VATNumber:         u.VATNumber,
+		FiscalCode:        u.FiscalCode,
+		SDICode:           u.SDICode,
+		PECEmail:          u.PECEmail,
+		EUVatID:           u.EUVatID,
+		BillingAddress:    u.BillingAddress,
+		BillingCity:       u.BillingCity,
+		BillingProvince:   u.BillingProvince,
+		BillingPostalCode: u.BillingPostalCode,
+		BillingCountry:    u.BillingCountry,
+	}
+}
+
+// publicBusinessName is the business name shown to other users: PRIVATE accounts have none
+func (u *User) publicBusinessName() string {
+	if !u.IsBusiness() {
+		return ""
+	}
+	return u.BusinessName
+}
+
+// UserProfile is the public-facing profile
 type UserProfile struct {
 	ID           uuid.UUID   `json:"id"`
 	FirstName    string      `json:"first_name"`
@@ -118,7 +168,7 @@ type UserPublicMinimal struct {
 	RatingAvg    float64     `json:"rating_avg"`
 }
 
-// UserFullProfile is shown after purchase (includes contact info)
+// UserFullProfile adds contact info, shown to buyers after a paid order
 type UserFullProfile struct {
 	UserProfile
 	Phone          string      `json:"phone,omitempty"`
@@ -134,7 +184,7 @@ func (u *User) ToProfile() UserProfile {
 		LastName:     u.LastName,
 		AvatarURL:    u.AvatarURL,
 		AccountType:  u.AccountType,
-		BusinessName: u.BusinessName,
+		BusinessName: u.publicBusinessName(),
 		City:         u.City,
 		RatingAvg:    u.RatingAvg,
 		RatingCount:  u.RatingCount,
@@ -146,7 +196,7 @@ func (u *User) ToMinimal() UserPublicMinimal {
 	return UserPublicMinimal{
 		ID:           u.ID,
 		AccountType:  u.AccountType,
-		BusinessName: u.BusinessName,
+		BusinessName: u.publicBusinessName(),
 		FirstName:    u.FirstName,
 		LastName:     u.LastName,
 		AvatarURL:    u.AvatarURL,
@@ -156,13 +206,17 @@ func (u *User) ToMinimal() UserPublicMinimal {
 }
 
 func (u *User) ToFullProfile() UserFullProfile {
-	return UserFullProfile{
-		UserProfile:    u.ToProfile(),
-		Phone:          u.Phone,
-		SocialLinks:    u.SocialLinks,
-		BusinessPhotos: u.BusinessPhotos,
-		VATNumber:      u.VATNumber,
+	profile := UserFullProfile{
+		UserProfile: u.ToProfile(),
+		Phone:       u.Phone,
+		SocialLinks: u.SocialLinks,
 	}
+	// Business data stays hidden after switching to PRIVATE
+	if u.IsBusiness() {
+		profile.BusinessPhotos = u.BusinessPhotos
+		profile.VATNumber = u.VATNumber
+	}
+	return profile
 }
 
 // Location represents a pickup location
@@ -180,6 +234,8 @@ type Location struct {
 	Email           string     `json:"email,omitempty"`
 	PickupHours     string     `json:"pickup_hours,omitempty"` // JSON string
 	PickupInstructions string  `json:"pickup_instructions,omitempty"`
+	Latitude        *float64   `json:"latitude,omitempty"`  // Filled in by geocoding
+	Longitude       *float64   `json:"longitude,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
 }
 
@@ -226,6 +282,123 @@ type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
+// TwoFactorChallengeResponse is returned by login when a 2FA code is still needed
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+// TwoFactorLoginRequest completes a 2FA login
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"` // TOTP or recovery code
+}
+
+// TwoFactorCodeRequest confirms a 2FA operation with a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// DisableTwoFactorRequest turns 2FA off (password and code required)
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// OIDCExchangeRequest redeems the one-time code the OIDC callback hands to the frontend
+type OIDCExchangeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// OIDCOnboardingResponse is returned on the first social login: the account
+// is created by OIDCCompleteRequest once the missing fields are known
+type OIDCOnboardingResponse struct {
+	OnboardingRequired bool   `json:"onboarding_required"`
+	OnboardingToken    string `json:"onboarding_token"`
+	Provider           string `json:"provider"`
+	Email              string `json:"email"`
+	FirstName          string `json:"first_name"`
+	LastName           string `json:"last_name"`
+}
+
+// OIDCCompleteRequest creates the account of a first social login
+type OIDCCompleteRequest struct {
+	OnboardingToken string      `json:"onboarding_token" validate:"required"`
+	FirstName       string      `json:"first_name" validate:"required"`
+	LastName        string      `json:"last_name" validate:"required"`
+	AccountType     AccountType `json:"account_type"`
+
+	// Business fields (required if AccountType is BUSINESS)
+	BusinessName         string `json:"business_name,omitempty"`
+	VATNumber            string `json:"vat_number,omitempty"`
+	HasMultipleLocations bool   `json:"has_multiple_locations"`
+
+	City       string `json:"city" validate:"required"`
+	Province   string `json:"province,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+}
+
+// SetUserStatusRequest bans, suspends or reactivates an account (admin only)
+type SetUserStatusRequest struct {
+	Status UserStatus `json:"status" validate:"required,oneof=ACTIVE SUSPENDED BANNED"`
+	Reason string     `json:"reason"`
+}
+
+// SetRolesRequest replaces a user's staff roles (admin only)
+type SetRolesRequest struct {
+	Roles []Role `json:"roles"`
+}
+
+// DeleteAccountRequest asks for the account to be deleted after the grace period.
+// Password is required when the account has one; social-only accounts confirm with their email.
+type DeleteAccountRequest struct {
+	Password     string `json:"password"`
+	ConfirmEmail string `json:"confirm_email"`
+}
+
+// PendingDeletion is an account whose grace period is over
+type PendingDeletion struct {
+	UserID uuid.UUID
+}
+
+// FileDeletion is a stored file of an anonymised account, still to be removed
+type FileDeletion struct {
+	ID        uuid.UUID
+	FileRef   string // public URL, or object key when IsPrivate
+	IsPrivate bool
+	Attempts  int
+}
+
+// ExportFile is a JSON file of the GDPR data export
+type ExportFile struct {
+	Name string
+	Data json.RawMessage
+}
+
+// ExportUpload is a file uploaded by the user, copied into the data export
+type ExportUpload struct {
+	Folder  string
+	URL     string // public URL, or object key when Private
+	Private bool
+}
+
+// VerifyEmailRequest confirms an email address with the token sent by email
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ForgotPasswordRequest asks for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest sets a new password with the token sent by email
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
 // UpdateProfileRequest for updating user profile
 type UpdateProfileRequest struct {
 	FirstName            *string      `json:"first_name,omitempty"`
@@ -234,7 +407,7 @@ type UpdateProfileRequest struct {
 	City                 *string      `json:"city,omitempty"`
 	Province             *string      `json:"province,omitempty"`
 	PostalCode           *string      `json:"postal_code,omitempty"`
-	AccountType          *AccountType `json:"account_type,omitempty"` // Allow switching between PRIVATE/BUSINESS
+	AccountType          *AccountType `json:"account_type,omitempty"` // Rejected if different: use SwitchAccountTypeRequest
 	BusinessName         *string      `json:"business_name,omitempty"`
 	VATNumber            *string      `json:"vat_number,omitempty"`
 	SocialLinks          *SocialLinks `json:"social_links,omitempty"`
@@ -252,6 +425,48 @@ type UpdateProfileRequest struct {
 	BillingCountry    *string `json:"billing_country,omitempty"`
 }
 
+// SwitchAccountTypeRequest changes between PRIVATE and BUSINESS.
+// Without Confirm nothing changes: the response previews the effects.
+// Upgrading takes the business data; empty fields keep the current (possibly hidden) value.
+type SwitchAccountTypeRequest struct {
+	AccountType AccountType `json:"account_type" validate:"required,oneof=PRIVATE BUSINESS"`
+	Confirm     bool        `json:"confirm"`
+	BusinessData
+}
+
+// Effects of an account type switch
+const (
+	EffectBusinessDataPublic   = "BUSINESS_DATA_PUBLIC"
+	EffectBusinessDataHidden   = "BUSINESS_DATA_HIDDEN"
+	EffectBusinessPhotosShown  = "BUSINESS_PHOTOS_SHOWN"
+	EffectBusinessPhotosHidden = "BUSINESS_PHOTOS_HIDDEN"
+	EffectListingsUnpublished  = "LISTINGS_UNPUBLISHED"
+	EffectInvoicesKept         = "INVOICES_KEPT"
+)
+
+// AccountSwitchEffect is a consequence of an account type switch, shown before confirming
+type AccountSwitchEffect struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Count   int    `json:"count,omitempty"`
+}
+
+// AccountSwitchStats is what an account type switch affects
+type AccountSwitchStats struct {
+	ActiveListings     int
+	ActiveSellerOrders int
+	InvoicedOrders     int
+	BusinessPhotos     int
+}
+
+// AccountSwitchResponse lists the effects of a switch; Applied is false for a preview
+type AccountSwitchResponse struct {
+	AccountType AccountType           `json:"account_type"`
+	Applied     bool                  `json:"applied"`
+	Effects     []AccountSwitchEffect `json:"effects"`
+	User        *User                 `json:"user,omitempty"`
+}
+
 // CreateLocationRequest for adding a new location
 type CreateLocationRequest struct {
 	Name               string `json:"name" validate:"required"`
@@ -287,5 +502,28 @@ type ImageReview struct {
 	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
 	RejectionReason string     `json:"rejection_reason,omitempty"`
 
+	// Duplicate detection (set when the image matches another user's photo)
+	DuplicateOfURL    *string    `json:"duplicate_of_url,omitempty"`
+	DuplicateOfUserID *uuid.UUID `json:"duplicate_of_user_id,omitempty"`
+	DuplicateDistance *int       `json:"duplicate_distance,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// ImageHash is the perceptual hash of an uploaded image
+type ImageHash struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ProductID *uuid.UUID `json:"product_id,omitempty"`
+	ImageURL  string     `json:"image_url"`
+	ImageType string     `json:"image_type"` // PRODUCT, PROFILE, BUSINESS
+	Hash      uint64     `json:"hash,string"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ImageDuplicateCluster groups near-identical images uploaded by different users
+type ImageDuplicateCluster struct {
+	Images      []ImageHash `json:"images"`
+	UserCount   int         `json:"user_count"`
+	MaxDistance int         `json:"max_distance"`
+}
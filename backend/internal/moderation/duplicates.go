@@ -0,0 +1,73 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// DuplicateDetector flags photos that were already uploaded by another account
+// (typical of scam listings reusing stolen pictures)
+type DuplicateDetector struct {
+	hashRepo        *repository.ImageHashRepository
+	imageReviewRepo *repository.ImageReviewRepository
+}
+
+// NewDuplicateDetector creates a new duplicate detector
+func NewDuplicateDetector(hashRepo *repository.ImageHashRepository, imageReviewRepo *repository.ImageReviewRepository) *DuplicateDetector {
+	return &DuplicateDetector{
+		hashRepo:        hashRepo,
+		imageReviewRepo: imageReviewRepo,
+	}
+}
+
+// Check hashes an uploaded image, stores the hash and queues the image for
+// admin review if it closely matches an image of a different user.
+// Formats we can't decode are skipped without error.
+func (d *DuplicateDetector) Check(ctx context.Context, data []byte, userID uuid.UUID, productID *uuid.UUID, imageURL, imageType string) error {
+	hash, err := ComputeDHash(data)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedImage) {
+			return nil
+		}
+		return err
+	}
+
+	// Look for matches before storing, so the new image doesn't match itself
+	matches, distances, err := d.hashRepo.FindSimilar(ctx, hash, userID, DuplicateThreshold, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := d.hashRepo.Create(ctx, &models.ImageHash{
+		UserID:    userID,
+		ProductID: productID,
+		ImageURL:  imageURL,
+		ImageType: imageType,
+		Hash:      hash,
+	}); err != nil {
+		return err
+	}
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	match := matches[0]
+	distance := distances[0]
+	review := &models.ImageReview{
+		UserID:            userID,
+		ProductID:         productID,
+		ImageURL:          imageURL,
+		ImageType:         imageType,
+		Confidence:        1 - float64(distance)/64,
+		DuplicateOfURL:    &match.ImageURL,
+		DuplicateOfUserID: &match.UserID,
+		DuplicateDistance: &distance,
+	}
+	return d.imageReviewRepo.Create(ctx, review)
+}
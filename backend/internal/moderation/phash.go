@@ -0,0 +1,78 @@
+package moderation
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"math/bits"
+
+	_ "golang.org/x/image/webp" // register WebP decoder
+)
+
+// DuplicateThreshold is the max Hamming distance between two hashes
+// for the images to be considered the same photo
+const DuplicateThreshold = 10
+
+// ErrUnsupportedImage is returned when the image format can't be decoded
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// ComputeDHash computes a 64-bit difference hash of an image.
+// The image is reduced to a 9x8 grayscale grid and each bit records whether
+// a cell is brighter than its right neighbour, so the hash survives
+// resizing, recompression and small colour changes.
+func ComputeDHash(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return 0, ErrUnsupportedImage
+		}
+		return 0, err
+	}
+
+	const gridW, gridH = 9, 8
+	var grid [gridH][gridW]float64
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return 0, ErrUnsupportedImage
+	}
+
+	// Average a few samples per cell instead of every pixel: big photos
+	// would otherwise cost millions of At() calls
+	const samples = 8
+	for gy := 0; gy < gridH; gy++ {
+		for gx := 0; gx < gridW; gx++ {
+			var sum float64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					x := bounds.Min.X + (gx*samples+sx)*w/(gridW*samples)
+					y := bounds.Min.Y + (gy*samples+sy)*h/(gridH*samples)
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			grid[gy][gx] = sum / (samples * samples)
+		}
+	}
+
+	var hash uint64
+	for gy := 0; gy < gridH; gy++ {
+		for gx := 0; gx < gridW-1; gx++ {
+			hash <<= 1
+			if grid[gy][gx] > grid[gy][gx+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+// HammingDistance returns the number of differing bits between two hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// KeyFunc extracts the identity a policy counts requests for.
+// An empty key skips the policy for that request.
+type KeyFunc func(c *fiber.Ctx) string
+
+// Policy limits a route to Limit requests per Window for each key
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    KeyFunc
+}
+
+// Result is the outcome of a policy check
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration // time until the window restarts
+}
+
+// Limiter applies policies on a shared store
+type Limiter struct {
+	store Store
+}
+
+// NewLimiter creates a limiter on the given store
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Allow counts one request for key under policy
+func (l *Limiter) Allow(ctx context.Context, policy Policy, key string) (*Result, error) {
+	count, reset, err := l.store.Incr(ctx, policy.Name+":"+key, policy.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := policy.Limit - int(count)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Result{
+		Allowed:   count <= int64(policy.Limit),
+		Limit:     policy.Limit,
+		Remaining: remaining,
+		Reset:     reset,
+	}, nil
+}
+
+// ByIP keys requests by client IP
+func ByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// ByUser keys requests by the authenticated user (falls back to IP)
+func ByUser(c *fiber.Ctx) string {
+	if userID, ok := c.Locals("userID").(uuid.UUID); ok {
+		return "user:" + userID.String()
+	}
+	return ByIP(c)
+}
+
+// ByEmail keys requests by the "email" field of the JSON body.
+// Requests without an email are not counted (other policies still apply).
+func ByEmail(c *fiber.Ctx) string {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return ""
+	}
+	email := NormalizeEmail(body.Email)
+	if email == "" {
+		return ""
+	}
+	return "email:" + HashKey(email)
+}
+
+// NormalizeEmail lowercases and trims an email, as the auth handlers do
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// HashKey keeps personal data (emails) out of the store's keys
+func HashKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
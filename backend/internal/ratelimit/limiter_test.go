@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	policy := Policy{Name: "test", Limit: 3, Window: time.Minute}
+
+	tests := []struct {
+		request       int
+		wantAllowed   bool
+		wantRemaining int
+	}{
+		{1, true, 2},
+		{2, true, 1},
+		{3, true, 0},
+		{4, false, 0},
+		{5, false, 0},
+	}
+
+	limiter := NewLimiter(NewMemoryStore())
+	for _, tt := range tests {
+		result, err := limiter.Allow(context.Background(), policy, "ip:1.2.3.4")
+		if err != nil {
+			t.Fatalf("request %d: %v", tt.request, err)
+		}
+		if result.Allowed != tt.wantAllowed || result.Remaining != tt.wantRemaining {
+			t.Errorf("request %d: allowed=%v remaining=%d, want allowed=%v remaining=%d",
+				tt.request, result.Allowed, result.Remaining, tt.wantAllowed, tt.wantRemaining)
+		}
+		if result.Limit != policy.Limit {
+			t.Errorf("request %d: limit=%d, want %d", tt.request, result.Limit, policy.Limit)
+		}
+		if result.Reset <= 0 || result.Reset > policy.Window {
+			t.Errorf("request %d: reset=%v, want within (0, %v]", tt.request, result.Reset, policy.Window)
+		}
+	}
+}
+
+func TestLimiterSeparatesKeysAndPolicies(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore())
+	login := Policy{Name: "login", Limit: 1, Window: time.Minute}
+	register := Policy{Name: "register", Limit: 1, Window: time.Minute}
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		key         string
+		wantAllowed bool
+	}{
+		{"first request", login, "ip:1.1.1.1", true},
+		{"same policy and key", login, "ip:1.1.1.1", false},
+		{"other key", login, "ip:2.2.2.2", true},
+		{"other policy, same key", register, "ip:1.1.1.1", true},
+	}
+
+	for _, tt := range tests {
+		result, err := limiter.Allow(context.Background(), tt.policy, tt.key)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Allowed != tt.wantAllowed {
+			t.Errorf("%s: allowed=%v, want %v", tt.name, result.Allowed, tt.wantAllowed)
+		}
+	}
+}
+
+func TestLimiterWindowExpires(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore())
+	policy := Policy{Name: "short", Limit: 1, Window: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	if result, _ := limiter.Allow(ctx, policy, "k"); !result.Allowed {
+		t.Fatal("first request denied")
+	}
+	if result, _ := limiter.Allow(ctx, policy, "k"); result.Allowed {
+		t.Fatal("second request allowed within the window")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if result, _ := limiter.Allow(ctx, policy, "k"); !result.Allowed {
+		t.Error("request denied after the window expired")
+	}
+}
+
+func TestNormalizedEmailKeys(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"mario@example.com", "mario@example.com", true},
+		{"Mario@Example.com", "mario@example.com", true},
+		{"  mario@example.com ", "mario@example.com", true},
+		{"mario@example.com", "luigi@example.com", false},
+	}
+
+	for _, tt := range tests {
+		a, b := HashKey(NormalizeEmail(tt.a)), HashKey(NormalizeEmail(tt.b))
+		if (a == b) != tt.same {
+			t.Errorf("%q vs %q: same key=%v, want %v", tt.a, tt.b, a == b, tt.same)
+		}
+	}
+}
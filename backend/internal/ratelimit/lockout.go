@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// lockoutFailureWindow is how long failed attempts are remembered
+const lockoutFailureWindow = 24 * time.Hour
+
+// Lockout locks an account out after repeated failed logins.
+// Each failure past the threshold doubles the lock, up to max.
+type Lockout struct {
+	store     Store
+	threshold int
+	base      time.Duration
+	max       time.Duration
+}
+
+// NewLockout creates a progressive lockout.
+// threshold failures lock the account for base, then 2×base, 4×base, ... up to max.
+func NewLockout(store Store, threshold int, base, max time.Duration) *Lockout {
+	return &Lockout{store: store, threshold: threshold, base: base, max: max}
+}
+
+// Locked returns how long the account is still locked, 0 if it isn't
+func (l *Lockout) Locked(ctx context.Context, email string) (time.Duration, error) {
+	return l.store.TTL(ctx, l.lockKey(email))
+}
+
+// Fail records a failed login and returns the lock duration it triggered (0 if none)
+func (l *Lockout) Fail(ctx context.Context, email string) (time.Duration, error) {
+	failures, _, err := l.store.Incr(ctx, l.failKey(email), lockoutFailureWindow)
+	if err != nil {
+		return 0, err
+	}
+	if failures < int64(l.threshold) {
+		return 0, nil
+	}
+
+	lock := l.base
+	for i := int64(l.threshold); i < failures && lock < l.max; i++ {
+		lock *= 2
+	}
+	if lock > l.max {
+		lock = l.max
+	}
+
+	if err := l.store.Set(ctx, l.lockKey(email), lock); err != nil {
+		return 0, err
+	}
+	return lock, nil
+}
+
+// Reset clears failures after a successful login
+func (l *Lockout) Reset(ctx context.Context, email string) error {
+	return l.store.Delete(ctx, l.failKey(email), l.lockKey(email))
+}
+
+func (l *Lockout) failKey(email string) string {
+	return "lockout:fail:" + HashKey(NormalizeEmail(email))
+}
+
+func (l *Lockout) lockKey(email string) string {
+	return "lockout:lock:" + HashKey(NormalizeEmail(email))
+}
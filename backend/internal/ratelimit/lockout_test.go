@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockoutProgression(t *testing.T) {
+	// 3 failures lock for 1m, then each failure doubles it up to 5m
+	tests := []struct {
+		failure  int
+		wantLock time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{7, 5 * time.Minute},
+	}
+
+	lockout := NewLockout(NewMemoryStore(), 3, time.Minute, 5*time.Minute)
+	ctx := context.Background()
+	for _, tt := range tests {
+		lock, err := lockout.Fail(ctx, "mario@example.com")
+		if err != nil {
+			t.Fatalf("failure %d: %v", tt.failure, err)
+		}
+		if lock != tt.wantLock {
+			t.Errorf("failure %d: lock=%v, want %v", tt.failure, lock, tt.wantLock)
+		}
+
+		locked, err := lockout.Locked(ctx, "mario@example.com")
+		if err != nil {
+			t.Fatalf("failure %d: %v", tt.failure, err)
+		}
+		if (locked > 0) != (tt.wantLock > 0) || locked > tt.wantLock {
+			t.Errorf("failure %d: locked for %v, want up to %v", tt.failure, locked, tt.wantLock)
+		}
+	}
+}
+
+func TestLockoutPerEmail(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), 1, time.Minute, time.Hour)
+	ctx := context.Background()
+
+	if _, err := lockout.Fail(ctx, "Mario@Example.com "); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email      string
+		wantLocked bool
+	}{
+		{"mario@example.com", true}, // Normalized like the auth handlers do
+		{"MARIO@EXAMPLE.COM", true},
+		{"luigi@example.com", false},
+	}
+
+	for _, tt := range tests {
+		locked, err := lockout.Locked(ctx, tt.email)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.email, err)
+		}
+		if (locked > 0) != tt.wantLocked {
+			t.Errorf("%s: locked for %v, want locked=%v", tt.email, locked, tt.wantLocked)
+		}
+	}
+}
+
+func TestLockoutReset(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), 2, time.Minute, time.Hour)
+	ctx := context.Background()
+
+	lockout.Fail(ctx, "mario@example.com")
+	lockout.Fail(ctx, "mario@example.com")
+	if locked, _ := lockout.Locked(ctx, "mario@example.com"); locked == 0 {
+		t.Fatal("not locked after reaching the threshold")
+	}
+
+	if err := lockout.Reset(ctx, "mario@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if locked, _ := lockout.Locked(ctx, "mario@example.com"); locked != 0 {
+		t.Errorf("still locked for %v after reset", locked)
+	}
+
+	// Failures count from zero again
+	if lock, _ := lockout.Fail(ctx, "mario@example.com"); lock != 0 {
+		t.Errorf("first failure after reset locked for %v", lock)
+	}
+}
@@ -0,0 +1,223 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store holds fixed-window counters and lock keys
+type Store interface {
+	// Incr increments key, starting a window of the given length on first use.
+	// Returns the new count and the time left in the window.
+	Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+	// Set creates or overwrites key with a TTL
+	Set(ctx context.Context, key string, ttl time.Duration) error
+	// TTL returns the time left before key expires, 0 if it doesn't exist
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Delete removes keys
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// RedisStore shares counters across API instances
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:"}
+}
+
+// incrScript increments and sets the window expiry atomically
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {n, ttl}
+`)
+
+func (s *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	res, err := incrScript.Run(ctx, s.client, []string{s.prefix + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return res[0], time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, 1, ttl).Err()
+}
+
+func (s *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.prefix+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// -2: missing key, -1: no expiry (never set by us)
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+// MemoryStore keeps counters in process memory.
+// Meant for tests, single-instance development without Redis and as the
+// FallbackStore of RedisStore.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// memoryPurgeSize triggers a purge of expired entries
+const memoryPurgeSize = 10000
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.entries) >= memoryPurgeSize {
+		s.purge(now)
+	}
+
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		entry = &memoryEntry{expiresAt: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.count++
+
+	return entry.count, entry.expiresAt.Sub(now), nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &memoryEntry{count: 1, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	ttl := time.Until(entry.expiresAt)
+	if ttl <= 0 {
+		delete(s.entries, key)
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) purge(now time.Time) {
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// FallbackStore uses the fallback store while the primary one fails, so
+// limits keep being enforced (per instance) when Redis is down
+type FallbackStore struct {
+	primary  Store
+	fallback Store
+	degraded atomic.Bool
+}
+
+// NewFallbackStore creates a store that falls back on errors of primary
+func NewFallbackStore(primary, fallback Store) *FallbackStore {
+	return &FallbackStore{primary: primary, fallback: fallback}
+}
+
+// use reports whether the primary store answered, logging outages and recoveries once
+func (s *FallbackStore) use(err error) bool {
+	if err != nil {
+		if !s.degraded.Swap(true) {
+			log.Printf("⚠️  Rate limit store unavailable, using in-memory limits: %v", err)
+		}
+		return false
+	}
+	if s.degraded.Swap(false) {
+		log.Println("✅ Rate limit store available again")
+	}
+	return true
+}
+
+func (s *FallbackStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	count, reset, err := s.primary.Incr(ctx, key, window)
+	if s.use(err) {
+		return count, reset, nil
+	}
+	return s.fallback.Incr(ctx, key, window)
+}
+
+func (s *FallbackStore) Set(ctx context.Context, key string, ttl time.Duration) error {
+	if s.use(s.primary.Set(ctx, key, ttl)) {
+		return nil
+	}
+	return s.fallback.Set(ctx, key, ttl)
+}
+
+// TTL also checks the fallback, so locks set during an outage survive the recovery
+func (s *FallbackStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.primary.TTL(ctx, key)
+	if s.use(err) && ttl > 0 {
+		return ttl, nil
+	}
+	return s.fallback.TTL(ctx, key)
+}
+
+func (s *FallbackStore) Delete(ctx context.Context, keys ...string) error {
+	s.use(s.primary.Delete(ctx, keys...))
+	return s.fallback.Delete(ctx, keys...)
+}
+
+// Compile-time checks that every store implements Store
+var (
+	_ Store = (*RedisStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*FallbackStore)(nil)
+)
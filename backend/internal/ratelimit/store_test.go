@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyStore wraps a store and fails every call while down is set
+type flakyStore struct {
+	Store
+	down bool
+}
+
+var errStoreDown = errors.New("store down")
+
+func (s *flakyStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	if s.down {
+		return 0, 0, errStoreDown
+	}
+	return s.Store.Incr(ctx, key, window)
+}
+
+func (s *flakyStore) Set(ctx context.Context, key string, ttl time.Duration) error {
+	if s.down {
+		return errStoreDown
+	}
+	return s.Store.Set(ctx, key, ttl)
+}
+
+func (s *flakyStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if s.down {
+		return 0, errStoreDown
+	}
+	return s.Store.TTL(ctx, key)
+}
+
+func (s *flakyStore) Delete(ctx context.Context, keys ...string) error {
+	if s.down {
+		return errStoreDown
+	}
+	return s.Store.Delete(ctx, keys...)
+}
+
+func TestFallbackStoreKeepsLimitingWhenPrimaryIsDown(t *testing.T) {
+	primary := &flakyStore{Store: NewMemoryStore(), down: true}
+	limiter := NewLimiter(NewFallbackStore(primary, NewMemoryStore()))
+	policy := Policy{Name: "login", Limit: 2, Window: time.Minute}
+
+	tests := []struct {
+		request     int
+		wantAllowed bool
+	}{
+		{1, true},
+		{2, true},
+		{3, false},
+	}
+
+	for _, tt := range tests {
+		result, err := limiter.Allow(context.Background(), policy, "ip:1.2.3.4")
+		if err != nil {
+			t.Fatalf("request %d: %v", tt.request, err)
+		}
+		if result.Allowed != tt.wantAllowed {
+			t.Errorf("request %d: allowed=%v, want %v", tt.request, result.Allowed, tt.wantAllowed)
+		}
+	}
+}
+
+func TestFallbackStoreLockSurvivesRecovery(t *testing.T) {
+	primary := &flakyStore{Store: NewMemoryStore(), down: true}
+	lockout := NewLockout(NewFallbackStore(primary, NewMemoryStore()), 1, time.Minute, time.Hour)
+	ctx := context.Background()
+
+	if lock, err := lockout.Fail(ctx, "mario@example.com"); err != nil || lock == 0 {
+		t.Fatalf("Fail while primary down: lock=%v err=%v", lock, err)
+	}
+
+	primary.down = false
+
+	locked, err := lockout.Locked(ctx, "mario@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked == 0 {
+		t.Error("lock set during the outage lost once the primary store recovered")
+	}
+
+	if err := lockout.Reset(ctx, "mario@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if locked, _ := lockout.Locked(ctx, "mario@example.com"); locked != 0 {
+		t.Errorf("still locked for %v after reset", locked)
+	}
+}
+
+func TestFallbackStoreUsesPrimaryWhenUp(t *testing.T) {
+	primary := &flakyStore{Store: NewMemoryStore()}
+	fallback := NewMemoryStore()
+	store := NewFallbackStore(primary, fallback)
+	ctx := context.Background()
+
+	if _, _, err := store.Incr(ctx, "k", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		store     Store
+		wantCount int64
+	}{
+		{"primary", primary, 2},
+		{"fallback", fallback, 1},
+	}
+
+	for _, tt := range tests {
+		count, _, err := tt.store.Incr(ctx, "k", time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if count != tt.wantCount {
+			t.Errorf("%s: count=%d, want %d", tt.name, count, tt.wantCount)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+// auditChainLock is the advisory lock key serializing appends to the chain
+const auditChainLock = 0x61756469 // "audi"
+
+// auditGenesisHash is the PrevHash of the first record
+var auditGenesisHash = strings.Repeat("0", 64)
+
+type AuditRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditRepository(pool *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{pool: pool}
+}
+
+// Append adds a record at the end of the hash chain.
+// Seq, PrevHash, Hash and CreatedAt are filled in.
+func (r *AuditRepository) Append(ctx context.Context, entry *models.AuditLog) error {
+	return r.AppendAll(ctx, []*models.AuditLog{entry})
+}
+
+// AppendAll adds the records of one action to the chain, in order and in a
+// single transaction: either all of them are written or none is.
+func (r *AuditRepository) AppendAll(ctx context.Context, entries []*models.AuditLog) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// appendAuditEntries chains the records inside tx, so repositories can log an
+// action in the same transaction that performs it
+func appendAuditEntries(ctx context.Context, tx pgx.Tx, entries []*models.AuditLog) error {
+	for _, entry := range entries {
+		if err := normalizeAuditEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	// One writer at a time, so every record links to the one before it
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return err
+	}
+
+	var lastSeq int64
+	lastHash := auditGenesisHash
+	err := tx.QueryRow(ctx, `
+		SELECT seq, hash FROM audit_logs WHERE seq IS NOT NULL ORDER BY seq DESC LIMIT 1
+	`).Scan(&lastSeq, &lastHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	for _, entry := range entries {
+		entry.ID = uuid.New()
+		entry.Seq = lastSeq + 1
+		entry.PrevHash = lastHash
+		// Stored with microsecond precision in UTC: hash what will be read back
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Hash = auditHash(entry)
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO audit_logs (
+				id, seq, user_id, action, entity_type, entity_id,
+				old_value, new_value, metadata, ip_address, user_agent,
+				prev_hash, hash, created_at
+			) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, NULLIF($10, '')::inet, NULLIF($11, ''), $12, $13, $14)
+		`, entry.ID, entry.Seq, entry.UserID, entry.Action, entry.EntityType, entry.EntityID,
+			nullJSON(entry.OldValue), nullJSON(entry.NewValue), nullJSON(entry.Metadata),
+			entry.IPAddress, entry.UserAgent, entry.PrevHash, entry.Hash, entry.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		lastSeq, lastHash = entry.Seq, entry.Hash
+	}
+	return nil
+}
+
+// normalizeAuditEntry puts the snapshots and the IP in the form that is hashed
+func normalizeAuditEntry(entry *models.AuditLog) error {
+	var err error
+	if entry.OldValue, err = canonicalJSON(entry.OldValue); err != nil {
+		return err
+	}
+	if entry.NewValue, err = canonicalJSON(entry.NewValue); err != nil {
+		return err
+	}
+	if entry.Metadata, err = canonicalJSON(entry.Metadata); err != nil {
+		return err
+	}
+	if ip := net.ParseIP(entry.IPAddress); ip != nil {
+		entry.IPAddress = ip.String()
+	} else {
+		entry.IPAddress = ""
+	}
+	return nil
+}
+
+// Search returns the records matching the filter, newest first, with the total count
+func (r *AuditRepository) Search(ctx context.Context, f models.AuditFilter) ([]models.AuditLog, int, error) {
+	where := []string{"a.seq IS NOT NULL"}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Action != "" {
+		where = append(where, "a.action = "+arg(f.Action))
+	}
+	if f.EntityType != "" {
+		where = append(where, "a.entity_type = "+arg(f.EntityType))
+	}
+	if f.EntityID != nil {
+		where = append(where, "a.entity_id = "+arg(*f.EntityID))
+	}
+	if f.UserID != nil {
+		where = append(where, "a.user_id = "+arg(*f.UserID))
+	}
+	if f.From != nil {
+		where = append(where, "a.created_at >= "+arg(f.From.UTC()))
+	}
+	if f.To != nil {
+		where = append(where, "a.created_at < "+arg(f.To.UTC()))
+	}
+	if f.Query != "" {
+		p := arg("%" + f.Query + "%")
+		where = append(where, fmt.Sprintf(
+			"(a.old_value::text ILIKE %[1]s OR a.new_value::text ILIKE %[1]s OR a.metadata::text ILIKE %[1]s)", p))
+	}
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	if err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM audit_logs a WHERE "+whereSQL, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT a.id, a.seq, a.user_id, COALESCE(u.email, ''), a.action, COALESCE(a.entity_type, ''), a.entity_id,
+		       a.old_value, a.new_value, a.metadata, COALESCE(host(a.ip_address), ''), COALESCE(a.user_agent, ''),
+		       a.prev_hash, a.hash, a.created_at
+		FROM audit_logs a
+		LEFT JOIN users u ON u.id = a.user_id
+		WHERE ` + whereSQL + `
+		ORDER BY a.seq DESC
+		LIMIT ` + arg(f.Limit) + ` OFFSET ` + arg(f.Offset)
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	logs := []models.AuditLog{}
+	for rows.Next() {
+		var l models.AuditLog
+		if err := rows.Scan(&l.ID, &l.Seq, &l.UserID, &l.ActorEmail, &l.Action, &l.EntityType, &l.EntityID,
+			&l.OldValue, &l.NewValue, &l.Metadata, &l.IPAddress, &l.UserAgent,
+			&l.PrevHash, &l.Hash, &l.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		logs = append(logs, l)
+	}
+
+	return logs, total, rows.Err()
+}
+
+// Verify walks the whole chain and recomputes every hash.
+// It stops at the first record that was altered, removed or inserted out of order.
+func (r *AuditRepository) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT seq, user_id, action, COALESCE(entity_type, ''), entity_id,
+		       old_value, new_value, metadata, COALESCE(host(ip_address), ''), COALESCE(user_agent, ''),
+		       prev_hash, hash, created_at
+		FROM audit_logs
+		WHERE seq IS NOT NULL
+		ORDER BY seq
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &models.AuditVerification{Valid: true}
+	expectedSeq := int64(1)
+	prevHash := auditGenesisHash
+
+	for rows.Next() {
+		var l models.AuditLog
+		if err := rows.Scan(&l.Seq, &l.UserID, &l.Action, &l.EntityType, &l.EntityID,
+			&l.OldValue, &l.NewValue, &l.Metadata, &l.IPAddress, &l.UserAgent,
+			&l.PrevHash, &l.Hash, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		broken := ""
+		switch {
+		case l.Seq != expectedSeq:
+			broken = fmt.Sprintf("record mancante: atteso seq %d", expectedSeq)
+		case l.PrevHash != prevHash:
+			broken = "collegamento al record precedente non valido"
+		default:
+			// JSONB doesn't keep the original formatting: hash the canonical form
+			l.OldValue, _ = canonicalJSON(l.OldValue)
+			l.NewValue, _ = canonicalJSON(l.NewValue)
+			l.Metadata, _ = canonicalJSON(l.Metadata)
+			l.CreatedAt = l.CreatedAt.UTC()
+			if auditHash(&l) != l.Hash {
+				broken = "contenuto modificato"
+			}
+		}
+		if broken != "" {
+			seq := l.Seq
+			result.Valid = false
+			result.BrokenAtSeq = &seq
+			result.Reason = broken
+			return result, nil
+		}
+
+		result.Checked++
+		expectedSeq++
+		prevHash = l.Hash
+	}
+
+	return result, rows.Err()
+}
+
+// auditHash is SHA-256 over the previous hash and every stored field
+func auditHash(l *models.AuditLog) string {
+	fields, _ := json.Marshal([]interface{}{
+		l.Seq, l.PrevHash, l.CreatedAt.Format(time.RFC3339Nano),
+		l.UserID, l.Action, l.EntityType, l.EntityID,
+		l.OldValue, l.NewValue, l.Metadata,
+		l.IPAddress, l.UserAgent,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON re-encodes a JSON value with sorted keys and no whitespace,
+// so it hashes the same before and after a round trip through JSONB
+func canonicalJSON(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// nullJSON stores an empty value as SQL NULL
+func nullJSON(raw json.RawMessage) interface{} {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
@@ -2,13 +2,30 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/gecogreen/backend/internal/models"
 )
 
+var (
+	ErrCategoryNotFound      = errors.New("category not found")
+	ErrCategorySlugTaken     = errors.New("category slug already in use")
+	ErrCategoryCycle         = errors.New("category cannot be moved under itself")
+	ErrCategoryTooDeep       = errors.New("category tree too deep")
+	ErrCategoryNotEmpty      = errors.New("category has products or subcategories")
+	ErrCategoryOrderMismatch = errors.New("ids don't match the children of the parent")
+)
+
+// categoryTreeLock is the advisory lock key serializing changes to the tree,
+// so concurrent moves can't create a cycle
+const categoryTreeLock = 0x63617465 // "cate"
+
 type CategoryRepository struct {
 	pool *pgxpool.Pool
 }
@@ -17,12 +34,18 @@ func NewCategoryRepository(pool *pgxpool.Pool) *CategoryRepository {
 	return &CategoryRepository{pool: pool}
 }
 
-// List returns all categories ordered by sort_order
+const categoryColumns = `id, name, slug, COALESCE(description, ''), COALESCE(icon, ''), parent_id, sort_order, COALESCE(is_active, TRUE)`
+
+func scanCategory(row pgx.Row, cat *models.Category) error {
+	return row.Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.Description, &cat.Icon, &cat.ParentID, &cat.SortOrder, &cat.IsActive)
+}
+
+// List returns the active root categories ordered by sort_order
 func (r *CategoryRepository) List(ctx context.Context) ([]models.Category, error) {
 	query := `
-		SELECT id, name, slug, COALESCE(icon, ''), parent_id, sort_order
+		SELECT ` + categoryColumns + `
 		FROM categories
-		WHERE parent_id IS NULL
+		WHERE parent_id IS NULL AND COALESCE(is_active, TRUE)
 		ORDER BY sort_order, name
 	`
 
@@ -35,26 +58,24 @@ func (r *CategoryRepository) List(ctx context.Context) ([]models.Category, error
 	var categories []models.Category
 	for rows.Next() {
 		var cat models.Category
-		err := rows.Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.Icon, &cat.ParentID, &cat.SortOrder)
-		if err != nil {
+		if err := scanCategory(rows, &cat); err != nil {
 			return nil, err
 		}
 		categories = append(categories, cat)
 	}
 
-	return categories, nil
+	return categories, rows.Err()
 }
 
 // GetByID returns a category by ID
 func (r *CategoryRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Category, error) {
-	query := `
-		SELECT id, name, slug, COALESCE(icon, ''), parent_id, sort_order
-		FROM categories
-		WHERE id = $1
-	`
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = $1`
 
 	var cat models.Category
-	err := r.pool.QueryRow(ctx, query, id).Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.Icon, &cat.ParentID, &cat.SortOrder)
+	err := scanCategory(r.pool.QueryRow(ctx, query, id), &cat)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCategoryNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -64,17 +85,447 @@ func (r *CategoryRepository) GetByID(ctx context.Context, id uuid.UUID) (*models
 
 // GetBySlug returns a category by slug
 func (r *CategoryRepository) GetBySlug(ctx context.Context, slug string) (*models.Category, error) {
-	query := `
-		SELECT id, name, slug, COALESCE(icon, ''), parent_id, sort_order
-		FROM categories
-		WHERE slug = $1
-	`
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE slug = $1`
 
 	var cat models.Category
-	err := r.pool.QueryRow(ctx, query, slug).Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.Icon, &cat.ParentID, &cat.SortOrder)
+	err := scanCategory(r.pool.QueryRow(ctx, query, slug), &cat)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCategoryNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &cat, nil
 }
+
+// Tree returns the root categories with their children nested, ordered by
+// sort_order. Each node counts the active products in its whole subtree.
+// Without includeInactive, inactive categories are left out with their children.
+func (r *CategoryRepository) Tree(ctx context.Context, includeInactive bool) ([]*models.CategoryNode, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories
+		ORDER BY sort_order, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*models.CategoryNode
+	for rows.Next() {
+		node := &models.CategoryNode{Children: []*models.CategoryNode{}}
+		if err := scanCategory(rows, &node.Category); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uuid.UUID]int)
+	countRows, err := r.pool.Query(ctx, `
+		SELECT category_id, COUNT(*)
+		FROM products
+		WHERE status = 'ACTIVE' AND category_id IS NOT NULL
+		GROUP BY category_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer countRows.Close()
+	for countRows.Next() {
+		var id uuid.UUID
+		var count int
+		if err := countRows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+	if err := countRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildCategoryTree(nodes, counts, includeInactive), nil
+}
+
+// buildCategoryTree nests the nodes (already in sibling order) under their parents
+// and sums the product counts up the tree
+func buildCategoryTree(nodes []*models.CategoryNode, counts map[uuid.UUID]int, includeInactive bool) []*models.CategoryNode {
+	byID := make(map[uuid.UUID]*models.CategoryNode, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, node := range nodes {
+		if !includeInactive && !node.IsActive {
+			continue
+		}
+		if node.ParentID == nil {
+			roots = append(roots, node)
+		} else if parent, ok := byID[*node.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	var sum func(node *models.CategoryNode) int
+	sum = func(node *models.CategoryNode) int {
+		node.ProductCount = counts[node.ID]
+		for _, child := range node.Children {
+			node.ProductCount += sum(child)
+		}
+		return node.ProductCount
+	}
+	for _, root := range roots {
+		sum(root)
+	}
+	return roots
+}
+
+// Create adds a category at the end of its siblings. An empty slug is generated from the name.
+func (r *CategoryRepository) Create(ctx context.Context, cat *models.Category) error {
+	tx, links, err := r.beginTreeChange(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if cat.ParentID != nil {
+		if err := links.checkAddChild(*cat.ParentID); err != nil {
+			return err
+		}
+	}
+	if cat.Slug == "" {
+		cat.Slug = slugify(cat.Name, 100)
+	}
+
+	cat.ID = uuid.New()
+	cat.IsActive = true
+	if cat.SortOrder, err = nextSortOrder(ctx, tx, cat.ParentID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO categories (id, name, slug, description, icon, parent_id, sort_order, is_active)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, TRUE)
+	`, cat.ID, cat.Name, cat.Slug, cat.Description, cat.Icon, cat.ParentID, cat.SortOrder)
+	if err != nil {
+		if strings.Contains(err.Error(), "categories_slug_key") {
+			return ErrCategorySlugTaken
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Update saves the name, slug, description, icon and active flag of a category
+func (r *CategoryRepository) Update(ctx context.Context, cat *models.Category) error {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE categories
+		SET name = $2, slug = $3, description = NULLIF($4, ''), icon = NULLIF($5, ''),
+		    is_active = $6, updated_at = NOW()
+		WHERE id = $1
+	`, cat.ID, cat.Name, cat.Slug, cat.Description, cat.Icon, cat.IsActive)
+	if err != nil {
+		if strings.Contains(err.Error(), "categories_slug_key") {
+			return ErrCategorySlugTaken
+		}
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// Move puts a category, with its subtree, at the end of the children of parentID
+// (nil for the roots). Returns ErrCategoryCycle when parentID is in the subtree
+// and ErrCategoryTooDeep when the subtree wouldn't fit in MaxCategoryDepth.
+func (r *CategoryRepository) Move(ctx context.Context, id uuid.UUID, parentID *uuid.UUID) error {
+	tx, links, err := r.beginTreeChange(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := links.checkMove(id, parentID); err != nil {
+		return err
+	}
+
+	sortOrder, err := nextSortOrder(ctx, tx, parentID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE categories SET parent_id = $2, sort_order = $3, updated_at = NOW() WHERE id = $1
+	`, id, parentID, sortOrder); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Reorder sets the order of the children of parentID (nil for the roots).
+// ids must list every child exactly once.
+func (r *CategoryRepository) Reorder(ctx context.Context, parentID *uuid.UUID, ids []uuid.UUID) error {
+	tx, links, err := r.beginTreeChange(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if parentID != nil {
+		if _, ok := links[*parentID]; !ok {
+			return ErrCategoryNotFound
+		}
+	}
+
+	children := make(map[uuid.UUID]bool)
+	for id, parent := range links {
+		if (parent == nil && parentID == nil) || (parent != nil && parentID != nil && *parent == *parentID) {
+			children[id] = true
+		}
+	}
+	if len(ids) != len(children) {
+		return ErrCategoryOrderMismatch
+	}
+	for _, id := range ids {
+		if !children[id] {
+			return ErrCategoryOrderMismatch
+		}
+		delete(children, id) // a repeated id fails on its second occurrence
+	}
+
+	for i, id := range ids {
+		if _, err := tx.Exec(ctx, `
+			UPDATE categories SET sort_order = $2, updated_at = NOW() WHERE id = $1
+		`, id, i); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Merge moves the products and subcategories of source into target, then
+// deletes source. The subcategories go after the target's own children.
+func (r *CategoryRepository) Merge(ctx context.Context, sourceID, targetID uuid.UUID) (*models.CategoryMergeResult, error) {
+	tx, links, err := r.beginTreeChange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := links.checkMerge(sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	result := &models.CategoryMergeResult{SourceID: sourceID, TargetID: targetID}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE products SET category_id = $2, updated_at = NOW() WHERE category_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	result.ProductsMoved = tag.RowsAffected()
+
+	offset, err := nextSortOrder(ctx, tx, &targetID)
+	if err != nil {
+		return nil, err
+	}
+	tag, err = tx.Exec(ctx, `
+		UPDATE categories
+		SET parent_id = $2, sort_order = sort_order + $3, updated_at = NOW()
+		WHERE parent_id = $1
+	`, sourceID, targetID, offset)
+	if err != nil {
+		return nil, err
+	}
+	result.ChildrenMoved = tag.RowsAffected()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM categories WHERE id = $1`, sourceID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Delete removes a category without products (in any status) or subcategories;
+// use Merge to move them elsewhere first
+func (r *CategoryRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, links, err := r.beginTreeChange(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, ok := links[id]; !ok {
+		return ErrCategoryNotFound
+	}
+	if links.height(id) > 1 {
+		return ErrCategoryNotEmpty
+	}
+
+	var hasProducts bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM products WHERE category_id = $1)
+	`, id).Scan(&hasProducts); err != nil {
+		return err
+	}
+	if hasProducts {
+		return ErrCategoryNotEmpty
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM categories WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// beginTreeChange starts a transaction holding the tree lock and loads the
+// parent of every category
+func (r *CategoryRepository) beginTreeChange(ctx context.Context) (pgx.Tx, categoryLinks, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fail := func(err error) (pgx.Tx, categoryLinks, error) {
+		tx.Rollback(ctx)
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", categoryTreeLock); err != nil {
+		return fail(err)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id, parent_id FROM categories`)
+	if err != nil {
+		return fail(err)
+	}
+	links := make(categoryLinks)
+	for rows.Next() {
+		var id uuid.UUID
+		var parentID *uuid.UUID
+		if err := rows.Scan(&id, &parentID); err != nil {
+			rows.Close()
+			return fail(err)
+		}
+		links[id] = parentID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fail(fmt.Errorf("load category tree: %w", err))
+	}
+	return tx, links, nil
+}
+
+// nextSortOrder is the position after the last child of parentID (nil for the roots)
+func nextSortOrder(ctx context.Context, tx pgx.Tx, parentID *uuid.UUID) (int, error) {
+	var next int
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(sort_order) + 1, 0) FROM categories WHERE parent_id IS NOT DISTINCT FROM $1
+	`, parentID).Scan(&next)
+	return next, err
+}
+
+// categoryLinks maps every category to its parent (nil for the roots)
+type categoryLinks map[uuid.UUID]*uuid.UUID
+
+// ancestors walks from id up to its root, id included. The walk is bounded,
+// so a corrupted tree can't loop forever.
+func (l categoryLinks) ancestors(id uuid.UUID) []uuid.UUID {
+	chain := []uuid.UUID{id}
+	for parent := l[id]; parent != nil && len(chain) <= len(l); parent = l[*parent] {
+		chain = append(chain, *parent)
+	}
+	return chain
+}
+
+// depth is the level of a category: 1 for the roots
+func (l categoryLinks) depth(id uuid.UUID) int {
+	return len(l.ancestors(id))
+}
+
+// inSubtree reports whether id is root or one of its descendants
+func (l categoryLinks) inSubtree(id, root uuid.UUID) bool {
+	for _, ancestor := range l.ancestors(id) {
+		if ancestor == root {
+			return true
+		}
+	}
+	return false
+}
+
+// height is how many levels the subtree of root spans: 1 for a leaf
+func (l categoryLinks) height(root uuid.UUID) int {
+	rootDepth, height := l.depth(root), 1
+	for id := range l {
+		if l.inSubtree(id, root) {
+			if h := l.depth(id) - rootDepth + 1; h > height {
+				height = h
+			}
+		}
+	}
+	return height
+}
+
+// checkAddChild reports whether a new category fits under parentID
+func (l categoryLinks) checkAddChild(parentID uuid.UUID) error {
+	if _, ok := l[parentID]; !ok {
+		return ErrCategoryNotFound
+	}
+	if l.depth(parentID)+1 > models.MaxCategoryDepth {
+		return ErrCategoryTooDeep
+	}
+	return nil
+}
+
+// checkMove reports whether the subtree of id can be moved under parentID
+// (nil for the roots)
+func (l categoryLinks) checkMove(id uuid.UUID, parentID *uuid.UUID) error {
+	if _, ok := l[id]; !ok {
+		return ErrCategoryNotFound
+	}
+
+	depth := 0
+	if parentID != nil {
+		if _, ok := l[*parentID]; !ok {
+			return ErrCategoryNotFound
+		}
+		if l.inSubtree(*parentID, id) {
+			return ErrCategoryCycle
+		}
+		depth = l.depth(*parentID)
+	}
+	if depth+l.height(id) > models.MaxCategoryDepth {
+		return ErrCategoryTooDeep
+	}
+	return nil
+}
+
+// checkMerge reports whether sourceID can be merged into targetID
+func (l categoryLinks) checkMerge(sourceID, targetID uuid.UUID) error {
+	if _, ok := l[sourceID]; !ok {
+		return ErrCategoryNotFound
+	}
+	if _, ok := l[targetID]; !ok {
+		return ErrCategoryNotFound
+	}
+	if l.inSubtree(targetID, sourceID) {
+		return ErrCategoryCycle
+	}
+	// The source's children take its place one level below the target
+	if l.depth(targetID)+l.height(sourceID)-1 > models.MaxCategoryDepth {
+		return ErrCategoryTooDeep
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testTree is food > fruit > apple, veg > leafy and drinks, as categoryLinks
+func testTree() (categoryLinks, map[string]uuid.UUID) {
+	ids := map[string]uuid.UUID{}
+	for _, name := range []string{"food", "fruit", "apple", "veg", "leafy", "drinks"} {
+		ids[name] = uuid.New()
+	}
+	parent := func(name string) *uuid.UUID {
+		id := ids[name]
+		return &id
+	}
+	links := categoryLinks{
+		ids["food"]:   nil,
+		ids["fruit"]:  parent("food"),
+		ids["apple"]:  parent("fruit"),
+		ids["veg"]:    nil,
+		ids["leafy"]:  parent("veg"),
+		ids["drinks"]: nil,
+	}
+	return links, ids
+}
+
+func TestCategoryLinksShape(t *testing.T) {
+	links, ids := testTree()
+
+	tests := []struct {
+		id         string
+		wantDepth  int
+		wantHeight int
+	}{
+		{"food", 1, 3},
+		{"fruit", 2, 2},
+		{"apple", 3, 1},
+		{"veg", 1, 2},
+		{"leafy", 2, 1},
+		{"drinks", 1, 1},
+	}
+
+	for _, tt := range tests {
+		if got := links.depth(ids[tt.id]); got != tt.wantDepth {
+			t.Errorf("depth(%s) = %d, want %d", tt.id, got, tt.wantDepth)
+		}
+		if got := links.height(ids[tt.id]); got != tt.wantHeight {
+			t.Errorf("height(%s) = %d, want %d", tt.id, got, tt.wantHeight)
+		}
+	}
+}
+
+func TestCategoryLinksCheckAddChild(t *testing.T) {
+	links, ids := testTree()
+
+	tests := []struct {
+		parent string
+		want   error
+	}{
+		{"food", nil},
+		{"fruit", nil},
+		{"leafy", nil},
+		{"apple", ErrCategoryTooDeep},
+		{"missing", ErrCategoryNotFound},
+	}
+
+	for _, tt := range tests {
+		if err := links.checkAddChild(ids[tt.parent]); !errors.Is(err, tt.want) {
+			t.Errorf("checkAddChild(%s) = %v, want %v", tt.parent, err, tt.want)
+		}
+	}
+}
+
+func TestCategoryLinksCheckMove(t *testing.T) {
+	links, ids := testTree()
+
+	tests := []struct {
+		id     string
+		parent string // empty for the roots
+		want   error
+	}{
+		{"apple", "veg", nil},
+		{"apple", "", nil},
+		{"fruit", "", nil},
+		{"fruit", "veg", nil},
+		{"veg", "food", nil},
+		{"fruit", "leafy", ErrCategoryTooDeep},
+		{"food", "drinks", ErrCategoryTooDeep},
+		{"fruit", "fruit", ErrCategoryCycle},
+		{"food", "apple", ErrCategoryCycle},
+		{"fruit", "apple", ErrCategoryCycle},
+		{"missing", "food", ErrCategoryNotFound},
+		{"fruit", "missing", ErrCategoryNotFound},
+	}
+
+	for _, tt := range tests {
+		var parentID *uuid.UUID
+		if tt.parent != "" {
+			id := ids[tt.parent]
+			parentID = &id
+		}
+		if err := links.checkMove(ids[tt.id], parentID); !errors.Is(err, tt.want) {
+			t.Errorf("checkMove(%s, %q) = %v, want %v", tt.id, tt.parent, err, tt.want)
+		}
+	}
+}
+
+func TestCategoryLinksCheckMerge(t *testing.T) {
+	links, ids := testTree()
+
+	tests := []struct {
+		source string
+		target string
+		want   error
+	}{
+		{"fruit", "veg", nil},
+		{"fruit", "leafy", nil},
+		{"apple", "food", nil},
+		{"veg", "fruit", nil},
+		{"food", "veg", nil},
+		{"food", "leafy", ErrCategoryTooDeep},
+		{"veg", "apple", ErrCategoryTooDeep},
+		{"fruit", "fruit", ErrCategoryCycle},
+		{"food", "apple", ErrCategoryCycle},
+		{"missing", "food", ErrCategoryNotFound},
+		{"food", "missing", ErrCategoryNotFound},
+	}
+
+	for _, tt := range tests {
+		if err := links.checkMerge(ids[tt.source], ids[tt.target]); !errors.Is(err, tt.want) {
+			t.Errorf("checkMerge(%s, %s) = %v, want %v", tt.source, tt.target, err, tt.want)
+		}
+	}
+}
+
+func TestCategoryLinksCorruptedLoop(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	links := categoryLinks{a: &b, b: &a}
+
+	if got := len(links.ancestors(a)); got > len(links)+1 {
+		t.Errorf("ancestors walked %d categories, want at most %d", got, len(links)+1)
+	}
+	if err := links.checkMove(a, &b); !errors.Is(err, ErrCategoryCycle) {
+		t.Errorf("checkMove on a loop = %v, want %v", err, ErrCategoryCycle)
+	}
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/geo"
+	"github.com/gecogreen/backend/internal/models"
+)
+
+// GeoRepository reads the offline CAP/comune table and stores the coordinates
+// found by the geocoding job. It implements geo.PlaceLookup.
+type GeoRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewGeoRepository(pool *pgxpool.Pool) *GeoRepository {
+	return &GeoRepository{pool: pool}
+}
+
+const placeColumns = `postal_code, comune, province, latitude::float8, longitude::float8`
+
+func (r *GeoRepository) getPlace(ctx context.Context, query string, args ...interface{}) (*geo.Place, error) {
+	var p geo.Place
+	err := r.pool.QueryRow(ctx, query, args...).Scan(
+		&p.PostalCode, &p.Comune, &p.Province, &p.Point.Lat, &p.Point.Lng,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, geo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ByPostalCode finds a CAP; with comune set, only that comune's row
+func (r *GeoRepository) ByPostalCode(ctx context.Context, postalCode, comune string) (*geo.Place, error) {
+	return r.getPlace(ctx, `
+		SELECT `+placeColumns+`
+		FROM geo_places
+		WHERE postal_code = $1 AND ($2 = '' OR LOWER(comune) = LOWER($2))
+		ORDER BY is_capital DESC, comune
+		LIMIT 1
+	`, postalCode, comune)
+}
+
+// ByComune finds a comune by name; a comune spanning several CAPs
+// prefers the row flagged as capital, then the lowest CAP
+func (r *GeoRepository) ByComune(ctx context.Context, comune, province string) (*geo.Place, error) {
+	return r.getPlace(ctx, `
+		SELECT `+placeColumns+`
+		FROM geo_places
+		WHERE LOWER(comune) = LOWER($1) AND ($2 = '' OR province = $2)
+		ORDER BY is_capital DESC, postal_code
+		LIMIT 1
+	`, comune, province)
+}
+
+// ProvinceCapital finds the capital of a province (sigla)
+func (r *GeoRepository) ProvinceCapital(ctx context.Context, province string) (*geo.Place, error) {
+	return r.getPlace(ctx, `
+		SELECT `+placeColumns+`
+		FROM geo_places
+		WHERE province = $1 AND is_capital = TRUE
+		ORDER BY postal_code
+		LIMIT 1
+	`, province)
+}
+
+// GetLocationsToGeocode returns active seller locations without coordinates,
+// skipping those that failed less than a day ago
+func (r *GeoRepository) GetLocationsToGeocode(ctx context.Context, limit int) ([]models.GeocodeTarget, error) {
+	return r.getTargets(ctx, `
+		SELECT id, COALESCE(address_street, ''), COALESCE(address_city, ''),
+		       COALESCE(address_province, ''), COALESCE(address_postal_code, ''),
+		       COALESCE(address_country, '')
+		FROM seller_locations
+		WHERE latitude IS NULL AND is_active = TRUE
+		  AND (geocoded_at IS NULL OR geocoded_at < NOW() - INTERVAL '1 day')
+		ORDER BY created_at
+		LIMIT $1
+	`, limit)
+}
+
+// GetProductsToGeocode returns products without coordinates. Products with no
+// address of their own use their first pickup location's; the street is never
+// read, since product coordinates are public.
+func (r *GeoRepository) GetProductsToGeocode(ctx context.Context, limit int) ([]models.GeocodeTarget, error) {
+	return r.getTargets(ctx, `
+		SELECT p.id, '',
+		       COALESCE(NULLIF(p.city, ''), l.address_city, ''),
+		       COALESCE(NULLIF(p.province, ''), l.address_province, ''),
+		       COALESCE(NULLIF(p.postal_code, ''), l.address_postal_code, ''),
+		       COALESCE(l.address_country, '')
+		FROM products p
+		LEFT JOIN seller_locations l ON l.id::text = p.pickup_location_ids->>0
+		WHERE p.latitude IS NULL AND p.status <> 'DELETED'
+		  AND (p.geocoded_at IS NULL OR p.geocoded_at < NOW() - INTERVAL '1 day')
+		ORDER BY p.created_at
+		LIMIT $1
+	`, limit)
+}
+
+func (r *GeoRepository) getTargets(ctx context.Context, query string, limit int) ([]models.GeocodeTarget, error) {
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []models.GeocodeTarget
+	for rows.Next() {
+		var t models.GeocodeTarget
+		if err := rows.Scan(
+			&t.ID, &t.Address.Street, &t.Address.City,
+			&t.Address.Province, &t.Address.PostalCode, &t.Address.Country,
+		); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// SetLocationCoordinates stores a geocoding result on a seller location
+func (r *GeoRepository) SetLocationCoordinates(ctx context.Context, id uuid.UUID, result *geo.Result) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE seller_locations
+		SET latitude = $2, longitude = $3, geocode_precision = $4, geocoded_at = NOW()
+		WHERE id = $1
+	`, id, result.Point.Lat, result.Point.Lng, string(result.Precision))
+	return err
+}
+
+// SetProductCoordinates stores a geocoding result on a product. Coordinates set
+// meanwhile by the seller are kept.
+func (r *GeoRepository) SetProductCoordinates(ctx context.Context, id uuid.UUID, result *geo.Result) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE products
+		SET latitude = $2, longitude = $3, geocode_precision = $4, geocoded_at = NOW()
+		WHERE id = $1 AND latitude IS NULL
+	`, id, result.Point.Lat, result.Point.Lng, string(result.Precision))
+	return err
+}
+
+// MarkLocationGeocodeFailed records a failed attempt, so it's retried tomorrow
+func (r *GeoRepository) MarkLocationGeocodeFailed(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `UPDATE seller_locations SET geocoded_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+// MarkProductGeocodeFailed records a failed attempt, so it's retried tomorrow
+func (r *GeoRepository) MarkProductGeocodeFailed(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `UPDATE products SET geocoded_at = NOW() WHERE id = $1`, id)
+	return err
+}
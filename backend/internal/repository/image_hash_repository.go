@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+// hammingSQL computes the Hamming distance between two BIGINT hashes.
+// Counting '1' chars of the bit string works on every PostgreSQL version
+// (bit_count() needs 14+).
+const hammingSQL = `length(replace(((%s # %s)::bit(64))::text, '0', ''))`
+
+// phashBandLayout splits a hash in the bands of image_hashes.phash_bands (see
+// migration 025_image_hash_bands.sql). Hashes within maxBandedDistance share at
+// least one band, so lookups can use the GIN index instead of a full scan.
+var phashBandLayout = [...]struct{ shift, bits uint }{
+	{58, 6}, {52, 6}, {46, 6}, {40, 6}, {34, 6}, {28, 6}, {22, 6}, {16, 6}, {10, 6}, {5, 5}, {0, 5},
+}
+
+const maxBandedDistance = len(phashBandLayout) - 1
+
+// phashBands returns the band values of a hash, each encoded as band * 64 + value
+func phashBands(hash uint64) []int32 {
+	bands := make([]int32, len(phashBandLayout))
+	for i, band := range phashBandLayout {
+		bands[i] = int32(i*64) + int32((hash>>band.shift)&(1<<band.bits-1))
+	}
+	return bands
+}
+
+type ImageHashRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewImageHashRepository(pool *pgxpool.Pool) *ImageHashRepository {
+	return &ImageHashRepository{pool: pool}
+}
+
+// Create stores the perceptual hash of an uploaded image
+func (r *ImageHashRepository) Create(ctx context.Context, h *models.ImageHash) error {
+	query := `
+		INSERT INTO image_hashes (id, user_id, product_id, image_url, image_type, phash, phash_bands, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (image_url) DO NOTHING
+	`
+
+	h.ID = uuid.New()
+	h.CreatedAt = time.Now()
+
+	_, err := r.pool.Exec(ctx, query,
+		h.ID, h.UserID, h.ProductID, h.ImageURL, h.ImageType, int64(h.Hash), phashBands(h.Hash), h.CreatedAt,
+	)
+	return err
+}
+
+// FindSimilar returns images of other users whose hash is within maxDistance,
+// closest first. Up to maxBandedDistance only the rows sharing a band are compared.
+func (r *ImageHashRepository) FindSimilar(ctx context.Context, hash uint64, excludeUserID uuid.UUID, maxDistance, limit int) ([]models.ImageHash, []int, error) {
+	args := []interface{}{int64(hash), excludeUserID, maxDistance, limit}
+	bandFilter := ""
+	if maxDistance <= maxBandedDistance {
+		bandFilter = "AND phash_bands && $5"
+		args = append(args, phashBands(hash))
+	}
+
+	query := `
+		SELECT id, user_id, product_id, image_url, image_type, phash, created_at,
+		       ` + hammingExpr("phash", "$1") + ` AS distance
+		FROM image_hashes
+		WHERE user_id <> $2
+		  ` + bandFilter + `
+		  AND ` + hammingExpr("phash", "$1") + ` <= $3
+		ORDER BY distance ASC, created_at ASC
+		LIMIT $4
+	`
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var matches []models.ImageHash
+	var distances []int
+	for rows.Next() {
+		var m models.ImageHash
+		var phash int64
+		var distance int
+		if err := rows.Scan(&m.ID, &m.UserID, &m.ProductID, &m.ImageURL, &m.ImageType, &phash, &m.CreatedAt, &distance); err != nil {
+			return nil, nil, err
+		}
+		m.Hash = uint64(phash)
+		matches = append(matches, m)
+		distances = append(distances, distance)
+	}
+
+	return matches, distances, nil
+}
+
+// GetDuplicateClusters groups images that match across different users.
+// Matching pairs are fetched from the database and merged into clusters
+// with a union-find, so A~B and B~C end up in the same group. Up to
+// maxBandedDistance the pairs are joined on a shared band (indexed), not on
+// every combination of rows.
+func (r *ImageHashRepository) GetDuplicateClusters(ctx context.Context, maxDistance, limit int) ([]models.ImageDuplicateCluster, error) {
+	bandJoin := ""
+	if maxDistance <= maxBandedDistance {
+		bandJoin = "AND a.phash_bands && b.phash_bands"
+	}
+
+	pairsQuery := `
+		SELECT a.id, b.id, ` + hammingExpr("a.phash", "b.phash") + ` AS distance
+		FROM image_hashes a
+		JOIN image_hashes b ON a.id < b.id AND a.user_id <> b.user_id ` + bandJoin + `
+		WHERE ` + hammingExpr("a.phash", "b.phash") + ` <= $1
+		ORDER BY distance ASC
+		LIMIT $2
+	`
+
+	// Cap the number of pairs, not clusters: a cluster of N images has up to N^2 pairs
+	rows, err := r.pool.Query(ctx, pairsQuery, maxDistance, limit*10)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := make(map[uuid.UUID]uuid.UUID)
+	var find func(id uuid.UUID) uuid.UUID
+	find = func(id uuid.UUID) uuid.UUID {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+
+	type pair struct {
+		a        uuid.UUID
+		distance int
+	}
+	var pairs []pair
+	for rows.Next() {
+		var a, b uuid.UUID
+		var distance int
+		if err := rows.Scan(&a, &b, &distance); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, ok := parent[a]; !ok {
+			parent[a] = a
+		}
+		if _, ok := parent[b]; !ok {
+			parent[b] = b
+		}
+		parent[find(a)] = find(b)
+		pairs = append(pairs, pair{a: a, distance: distance})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(parent) == 0 {
+		return []models.ImageDuplicateCluster{}, nil
+	}
+
+	maxDist := make(map[uuid.UUID]int)
+	for _, p := range pairs {
+		root := find(p.a)
+		if p.distance > maxDist[root] {
+			maxDist[root] = p.distance
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(parent))
+	for id := range parent {
+		ids = append(ids, id)
+	}
+
+	imgRows, err := r.pool.Query(ctx, `
+		SELECT id, user_id, product_id, image_url, image_type, phash, created_at
+		FROM image_hashes
+		WHERE id = ANY($1)
+		ORDER BY created_at ASC
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer imgRows.Close()
+
+	clusterIndex := make(map[uuid.UUID]int)
+	clusters := []models.ImageDuplicateCluster{}
+	for imgRows.Next() {
+		var img models.ImageHash
+		var phash int64
+		if err := imgRows.Scan(&img.ID, &img.UserID, &img.ProductID, &img.ImageURL, &img.ImageType, &phash, &img.CreatedAt); err != nil {
+			return nil, err
+		}
+		img.Hash = uint64(phash)
+
+		root := find(img.ID)
+		idx, ok := clusterIndex[root]
+		if !ok {
+			if len(clusters) >= limit {
+				continue
+			}
+			idx = len(clusters)
+			clusterIndex[root] = idx
+			clusters = append(clusters, models.ImageDuplicateCluster{MaxDistance: maxDist[root]})
+		}
+		clusters[idx].Images = append(clusters[idx].Images, img)
+	}
+
+	for i := range clusters {
+		users := make(map[uuid.UUID]bool)
+		for _, img := range clusters[i].Images {
+			users[img.UserID] = true
+		}
+		clusters[i].UserCount = len(users)
+	}
+
+	return clusters, nil
+}
+
+// hammingExpr builds the SQL Hamming distance expression for two hash operands
+func hammingExpr(a, b string) string {
+	return fmt.Sprintf(hammingSQL, a, b)
+}
@@ -24,8 +24,9 @@ func (r *ImageReviewRepository) Create(ctx context.Context, review *models.Image
 		INSERT INTO image_reviews (
 			id, user_id, product_id, image_url, image_type,
 			detected_text, detected_phone, detected_email, detected_url, confidence_score,
+			duplicate_of_url, duplicate_of_user_id, duplicate_distance,
 			status, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 
 	review.ID = uuid.New()
@@ -35,6 +36,7 @@ func (r *ImageReviewRepository) Create(ctx context.Context, review *models.Image
 	_, err := r.pool.Exec(ctx, query,
 		review.ID, review.UserID, review.ProductID, review.ImageURL, review.ImageType,
 		review.DetectedText, review.DetectedPhone, review.DetectedEmail, review.DetectedURL, review.Confidence,
+		review.DuplicateOfURL, review.DuplicateOfUserID, review.DuplicateDistance,
 		review.Status, review.CreatedAt,
 	)
 	return err
@@ -52,6 +54,7 @@ func (r *ImageReviewRepository) GetPending(ctx context.Context, limit, offset in
 	query := `
 		SELECT id, user_id, product_id, image_url, image_type,
 		       COALESCE(detected_text, ''), detected_phone, detected_email, detected_url, COALESCE(confidence_score, 0),
+		       duplicate_of_url, duplicate_of_user_id, duplicate_distance,
 		       status, reviewed_by, reviewed_at, COALESCE(rejection_reason, ''), created_at
 		FROM image_reviews
 		WHERE status = 'PENDING'
@@ -71,6 +74,7 @@ func (r *ImageReviewRepository) GetPending(ctx context.Context, limit, offset in
 		err := rows.Scan(
 			&rev.ID, &rev.UserID, &rev.ProductID, &rev.ImageURL, &rev.ImageType,
 			&rev.DetectedText, &rev.DetectedPhone, &rev.DetectedEmail, &rev.DetectedURL, &rev.Confidence,
+			&rev.DuplicateOfURL, &rev.DuplicateOfUserID, &rev.DuplicateDistance,
 			&rev.Status, &rev.ReviewedBy, &rev.ReviewedAt, &rev.RejectionReason, &rev.CreatedAt,
 		)
 		if err != nil {
@@ -87,6 +91,7 @@ func (r *ImageReviewRepository) GetByID(ctx context.Context, id uuid.UUID) (*mod
 	query := `
 		SELECT id, user_id, product_id, image_url, image_type,
 		       COALESCE(detected_text, ''), detected_phone, detected_email, detected_url, COALESCE(confidence_score, 0),
+		       duplicate_of_url, duplicate_of_user_id, duplicate_distance,
 		       status, reviewed_by, reviewed_at, COALESCE(rejection_reason, ''), created_at
 		FROM image_reviews
 		WHERE id = $1
@@ -96,6 +101,7 @@ func (r *ImageReviewRepository) GetByID(ctx context.Context, id uuid.UUID) (*mod
 	err := r.pool.QueryRow(ctx, query, id).Scan(
 		&rev.ID, &rev.UserID, &rev.ProductID, &rev.ImageURL, &rev.ImageType,
 		&rev.DetectedText, &rev.DetectedPhone, &rev.DetectedEmail, &rev.DetectedURL, &rev.Confidence,
+		&rev.DuplicateOfURL, &rev.DuplicateOfUserID, &rev.DuplicateDistance,
 		&rev.Status, &rev.ReviewedBy, &rev.ReviewedAt, &rev.RejectionReason, &rev.CreatedAt,
 	)
 	if err != nil {
@@ -104,26 +110,43 @@ func (r *ImageReviewRepository) GetByID(ctx context.Context, id uuid.UUID) (*mod
 	return rev, nil
 }
 
-// Approve marks an image review as approved
-func (r *ImageReviewRepository) Approve(ctx context.Context, reviewID, adminID uuid.UUID) error {
+// Approve marks an image review as approved and writes its audit records in
+// the same transaction
+func (r *ImageReviewRepository) Approve(ctx context.Context, reviewID, adminID uuid.UUID, entries ...*models.AuditLog) error {
 	query := `
 		UPDATE image_reviews
 		SET status = 'APPROVED', reviewed_by = $1, reviewed_at = $2
 		WHERE id = $3
 	`
-	_, err := r.pool.Exec(ctx, query, adminID, time.Now(), reviewID)
-	return err
+	return r.review(ctx, entries, query, adminID, time.Now(), reviewID)
 }
 
-// Reject marks an image review as rejected
-func (r *ImageReviewRepository) Reject(ctx context.Context, reviewID, adminID uuid.UUID, reason string) error {
+// Reject marks an image review as rejected and writes its audit records in
+// the same transaction
+func (r *ImageReviewRepository) Reject(ctx context.Context, reviewID, adminID uuid.UUID, reason string, entries ...*models.AuditLog) error {
 	query := `
 		UPDATE image_reviews
 		SET status = 'REJECTED', reviewed_by = $1, reviewed_at = $2, rejection_reason = $3
 		WHERE id = $4
 	`
-	_, err := r.pool.Exec(ctx, query, adminID, time.Now(), reason, reviewID)
-	return err
+	return r.review(ctx, entries, query, adminID, time.Now(), reason, reviewID)
+}
+
+// review runs a review decision and its audit records in one transaction
+func (r *ImageReviewRepository) review(ctx context.Context, entries []*models.AuditLog, query string, args ...interface{}) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return err
+	}
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 // GetStats returns moderation statistics
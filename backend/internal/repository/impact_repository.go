@@ -0,0 +1,820 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+var (
+	ErrImpactFactorNotFound = errors.New("impact factor not found")
+	ErrInsufficientCredits  = errors.New("insufficient eco credits")
+)
+
+// impactFactorLock is the advisory lock key serializing new factor versions
+const impactFactorLock = 0x696d7061 // "impa"
+
+// ImpactRepository reads and versions the impact factors (see migration 019_impact_factors.sql)
+type ImpactRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewImpactRepository(pool *pgxpool.Pool) *ImpactRepository {
+	return &ImpactRepository{pool: pool}
+}
+
+const impactFactorColumns = `
+	f.id, f.category_id, f.version, f.co2_kg::float8, f.water_l::float8, f.waste_kg::float8,
+	f.reference_kg::float8, COALESCE(f.note, ''), f.created_by, f.created_at, f.superseded_at`
+
+func scanImpactFactor(row pgx.Row, f *models.ImpactFactor) error {
+	return row.Scan(
+		&f.ID, &f.CategoryID, &f.Version, &f.CO2Kg, &f.WaterL, &f.WasteKg,
+		&f.ReferenceKg, &f.Note, &f.CreatedBy, &f.CreatedAt, &f.SupersededAt,
+	)
+}
+
+// FactorFor returns the factor in use for a category: its own, else the nearest
+// ancestor's, else the platform default. A nil categoryID gets the default.
+func (r *ImpactRepository) FactorFor(ctx context.Context, categoryID *uuid.UUID) (*models.ImpactFactor, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, 0 AS level FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id, a.level + 1
+			FROM categories c JOIN ancestors a ON c.id = a.parent_id
+			WHERE a.level < 10
+		)
+		SELECT ` + impactFactorColumns + `
+		FROM impact_factors f
+		LEFT JOIN ancestors a ON a.id = f.category_id
+		WHERE f.superseded_at IS NULL AND (a.id IS NOT NULL OR f.category_id IS NULL)
+		ORDER BY f.category_id IS NULL, a.level
+		LIMIT 1
+	`
+
+	var f models.ImpactFactor
+	err := scanImpactFactor(r.pool.QueryRow(ctx, query, categoryID), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrImpactFactorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ListCurrent returns the platform default followed by every category, in tree
+// order, with the factor it uses
+func (r *ImpactRepository) ListCurrent(ctx context.Context) ([]models.CategoryImpactFactor, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+impactFactorColumns+`
+		FROM impact_factors f
+		WHERE f.superseded_at IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var defaultFactor *models.ImpactFactor
+	own := make(map[uuid.UUID]*models.ImpactFactor)
+	for rows.Next() {
+		f := &models.ImpactFactor{}
+		if err := scanImpactFactor(rows, f); err != nil {
+			return nil, err
+		}
+		if f.CategoryID == nil {
+			defaultFactor = f
+		} else {
+			own[*f.CategoryID] = f
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	categoryRows, err := r.pool.Query(ctx, `
+		SELECT `+categoryColumns+` FROM categories ORDER BY sort_order, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer categoryRows.Close()
+
+	var nodes []*models.CategoryNode
+	links := make(categoryLinks)
+	for categoryRows.Next() {
+		node := &models.CategoryNode{}
+		if err := scanCategory(categoryRows, &node.Category); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		links[node.ID] = node.ParentID
+	}
+	if err := categoryRows.Err(); err != nil {
+		return nil, err
+	}
+
+	factors := []models.CategoryImpactFactor{{Factor: defaultFactor}}
+	var walk func(nodes []*models.CategoryNode)
+	walk = func(nodes []*models.CategoryNode) {
+		for _, node := range nodes {
+			entry := models.CategoryImpactFactor{
+				CategoryID:   &node.ID,
+				CategoryName: node.Name,
+				ParentID:     node.ParentID,
+				Factor:       defaultFactor,
+				Inherited:    true,
+			}
+			for _, id := range links.ancestors(node.ID) {
+				if f, ok := own[id]; ok {
+					entry.Factor, entry.Inherited = f, id != node.ID
+					break
+				}
+			}
+			factors = append(factors, entry)
+			walk(node.Children)
+		}
+	}
+	walk(buildCategoryTree(nodes, nil, true))
+
+	return factors, nil
+}
+
+// History returns every version of a category's own factor (nil for the
+// platform default), newest first
+func (r *ImpactRepository) History(ctx context.Context, categoryID *uuid.UUID) ([]models.ImpactFactor, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+impactFactorColumns+`
+		FROM impact_factors f
+		WHERE f.category_id IS NOT DISTINCT FROM $1
+		ORDER BY f.version DESC
+	`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	factors := []models.ImpactFactor{}
+	for rows.Next() {
+		var f models.ImpactFactor
+		if err := scanImpactFactor(rows, &f); err != nil {
+			return nil, err
+		}
+		factors = append(factors, f)
+	}
+	return factors, rows.Err()
+}
+
+// SetFactor saves factor as the next version of its category's factor,
+// superseding the one in use. ID, Version and CreatedAt are filled in.
+func (r *ImpactRepository) SetFactor(ctx context.Context, factor *models.ImpactFactor) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", impactFactorLock); err != nil {
+		return err
+	}
+
+	if factor.CategoryID != nil {
+		var exists bool
+		if err := tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)
+		`, factor.CategoryID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrCategoryNotFound
+		}
+	}
+
+	if err := tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(version), 0) + 1 FROM impact_factors WHERE category_id IS NOT DISTINCT FROM $1
+	`, factor.CategoryID).Scan(&factor.Version); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE impact_factors SET superseded_at = NOW()
+		WHERE category_id IS NOT DISTINCT FROM $1 AND superseded_at IS NULL
+	`, factor.CategoryID); err != nil {
+		return err
+	}
+
+	factor.ID = uuid.New()
+	err = tx.QueryRow(ctx, `
+		INSERT INTO impact_factors (id, category_id, version, co2_kg, water_l, waste_kg, reference_kg, note, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+		RETURNING created_at
+	`, factor.ID, factor.CategoryID, factor.Version, factor.CO2Kg, factor.WaterL, factor.WasteKg,
+		factor.ReferenceKg, factor.Note, factor.CreatedBy,
+	).Scan(&factor.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ClearFactor supersedes a category's own factor, so it inherits its parent's
+// (or the default) again. The platform default can't be cleared.
+func (r *ImpactRepository) ClearFactor(ctx context.Context, categoryID uuid.UUID) error {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE impact_factors SET superseded_at = NOW()
+		WHERE category_id = $1 AND superseded_at IS NULL
+	`, categoryID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrImpactFactorNotFound
+	}
+	return nil
+}
+
+// PostOrder posts the entries of a COMPLETED order to impact_logs and the
+// users' totals. An order is posted once: it returns no entries if the order
+// isn't completed or was posted already.
+func (r *ImpactRepository) PostOrder(ctx context.Context, orderID uuid.UUID) ([]models.ImpactLog, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	p := models.OrderPosting{OrderID: orderID}
+	var deliveryType string
+	err = tx.QueryRow(ctx, `
+		UPDATE orders o SET impact_posted_at = NOW()
+		WHERE o.id = $1 AND o.status = 'COMPLETED' AND o.impact_posted_at IS NULL
+		RETURNING o.buyer_id, o.seller_id, o.delivery_type::text,
+			COALESCE(o.co2_saved, 0), COALESCE(o.water_saved, 0), COALESCE(o.waste_saved, 0),
+			COALESCE(o.eco_credits_buyer, 0), COALESCE(o.eco_credits_seller, 0), o.created_at,
+			(SELECT COALESCE(title, '') FROM products WHERE id = o.product_id),
+			(SELECT expiry_date FROM products WHERE id = o.product_id)
+	`, orderID).Scan(
+		&p.BuyerID, &p.SellerID, &deliveryType,
+		&p.CO2Saved, &p.WaterSaved, &p.WasteSaved,
+		&p.EcoCreditsBuyer, &p.EcoCreditsSeller, &p.OrderedAt,
+		&p.ProductTitle, &p.ExpiryDate,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.DeliveryType = models.DeliveryType(deliveryType)
+
+	if _, err := lockImpactUsers(ctx, tx, p.BuyerID, p.SellerID); err != nil {
+		return nil, err
+	}
+
+	// First purchase/sale: no other one posted and not reversed
+	err = tx.QueryRow(ctx, `
+		SELECT
+			NOT EXISTS (
+				SELECT 1 FROM impact_logs l
+				WHERE l.user_id = $1 AND l.action_type = 'PURCHASE' AND l.order_id <> $3
+					AND NOT EXISTS (SELECT 1 FROM impact_logs rv WHERE rv.reverses_id = l.id)
+			),
+			NOT EXISTS (
+				SELECT 1 FROM impact_logs l
+				WHERE l.user_id = $2 AND l.action_type = 'SALE' AND l.order_id <> $3
+					AND NOT EXISTS (SELECT 1 FROM impact_logs rv WHERE rv.reverses_id = l.id)
+			)
+	`, p.BuyerID, p.SellerID, orderID).Scan(&p.FirstPurchase, &p.FirstSale)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := p.Entries()
+	for i := range entries {
+		if err := insertImpactLog(ctx, tx, &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, tx.Commit(ctx)
+}
+
+// ReverseOrder posts an ORDER_REVERSAL for every entry of a REFUNDED order. An
+// order is reversed once: it returns no entries if the order isn't refunded,
+// was never posted or was reversed already.
+func (r *ImpactRepository) ReverseOrder(ctx context.Context, orderID uuid.UUID) ([]models.ImpactLog, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var buyerID, sellerID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		UPDATE orders SET impact_reversed_at = NOW()
+		WHERE id = $1 AND status = 'REFUNDED' AND impact_posted_at IS NOT NULL AND impact_reversed_at IS NULL
+		RETURNING buyer_id, seller_id
+	`, orderID).Scan(&buyerID, &sellerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := lockImpactUsers(ctx, tx, buyerID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, user_id, order_id, action_type::text, co2_saved, water_saved, COALESCE(waste_saved, 0),
+			eco_credits_earned, eco_credits_spent, COALESCE(description, '')
+		FROM impact_logs
+		WHERE order_id = $1 AND reverses_id IS NULL AND action_type <> 'ORDER_REVERSAL'
+		ORDER BY created_at
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	var reversals []models.ImpactLog
+	for rows.Next() {
+		var l models.ImpactLog
+		var actionType string
+		if err := rows.Scan(
+			&l.ID, &l.UserID, &l.OrderID, &actionType, &l.CO2Saved, &l.WaterSaved, &l.WasteSaved,
+			&l.EcoCreditsEarned, &l.EcoCreditsSpent, &l.Description,
+		); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		l.ActionType = models.ImpactActionType(actionType)
+
+		// Credits already spent can't be taken back: the balance can't go negative
+		reversal := l.Reversal()
+		if short := reversal.EcoCreditsSpent - reversal.EcoCreditsEarned - balances[l.UserID]; short > 0 {
+			reversal.EcoCreditsSpent -= short
+			reversal.Description += fmt.Sprintf(" (%d EcoCredits già spesi)", short)
+		}
+		balances[l.UserID] += reversal.EcoCreditsEarned - reversal.EcoCreditsSpent
+		reversals = append(reversals, reversal)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range reversals {
+		if err := insertImpactLog(ctx, tx, &reversals[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return reversals, tx.Commit(ctx)
+}
+
+// OrdersToSettle returns completed orders not posted yet and refunded orders
+// not reversed yet, oldest change first
+func (r *ImpactRepository) OrdersToSettle(ctx context.Context, limit int) (post, reverse []uuid.UUID, err error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, status = 'REFUNDED'
+		FROM orders
+		WHERE (status = 'COMPLETED' AND impact_posted_at IS NULL)
+			OR (status = 'REFUNDED' AND impact_posted_at IS NOT NULL AND impact_reversed_at IS NULL)
+		ORDER BY updated_at
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var refunded bool
+		if err := rows.Scan(&id, &refunded); err != nil {
+			return nil, nil, err
+		}
+		if refunded {
+			reverse = append(reverse, id)
+		} else {
+			post = append(post, id)
+		}
+	}
+	return post, reverse, rows.Err()
+}
+
+// ReconcileCredits recomputes every balance from the ledger and records the
+// users whose cached balance differs in eco_credits_drift (dropping those that
+// match again). Ledger and balances are read in one snapshot, so postings in
+// flight don't show up as drift. Returns the number of drifting users.
+func (r *ImpactRepository) ReconcileCredits(ctx context.Context) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var drifting int
+	err = tx.QueryRow(ctx, `
+		WITH ledger AS (
+			SELECT user_id, SUM(COALESCE(eco_credits_earned, 0) - COALESCE(eco_credits_spent, 0))::int AS balance
+			FROM impact_logs
+			WHERE user_id IS NOT NULL
+			GROUP BY user_id
+		), drift AS (
+			SELECT u.id AS user_id, COALESCE(l.balance, 0) AS ledger_balance, COALESCE(u.eco_credits, 0) AS stored_balance
+			FROM users u
+			LEFT JOIN ledger l ON l.user_id = u.id
+			WHERE COALESCE(l.balance, 0) <> COALESCE(u.eco_credits, 0)
+		), upserted AS (
+			INSERT INTO eco_credits_drift (user_id, ledger_balance, stored_balance)
+			SELECT user_id, ledger_balance, stored_balance FROM drift
+			ON CONFLICT (user_id) DO UPDATE SET
+				ledger_balance = EXCLUDED.ledger_balance,
+				stored_balance = EXCLUDED.stored_balance,
+				checked_at = NOW()
+			RETURNING user_id
+		), resolved AS (
+			DELETE FROM eco_credits_drift
+			WHERE user_id NOT IN (SELECT user_id FROM drift)
+		)
+		SELECT COUNT(*) FROM upserted
+	`).Scan(&drifting)
+	if err != nil {
+		return 0, err
+	}
+
+	return drifting, tx.Commit(ctx)
+}
+
+// ListCreditDrift returns the drift found by the last reconciliation, largest first
+func (r *ImpactRepository) ListCreditDrift(ctx context.Context) ([]models.CreditDrift, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT d.user_id, u.email, u.first_name, u.last_name, d.ledger_balance, d.stored_balance,
+			d.first_detected_at, d.checked_at
+		FROM eco_credits_drift d
+		JOIN users u ON u.id = d.user_id
+		ORDER BY ABS(d.stored_balance - d.ledger_balance) DESC, d.first_detected_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drift := []models.CreditDrift{}
+	for rows.Next() {
+		var d models.CreditDrift
+		if err := rows.Scan(
+			&d.UserID, &d.Email, &d.FirstName, &d.LastName, &d.LedgerBalance, &d.StoredBalance,
+			&d.FirstDetectedAt, &d.CheckedAt,
+		); err != nil {
+			return nil, err
+		}
+		d.Drift = d.StoredBalance - d.LedgerBalance
+		drift = append(drift, d)
+	}
+	return drift, rows.Err()
+}
+
+// CreditExpirations returns a user's balance and the credits still to expire,
+// grouped by expiry day (lifetime after they were earned), soonest first. Both
+// are read from the same snapshot, so they always add up.
+func (r *ImpactRepository) CreditExpirations(ctx context.Context, userID uuid.UUID, lifetime time.Duration) (int, []models.CreditExpiration, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var balance int
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(eco_credits, 0) FROM users WHERE id = $1
+	`, userID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT (earned_at + make_interval(secs => $2))::date AS expires_on, SUM(remaining)::int
+		FROM eco_credit_lots
+		WHERE user_id = $1 AND remaining > 0
+		GROUP BY expires_on
+		ORDER BY expires_on
+	`, userID, lifetime.Seconds())
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	expirations := []models.CreditExpiration{}
+	for rows.Next() {
+		var e models.CreditExpiration
+		if err := rows.Scan(&e.ExpiresOn, &e.Credits); err != nil {
+			return 0, nil, err
+		}
+		expirations = append(expirations, e)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	return balance, expirations, nil
+}
+
+// CreditsToWarn returns the users with credits earned before earnedBefore that
+// are still unspent and weren't warned about yet
+func (r *ImpactRepository) CreditsToWarn(ctx context.Context, earnedBefore time.Time, limit int) ([]models.CreditExpiryNotice, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT u.id, u.email, u.first_name, SUM(l.remaining)::int, MIN(l.earned_at)
+		FROM eco_credit_lots l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.remaining > 0 AND l.warned_at IS NULL AND l.earned_at < $1
+			AND u.deleted_at IS NULL AND u.status = 'ACTIVE'
+		GROUP BY u.id, u.email, u.first_name
+		ORDER BY MIN(l.earned_at)
+		LIMIT $2
+	`, earnedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notices []models.CreditExpiryNotice
+	for rows.Next() {
+		var n models.CreditExpiryNotice
+		if err := rows.Scan(&n.UserID, &n.Email, &n.FirstName, &n.Credits, &n.EarnedAt); err != nil {
+			return nil, err
+		}
+		notices = append(notices, n)
+	}
+	return notices, rows.Err()
+}
+
+// MarkCreditsWarned records that the user was warned about the lots CreditsToWarn returned
+func (r *ImpactRepository) MarkCreditsWarned(ctx context.Context, userID uuid.UUID, earnedBefore time.Time) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE eco_credit_lots SET warned_at = NOW()
+		WHERE user_id = $1 AND remaining > 0 AND warned_at IS NULL AND earned_at < $2
+	`, userID, earnedBefore)
+	return err
+}
+
+// UsersWithExpiredCredits returns the users with unspent credits earned before earnedBefore
+func (r *ImpactRepository) UsersWithExpiredCredits(ctx context.Context, earnedBefore time.Time, limit int) ([]uuid.UUID, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT DISTINCT user_id FROM eco_credit_lots
+		WHERE remaining > 0 AND earned_at < $1
+		LIMIT $2
+	`, earnedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ExpireCredits expires what's left of the user's lots earned before
+// earnedBefore, posting it as a POINTS_EXPIRED entry. Returns the credits expired.
+func (r *ImpactRepository) ExpireCredits(ctx context.Context, userID uuid.UUID, earnedBefore time.Time) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	balances, err := lockImpactUsers(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var lotIDs []uuid.UUID
+	var expiring int
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(array_agg(id), '{}'), COALESCE(SUM(remaining), 0)::int
+		FROM eco_credit_lots
+		WHERE user_id = $1 AND remaining > 0 AND earned_at < $2
+	`, userID, earnedBefore).Scan(&lotIDs, &expiring)
+	if err != nil {
+		return 0, err
+	}
+	if len(lotIDs) == 0 {
+		return 0, nil
+	}
+
+	// The expired lots are the oldest, so the entry consumes exactly them
+	if expiring > balances[userID] {
+		expiring = balances[userID]
+	}
+	if expiring > 0 {
+		entry := &models.ImpactLog{
+			UserID:          userID,
+			ActionType:      models.ImpactPointsExpired,
+			EcoCreditsSpent: expiring,
+			Description:     "EcoCredits scaduti",
+		}
+		if err := insertImpactLog(ctx, tx, entry); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE eco_credit_lots SET remaining = 0, expired_at = NOW() WHERE id = ANY($1)
+	`, lotIDs); err != nil {
+		return 0, err
+	}
+
+	return expiring, tx.Commit(ctx)
+}
+
+// lockImpactUsers locks the users rows an order posts to, in id order so two
+// postings can't deadlock, and returns their EcoCredits balances
+func lockImpactUsers(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) (map[uuid.UUID]int, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id, COALESCE(eco_credits, 0) FROM users WHERE id = ANY($1) ORDER BY id FOR UPDATE
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[uuid.UUID]int, len(ids))
+	for rows.Next() {
+		var id uuid.UUID
+		var balance int
+		if err := rows.Scan(&id, &balance); err != nil {
+			return nil, err
+		}
+		balances[id] = balance
+	}
+	return balances, rows.Err()
+}
+
+// insertImpactLog writes an entry and applies it to the user's totals within tx.
+// The balance update is conditional, so concurrent spends are serialized on the
+// user row and can't overdraw it: ErrInsufficientCredits if it would go negative.
+// ID, EcoCreditsBalance and CreatedAt are filled in.
+func insertImpactLog(ctx context.Context, tx pgx.Tx, log *models.ImpactLog) error {
+	delta := log.EcoCreditsEarned - log.EcoCreditsSpent
+	err := tx.QueryRow(ctx, `
+		UPDATE users SET
+			total_co2_saved = COALESCE(total_co2_saved, 0) + $2,
+			total_water_saved = COALESCE(total_water_saved, 0) + $3,
+			total_waste_saved = COALESCE(total_waste_saved, 0) + $4,
+			eco_credits = COALESCE(eco_credits, 0) + $5,
+			updated_at = NOW()
+		WHERE id = $1 AND COALESCE(eco_credits, 0) + $5 >= 0
+		RETURNING eco_credits
+	`, log.UserID, log.CO2Saved, log.WaterSaved, log.WasteSaved, delta,
+	).Scan(&log.EcoCreditsBalance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", log.UserID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+		return ErrInsufficientCredits
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "users_eco_credits_non_negative") {
+			return ErrInsufficientCredits
+		}
+		return err
+	}
+
+	log.ID = uuid.New()
+	err = tx.QueryRow(ctx, `
+		INSERT INTO impact_logs (
+			id, user_id, order_id, action_type, co2_saved, water_saved, waste_saved,
+			eco_credits_earned, eco_credits_spent, eco_credits_balance, description, reverses_id
+		) VALUES ($1, $2, $3, $4::impact_action_type, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING created_at
+	`, log.ID, log.UserID, log.OrderID, string(log.ActionType), log.CO2Saved, log.WaterSaved, log.WasteSaved,
+		log.EcoCreditsEarned, log.EcoCreditsSpent, log.EcoCreditsBalance, log.Description, log.ReversesID,
+	).Scan(&log.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	// Credits earned open a lot, credits spent consume the oldest lots
+	if log.EcoCreditsEarned > 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO eco_credit_lots (user_id, impact_log_id, amount, remaining, earned_at)
+			VALUES ($1, $2, $3, $3, $4)
+		`, log.UserID, log.ID, log.EcoCreditsEarned, log.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if log.EcoCreditsSpent > 0 {
+		return spendCredits(ctx, tx, log.UserID, log.EcoCreditsSpent, log.ReversesID)
+	}
+	return nil
+}
+
+// creditLot is an open lot of a user, as loaded by spendCredits
+type creditLot struct {
+	ID          uuid.UUID
+	ImpactLogID *uuid.UUID // entry that earned it
+	Remaining   int
+}
+
+// lotDebit is what a spend takes from one lot
+type lotDebit struct {
+	LotID  uuid.UUID
+	Amount int
+}
+
+// spendCredits consumes amount credits from the user's open lots, oldest first.
+// A reversal (reverses set) first cancels what is left of the lot opened by the
+// entry it reverses.
+func spendCredits(ctx context.Context, tx pgx.Tx, userID uuid.UUID, amount int, reverses *uuid.UUID) error {
+	rows, err := tx.Query(ctx, `
+		SELECT id, impact_log_id, remaining FROM eco_credit_lots
+		WHERE user_id = $1 AND remaining > 0
+		ORDER BY earned_at, id
+		FOR UPDATE
+	`, userID)
+	if err != nil {
+		return err
+	}
+	var lots []creditLot
+	for rows.Next() {
+		var lot creditLot
+		if err := rows.Scan(&lot.ID, &lot.ImpactLogID, &lot.Remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, lot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, debit := range spendFromLots(lots, amount, reverses) {
+		if _, err := tx.Exec(ctx, `
+			UPDATE eco_credit_lots SET remaining = remaining - $2 WHERE id = $1
+		`, debit.LotID, debit.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spendFromLots takes amount from lots in the given order (FIFO when they are
+// sorted by earned_at), starting from the lot earned by the reversed entry, if
+// any. Whatever the lots can't cover is not taken from any lot.
+func spendFromLots(lots []creditLot, amount int, reverses *uuid.UUID) []lotDebit {
+	if reverses != nil {
+		ordered := make([]creditLot, 0, len(lots))
+		for _, lot := range lots {
+			if lot.ImpactLogID != nil && *lot.ImpactLogID == *reverses {
+				ordered = append(ordered, lot)
+			}
+		}
+		for _, lot := range lots {
+			if lot.ImpactLogID == nil || *lot.ImpactLogID != *reverses {
+				ordered = append(ordered, lot)
+			}
+		}
+		lots = ordered
+	}
+
+	var debits []lotDebit
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
+		}
+		take := min(lot.Remaining, amount)
+		if take <= 0 {
+			continue
+		}
+		debits = append(debits, lotDebit{LotID: lot.ID, Amount: take})
+		amount -= take
+	}
+	return debits
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSpendFromLots(t *testing.T) {
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	earnedBy := uuid.New() // entry that opened the third lot
+	missing := uuid.New()
+	lots := []creditLot{
+		{ID: first, Remaining: 100},
+		{ID: second, Remaining: 50},
+		{ID: third, ImpactLogID: &earnedBy, Remaining: 25},
+	}
+
+	tests := []struct {
+		name     string
+		lots     []creditLot
+		amount   int
+		reverses *uuid.UUID
+		want     []lotDebit
+	}{
+		{"nothing to spend", lots, 0, nil, nil},
+		{"within the oldest lot", lots, 60, nil, []lotDebit{{first, 60}}},
+		{"exactly the oldest lot", lots, 100, nil, []lotDebit{{first, 100}}},
+		{"across lots", lots, 130, nil, []lotDebit{{first, 100}, {second, 30}}},
+		{"every lot", lots, 175, nil, []lotDebit{{first, 100}, {second, 50}, {third, 25}}},
+		{"more than the lots hold", lots, 500, nil, []lotDebit{{first, 100}, {second, 50}, {third, 25}}},
+		{"empty lots are skipped", []creditLot{{ID: first}, {ID: second, Remaining: 50}}, 20, nil, []lotDebit{{second, 20}}},
+		{"no lots", nil, 20, nil, nil},
+		{"reversal cancels its lot", lots, 25, &earnedBy, []lotDebit{{third, 25}}},
+		{"reversal of a partly spent lot", lots, 40, &earnedBy, []lotDebit{{third, 25}, {first, 15}}},
+		{"reversal of a spent lot", []creditLot{{ID: first, Remaining: 100}, {ID: third, ImpactLogID: &earnedBy}}, 25, &earnedBy, []lotDebit{{first, 25}}},
+		{"reversal without its lot", lots, 120, &missing, []lotDebit{{first, 100}, {second, 20}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spendFromLots(tt.lots, tt.amount, tt.reverses); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("spendFromLots(%d) = %+v, want %+v", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
@@ -59,7 +59,7 @@ func (r *LeaderboardRepository) GetLeaderboard(ctx context.Context, period model
 		WITH user_stats AS (
 			SELECT
 				u.id as user_id,
-				COALESCE(u.business_name, '') as business_name,
+				CASE WHEN u.account_type = 'BUSINESS' THEN COALESCE(u.business_name, '') ELSE '' END as business_name,
 				u.first_name,
 				u.last_name,
 				COALESCE(u.account_type::text, 'PRIVATE') as account_type,
@@ -246,7 +246,7 @@ func (r *LeaderboardRepository) GetAwardByID(ctx context.Context, id uuid.UUID)
 			COALESCE(a.youtube_url, ''), a.interview_status::text,
 			a.interview_scheduled_at, COALESCE(a.interview_notes, ''),
 			a.is_featured, a.is_public, a.created_at, a.published_at,
-			u.id, COALESCE(u.business_name, ''), u.first_name, u.last_name,
+			u.id, CASE WHEN u.account_type = 'BUSINESS' THEN COALESCE(u.business_name, '') ELSE '' END, u.first_name, u.last_name,
 			COALESCE(u.avatar_url, ''), COALESCE(u.city, '')
 		FROM awards a
 		JOIN users u ON a.user_id = u.id
@@ -336,7 +336,7 @@ func (r *LeaderboardRepository) GetFeaturedAwards(ctx context.Context, periodTyp
 			COALESCE(a.youtube_url, ''), a.interview_status::text,
 			a.interview_scheduled_at, COALESCE(a.interview_notes, ''),
 			a.is_featured, a.is_public, a.created_at, a.published_at,
-			u.id, COALESCE(u.business_name, ''), u.first_name, u.last_name,
+			u.id, CASE WHEN u.account_type = 'BUSINESS' THEN COALESCE(u.business_name, '') ELSE '' END, u.first_name, u.last_name,
 			COALESCE(u.avatar_url, ''), COALESCE(u.city, '')
 		FROM awards a
 		JOIN users u ON a.user_id = u.id
@@ -644,62 +644,17 @@ func (r *LeaderboardRepository) CreateTask(ctx context.Context, task *models.Adm
 // IMPACT LOG
 // =====================
 
-// AddImpactLog adds an impact log entry
+// AddImpactLog adds an impact log entry and applies it to the user's totals.
+// Spending more EcoCredits than the balance fails with ErrInsufficientCredits,
+// also when concurrent requests spend from the same balance.
 func (r *LeaderboardRepository) AddImpactLog(ctx context.Context, log *models.ImpactLog) error {
-	// First get current balance
-	var currentBalance int
-	err := r.pool.QueryRow(ctx,
-		"SELECT COALESCE(eco_credits, 0) FROM users WHERE id = $1",
-		log.UserID,
-	).Scan(&currentBalance)
-	if err != nil {
-		return err
-	}
-
-	log.ID = uuid.New()
-	log.EcoCreditsBalance = currentBalance + log.EcoCreditsEarned - log.EcoCreditsSpent
-	log.CreatedAt = time.Now()
-
-	// Start transaction
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	// Insert impact log
-	query := `
-		INSERT INTO impact_logs (
-			id, user_id, order_id, action_type, co2_saved, water_saved,
-			eco_credits_earned, eco_credits_spent, eco_credits_balance,
-			description, created_at
-		) VALUES ($1, $2, $3, $4::impact_action_type, $5, $6, $7, $8, $9, $10, $11)
-	`
-
-	_, err = tx.Exec(ctx, query,
-		log.ID, log.UserID, log.OrderID, string(log.ActionType),
-		log.CO2Saved, log.WaterSaved,
-		log.EcoCreditsEarned, log.EcoCreditsSpent, log.EcoCreditsBalance,
-		log.Description, log.CreatedAt,
-	)
-	if err != nil {
-		return err
-	}
-
-	// Update user totals
-	updateQuery := `
-		UPDATE users SET
-			total_co2_saved = COALESCE(total_co2_saved, 0) + $1,
-			total_water_saved = COALESCE(total_water_saved, 0) + $2,
-			eco_credits = $3,
-			updated_at = NOW()
-		WHERE id = $4
-	`
-
-	_, err = tx.Exec(ctx, updateQuery,
-		log.CO2Saved, log.WaterSaved, log.EcoCreditsBalance, log.UserID,
-	)
-	if err != nil {
+	if err := insertImpactLog(ctx, tx, log); err != nil {
 		return err
 	}
 
@@ -709,9 +664,9 @@ func (r *LeaderboardRepository) AddImpactLog(ctx context.Context, log *models.Im
 // GetUserImpactHistory returns impact history for a user
 func (r *LeaderboardRepository) GetUserImpactHistory(ctx context.Context, userID uuid.UUID, limit int) ([]models.ImpactLog, error) {
 	query := `
-		SELECT id, user_id, order_id, action_type::text, co2_saved, water_saved,
+		SELECT id, user_id, order_id, action_type::text, co2_saved, water_saved, COALESCE(waste_saved, 0),
 			eco_credits_earned, eco_credits_spent, eco_credits_balance,
-			COALESCE(description, ''), created_at
+			COALESCE(description, ''), reverses_id, created_at
 		FROM impact_logs
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -731,9 +686,9 @@ func (r *LeaderboardRepository) GetUserImpactHistory(ctx context.Context, userID
 
 		err := rows.Scan(
 			&log.ID, &log.UserID, &log.OrderID, &actionType,
-			&log.CO2Saved, &log.WaterSaved,
+			&log.CO2Saved, &log.WaterSaved, &log.WasteSaved,
 			&log.EcoCreditsEarned, &log.EcoCreditsSpent, &log.EcoCreditsBalance,
-			&log.Description, &log.CreatedAt,
+			&log.Description, &log.ReversesID, &log.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -756,7 +711,9 @@ func (r *LeaderboardRepository) GetCommunityStats(ctx context.Context) (*models.
 		SELECT
 			COALESCE(SUM(total_co2_saved), 0),
 			COALESCE(SUM(total_water_saved), 0),
-			COALESCE((SELECT SUM(trees_count) FROM trees_planted), 0),
+			COALESCE(SUM(total_waste_saved), 0),
+			COALESCE((SELECT SUM(trees_count) FROM trees_planted WHERE status = 'PLANTED'), 0),
+			COALESCE((SELECT trees_target FROM community_impact LIMIT 1), 0),
 			COALESCE((SELECT COUNT(*) FROM products WHERE deleted_at IS NULL), 0),
 			COUNT(*)
 		FROM users
@@ -767,7 +724,9 @@ func (r *LeaderboardRepository) GetCommunityStats(ctx context.Context) (*models.
 	err := r.pool.QueryRow(ctx, query).Scan(
 		&stats.TotalCO2Saved,
 		&stats.TotalWaterSaved,
+		&stats.TotalWasteSaved,
 		&stats.TotalTreesPlanted,
+		&stats.TreesTarget,
 		&stats.TotalProducts,
 		&stats.TotalUsers,
 	)
@@ -810,7 +769,7 @@ func (r *LeaderboardRepository) GetHallOfFame(ctx context.Context, periodType mo
 			COALESCE(a.youtube_url, ''), a.interview_status::text,
 			a.interview_scheduled_at, COALESCE(a.interview_notes, ''),
 			a.is_featured, a.is_public, a.created_at, a.published_at,
-			u.id, COALESCE(u.business_name, ''), u.first_name, u.last_name,
+			u.id, CASE WHEN u.account_type = 'BUSINESS' THEN COALESCE(u.business_name, '') ELSE '' END, u.first_name, u.last_name,
 			COALESCE(u.avatar_url, ''), COALESCE(u.city, '')
 		FROM awards a
 		JOIN users u ON a.user_id = u.id
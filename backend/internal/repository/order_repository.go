@@ -16,11 +16,18 @@ import (
 )
 
 var (
-	ErrOrderNotFound   = errors.New("order not found")
-	ErrDisputeNotFound = errors.New("dispute not found")
-	ErrCannotOrder     = errors.New("user cannot place orders (too many strikes)")
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrDisputeNotFound  = errors.New("dispute not found")
+	ErrDisputeFinal     = errors.New("dispute already resolved")
+	ErrEvidenceNotFound = errors.New("evidence not found")
+	ErrEvidenceLimit    = errors.New("evidence limit reached")
+	ErrCannotOrder      = errors.New("user cannot place orders (too many strikes)")
+	ErrReviewNotFound   = errors.New("review not found")
 )
 
+// closedOrderStatuses is the SQL list of finished orders; any other order still needs both parties
+const closedOrderStatuses = `('COMPLETED', 'CANCELLED', 'REFUNDED')`
+
 type OrderRepository struct {
 	pool *pgxpool.Pool
 }
@@ -60,6 +67,45 @@ func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error
 	order.StripeFee = round(order.TotalAmount*0.014 + 0.25)
 	order.SellerPayout = order.TotalAmount - order.PlatformFee - order.StripeFee
 
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// The seller's oldest commission waiver (redeemed with EcoCredits) covers
+	// the platform fee, up to its max_amount. The order only reserves it: the
+	// waiver is used once the order is paid (MarkAsPaid) and given back if the
+	// order is cancelled, e.g. when its checkout expires.
+	var waiverID uuid.UUID
+	var maxWaived *float64
+	hasWaiver := false
+	if order.PlatformFee > 0 {
+		err = tx.QueryRow(ctx, `
+			SELECT rr.id, (rr.config->>'max_amount')::float8
+			FROM redeemed_rewards rr
+			JOIN eco_rewards er ON er.id = rr.reward_id
+			WHERE rr.user_id = $1 AND er.reward_type = 'COMMISSION_WAIVER' AND rr.status = 'ACTIVE'
+				AND rr.applied_to_order_id IS NULL
+				AND (rr.expires_at IS NULL OR rr.expires_at > NOW())
+			ORDER BY rr.created_at
+			LIMIT 1
+			FOR UPDATE OF rr SKIP LOCKED
+		`, order.SellerID).Scan(&waiverID, &maxWaived)
+		hasWaiver = err == nil
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+	if hasWaiver {
+		order.PlatformFeeWaived = order.PlatformFee
+		if maxWaived != nil && *maxWaived < order.PlatformFeeWaived {
+			order.PlatformFeeWaived = round(*maxWaived)
+		}
+		order.PlatformFee -= order.PlatformFeeWaived
+		order.SellerPayout += order.PlatformFeeWaived
+	}
+
 	order.ID = uuid.New()
 	order.Status = models.OrderPending
 	order.CreatedAt = time.Now()
@@ -76,7 +122,9 @@ func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error
 			qr_code_token, qr_code_expires_at,
 			co2_saved, water_saved, eco_credits_buyer, eco_credits_seller,
 			buyer_notes,
-			created_at, updated_at
+			created_at, updated_at,
+			waste_saved, impact_factor_id, impact_factor_version,
+			platform_fee_waived
 		) VALUES (
 			$1, $2, $3, $4,
 			$5, $6, $7, $8,
@@ -87,11 +135,13 @@ func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error
 			$23, $24,
 			$25, $26, $27, $28,
 			$29,
-			$30, $31
+			$30, $31,
+			$32, $33, NULLIF($34, 0),
+			$35
 		)
 	`
 
-	_, err = r.pool.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
 		order.ID, order.BuyerID, order.SellerID, order.ProductID,
 		order.Quantity, order.UnitPrice, order.ShippingCost, order.TotalAmount,
 		order.PlatformFee, order.StripeFee, order.SellerPayout,
@@ -102,8 +152,32 @@ func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error
 		order.CO2Saved, order.WaterSaved, order.EcoCreditsBuyer, order.EcoCreditsSeller,
 		order.BuyerNotes,
 		order.CreatedAt, order.UpdatedAt,
+		order.WasteSaved, order.ImpactFactorID, order.ImpactFactorVersion,
+		order.PlatformFeeWaived,
 	)
+	if err != nil {
+		return err
+	}
+
+	if hasWaiver {
+		_, err = tx.Exec(ctx, `
+			UPDATE redeemed_rewards SET applied_to_order_id = $2 WHERE id = $1
+		`, waiverID, order.ID)
+		if err != nil {
+			return err
+		}
+	}
 
+	return tx.Commit(ctx)
+}
+
+// releaseCommissionWaiver gives back the commission waiver reserved or used by
+// an order that won't be sold (cancelled or refunded)
+func releaseCommissionWaiver(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE redeemed_rewards SET status = 'ACTIVE', used_at = NULL, applied_to_order_id = NULL
+		WHERE applied_to_order_id = $1 AND status IN ('ACTIVE', 'USED')
+	`, orderID)
 	return err
 }
 
@@ -114,6 +188,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Or
 			o.id, o.buyer_id, o.seller_id, o.product_id,
 			o.quantity, o.unit_price, COALESCE(o.shipping_cost, 0), o.total_amount,
 			COALESCE(o.platform_fee, 0), COALESCE(o.stripe_fee, 0), COALESCE(o.seller_payout, 0),
+			COALESCE(o.platform_fee_waived, 0),
 			o.status::text, o.delivery_type::text,
 			o.pickup_location_id, COALESCE(o.pickup_address, ''), COALESCE(o.pickup_instructions, ''), o.pickup_deadline,
 			COALESCE(o.shipping_address, ''), COALESCE(o.shipping_city, ''), COALESCE(o.shipping_province, ''),
@@ -123,6 +198,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Or
 			COALESCE(o.stripe_payment_intent_id, ''), COALESCE(o.stripe_checkout_session_id, ''), o.paid_at,
 			o.payout_scheduled_at, o.payout_completed_at,
 			COALESCE(o.co2_saved, 0), COALESCE(o.water_saved, 0), COALESCE(o.eco_credits_buyer, 0), COALESCE(o.eco_credits_seller, 0),
+			COALESCE(o.waste_saved, 0), o.impact_factor_id, COALESCE(o.impact_factor_version, 0),
 			COALESCE(o.buyer_notes, ''), COALESCE(o.seller_notes, ''),
 			o.created_at, o.updated_at, o.completed_at, o.cancelled_at, COALESCE(o.cancellation_reason, ''),
 			-- Buyer
@@ -149,6 +225,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Or
 		&order.ID, &order.BuyerID, &order.SellerID, &order.ProductID,
 		&order.Quantity, &order.UnitPrice, &order.ShippingCost, &order.TotalAmount,
 		&order.PlatformFee, &order.StripeFee, &order.SellerPayout,
+		&order.PlatformFeeWaived,
 		&status, &deliveryType,
 		&order.PickupLocationID, &order.PickupAddress, &order.PickupInstructions, &order.PickupDeadline,
 		&order.ShippingAddress, &order.ShippingCity, &order.ShippingProvince,
@@ -158,6 +235,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Or
 		&order.StripePaymentIntentID, &order.StripeCheckoutSessionID, &order.PaidAt,
 		&order.PayoutScheduledAt, &order.PayoutCompletedAt,
 		&order.CO2Saved, &order.WaterSaved, &order.EcoCreditsBuyer, &order.EcoCreditsSeller,
+		&order.WasteSaved, &order.ImpactFactorID, &order.ImpactFactorVersion,
 		&order.BuyerNotes, &order.SellerNotes,
 		&order.CreatedAt, &order.UpdatedAt, &order.CompletedAt, &order.CancelledAt, &order.CancellationReason,
 		// Buyer
@@ -298,11 +376,32 @@ func (r *OrderRepository) listOrders(ctx context.Context, buyerID, sellerID *uui
 	}, nil
 }
 
-// UpdateStatus updates order status
+// UpdateStatus updates order status. Cancelled and refunded orders give back
+// the seller's commission waiver.
 func (r *OrderRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status models.OrderStatus) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := updateOrderStatus(ctx, tx, id, status); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// updateOrderStatus sets the status of an order inside tx, giving back the
+// commission waiver of cancelled and refunded orders
+func updateOrderStatus(ctx context.Context, tx pgx.Tx, id uuid.UUID, status models.OrderStatus) error {
 	query := `UPDATE orders SET status = $1::order_status, updated_at = NOW() WHERE id = $2`
-	_, err := r.pool.Exec(ctx, query, string(status), id)
-	return err
+	if _, err := tx.Exec(ctx, query, string(status), id); err != nil {
+		return err
+	}
+	if status == models.OrderCancelled || status == models.OrderRefunded {
+		return releaseCommissionWaiver(ctx, tx, id)
+	}
+	return nil
 }
 
 // UpdateStripeSession saves the Stripe checkout session ID
@@ -312,8 +411,14 @@ func (r *OrderRepository) UpdateStripeSession(ctx context.Context, id uuid.UUID,
 	return err
 }
 
-// MarkAsPaid marks order as paid
+// MarkAsPaid marks order as paid and uses the commission waiver it reserved
 func (r *OrderRepository) MarkAsPaid(ctx context.Context, id uuid.UUID, paymentIntentID string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 		UPDATE orders SET
 			status = 'PAID'::order_status,
@@ -322,38 +427,75 @@ func (r *OrderRepository) MarkAsPaid(ctx context.Context, id uuid.UUID, paymentI
 			updated_at = NOW()
 		WHERE id = $2
 	`
-	_, err := r.pool.Exec(ctx, query, paymentIntentID, id)
-	return err
+	if _, err := tx.Exec(ctx, query, paymentIntentID, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE redeemed_rewards SET status = 'USED', used_at = NOW()
+		WHERE applied_to_order_id = $1 AND status = 'ACTIVE'
+	`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// UpdateTracking updates shipping tracking info
-func (r *OrderRepository) UpdateTracking(ctx context.Context, id uuid.UUID, trackingNumber, trackingURL, carrier string) error {
-	query := `
-		UPDATE orders SET
-			tracking_number = $1,
-			tracking_url = $2,
-			shipping_carrier = $3,
-			status = 'SHIPPED'::order_status,
-			shipped_at = NOW(),
-			updated_at = NOW()
-		WHERE id = $4
-	`
-	_, err := r.pool.Exec(ctx, query, trackingNumber, trackingURL, carrier, id)
-	return err
+// UpdateFulfillment applies a seller's update to an order in one transaction
+// with its audit records: the tracking info when trackingNumber is set (the
+// order is then SHIPPED), then the status when set
+func (r *OrderRepository) UpdateFulfillment(ctx context.Context, id uuid.UUID, status models.OrderStatus, trackingNumber, trackingURL, carrier string, entries ...*models.AuditLog) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if trackingNumber != "" {
+		query := `
+			UPDATE orders SET
+				tracking_number = $1,
+				tracking_url = $2,
+				shipping_carrier = $3,
+				status = 'SHIPPED'::order_status,
+				shipped_at = NOW(),
+				updated_at = NOW()
+			WHERE id = $4
+		`
+		if _, err := tx.Exec(ctx, query, trackingNumber, trackingURL, carrier, id); err != nil {
+			return err
+		}
+	}
+	if status != "" {
+		if err := updateOrderStatus(ctx, tx, id, status); err != nil {
+			return err
+		}
+	}
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// ConfirmPickup confirms pickup via QR code
-func (r *OrderRepository) ConfirmPickup(ctx context.Context, qrToken string) (*models.Order, error) {
+// ConfirmPickup confirms pickup via QR code. confirm is called with the order
+// before it is updated and returns the audit records of the confirmation, or
+// an error that leaves the order untouched.
+func (r *OrderRepository) ConfirmPickup(ctx context.Context, qrToken string, confirm func(orderID, sellerID uuid.UUID) ([]*models.AuditLog, error)) (*models.Order, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
 	// Find and validate order
 	query := `
-		SELECT id FROM orders
+		SELECT id, seller_id FROM orders
 		WHERE qr_code_token = $1
 			AND status IN ('PAID', 'READY_FOR_PICKUP')
 			AND (qr_code_expires_at IS NULL OR qr_code_expires_at > NOW())
+		FOR UPDATE
 	`
 
-	var orderID uuid.UUID
-	err := r.pool.QueryRow(ctx, query, qrToken).Scan(&orderID)
+	var orderID, sellerID uuid.UUID
+	err = tx.QueryRow(ctx, query, qrToken).Scan(&orderID, &sellerID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, errors.New("QR code non valido o scaduto")
@@ -361,6 +503,11 @@ func (r *OrderRepository) ConfirmPickup(ctx context.Context, qrToken string) (*m
 		return nil, err
 	}
 
+	entries, err := confirm(orderID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Update order
 	updateQuery := `
 		UPDATE orders SET
@@ -370,16 +517,21 @@ func (r *OrderRepository) ConfirmPickup(ctx context.Context, qrToken string) (*m
 			updated_at = NOW()
 		WHERE id = $1
 	`
-	_, err = r.pool.Exec(ctx, updateQuery, orderID)
-	if err != nil {
+	if _, err := tx.Exec(ctx, updateQuery, orderID); err != nil {
+		return nil, err
+	}
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
 
 	return r.GetByID(ctx, orderID)
 }
 
-// CancelOrder cancels an order
-func (r *OrderRepository) CancelOrder(ctx context.Context, id uuid.UUID, cancelledBy uuid.UUID, reason string) error {
+// CancelOrder cancels an order and writes its audit records in the same transaction
+func (r *OrderRepository) CancelOrder(ctx context.Context, id uuid.UUID, cancelledBy uuid.UUID, reason string, entries ...*models.AuditLog) error {
 	query := `
 		UPDATE orders SET
 			status = 'CANCELLED'::order_status,
@@ -389,14 +541,26 @@ func (r *OrderRepository) CancelOrder(ctx context.Context, id uuid.UUID, cancell
 			updated_at = NOW()
 		WHERE id = $3 AND status IN ('PENDING', 'PAID')
 	`
-	result, err := r.pool.Exec(ctx, query, cancelledBy, reason, id)
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, query, cancelledBy, reason, id)
 	if err != nil {
 		return err
 	}
 	if result.RowsAffected() == 0 {
 		return errors.New("ordine non cancellabile")
 	}
-	return nil
+	if err := releaseCommissionWaiver(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 // =====================
@@ -435,7 +599,13 @@ func (r *OrderRepository) CreateDispute(ctx context.Context, dispute *models.Dis
 	// Update order status
 	r.pool.Exec(ctx, "UPDATE orders SET status = 'DISPUTED'::order_status WHERE id = $1", dispute.OrderID)
 
-	return nil
+	// Attach the evidence the opener uploaded beforehand
+	_, err = r.pool.Exec(ctx, `
+		UPDATE dispute_evidence SET dispute_id = $1
+		WHERE order_id = $2 AND uploaded_by = $3 AND dispute_id IS NULL
+	`, dispute.ID, dispute.OrderID, dispute.OpenedBy)
+
+	return err
 }
 
 // GetDisputeByOrderID gets dispute for an order
@@ -472,6 +642,157 @@ func (r *OrderRepository) GetDisputeByOrderID(ctx context.Context, orderID uuid.
 	return dispute, nil
 }
 
+// ResolveDispute records staff's decision on a dispute still under discussion
+// and moves the order to its final status. A refunded order gives back the
+// seller's commission waiver. The audit records are written in the same transaction.
+func (r *OrderRepository) ResolveDispute(ctx context.Context, dispute *models.Dispute, orderStatus models.OrderStatus, entries ...*models.AuditLog) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		UPDATE disputes SET
+			status = $2::dispute_status, resolved_by = $3, resolution_notes = $4,
+			refund_amount = $5, seller_payout_amount = $6, resolved_at = NOW(), updated_at = NOW()
+		WHERE order_id = $1 AND status IN ('OPEN', 'SELLER_RESPONSE', 'BUYER_REVIEW', 'ADMIN_REVIEW')
+		RETURNING resolved_at, updated_at
+	`, dispute.OrderID, string(dispute.Status), dispute.ResolvedBy, dispute.ResolutionNotes,
+		dispute.RefundAmount, dispute.SellerPayoutAmount,
+	).Scan(&dispute.ResolvedAt, &dispute.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrDisputeFinal
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE orders SET status = $1::order_status, updated_at = NOW() WHERE id = $2`,
+		string(orderStatus), dispute.OrderID)
+	if err != nil {
+		return err
+	}
+	if orderStatus == models.OrderRefunded {
+		if err := releaseCommissionWaiver(ctx, tx, dispute.OrderID); err != nil {
+			return err
+		}
+	}
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AddDisputeEvidence records an uploaded evidence file, unless the party
+// already has limit files of its media type (ErrEvidenceLimit).
+// If the order already has a dispute the file is attached to it right away.
+func (r *OrderRepository) AddDisputeEvidence(ctx context.Context, ev *models.DisputeEvidence, limit int) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the order so concurrent uploads can't both pass the count
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, ev.OrderID); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM dispute_evidence
+		WHERE order_id = $1 AND party = $2 AND media_type = $3
+	`, ev.OrderID, ev.Party, ev.MediaType).Scan(&count); err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrEvidenceLimit
+	}
+
+	ev.ID = uuid.New()
+	ev.UploadedAt = time.Now()
+
+	query := `
+		INSERT INTO dispute_evidence (
+			id, order_id, dispute_id, uploaded_by, party, storage_key,
+			media_type, content_type, size_bytes, sha256, uploaded_at
+		) VALUES (
+			$1, $2, (SELECT id FROM disputes WHERE order_id = $2), $3, $4, $5,
+			$6, $7, $8, $9, $10
+		)
+		RETURNING dispute_id
+	`
+
+	if err := tx.QueryRow(ctx, query,
+		ev.ID, ev.OrderID, ev.UploadedBy, ev.Party, ev.StorageKey,
+		ev.MediaType, ev.ContentType, ev.SizeBytes, ev.SHA256, ev.UploadedAt,
+	).Scan(&ev.DisputeID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetDisputeEvidence returns all evidence of an order, oldest first
+func (r *OrderRepository) GetDisputeEvidence(ctx context.Context, orderID uuid.UUID) ([]models.DisputeEvidence, error) {
+	query := `
+		SELECT id, order_id, dispute_id, uploaded_by, party, storage_key,
+			media_type, content_type, size_bytes, sha256, uploaded_at
+		FROM dispute_evidence
+		WHERE order_id = $1
+		ORDER BY uploaded_at ASC
+	`
+
+	rows, err := r.pool.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	evidence := []models.DisputeEvidence{}
+	for rows.Next() {
+		var ev models.DisputeEvidence
+		if err := rows.Scan(
+			&ev.ID, &ev.OrderID, &ev.DisputeID, &ev.UploadedBy, &ev.Party, &ev.StorageKey,
+			&ev.MediaType, &ev.ContentType, &ev.SizeBytes, &ev.SHA256, &ev.UploadedAt,
+		); err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, ev)
+	}
+
+	return evidence, nil
+}
+
+// CountDisputeEvidence counts a party's evidence of the given media type for an order
+func (r *OrderRepository) CountDisputeEvidence(ctx context.Context, orderID uuid.UUID, party, mediaType string) (int, error) {
+	var count int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM dispute_evidence
+		WHERE order_id = $1 AND party = $2 AND media_type = $3
+	`, orderID, party, mediaType).Scan(&count)
+	return count, err
+}
+
+// DeleteDisputeEvidence deletes evidence not yet attached to a dispute and returns its storage key.
+// Attached evidence is immutable.
+func (r *OrderRepository) DeleteDisputeEvidence(ctx context.Context, evidenceID, userID uuid.UUID) (string, error) {
+	var key string
+	err := r.pool.QueryRow(ctx, `
+		DELETE FROM dispute_evidence
+		WHERE id = $1 AND uploaded_by = $2 AND dispute_id IS NULL
+		RETURNING storage_key
+	`, evidenceID, userID).Scan(&key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrEvidenceNotFound
+		}
+		return "", err
+	}
+	return key, nil
+}
+
 // =====================
 // REVIEWS
 // =====================
@@ -498,7 +819,7 @@ func (r *OrderRepository) CreateReview(ctx context.Context, review *models.Order
 func (r *OrderRepository) GetReviewsForUser(ctx context.Context, userID uuid.UUID, limit int) ([]models.OrderReview, error) {
 	query := `
 		SELECT r.id, r.order_id, r.reviewer_id, r.reviewed_id, r.rating, COALESCE(r.comment, ''), r.is_anonymous, r.created_at,
-			u.id, COALESCE(u.business_name, ''), u.first_name, u.last_name, COALESCE(u.avatar_url, '')
+			u.id, CASE WHEN u.account_type = 'BUSINESS' THEN COALESCE(u.business_name, '') ELSE '' END, u.first_name, u.last_name, COALESCE(u.avatar_url, '')
 		FROM order_reviews r
 		LEFT JOIN users u ON r.reviewer_id = u.id
 		WHERE r.reviewed_id = $1 AND r.is_approved = TRUE
@@ -526,6 +847,7 @@ func (r *OrderRepository) GetReviewsForUser(ctx context.Context, userID uuid.UUI
 
 		// Hide reviewer info if anonymous
 		if review.IsAnonymous {
+			review.ReviewerID = uuid.Nil
 			review.Reviewer = nil
 		}
 
@@ -535,6 +857,73 @@ func (r *OrderRepository) GetReviewsForUser(ctx context.Context, userID uuid.UUI
 	return reviews, nil
 }
 
+// ListReviewsForModeration returns the latest reviews, hidden ones included,
+// optionally only those about one user
+func (r *OrderRepository) ListReviewsForModeration(ctx context.Context, reviewedID *uuid.UUID, limit int) ([]models.OrderReview, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, order_id, reviewer_id, reviewed_id, rating, COALESCE(comment, ''), is_anonymous,
+			COALESCE(is_approved, TRUE), COALESCE(moderation_notes, ''), created_at
+		FROM order_reviews
+		WHERE $1::uuid IS NULL OR reviewed_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, reviewedID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []models.OrderReview{}
+	for rows.Next() {
+		var review models.OrderReview
+		err := rows.Scan(
+			&review.ID, &review.OrderID, &review.ReviewerID, &review.ReviewedID, &review.Rating,
+			&review.Comment, &review.IsAnonymous, &review.IsApproved, &review.ModerationNotes, &review.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// ModerateReview hides or restores a review. entriesFor is called with the review
+// as it was before and its records are written in the same transaction; the
+// previous review is returned.
+func (r *OrderRepository) ModerateReview(ctx context.Context, id uuid.UUID, approved bool, notes string, entriesFor func(before *models.OrderReview) []*models.AuditLog) (*models.OrderReview, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	review := &models.OrderReview{}
+	err = tx.QueryRow(ctx, `
+		UPDATE order_reviews r SET is_approved = $2, moderation_notes = NULLIF($3, ''), updated_at = NOW()
+		FROM order_reviews prev
+		WHERE r.id = $1 AND prev.id = r.id
+		RETURNING prev.id, prev.order_id, prev.reviewer_id, prev.reviewed_id, prev.rating,
+			COALESCE(prev.is_approved, TRUE), COALESCE(prev.moderation_notes, '')
+	`, id, approved, notes).Scan(
+		&review.ID, &review.OrderID, &review.ReviewerID, &review.ReviewedID, &review.Rating,
+		&review.IsApproved, &review.ModerationNotes,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+	if err := appendAuditEntries(ctx, tx, entriesFor(review)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
 // =====================
 // STRIKES
 // =====================
@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+var (
+	ErrDeletionNotRequested = errors.New("account deletion not requested")
+	ErrActiveOrders         = errors.New("user has orders in progress")
+)
+
+// PrivacyRepository serves the GDPR data export and account deletion
+type PrivacyRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPrivacyRepository(pool *pgxpool.Pool) *PrivacyRepository {
+	return &PrivacyRepository{pool: pool}
+}
+
+// exportSection is one JSON file of the data export
+type exportSection struct {
+	Name  string
+	Query string
+}
+
+// exportSections are the user's data, one JSON array each. Secrets (password and
+// TOTP hashes, tokens) and other users' personal data are left out.
+var exportSections = []exportSection{
+	{"profile", `
+		SELECT id, email, first_name, last_name, phone, city, province, postal_code, country,
+		       account_type, business_name, vat_number, has_multiple_locations,
+		       fiscal_code, sdi_code, pec_email, eu_vat_id, billing_address, billing_city,
+		       billing_province, billing_postal_code, billing_country,
+		       roles, status, email_verified, oauth_provider,
+		       google_id IS NOT NULL AS google_linked, apple_id IS NOT NULL AS apple_linked,
+		       facebook_id IS NOT NULL AS facebook_linked, COALESCE(totp_enabled, false) AS totp_enabled,
+		       avatar_url, social_links, business_photos,
+		       total_co2_saved, total_water_saved, total_waste_saved, eco_credits, eco_level, rating_avg, rating_count,
+		       created_at, updated_at, last_login_at, deletion_requested_at, deletion_scheduled_at
+		FROM users WHERE id = $1`},
+	{"locations", `
+		SELECT id, name, is_primary, is_active, address_street, address_city, address_province,
+		       address_postal_code, address_country, latitude, longitude, phone, email,
+		       pickup_hours, pickup_instructions, created_at, updated_at
+		FROM seller_locations WHERE user_id = $1 ORDER BY created_at`},
+	{"products", `
+		SELECT * FROM products WHERE seller_id = $1 ORDER BY created_at`},
+	{"orders_as_buyer", `
+		SELECT o.id, o.product_id, p.title AS product_title, o.quantity, o.unit_price, o.shipping_cost,
+		       o.total_amount, o.status, o.delivery_type, o.pickup_address, o.shipping_address,
+		       o.shipping_city, o.shipping_province, o.shipping_postal_code, o.shipping_country,
+		       o.tracking_number, o.shipping_carrier, o.buyer_notes, o.co2_saved, o.water_saved, o.waste_saved,
+		       o.eco_credits_buyer, o.created_at, o.paid_at, o.shipped_at, o.completed_at,
+		       o.cancelled_at, o.cancellation_reason
+		FROM orders o LEFT JOIN products p ON p.id = o.product_id
+		WHERE o.buyer_id = $1 ORDER BY o.created_at`},
+	{"orders_as_seller", `
+		SELECT o.id, o.product_id, p.title AS product_title, o.quantity, o.unit_price, o.shipping_cost,
+		       o.total_amount, o.platform_fee, o.stripe_fee, o.seller_payout, o.status, o.delivery_type,
+		       o.pickup_address, o.tracking_number, o.shipping_carrier, o.seller_notes,
+		       o.co2_saved, o.water_saved, o.waste_saved, o.eco_credits_seller, o.created_at, o.paid_at,
+		       o.shipped_at, o.completed_at, o.payout_completed_at, o.cancelled_at, o.cancellation_reason
+		FROM orders o LEFT JOIN products p ON p.id = o.product_id
+		WHERE o.seller_id = $1 ORDER BY o.created_at`},
+	{"reviews_written", `
+		SELECT id, order_id, reviewed_id, rating, comment, is_anonymous, created_at
+		FROM order_reviews WHERE reviewer_id = $1 ORDER BY created_at`},
+	{"reviews_received", `
+		SELECT id, order_id, rating, comment, created_at
+		FROM order_reviews WHERE reviewed_id = $1 AND is_approved = true ORDER BY created_at`},
+	{"impact_logs", `
+		SELECT id, order_id, action_type, co2_saved, water_saved, waste_saved, eco_credits_earned,
+		       eco_credits_spent, eco_credits_balance, description, metadata, created_at
+		FROM impact_logs WHERE user_id = $1 ORDER BY created_at`},
+	{"dispute_evidence", `
+		SELECT id, order_id, dispute_id, party, media_type, content_type, size_bytes, sha256, uploaded_at
+		FROM dispute_evidence WHERE uploaded_by = $1 ORDER BY uploaded_at`},
+	{"favorites", `
+		SELECT product_id, created_at FROM favorites WHERE user_id = $1 ORDER BY created_at`},
+	{"sessions", `
+		SELECT id, device_info, host(ip_address) AS ip_address, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions WHERE user_id = $1 ORDER BY created_at`},
+}
+
+// ExportData returns every export section as a JSON array, in order
+func (r *PrivacyRepository) ExportData(ctx context.Context, userID uuid.UUID) ([]models.ExportFile, error) {
+	files := make([]models.ExportFile, 0, len(exportSections))
+	for _, section := range exportSections {
+		var data json.RawMessage
+		query := `SELECT COALESCE(json_agg(t), '[]'::json) FROM (` + section.Query + `) t`
+		if err := r.pool.QueryRow(ctx, query, userID).Scan(&data); err != nil {
+			return nil, err
+		}
+		files = append(files, models.ExportFile{Name: section.Name, Data: data})
+	}
+	return files, nil
+}
+
+// GetUploadedFiles returns the files uploaded by the user and still in storage,
+// grouped by folder: deleted products keep their images until the sweeper runs,
+// and dispute evidence comes from the private bucket
+func (r *PrivacyRepository) GetUploadedFiles(ctx context.Context, userID uuid.UUID) ([]models.ExportUpload, error) {
+	query := `
+		SELECT 'avatar', avatar_url, false FROM users WHERE id = $1 AND COALESCE(avatar_url, '') <> ''
+		UNION ALL
+		SELECT 'business-photos', jsonb_array_elements_text(COALESCE(business_photos, '[]')), false FROM users WHERE id = $1
+		UNION ALL
+		SELECT 'products/' || id, jsonb_array_elements_text(COALESCE(images, '[]')), false
+		FROM products WHERE seller_id = $1
+		UNION ALL
+		SELECT 'products/' || id, expiry_photo_url, false
+		FROM products WHERE seller_id = $1 AND COALESCE(expiry_photo_url, '') <> ''
+		UNION ALL
+		SELECT 'dispute-evidence/' || order_id, storage_key, true
+		FROM dispute_evidence WHERE uploaded_by = $1
+	`
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []models.ExportUpload{}
+	for rows.Next() {
+		var u models.ExportUpload
+		if err := rows.Scan(&u.Folder, &u.URL, &u.Private); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+// CountActiveOrders counts the orders, as buyer or seller, that are not closed yet
+func (r *PrivacyRepository) CountActiveOrders(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM orders
+		WHERE (buyer_id = $1 OR seller_id = $1) AND status::text NOT IN `+closedOrderStatuses,
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+// RequestDeletion schedules the anonymisation of the account
+func (r *PrivacyRepository) RequestDeletion(ctx context.Context, userID uuid.UUID, scheduledAt time.Time) error {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE users
+		SET deletion_requested_at = NOW(), deletion_scheduled_at = $2, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, userID, scheduledAt)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CancelDeletion restores an account whose grace period is not over yet
+func (r *PrivacyRepository) CancelDeletion(ctx context.Context, userID uuid.UUID) error {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE users
+		SET deletion_requested_at = NULL, deletion_scheduled_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deletion_scheduled_at > NOW() AND deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDeletionNotRequested
+	}
+	return nil
+}
+
+// GetDueDeletions returns the accounts whose grace period is over
+func (r *PrivacyRepository) GetDueDeletions(ctx context.Context, limit int) ([]models.PendingDeletion, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_at <= NOW() AND deleted_at IS NULL
+		ORDER BY deletion_scheduled_at
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []models.PendingDeletion{}
+	for rows.Next() {
+		var p models.PendingDeletion
+		if err := rows.Scan(&p.UserID); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// Anonymize erases the personal data of an account whose grace period is over.
+// Orders, reviews and the audit log keep referencing the anonymised row; the billing
+// identity of users with paid orders is moved to retained_billing_data until retainUntil.
+// The user's stored files (avatar, business photos, expiry photos, dispute evidence)
+// are queued in file_deletions and the ACCOUNT_DELETED audit record is written, both
+// in the same transaction. Returns ErrActiveOrders if an order is still in progress
+// (the deletion is retried later) and whether billing data was retained.
+func (r *PrivacyRepository) Anonymize(ctx context.Context, userID uuid.UUID, retainUntil time.Time) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the row: a cancellation racing with the purge must not be lost
+	var due bool
+	err = tx.QueryRow(ctx, `
+		SELECT deletion_scheduled_at <= NOW() FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, userID).Scan(&due)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+	if !due {
+		return false, ErrDeletionNotRequested
+	}
+
+	var active int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM orders
+		WHERE (buyer_id = $1 OR seller_id = $1) AND status::text NOT IN `+closedOrderStatuses,
+		userID,
+	).Scan(&active); err != nil {
+		return false, err
+	}
+	if active > 0 {
+		return false, ErrActiveOrders
+	}
+
+	// Billing identity of paid orders: kept for the accounting retention period
+	result, err := tx.Exec(ctx, `
+		INSERT INTO retained_billing_data (user_id, billing, retain_until)
+		SELECT id, jsonb_strip_nulls(jsonb_build_object(
+		           'email', email, 'first_name', first_name, 'last_name', last_name,
+		           'account_type', account_type, 'business_name', business_name,
+		           'vat_number', vat_number, 'fiscal_code', fiscal_code, 'sdi_code', sdi_code,
+		           'pec_email', pec_email, 'eu_vat_id', eu_vat_id,
+		           'billing_address', billing_address, 'billing_city', billing_city,
+		           'billing_province', billing_province, 'billing_postal_code', billing_postal_code,
+		           'billing_country', billing_country
+		       )), $2
+		FROM users
+		WHERE id = $1
+		  AND EXISTS (SELECT 1 FROM orders WHERE (buyer_id = $1 OR seller_id = $1) AND paid_at IS NOT NULL)
+		ON CONFLICT (user_id) DO NOTHING
+	`, userID, retainUntil)
+	if err != nil {
+		return false, err
+	}
+	retained := result.RowsAffected() > 0
+
+	// Files are deleted from storage only after this transaction commits
+	queued, err := tx.Exec(ctx, `
+		INSERT INTO file_deletions (user_id, file_ref, is_private)
+		SELECT id, avatar_url, false FROM users WHERE id = $1 AND COALESCE(avatar_url, '') <> ''
+		UNION ALL
+		SELECT id, jsonb_array_elements_text(COALESCE(business_photos, '[]')), false FROM users WHERE id = $1
+		UNION ALL
+		SELECT seller_id, expiry_photo_url, false
+		FROM products WHERE seller_id = $1 AND COALESCE(expiry_photo_url, '') <> ''
+		UNION ALL
+		SELECT uploaded_by, storage_key, true FROM dispute_evidence WHERE uploaded_by = $1
+	`, userID)
+	if err != nil {
+		return false, err
+	}
+
+	steps := []string{
+		// Orders stay for accounting; free text and delivery details go
+		`UPDATE orders SET buyer_notes = NULL, shipping_address = NULL, shipping_postal_code = NULL,
+		        qr_code_token = NULL, updated_at = NOW()
+		 WHERE buyer_id = $1`,
+		`UPDATE orders SET seller_notes = NULL, pickup_instructions = NULL, updated_at = NOW()
+		 WHERE seller_id = $1`,
+		// Ratings keep counting for the reviewed user, without the author
+		`UPDATE order_reviews SET is_anonymous = true, updated_at = NOW() WHERE reviewer_id = $1`,
+		// Listings come down; the upload sweeper deletes their images
+		`UPDATE products SET status = 'DELETED', deleted_at = NOW(), updated_at = NOW()
+		 WHERE seller_id = $1 AND status <> 'DELETED'`,
+		`UPDATE products SET expiry_photo_url = NULL WHERE seller_id = $1 AND expiry_photo_url IS NOT NULL`,
+		// Resolved disputes keep their outcome, not the files the user uploaded
+		`DELETE FROM dispute_evidence WHERE uploaded_by = $1`,
+		`UPDATE seller_locations
+		 SET is_active = false, is_primary = false, name = 'Sede eliminata', address_street = '',
+		     latitude = NULL, longitude = NULL, phone = NULL, email = NULL,
+		     pickup_hours = NULL, pickup_instructions = NULL, updated_at = NOW()
+		 WHERE user_id = $1`,
+		`DELETE FROM favorites WHERE user_id = $1`,
+		`DELETE FROM cart_items WHERE user_id = $1`,
+		`DELETE FROM sessions WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM image_hashes WHERE user_id = $1`,
+		`DELETE FROM image_reviews WHERE user_id = $1 AND image_type IN ('PROFILE', 'BUSINESS')`,
+		`UPDATE users
+		 SET email = 'deleted-' || id || '@deleted.invalid', password_hash = '',
+		     first_name = 'Utente', last_name = 'eliminato', phone = NULL,
+		     city = NULL, province = NULL, postal_code = NULL,
+		     business_name = NULL, vat_number = NULL, fiscal_code = NULL, sdi_code = NULL,
+		     pec_email = NULL, eu_vat_id = NULL, billing_address = NULL, billing_city = NULL,
+		     billing_province = NULL, billing_postal_code = NULL,
+		     google_id = NULL, apple_id = NULL, facebook_id = NULL, oauth_provider = NULL,
+		     avatar_url = NULL, social_links = '{}', business_photos = '[]', slug = NULL,
+		     email_verification_token = NULL, password_reset_token = NULL,
+		     totp_secret = NULL, totp_enabled = false, totp_enabled_at = NULL,
+		     roles = '{BUYER}', is_admin = false,
+		     deleted_at = NOW(), updated_at = NOW()
+		 WHERE id = $1`,
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(ctx, step, userID); err != nil {
+			return false, err
+		}
+	}
+
+	metadata := map[string]interface{}{"files_queued": queued.RowsAffected()}
+	if retained {
+		metadata["billing_retained_until"] = retainUntil.Format("2006-01-02")
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return false, err
+	}
+	entry := &models.AuditLog{
+		Action:     models.AuditAccountDeleted,
+		EntityType: "user",
+		EntityID:   &userID,
+		Metadata:   metadataJSON,
+	}
+	if err := appendAuditEntries(ctx, tx, []*models.AuditLog{entry}); err != nil {
+		return false, err
+	}
+
+	return retained, tx.Commit(ctx)
+}
+
+// GetFileDeletions returns queued files, those never attempted first
+func (r *PrivacyRepository) GetFileDeletions(ctx context.Context, limit int) ([]models.FileDeletion, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, file_ref, is_private, attempts
+		FROM file_deletions
+		ORDER BY last_attempt_at NULLS FIRST, created_at
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.FileDeletion{}
+	for rows.Next() {
+		var f models.FileDeletion
+		if err := rows.Scan(&f.ID, &f.FileRef, &f.IsPrivate, &f.Attempts); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// CompleteFileDeletion removes a file from the queue once it is gone from storage
+func (r *PrivacyRepository) CompleteFileDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM file_deletions WHERE id = $1`, id)
+	return err
+}
+
+// FailFileDeletion records a failed attempt; the file is retried on a later run
+func (r *PrivacyRepository) FailFileDeletion(ctx context.Context, id uuid.UUID, reason string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE file_deletions
+		SET attempts = attempts + 1, last_error = $2, last_attempt_at = NOW()
+		WHERE id = $1
+	`, id, reason)
+	return err
+}
+
+// PurgeExpiredBilling deletes the retained billing data past its retention period
+func (r *PrivacyRepository) PurgeExpiredBilling(ctx context.Context) (int64, error) {
+	result, err := r.pool.Exec(ctx, `DELETE FROM retained_billing_data WHERE retain_until < CURRENT_DATE`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
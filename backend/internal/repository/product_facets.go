@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+// priceBucketBounds splits paid products into price ranges (EUR); free products
+// (gifts) get their own bucket
+var priceBucketBounds = []float64{10, 25, 50, 100}
+
+const freePriceBucket = "free"
+
+// facetColumns is the value and label each facet groups by
+var facetColumns = map[string]struct{ value, label string }{
+	models.FacetCategory:       {"p.category_id::text", "COALESCE(c.name, '')"},
+	models.FacetProvince:       {"p.province", "''"},
+	models.FacetListingType:    {"p.listing_type::text", "''"},
+	models.FacetShippingMethod: {"p.shipping_method::text", "''"},
+}
+
+// Facet counts the products matching filters by each value of a facet. The caller
+// drops the facet's own filter first (models.ProductFilters.WithoutFacet).
+// Price buckets are all returned, empty ones included, cheapest first; the other
+// facets only list values with products, most common first.
+func (r *ProductRepository) Facet(ctx context.Context, filters models.ProductFilters, facet string) ([]models.FacetValue, error) {
+	if facet == models.FacetPrice {
+		return r.priceFacet(ctx, filters)
+	}
+	columns, ok := facetColumns[facet]
+	if !ok {
+		return nil, fmt.Errorf("unknown facet %q", facet)
+	}
+
+	where := productConditions(filters)
+	conditions := append(where.conditions, columns.value+" IS NOT NULL", columns.value+" <> ''")
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s, COUNT(*)
+		FROM products p
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE %s
+		GROUP BY 1, 2
+		ORDER BY 3 DESC, 1
+	`, columns.value, columns.label, strings.Join(conditions, " AND "))
+
+	rows, err := r.pool.Query(ctx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []models.FacetValue{}
+	for rows.Next() {
+		var v models.FacetValue
+		if err := rows.Scan(&v.Value, &v.Label, &v.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// priceFacet counts the products in each price bucket
+func (r *ProductRepository) priceFacet(ctx context.Context, filters models.ProductFilters) ([]models.FacetValue, error) {
+	buckets := priceBuckets()
+
+	// CASE p.price <= 0 THEN 'free' WHEN p.price < 10 THEN '0-10' ... ELSE '100+' END
+	var bucketExpr strings.Builder
+	bucketExpr.WriteString("CASE WHEN p.price <= 0 THEN '" + freePriceBucket + "'")
+	for _, b := range buckets[1 : len(buckets)-1] {
+		fmt.Fprintf(&bucketExpr, " WHEN p.price < %g THEN '%s'", *b.Max, b.Value)
+	}
+	fmt.Fprintf(&bucketExpr, " ELSE '%s' END", buckets[len(buckets)-1].Value)
+
+	where := productConditions(filters)
+	query := fmt.Sprintf(`
+		SELECT %s, COUNT(*)
+		FROM products p
+		WHERE %s
+		GROUP BY 1
+	`, bucketExpr.String(), strings.Join(where.conditions, " AND "))
+
+	rows, err := r.pool.Query(ctx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var bucket string
+		var count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		counts[bucket] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range buckets {
+		buckets[i].Count = counts[buckets[i].Value]
+	}
+	return buckets, nil
+}
+
+// priceBuckets lists the price buckets with the min_price/max_price that select them:
+// free, 0-10, 10-25, 25-50, 50-100, 100+
+func priceBuckets() []models.FacetValue {
+	bound := func(v float64) *float64 { return &v }
+
+	buckets := []models.FacetValue{{Value: freePriceBucket, Min: bound(0), Max: bound(0)}}
+	lower := 0.0
+	for _, upper := range priceBucketBounds {
+		buckets = append(buckets, models.FacetValue{
+			Value: fmt.Sprintf("%g-%g", lower, upper),
+			Min:   bound(lower),
+			Max:   bound(upper),
+		})
+		lower = upper
+	}
+	return append(buckets, models.FacetValue{Value: fmt.Sprintf("%g+", lower), Min: bound(lower)})
+}
@@ -0,0 +1,22 @@
+package repository
+
+import "fmt"
+
+// Geo search on products.latitude/longitude: a bounding-box prefilter that can use
+// idx_products_coordinates, then the exact haversine distance.
+// See migration 017_geo_search.sql.
+
+// boxCondition keeps the products inside the box in arguments $n (min lat),
+// $n+1 (max lat), $n+2 (min lng) and $n+3 (max lng)
+func boxCondition(n int) string {
+	return fmt.Sprintf("(p.latitude BETWEEN $%d AND $%d AND p.longitude BETWEEN $%d AND $%d)", n, n+1, n+2, n+3)
+}
+
+// distanceKm is the haversine distance in km between the product and the point
+// in arguments $n (lat) and $n+1 (lng)
+func distanceKm(n int) string {
+	return fmt.Sprintf(`(6371 * 2 * ASIN(SQRT(
+		POWER(SIN(RADIANS(p.latitude::float8 - $%[1]d::float8) / 2), 2) +
+		COS(RADIANS($%[1]d::float8)) * COS(RADIANS(p.latitude::float8)) *
+		POWER(SIN(RADIANS(p.longitude::float8 - $%[2]d::float8) / 2), 2))))`, n, n+1)
+}
@@ -12,13 +12,20 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/gecogreen/backend/internal/geo"
 	"github.com/gecogreen/backend/internal/models"
 )
 
 var (
-	ErrProductNotFound = errors.New("product not found")
+	ErrProductNotFound   = errors.New("product not found")
+	ErrImageNotFound     = errors.New("image not found")
+	ErrImageLimitReached = errors.New("image limit reached")
+	ErrImagesChanged     = errors.New("images changed concurrently")
 )
 
+// boostedNow is true while a visibility boost redeemed with EcoCredits is running
+const boostedNow = "COALESCE(p.boosted_until > NOW(), false)"
+
 // Province codes grouped by region for filtering
 var regionProvinces = map[string][]string{
 	"Abruzzo":               {"AQ", "CH", "PE", "TE"},
@@ -71,7 +78,8 @@ func (r *ProductRepository) Create(ctx context.Context, product *models.Product)
 	`
 
 	product.ID = uuid.New()
-	product.Status = models.ProductStatusActive
+	// Listings start as drafts: they need MinProductImages photos before going ACTIVE
+	product.Status = models.ProductStatusDraft
 	product.QuantityAvail = product.Quantity
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = time.Now()
@@ -202,8 +210,17 @@ func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 	return product, nil
 }
 
-// List retrieves products with filters
-func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilters) (*models.ProductListResponse, error) {
+// productWhere is the WHERE clause of a product listing. searchArg and originArg
+// are the positions of the search query and of the distance origin (0 if unused).
+type productWhere struct {
+	conditions []string
+	args       []interface{}
+	searchArg  int
+	originArg  int
+}
+
+// productConditions translates the filters into SQL conditions on products p
+func productConditions(filters models.ProductFilters) productWhere {
 	var conditions []string
 	var args []interface{}
 	argNum := 1
@@ -219,8 +236,9 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 		argNum++
 	}
 
+	// A category includes its subcategories (see migration 018_category_tree.sql)
 	if filters.CategoryID != nil {
-		conditions = append(conditions, fmt.Sprintf("p.category_id = $%d", argNum))
+		conditions = append(conditions, fmt.Sprintf("p.category_id IN (SELECT category_subtree($%d))", argNum))
 		args = append(args, *filters.CategoryID)
 		argNum++
 	}
@@ -237,6 +255,12 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 		argNum++
 	}
 
+	if filters.ShippingMethod != nil {
+		conditions = append(conditions, fmt.Sprintf("p.shipping_method = $%d", argNum))
+		args = append(args, *filters.ShippingMethod)
+		argNum++
+	}
+
 	if filters.MinPrice != nil {
 		conditions = append(conditions, fmt.Sprintf("p.price >= $%d", argNum))
 		args = append(args, *filters.MinPrice)
@@ -274,12 +298,48 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 		}
 	}
 
-	if filters.Search != nil && *filters.Search != "" {
-		conditions = append(conditions, fmt.Sprintf("(p.title ILIKE $%d OR p.description ILIKE $%d)", argNum, argNum))
-		args = append(args, "%"+*filters.Search+"%")
-		argNum++
+	// Full-text search, with typo tolerance on the title (see product_search.go)
+	searchArg := 0
+	if filters.Search != nil {
+		if search := normalizeSearch(*filters.Search); search != "" {
+			conditions = append(conditions, searchCondition(argNum))
+			args = append(args, search)
+			searchArg = argNum
+			argNum++
+		}
+	}
+
+	// Within RadiusKm of a point, prefiltered on the bounding box (see product_geo.go)
+	originArg := 0
+	if filters.Lat != nil && filters.Lng != nil {
+		origin := geo.Point{Lat: *filters.Lat, Lng: *filters.Lng}
+		box := geo.BoxAround(origin, filters.RadiusKm)
+		conditions = append(conditions, boxCondition(argNum))
+		args = append(args, box.MinLat, box.MaxLat, box.MinLng, box.MaxLng)
+		argNum += 4
+
+		conditions = append(conditions, fmt.Sprintf("%s <= $%d", distanceKm(argNum), argNum+2))
+		args = append(args, origin.Lat, origin.Lng, filters.RadiusKm)
+		originArg = argNum
+		argNum += 3
+	}
+
+	// Map viewport
+	if filters.Bounds != nil {
+		conditions = append(conditions, boxCondition(argNum))
+		args = append(args, filters.Bounds.MinLat, filters.Bounds.MaxLat, filters.Bounds.MinLng, filters.Bounds.MaxLng)
+		argNum += 4
 	}
 
+	return productWhere{conditions: conditions, args: args, searchArg: searchArg, originArg: originArg}
+}
+
+// List retrieves products with filters
+func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilters) (*models.ProductListResponse, error) {
+	where := productConditions(filters)
+	conditions, args, searchArg, originArg := where.conditions, where.args, where.searchArg, where.originArg
+	argNum := len(args) + 1
+
 	whereClause := ""
 	if len(conditions) > 0 {
 		whereClause = "WHERE " + strings.Join(conditions, " AND ")
@@ -301,10 +361,17 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 	}
 	offset := (filters.Page - 1) * filters.PerPage
 
-	// Sort
+	// Sort (searches default to relevance, then radius searches to distance)
 	sortBy := "created_at"
-	if filters.SortBy != "" {
-		allowedSorts := map[string]bool{"created_at": true, "price": true, "view_count": true}
+	if filters.SortBy == "" && searchArg > 0 {
+		sortBy = models.SortRelevance
+	} else if filters.SortBy == "" && originArg > 0 {
+		sortBy = models.SortDistance
+	} else if filters.SortBy != "" {
+		allowedSorts := map[string]bool{
+			"created_at": true, "price": true, "view_count": true,
+			models.SortRelevance: searchArg > 0, models.SortDistance: originArg > 0,
+		}
 		if allowedSorts[filters.SortBy] {
 			sortBy = filters.SortBy
 		}
@@ -313,6 +380,34 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 	if filters.SortOrder == "asc" {
 		sortOrder = "ASC"
 	}
+	orderBy := fmt.Sprintf("p.%s %s", sortBy, sortOrder)
+	switch sortBy {
+	case models.SortRelevance:
+		orderBy = searchRank(searchArg) + " DESC, p.created_at DESC"
+	case models.SortDistance:
+		orderBy = distanceKm(originArg) + " ASC, p.created_at DESC" // nearest first
+	}
+
+	// The default browsing order puts the products boosted with EcoCredits
+	// first, and within a category the ones pinned to its top before them
+	if filters.SortBy == "" && sortBy == "created_at" {
+		orderBy = boostedNow + " DESC, " + orderBy
+		if filters.CategoryID != nil {
+			orderBy = "COALESCE(p.pinned_until > NOW(), false) DESC, " + orderBy
+		}
+	}
+
+	// Search results carry the highlighted snippets and their rank,
+	// radius searches the distance
+	extraColumns := ""
+	if searchArg > 0 {
+		extraColumns += fmt.Sprintf(", %s, %s", searchHeadlines(searchArg, argNum), searchRank(searchArg))
+		args = append(args, titleHighlightOptions, descriptionHighlightOptions)
+		argNum += 2
+	}
+	if originArg > 0 {
+		extraColumns += ", " + distanceKm(originArg)
+	}
 
 	// Main query
 	query := fmt.Sprintf(`
@@ -320,14 +415,14 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 			   p.listing_type::text, p.shipping_method::text, p.shipping_cost, p.quantity, p.quantity_available,
 			   p.expiry_date, p.is_dutch_auction, p.dutch_start_price, p.dutch_min_price,
 			   COALESCE(p.city, ''), COALESCE(p.province, ''), p.images, p.status::text,
-			   p.view_count, p.favorite_count, p.created_at,
-			   u.id, u.first_name, u.last_name, COALESCE(u.avatar_url, '')
+			   p.view_count, p.favorite_count, p.created_at, %s,
+			   u.id, u.first_name, u.last_name, COALESCE(u.avatar_url, '')%s
 		FROM products p
 		JOIN users u ON p.seller_id = u.id
 		%s
-		ORDER BY p.%s %s
+		ORDER BY %s
 		LIMIT $%d OFFSET $%d
-	`, whereClause, sortBy, sortOrder, argNum, argNum+1)
+	`, boostedNow, extraColumns, whereClause, orderBy, argNum, argNum+1)
 
 	args = append(args, filters.PerPage, offset)
 
@@ -343,19 +438,38 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 		var seller models.UserProfile
 		var imagesJSON []byte
 		var listingType, shippingMethod, status string
+		var highlight models.ProductHighlight
 
-		err := rows.Scan(
+		dest := []interface{}{
 			&p.ID, &p.SellerID, &p.CategoryID, &p.Title, &p.Description, &p.Price, &p.OriginalPrice,
 			&listingType, &shippingMethod, &p.ShippingCost, &p.Quantity, &p.QuantityAvail,
 			&p.ExpiryDate, &p.IsDutchAuction, &p.DutchStartPrice, &p.DutchMinPrice,
 			&p.City, &p.Province, &imagesJSON, &status,
-			&p.ViewCount, &p.FavoriteCount, &p.CreatedAt,
+			&p.ViewCount, &p.FavoriteCount, &p.CreatedAt, &p.Boosted,
 			&seller.ID, &seller.FirstName, &seller.LastName, &seller.AvatarURL,
-		)
-		if err != nil {
+		}
+		if searchArg > 0 {
+			dest = append(dest, &highlight.Title, &highlight.Description, &highlight.Rank)
+		}
+		var distance float64
+		if originArg > 0 {
+			dest = append(dest, &distance)
+		}
+		if err := rows.Scan(dest...); err != nil {
 			return nil, err
 		}
 
+		if originArg > 0 {
+			distance = round(distance)
+			p.DistanceKm = &distance
+		}
+
+		if searchArg > 0 {
+			highlight.Title = renderHighlight(highlight.Title)
+			highlight.Description = renderHighlight(highlight.Description)
+			p.Highlight = &highlight
+		}
+
 		// Convert string types
 		p.ListingType = models.ListingType(listingType)
 		p.ShippingMethod = models.ShippingMethod(shippingMethod)
@@ -384,8 +498,56 @@ func (r *ProductRepository) List(ctx context.Context, filters models.ProductFilt
 	}, nil
 }
 
-// Update updates a product
-func (r *ProductRepository) Update(ctx context.Context, product *models.Product) error {
+// Clusters groups the products matching filters into a grid of cellSize degrees
+// (see geo.ClusterCellSize), largest clusters first
+func (r *ProductRepository) Clusters(ctx context.Context, filters models.ProductFilters, cellSize float64, limit int) ([]models.MapCluster, error) {
+	where := productConditions(filters)
+	conditions, args := append(where.conditions, "p.latitude IS NOT NULL AND p.longitude IS NOT NULL"), where.args
+	argNum := len(args) + 1
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*), AVG(p.latitude)::float8, AVG(p.longitude)::float8,
+			   (ARRAY_AGG(p.id ORDER BY p.created_at DESC))[1],
+			   (ARRAY_AGG(p.title ORDER BY p.created_at DESC))[1],
+			   (ARRAY_AGG(p.price ORDER BY p.created_at DESC))[1]::float8,
+			   (ARRAY_AGG(p.listing_type::text ORDER BY p.created_at DESC))[1],
+			   (ARRAY_AGG(COALESCE(p.images->>0, '') ORDER BY p.created_at DESC))[1]
+		FROM products p
+		WHERE %s
+		GROUP BY FLOOR(p.latitude::float8 / $%d), FLOOR(p.longitude::float8 / $%d)
+		ORDER BY COUNT(*) DESC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), argNum, argNum, argNum+1)
+	args = append(args, cellSize, limit)
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clusters := []models.MapCluster{}
+	for rows.Next() {
+		var cluster models.MapCluster
+		var product models.MapProduct
+		var listingType string
+		if err := rows.Scan(
+			&cluster.Count, &cluster.Lat, &cluster.Lng,
+			&product.ID, &product.Title, &product.Price, &listingType, &product.Image,
+		); err != nil {
+			return nil, err
+		}
+		if cluster.Count == 1 {
+			product.ListingType = models.ListingType(listingType)
+			cluster.Product = &product
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, rows.Err()
+}
+
+// Update updates a product and writes its audit records in the same transaction
+func (r *ProductRepository) Update(ctx context.Context, product *models.Product, entries ...*models.AuditLog) error {
 	query := `
 		UPDATE products SET
 			title = $1, description = $2, price = $3, quantity = $4, quantity_available = $5,
@@ -394,7 +556,13 @@ func (r *ProductRepository) Update(ctx context.Context, product *models.Product)
 	`
 	product.UpdatedAt = time.Now()
 
-	result, err := r.pool.Exec(ctx, query,
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, query,
 		product.Title, product.Description, product.Price, product.Quantity, product.QuantityAvail,
 		product.Status, product.ShippingMethod, product.ShippingCost, product.UpdatedAt,
 		product.ID, product.SellerID,
@@ -406,20 +574,32 @@ func (r *ProductRepository) Update(ctx context.Context, product *models.Product)
 	if result.RowsAffected() == 0 {
 		return ErrProductNotFound
 	}
-	return nil
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// Delete soft-deletes a product
-func (r *ProductRepository) Delete(ctx context.Context, id, sellerID uuid.UUID) error {
+// Delete soft-deletes a product and writes its audit records in the same transaction
+func (r *ProductRepository) Delete(ctx context.Context, id, sellerID uuid.UUID, entries ...*models.AuditLog) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	query := `UPDATE products SET status = $1, updated_at = $2 WHERE id = $3 AND seller_id = $4`
-	result, err := r.pool.Exec(ctx, query, models.ProductStatusDeleted, time.Now(), id, sellerID)
+	result, err := tx.Exec(ctx, query, models.ProductStatusDeleted, time.Now(), id, sellerID)
 	if err != nil {
 		return err
 	}
 	if result.RowsAffected() == 0 {
 		return ErrProductNotFound
 	}
-	return nil
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 // IncrementViewCount increments the view count
@@ -453,12 +633,60 @@ func (r *ProductRepository) DecrementQuantity(ctx context.Context, productID uui
 func (r *ProductRepository) AddImage(ctx context.Context, productID uuid.UUID, imageURL string) error {
 	query := `
 		UPDATE products
-		SET images = images || $1::jsonb, updated_at = $2
-		WHERE id = $3
+		SET images = COALESCE(images, '[]'::jsonb) || $1::jsonb, updated_at = $2
+		WHERE id = $3 AND jsonb_array_length(COALESCE(images, '[]'::jsonb)) < $4
 	`
 	imageJSON, _ := json.Marshal([]string{imageURL})
-	_, err := r.pool.Exec(ctx, query, imageJSON, time.Now(), productID)
-	return err
+	result, err := r.pool.Exec(ctx, query, imageJSON, time.Now(), productID, models.MaxProductImages)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrImageLimitReached
+	}
+	return nil
+}
+
+// RemoveImage removes an image from the gallery.
+// An ACTIVE product can't go below MinProductImages.
+func (r *ProductRepository) RemoveImage(ctx context.Context, productID uuid.UUID, imageURL string) error {
+	query := `
+		UPDATE products
+		SET images = images - $1::text, updated_at = $2
+		WHERE id = $3 AND images ? $1::text
+		  AND (status <> 'ACTIVE' OR jsonb_array_length(images) > $4)
+	`
+	result, err := r.pool.Exec(ctx, query, imageURL, time.Now(), productID, models.MinProductImages)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrImageNotFound
+	}
+	return nil
+}
+
+// SetImages replaces the gallery order, only if it still equals current
+// (so a concurrent upload or delete isn't silently overwritten)
+func (r *ProductRepository) SetImages(ctx context.Context, productID uuid.UUID, current, images []string) error {
+	query := `
+		UPDATE products
+		SET images = $1::jsonb, updated_at = $2
+		WHERE id = $3 AND COALESCE(images, '[]'::jsonb) = $4::jsonb
+	`
+	if current == nil {
+		current = []string{}
+	}
+	imagesJSON, _ := json.Marshal(images)
+	currentJSON, _ := json.Marshal(current)
+	result, err := r.pool.Exec(ctx, query, imagesJSON, time.Now(), productID, currentJSON)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrImagesChanged
+	}
+	return nil
 }
 
 // GetImages gets all images for a product
@@ -476,3 +704,40 @@ func (r *ProductRepository) GetImages(ctx context.Context, productID uuid.UUID)
 	}
 	return images, nil
 }
+
+// GetDeletedWithImages returns DELETED products that still reference stored images
+func (r *ProductRepository) GetDeletedWithImages(ctx context.Context, limit int) ([]models.Product, error) {
+	query := `
+		SELECT id, images
+		FROM products
+		WHERE status = 'DELETED' AND images IS NOT NULL AND images <> '[]'::jsonb
+		ORDER BY updated_at ASC
+		LIMIT $1
+	`
+
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.Product
+	for rows.Next() {
+		var p models.Product
+		var imagesJSON []byte
+		if err := rows.Scan(&p.ID, &imagesJSON); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(imagesJSON, &p.Images)
+		products = append(products, p)
+	}
+
+	return products, nil
+}
+
+// ClearImages empties the image list of a product (after its files were deleted)
+func (r *ProductRepository) ClearImages(ctx context.Context, productID uuid.UUID) error {
+	query := `UPDATE products SET images = '[]'::jsonb WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, productID)
+	return err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// Product search: full-text on products.search_vector (Italian stemming, weighted
+// title > category > description) plus trigram matching on the title for typos.
+// See migration 016_product_search.sql.
+
+const (
+	// searchMinLength and searchMaxLength bound the query, in characters
+	searchMinLength = 2
+	searchMaxLength = 100
+
+	// searchFuzzyWeight scales the title similarity added to the full-text rank,
+	// so fuzzy-only matches rank below exact ones
+	searchFuzzyWeight = 0.3
+
+	// Markers around the matched words in ts_headline output, replaced with
+	// <mark> after escaping the text
+	highlightStart = "⟪"
+	highlightStop  = "⟫"
+)
+
+// highlightOptions configures ts_headline. Descriptions show up to two fragments.
+var (
+	titleHighlightOptions       = fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", highlightStart, highlightStop)
+	descriptionHighlightOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=12, MaxFragments=2, FragmentDelimiter=\" … \"", highlightStart, highlightStop)
+)
+
+// normalizeSearch trims the query and collapses whitespace; it returns "" for
+// queries too short to search
+func normalizeSearch(q string) string {
+	q = strings.Join(strings.Fields(q), " ")
+	q = strings.NewReplacer(highlightStart, "", highlightStop, "").Replace(q)
+	if utf8.RuneCountInString(q) < searchMinLength {
+		return ""
+	}
+	if utf8.RuneCountInString(q) > searchMaxLength {
+		q = string([]rune(q)[:searchMaxLength])
+	}
+	return q
+}
+
+// searchCondition matches products for the query in argument $n: websearch syntax
+// ("quoted phrases", -exclusions, OR) on the vector, or a title close to the query
+func searchCondition(n int) string {
+	return fmt.Sprintf("(p.search_vector @@ websearch_to_tsquery('italian', $%d) OR $%d <%% p.title)", n, n)
+}
+
+// searchRank orders the matches: full-text rank normalized by document length,
+// plus a share of the title similarity
+func searchRank(n int) string {
+	return fmt.Sprintf("(ts_rank(p.search_vector, websearch_to_tsquery('italian', $%d), 1) + %g * word_similarity($%d, p.title))", n, searchFuzzyWeight, n)
+}
+
+// searchHeadlines selects the highlighted title and description for the query in
+// argument $n; the title and description options are arguments $o and $o+1
+func searchHeadlines(n, o int) string {
+	return fmt.Sprintf(
+		"ts_headline('italian', p.title, websearch_to_tsquery('italian', $%d), $%d), ts_headline('italian', COALESCE(p.description, ''), websearch_to_tsquery('italian', $%d), $%d)",
+		n, o, n, o+1)
+}
+
+// renderHighlight escapes a ts_headline result and turns the markers into <mark> tags.
+// It returns "" when nothing was highlighted, e.g. for typo-only matches.
+func renderHighlight(s string) string {
+	if !strings.Contains(s, highlightStart) {
+		return ""
+	}
+	s = html.EscapeString(s)
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(s)
+}
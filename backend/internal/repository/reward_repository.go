@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+var (
+	ErrRewardNotFound        = errors.New("reward not found")
+	ErrRewardUnavailable     = errors.New("reward not available")
+	ErrRewardOutOfStock      = errors.New("reward out of stock")
+	ErrRewardProductRequired = errors.New("reward requires a product")
+	ErrRewardProductInvalid  = errors.New("product not eligible for the reward")
+	ErrRewardAlreadyOwned    = errors.New("reward already owned")
+	ErrRewardCodeTaken       = errors.New("reward code already in use")
+	ErrRewardInUse           = errors.New("reward already redeemed by users")
+)
+
+// RewardRepository manages the EcoCredits reward catalogue (eco_rewards) and
+// the redemptions (redeemed_rewards)
+type RewardRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRewardRepository(pool *pgxpool.Pool) *RewardRepository {
+	return &RewardRepository{pool: pool}
+}
+
+const rewardColumns = `
+	id, COALESCE(code, ''), name, COALESCE(description, ''), COALESCE(icon, ''), eco_credits_cost,
+	reward_type, config, COALESCE(is_active, true), stock, COALESCE(sort_order, 0),
+	created_at, COALESCE(updated_at, created_at)`
+
+func scanReward(row pgx.Row, reward *models.EcoReward) error {
+	var rewardType string
+	var config []byte
+	if err := row.Scan(
+		&reward.ID, &reward.Code, &reward.Name, &reward.Description, &reward.Icon, &reward.Cost,
+		&rewardType, &config, &reward.IsActive, &reward.Stock, &reward.SortOrder,
+		&reward.CreatedAt, &reward.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	reward.RewardType = models.RewardType(rewardType)
+	if config != nil {
+		_ = json.Unmarshal(config, &reward.Config)
+	}
+	return nil
+}
+
+// List returns the catalogue, in display order. Inactive rewards are included
+// only for admins.
+func (r *RewardRepository) List(ctx context.Context, includeInactive bool) ([]models.EcoReward, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+rewardColumns+`
+		FROM eco_rewards
+		WHERE $1 OR COALESCE(is_active, true)
+		ORDER BY sort_order, name
+	`, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rewards := []models.EcoReward{}
+	for rows.Next() {
+		var reward models.EcoReward
+		if err := scanReward(rows, &reward); err != nil {
+			return nil, err
+		}
+		rewards = append(rewards, reward)
+	}
+	return rewards, rows.Err()
+}
+
+// GetByID returns a reward
+func (r *RewardRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.EcoReward, error) {
+	return r.getReward(ctx, "id = $1", id)
+}
+
+// GetByCode returns a reward by its catalogue code
+func (r *RewardRepository) GetByCode(ctx context.Context, code string) (*models.EcoReward, error) {
+	return r.getReward(ctx, "code = $1", code)
+}
+
+func (r *RewardRepository) getReward(ctx context.Context, where string, arg interface{}) (*models.EcoReward, error) {
+	var reward models.EcoReward
+	err := scanReward(r.pool.QueryRow(ctx, "SELECT "+rewardColumns+" FROM eco_rewards WHERE "+where, arg), &reward)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRewardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+// Create adds a reward to the catalogue. ID, CreatedAt and UpdatedAt are filled in.
+func (r *RewardRepository) Create(ctx context.Context, reward *models.EcoReward) error {
+	config, err := json.Marshal(reward.Config)
+	if err != nil {
+		return err
+	}
+
+	reward.ID = uuid.New()
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO eco_rewards (
+			id, code, name, description, icon, eco_credits_cost, reward_type, config, is_active, stock, sort_order
+		) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11)
+		RETURNING created_at, updated_at
+	`, reward.ID, reward.Code, reward.Name, reward.Description, reward.Icon, reward.Cost,
+		string(reward.RewardType), config, reward.IsActive, reward.Stock, reward.SortOrder,
+	).Scan(&reward.CreatedAt, &reward.UpdatedAt)
+	if err != nil && strings.Contains(err.Error(), "idx_eco_rewards_code") {
+		return ErrRewardCodeTaken
+	}
+	return err
+}
+
+// Update saves the editable fields of a reward
+func (r *RewardRepository) Update(ctx context.Context, reward *models.EcoReward) error {
+	config, err := json.Marshal(reward.Config)
+	if err != nil {
+		return err
+	}
+
+	err = r.pool.QueryRow(ctx, `
+		UPDATE eco_rewards SET
+			code = $2, name = $3, description = NULLIF($4, ''), icon = NULLIF($5, ''),
+			eco_credits_cost = $6, config = $7, is_active = $8, stock = $9, sort_order = $10,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`, reward.ID, reward.Code, reward.Name, reward.Description, reward.Icon,
+		reward.Cost, config, reward.IsActive, reward.Stock, reward.SortOrder,
+	).Scan(&reward.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRewardNotFound
+	}
+	if err != nil && strings.Contains(err.Error(), "idx_eco_rewards_code") {
+		return ErrRewardCodeTaken
+	}
+	return err
+}
+
+// Delete removes a reward nobody redeemed yet; redeemed ones can only be deactivated
+func (r *RewardRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result, err := r.pool.Exec(ctx, "DELETE FROM eco_rewards WHERE id = $1", id)
+	if err != nil {
+		if strings.Contains(err.Error(), "redeemed_rewards_reward_id_fkey") {
+			return ErrRewardInUse
+		}
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRewardNotFound
+	}
+	return nil
+}
+
+// Redeem spends the user's EcoCredits on a reward and fulfils it, in one
+// transaction: boosts and category pins extend the product's ranking (from the
+// end of any boost in progress), badges and commission waivers become ACTIVE,
+// tree donations stay PENDING until the tree planter plants them. Returns the
+// redemption and the balance left.
+func (r *RewardRepository) Redeem(ctx context.Context, userID, rewardID uuid.UUID, productID *uuid.UUID) (*models.RedeemedReward, int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the reward serializes redemptions of a limited stock
+	var reward models.EcoReward
+	err = scanReward(tx.QueryRow(ctx, "SELECT "+rewardColumns+" FROM eco_rewards WHERE id = $1 FOR UPDATE", rewardID), &reward)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, ErrRewardNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if !reward.IsActive {
+		return nil, 0, ErrRewardUnavailable
+	}
+	if reward.Stock != nil && *reward.Stock <= 0 {
+		return nil, 0, ErrRewardOutOfStock
+	}
+
+	redeemed := &models.RedeemedReward{
+		ID:              uuid.New(),
+		UserID:          userID,
+		RewardID:        reward.ID,
+		Code:            reward.Code,
+		Name:            reward.Name,
+		Icon:            reward.Icon,
+		RewardType:      reward.RewardType,
+		Config:          reward.Config,
+		EcoCreditsSpent: reward.Cost,
+		Status:          models.RedeemedActive,
+	}
+
+	if reward.RewardType.NeedsProduct() {
+		if productID == nil {
+			return nil, 0, ErrRewardProductRequired
+		}
+		var eligible bool
+		err := tx.QueryRow(ctx, `
+			SELECT seller_id = $2 AND status = 'ACTIVE' AND ($3 OR category_id IS NOT NULL)
+			FROM products WHERE id = $1
+		`, productID, userID, reward.RewardType != models.RewardTopCategory).Scan(&eligible)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !eligible) {
+			return nil, 0, ErrRewardProductInvalid
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		redeemed.ProductID = productID
+	}
+
+	if reward.RewardType == models.RewardBadge {
+		var owned bool
+		if err := tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM redeemed_rewards
+				WHERE user_id = $1 AND reward_id = $2 AND status = 'ACTIVE'
+					AND (expires_at IS NULL OR expires_at > NOW())
+			)
+		`, userID, reward.ID).Scan(&owned); err != nil {
+			return nil, 0, err
+		}
+		if owned {
+			return nil, 0, ErrRewardAlreadyOwned
+		}
+	}
+
+	entry := &models.ImpactLog{
+		UserID:          userID,
+		ActionType:      reward.RewardType.ActionType(),
+		EcoCreditsSpent: reward.Cost,
+		Description:     "Riscatto: " + reward.Name,
+	}
+	if err := insertImpactLog(ctx, tx, entry); err != nil {
+		return nil, 0, err
+	}
+
+	if reward.Stock != nil {
+		if _, err := tx.Exec(ctx, "UPDATE eco_rewards SET stock = stock - 1 WHERE id = $1", reward.ID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	switch reward.RewardType {
+	case models.RewardVisibilityBoost:
+		err = tx.QueryRow(ctx, `
+			UPDATE products SET boosted_until = GREATEST(COALESCE(boosted_until, NOW()), NOW()) + make_interval(hours => $2)
+			WHERE id = $1
+			RETURNING boosted_until
+		`, productID, reward.Config.DurationHours).Scan(&redeemed.ExpiresAt)
+	case models.RewardTopCategory:
+		err = tx.QueryRow(ctx, `
+			UPDATE products SET pinned_until = GREATEST(COALESCE(pinned_until, NOW()), NOW()) + make_interval(hours => $2)
+			WHERE id = $1
+			RETURNING pinned_until
+		`, productID, reward.Config.DurationHours).Scan(&redeemed.ExpiresAt)
+	case models.RewardCommissionWaiver:
+		if reward.Config.ValidDays > 0 {
+			expires := time.Now().AddDate(0, 0, reward.Config.ValidDays)
+			redeemed.ExpiresAt = &expires
+		}
+	case models.RewardTreeDonation:
+		redeemed.Status = models.RedeemedPending
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	config, err := json.Marshal(reward.Config)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO redeemed_rewards (
+			id, user_id, reward_id, eco_credits_spent, status, expires_at, product_id, impact_log_id, config
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at
+	`, redeemed.ID, userID, reward.ID, reward.Cost, string(redeemed.Status), redeemed.ExpiresAt,
+		redeemed.ProductID, entry.ID, config,
+	).Scan(&redeemed.CreatedAt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The tree planter sends the donation to the partner
+	if reward.RewardType == models.RewardTreeDonation {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO trees_planted (user_id, impact_log_id, redeemed_reward_id, trees_count, status, planted_at)
+			VALUES ($1, $2, $3, $4, 'PENDING', NULL)
+		`, userID, entry.ID, redeemed.ID, max(reward.Config.TreeCount, 1)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, 0, err
+	}
+	return redeemed, entry.EcoCreditsBalance, nil
+}
+
+// ListRedeemed returns the rewards a user redeemed, newest first
+func (r *RewardRepository) ListRedeemed(ctx context.Context, userID uuid.UUID) ([]models.RedeemedReward, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT rr.id, rr.user_id, rr.reward_id, COALESCE(r.code, ''), r.name, COALESCE(r.icon, ''), r.reward_type,
+			COALESCE(rr.config, r.config), rr.eco_credits_spent,
+			CASE WHEN rr.status = 'ACTIVE' AND rr.expires_at <= NOW() THEN 'EXPIRED' ELSE COALESCE(rr.status, 'PENDING') END,
+			rr.product_id, rr.applied_to_order_id, rr.expires_at, rr.used_at,
+			COALESCE(t.tree_nation_url, ''), rr.created_at
+		FROM redeemed_rewards rr
+		JOIN eco_rewards r ON r.id = rr.reward_id
+		LEFT JOIN trees_planted t ON t.redeemed_reward_id = rr.id AND t.status = 'PLANTED'
+		WHERE rr.user_id = $1
+		ORDER BY rr.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redeemed := []models.RedeemedReward{}
+	for rows.Next() {
+		var rr models.RedeemedReward
+		var rewardType, status string
+		var config []byte
+		if err := rows.Scan(
+			&rr.ID, &rr.UserID, &rr.RewardID, &rr.Code, &rr.Name, &rr.Icon, &rewardType,
+			&config, &rr.EcoCreditsSpent, &status,
+			&rr.ProductID, &rr.AppliedToOrderID, &rr.ExpiresAt, &rr.UsedAt,
+			&rr.CertificateURL, &rr.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rr.RewardType = models.RewardType(rewardType)
+		rr.Status = models.RedeemedRewardStatus(status)
+		if config != nil {
+			_ = json.Unmarshal(config, &rr.Config)
+		}
+		redeemed = append(redeemed, rr)
+	}
+	return redeemed, rows.Err()
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+// SellerRepository reads the aggregates shown on public seller storefronts
+type SellerRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSellerRepository(pool *pgxpool.Pool) *SellerRepository {
+	return &SellerRepository{pool: pool}
+}
+
+// GetRatingBreakdown counts the seller's approved reviews by stars
+func (r *SellerRepository) GetRatingBreakdown(ctx context.Context, sellerID uuid.UUID) (*models.RatingBreakdown, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT rating, COUNT(*)
+		FROM order_reviews
+		WHERE reviewed_id = $1 AND is_approved = TRUE
+		GROUP BY rating
+	`, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := &models.RatingBreakdown{Stars: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	total := 0
+	for rows.Next() {
+		var rating, count int
+		if err := rows.Scan(&rating, &count); err != nil {
+			return nil, err
+		}
+		breakdown.Stars[rating] = count
+		breakdown.Count += count
+		total += rating * count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if breakdown.Count > 0 {
+		breakdown.Average = round(float64(total) / float64(breakdown.Count))
+	}
+	return breakdown, nil
+}
+
+// GetPickupAreas returns the distinct cities of the seller's active pickup locations
+func (r *SellerRepository) GetPickupAreas(ctx context.Context, sellerID uuid.UUID) ([]models.PickupArea, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT DISTINCT INITCAP(TRIM(address_city)), UPPER(COALESCE(address_province, ''))
+		FROM seller_locations
+		WHERE user_id = $1 AND is_active = true AND TRIM(address_city) <> ''
+		ORDER BY 1
+	`, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	areas := []models.PickupArea{}
+	for rows.Next() {
+		var area models.PickupArea
+		if err := rows.Scan(&area.City, &area.Province); err != nil {
+			return nil, err
+		}
+		areas = append(areas, area)
+	}
+	return areas, rows.Err()
+}
+
+// GetRewardBadges returns the profile badges the seller redeemed with EcoCredits
+func (r *SellerRepository) GetRewardBadges(ctx context.Context, sellerID uuid.UUID) ([]models.ProfileBadge, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT COALESCE(NULLIF(rr.config->>'badge_name', ''), er.name),
+			COALESCE(NULLIF(rr.config->>'badge_icon', ''), er.icon, ''), rr.created_at
+		FROM redeemed_rewards rr
+		JOIN eco_rewards er ON er.id = rr.reward_id
+		WHERE rr.user_id = $1 AND er.reward_type = 'BADGE' AND rr.status = 'ACTIVE'
+			AND (rr.expires_at IS NULL OR rr.expires_at > NOW())
+		ORDER BY rr.created_at
+	`, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	badges := []models.ProfileBadge{}
+	for rows.Next() {
+		var badge models.ProfileBadge
+		if err := rows.Scan(&badge.Name, &badge.Icon, &badge.AwardedAt); err != nil {
+			return nil, err
+		}
+		badges = append(badges, badge)
+	}
+	return badges, rows.Err()
+}
+
+// GetSalesTotals returns the completed orders and items sold by the seller
+func (r *SellerRepository) GetSalesTotals(ctx context.Context, sellerID uuid.UUID) (orders, items int, err error) {
+	err = r.pool.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(quantity), 0)
+		FROM orders
+		WHERE seller_id = $1 AND status = 'COMPLETED'
+	`, sellerID).Scan(&orders, &items)
+	return orders, items, err
+}
+
+// HasPaidOrder reports whether the buyer paid an order from the seller
+// that was not cancelled or refunded afterwards
+func (r *SellerRepository) HasPaidOrder(ctx context.Context, buyerID, sellerID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.pool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM orders
+			WHERE buyer_id = $1 AND seller_id = $2
+			  AND paid_at IS NOT NULL AND status NOT IN ('CANCELLED', 'REFUNDED')
+		)
+	`, buyerID, sellerID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionReused   = errors.New("refresh token reused")
+)
+
+type SessionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSessionRepository(pool *pgxpool.Pool) *SessionRepository {
+	return &SessionRepository{pool: pool}
+}
+
+// Create stores the first refresh token of a new login (new family)
+func (r *SessionRepository) Create(ctx context.Context, s *models.Session) error {
+	s.ID = uuid.New()
+	s.FamilyID = s.ID
+	s.CreatedAt = time.Now()
+	s.LastUsedAt = s.CreatedAt
+
+	// Rotated-out rows are kept until expiry for reuse detection; drop the stale ones
+	if _, err := r.pool.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1 AND expires_at < NOW()", s.UserID); err != nil {
+		return err
+	}
+
+	return r.insert(ctx, r.pool, s)
+}
+
+// Rotate exchanges a refresh token for its successor.
+// newSession carries the new hash, expiry and client info; it is filled with
+// the IDs of the session being rotated.
+// A token that was already rotated out revokes its whole family (ErrSessionReused):
+// either the client or an attacker holds a stolen copy.
+func (r *SessionRepository) Rotate(ctx context.Context, tokenHash string, newSession *models.Session) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		id, userID, familyID uuid.UUID
+		expiresAt            time.Time
+		revokedAt            *time.Time
+		replacedBy           *uuid.UUID
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, family_id, expires_at, revoked_at, replaced_by
+		FROM sessions
+		WHERE refresh_token = $1
+		FOR UPDATE
+	`, tokenHash).Scan(&id, &userID, &familyID, &expiresAt, &revokedAt, &replacedBy)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	if revokedAt != nil {
+		if replacedBy == nil {
+			// Logged out
+			return ErrSessionNotFound
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE sessions SET revoked_at = NOW()
+			WHERE family_id = $1 AND revoked_at IS NULL
+		`, familyID); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		return ErrSessionReused
+	}
+
+	if time.Now().After(expiresAt) {
+		return ErrSessionNotFound
+	}
+
+	newSession.ID = uuid.New()
+	newSession.UserID = userID
+	newSession.FamilyID = familyID
+	newSession.CreatedAt = time.Now()
+	newSession.LastUsedAt = newSession.CreatedAt
+
+	if err := r.insert(ctx, tx, newSession); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW(), replaced_by = $2, last_used_at = NOW()
+		WHERE id = $1
+	`, id, newSession.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeFamily revokes all tokens of one of the user's logins (one device)
+func (r *SessionRepository) RevokeFamily(ctx context.Context, userID, familyID uuid.UUID) error {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+	`, userID, familyID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll revokes every session of a user and returns how many logins were closed
+func (r *SessionRepository) RevokeAll(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// RevokeOthers revokes every session of a user except the given login
+func (r *SessionRepository) RevokeOthers(ctx context.Context, userID, keepFamilyID uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+	`, userID, keepFamilyID)
+	return err
+}
+
+// ListActive returns the user's active logins, most recently used first
+func (r *SessionRepository) ListActive(ctx context.Context, userID uuid.UUID) ([]models.DeviceSession, error) {
+	query := `
+		SELECT s.family_id,
+		       COALESCE(s.device_info->>'user_agent', ''),
+		       COALESCE(host(s.ip_address), ''),
+		       (SELECT MIN(f.created_at) FROM sessions f WHERE f.family_id = s.family_id),
+		       s.created_at, s.expires_at
+		FROM sessions s
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		ORDER BY s.created_at DESC
+	`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.DeviceSession{}
+	for rows.Next() {
+		var d models.DeviceSession
+		// The active row was created by the last refresh
+		if err := rows.Scan(&d.ID, &d.UserAgent, &d.IPAddress, &d.SignedInAt, &d.LastUsedAt, &d.ExpiresAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// execer is satisfied by both the pool and a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func (r *SessionRepository) insert(ctx context.Context, db execer, s *models.Session) error {
+	var ip *string
+	if s.IPAddress != "" {
+		ip = &s.IPAddress
+	}
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO sessions (
+			id, user_id, family_id, refresh_token, expires_at,
+			device_info, ip_address, created_at, last_used_at
+		) VALUES ($1, $2, $3, $4, $5, jsonb_build_object('user_agent', $6::text), $7::inet, $8, $9)
+	`, s.ID, s.UserID, s.FamilyID, s.TokenHash, s.ExpiresAt,
+		s.UserAgent, ip, s.CreatedAt, s.LastUsedAt,
+	)
+	return err
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/trees"
+)
+
+// TreeRepository manages the tree donations (trees_planted) and the
+// community trees target (community_impact)
+type TreeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTreeRepository(pool *pgxpool.Pool) *TreeRepository {
+	return &TreeRepository{pool: pool}
+}
+
+// ClaimPending returns up to limit PENDING donations that are due and moves
+// them to SUBMITTED before they are sent to the partner, counting an attempt
+// for each: a donation tried n times waits n × 30 minutes (at most 12 hours)
+// before the next one, and concurrent planters never get the same row. Only
+// ReleaseUnsent puts a donation back to PENDING.
+func (r *TreeRepository) ClaimPending(ctx context.Context, limit int) ([]models.TreeDonation, error) {
+	rows, err := r.pool.Query(ctx, `
+		WITH due AS (
+			SELECT id FROM trees_planted
+			WHERE status = 'PENDING'
+				AND (last_attempt_at IS NULL
+					OR last_attempt_at < NOW() - make_interval(mins => LEAST(attempts, 24) * 30))
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE trees_planted t SET status = 'SUBMITTED', attempts = t.attempts + 1, last_attempt_at = NOW()
+			FROM due
+			WHERE t.id = due.id
+			RETURNING t.id, t.user_id, t.redeemed_reward_id, t.trees_count, t.attempts, t.created_at
+		)
+		SELECT c.id, c.user_id, c.redeemed_reward_id, c.trees_count, c.attempts, c.created_at,
+			COALESCE(NULLIF(TRIM(COALESCE(u.first_name, '') || ' ' || COALESCE(u.last_name, '')), ''), 'GecoGreen'),
+			CASE WHEN u.deleted_at IS NULL THEN COALESCE(u.email, '') ELSE '' END
+		FROM claimed c
+		LEFT JOIN users u ON u.id = c.user_id
+		ORDER BY c.created_at
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	donations := []models.TreeDonation{}
+	for rows.Next() {
+		d := models.TreeDonation{Status: models.TreeDonationSubmitted}
+		if err := rows.Scan(
+			&d.ID, &d.UserID, &d.RedeemedRewardID, &d.TreesCount, &d.Attempts, &d.CreatedAt,
+			&d.RecipientName, &d.RecipientEmail,
+		); err != nil {
+			return nil, err
+		}
+		donations = append(donations, d)
+	}
+	return donations, rows.Err()
+}
+
+// MarkPlanted stores the certificate of a donation, marks its redemption USED
+// and adds its trees to the community total, moving the target up by
+// models.TreesTargetStep once reached. Returns false when the donation was
+// already planted.
+func (r *TreeRepository) MarkPlanted(ctx context.Context, provider string, certificate trees.Certificate) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var count int
+	var redeemedRewardID *uuid.UUID
+	err = tx.QueryRow(ctx, `
+		UPDATE trees_planted SET
+			status = 'PLANTED', provider = $2,
+			tree_nation_id = $3, tree_nation_url = $4,
+			species = NULLIF($5, ''), location = NULLIF($6, ''),
+			planted_at = NOW(), last_error = NULL
+		WHERE id = $1 AND status IN ('PENDING', 'SUBMITTED')
+		RETURNING trees_count, redeemed_reward_id
+	`, certificate.DonationID, provider, certificate.TreeID, certificate.URL,
+		certificate.Species, certificate.Location,
+	).Scan(&count, &redeemedRewardID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if redeemedRewardID != nil {
+		if _, err := tx.Exec(ctx, `
+			UPDATE redeemed_rewards SET status = 'USED', used_at = NOW()
+			WHERE id = $1 AND status = 'PENDING'
+		`, redeemedRewardID); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE community_impact SET
+			trees_planted = trees_planted + $1,
+			trees_target = CASE
+				WHEN trees_planted + $1 >= trees_target THEN ((trees_planted + $1) / $2 + 1) * $2
+				ELSE trees_target
+			END,
+			updated_at = NOW()
+	`, count, models.TreesTargetStep); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// ReleaseUnsent puts back to PENDING a submitted donation the partner never
+// received, recording why, so it is claimed again later
+func (r *TreeRepository) ReleaseUnsent(ctx context.Context, id uuid.UUID, reason string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE trees_planted SET status = 'PENDING', last_error = $2
+		WHERE id = $1 AND status = 'SUBMITTED'
+	`, id, reason)
+	return err
+}
+
+// MarkPlantFailed records why a submitted donation got no certificate. The
+// partner may have ordered its trees, so it stays SUBMITTED and is never sent
+// again: staff check it with the partner.
+func (r *TreeRepository) MarkPlantFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE trees_planted SET last_error = $2
+		WHERE id = $1 AND status = 'SUBMITTED'
+	`, id, reason)
+	return err
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrTOTPNotSetUp   = errors.New("two-factor authentication not set up")
+	ErrTOTPCodeReused = errors.New("two-factor code already used")
+)
+
+type TwoFactorRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTwoFactorRepository(pool *pgxpool.Pool) *TwoFactorRepository {
+	return &TwoFactorRepository{pool: pool}
+}
+
+// GetSecret returns the encrypted TOTP secret and whether 2FA is active
+func (r *TwoFactorRepository) GetSecret(ctx context.Context, userID uuid.UUID) (string, bool, error) {
+	var secret *string
+	var enabled bool
+	err := r.pool.QueryRow(ctx, `
+		SELECT totp_secret, COALESCE(totp_enabled, false) FROM users WHERE id = $1
+	`, userID).Scan(&secret, &enabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, ErrUserNotFound
+		}
+		return "", false, err
+	}
+	if secret == nil {
+		return "", false, ErrTOTPNotSetUp
+	}
+	return *secret, enabled, nil
+}
+
+// SetPendingSecret stores a new secret awaiting confirmation (2FA stays off)
+func (r *TwoFactorRepository) SetPendingSecret(ctx context.Context, userID uuid.UUID, encryptedSecret string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE users SET totp_secret = $2, totp_enabled = false, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, userID, encryptedSecret)
+	return err
+}
+
+// Enable activates 2FA and replaces the recovery codes
+func (r *TwoFactorRepository) Enable(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE users SET totp_enabled = true, totp_enabled_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND totp_secret IS NOT NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPNotSetUp
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Disable turns 2FA off and deletes secret and recovery codes
+func (r *TwoFactorRepository) Disable(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled = false, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseStep records the time step of an accepted code.
+// Returns ErrTOTPCodeReused if that step (or a later one) was already used.
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE users SET totp_last_step = $2
+		WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPCodeReused
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes discards the old recovery codes and stores new ones
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseRecoveryCode consumes a recovery code, reporting whether it was valid
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	result, err := r.pool.Exec(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes are left
+func (r *TwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userID).Scan(&count)
+	return count, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
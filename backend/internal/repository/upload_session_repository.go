@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+)
+
+type UploadSessionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewUploadSessionRepository(pool *pgxpool.Pool) *UploadSessionRepository {
+	return &UploadSessionRepository{pool: pool}
+}
+
+// Create stores a new PENDING upload session
+func (r *UploadSessionRepository) Create(ctx context.Context, session *models.UploadSession) error {
+	query := `
+		INSERT INTO upload_sessions (id, user_id, product_id, file_url, content_type, status, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	session.ID = uuid.New()
+	session.Status = models.UploadSessionPending
+	session.CreatedAt = time.Now()
+
+	_, err := r.pool.Exec(ctx, query,
+		session.ID, session.UserID, session.ProductID, session.FileURL, session.ContentType,
+		session.Status, session.ExpiresAt, session.CreatedAt,
+	)
+	return err
+}
+
+// GetByID returns an upload session by ID
+func (r *UploadSessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.UploadSession, error) {
+	query := `
+		SELECT id, user_id, product_id, file_url, content_type, status,
+		       COALESCE(rejection_reason, ''), expires_at, finalized_at, created_at
+		FROM upload_sessions
+		WHERE id = $1
+	`
+
+	s := &models.UploadSession{}
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&s.ID, &s.UserID, &s.ProductID, &s.FileURL, &s.ContentType, &s.Status,
+		&s.RejectionReason, &s.ExpiresAt, &s.FinalizedAt, &s.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// MarkFinalized marks a PENDING session as finalized.
+// Returns ErrUploadSessionNotFound if it was already finalized by a concurrent request.
+func (r *UploadSessionRepository) MarkFinalized(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE upload_sessions
+		SET status = 'FINALIZED', finalized_at = $1
+		WHERE id = $2 AND status = 'PENDING'
+	`
+	result, err := r.pool.Exec(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUploadSessionNotFound
+	}
+	return nil
+}
+
+// MarkRejected marks a session whose object failed validation
+func (r *UploadSessionRepository) MarkRejected(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE upload_sessions
+		SET status = 'REJECTED', rejection_reason = $1
+		WHERE id = $2 AND status = 'PENDING'
+	`
+	_, err := r.pool.Exec(ctx, query, reason, id)
+	return err
+}
+
+// MarkExpired marks a session as expired (its object has been deleted)
+func (r *UploadSessionRepository) MarkExpired(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE upload_sessions SET status = 'EXPIRED' WHERE id = $1 AND status = 'PENDING'`
+	_, err := r.pool.Exec(ctx, query, id)
+	return err
+}
+
+// GetExpiredPending returns PENDING sessions whose expiry is older than before
+func (r *UploadSessionRepository) GetExpiredPending(ctx context.Context, before time.Time, limit int) ([]models.UploadSession, error) {
+	query := `
+		SELECT id, user_id, product_id, file_url, content_type, status,
+		       COALESCE(rejection_reason, ''), expires_at, finalized_at, created_at
+		FROM upload_sessions
+		WHERE status = 'PENDING' AND expires_at < $1
+		ORDER BY expires_at ASC
+		LIMIT $2
+	`
+
+	rows, err := r.pool.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.UploadSession
+	for rows.Next() {
+		var s models.UploadSession
+		if err := rows.Scan(
+			&s.ID, &s.UserID, &s.ProductID, &s.FileURL, &s.ContentType, &s.Status,
+			&s.RejectionReason, &s.ExpiresAt, &s.FinalizedAt, &s.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, nil
+}
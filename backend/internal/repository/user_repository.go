@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -19,6 +20,9 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrEmailAlreadyExists = errors.New("email already exists")
 	ErrLocationNotFound   = errors.New("location not found")
+	ErrInvalidEmailToken  = errors.New("invalid or expired token")
+	ErrEmailSentRecently  = errors.New("email sent too recently")
+	ErrAccountTypeSame    = errors.New("account already has this type")
 )
 
 type UserRepository struct {
@@ -35,9 +39,9 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 			id, email, password_hash, first_name, last_name, phone,
 			city, province, postal_code, account_type, business_name, vat_number,
 			has_multiple_locations, fiscal_code, sdi_code, pec_email, eu_vat_id, billing_country,
-			status, email_verified, created_at, updated_at
+			status, email_verified, slug, created_at, updated_at
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10::account_type, $11, $12, $13, $14, $15, $16, $17, $18, $19::user_status, $20, $21, $22
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10::account_type, $11, $12, $13, $14, $15, $16, $17, $18, $19::user_status, $20, $21, $22, $23
 		)
 	`
 
@@ -50,12 +54,14 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	if user.AccountType == "" {
 		user.AccountType = models.AccountPrivate
 	}
+	user.SetRoles([]models.Role{models.RoleBuyer})
+	user.Slug = sellerSlug(user)
 
 	_, err := r.pool.Exec(ctx, query,
 		user.ID, user.Email, user.PasswordHash, user.FirstName, user.LastName, user.Phone,
 		user.City, user.Province, user.PostalCode, string(user.AccountType), user.BusinessName, user.VATNumber,
 		user.HasMultipleLocations, user.FiscalCode, user.SDICode, user.PECEmail, user.EUVatID, user.BillingCountry,
-		string(user.Status), user.EmailVerified, user.CreatedAt, user.UpdatedAt,
+		string(user.Status), user.EmailVerified, user.Slug, user.CreatedAt, user.UpdatedAt,
 	)
 
 	if err != nil && strings.Contains(err.Error(), "users_email_key") {
@@ -64,6 +70,38 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	return err
 }
 
+// slugAccents folds the accented letters common in Italian names
+var slugAccents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ò", "o", "ó", "o", "ô", "o", "ö", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ç", "c", "ñ", "n",
+)
+
+var slugInvalidRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify lower-cases s and keeps letters and digits, joined by dashes, in at most maxLen bytes
+func slugify(s string, maxLen int) string {
+	slug := slugInvalidRe.ReplaceAllString(slugAccents.Replace(strings.ToLower(s)), "-")
+	if len(slug) > maxLen {
+		slug = slug[:maxLen]
+	}
+	return strings.Trim(slug, "-")
+}
+
+// sellerSlug builds the storefront address of a new user: the display name and the
+// first 8 hex digits of the id. Keep it in sync with migration 015_seller_storefront.sql.
+func sellerSlug(user *models.User) string {
+	name := user.FirstName + " " + user.LastName
+	if user.IsBusiness() && user.BusinessName != "" {
+		name = user.BusinessName
+	}
+	base := slugify(name, 60)
+	if base == "" {
+		base = "venditore"
+	}
+	return base + "-" + strings.ReplaceAll(user.ID.String(), "-", "")[:8]
+}
+
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
 		SELECT id, email, password_hash, first_name, last_name,
@@ -73,11 +111,11 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 		       COALESCE(fiscal_code, ''), COALESCE(sdi_code, ''), COALESCE(pec_email, ''),
 		       COALESCE(eu_vat_id, ''), COALESCE(billing_address, ''), COALESCE(billing_city, ''),
 		       COALESCE(billing_province, ''), COALESCE(billing_postal_code, ''), COALESCE(billing_country, 'IT'),
-		       status::text, email_verified, COALESCE(is_admin, false),
-		       COALESCE(avatar_url, ''), COALESCE(social_links, '{}'), COALESCE(business_photos, '[]'),
+		       status::text, email_verified, COALESCE(roles::text[], '{BUYER}'), COALESCE(totp_enabled, false),
+		       COALESCE(avatar_url, ''), COALESCE(social_links, '{}'), COALESCE(business_photos, '[]'), COALESCE(slug, ''),
 		       stripe_customer_id, stripe_account_id,
-		       COALESCE(total_co2_saved, 0), COALESCE(total_water_saved, 0), COALESCE(eco_credits, 0), COALESCE(eco_level, 'Germoglio'),
-		       COALESCE(rating_avg, 0), COALESCE(rating_count, 0),
+		       COALESCE(total_co2_saved, 0), COALESCE(total_water_saved, 0), COALESCE(total_waste_saved, 0), COALESCE(eco_credits, 0), COALESCE(eco_level, 'Germoglio'),
+		       COALESCE(rating_avg, 0), COALESCE(rating_count, 0), deletion_scheduled_at,
 		       last_login_at, created_at, updated_at
 		FROM users WHERE id = $1 AND deleted_at IS NULL
 	`
@@ -87,6 +125,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 	var accountType string
 	var socialLinksJSON []byte
 	var businessPhotosJSON []byte
+	var roles []string
 
 	err := r.pool.QueryRow(ctx, query, id).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
@@ -96,11 +135,11 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 		&user.FiscalCode, &user.SDICode, &user.PECEmail,
 		&user.EUVatID, &user.BillingAddress, &user.BillingCity,
 		&user.BillingProvince, &user.BillingPostalCode, &user.BillingCountry,
-		&status, &user.EmailVerified, &user.IsAdmin,
-		&user.AvatarURL, &socialLinksJSON, &businessPhotosJSON,
+		&status, &user.EmailVerified, &roles, &user.TOTPEnabled,
+		&user.AvatarURL, &socialLinksJSON, &businessPhotosJSON, &user.Slug,
 		&user.StripeCustomerID, &user.StripeAccountID,
-		&user.TotalCO2Saved, &user.TotalWaterSaved, &user.EcoCredits, &user.EcoLevel,
-		&user.RatingAvg, &user.RatingCount,
+		&user.TotalCO2Saved, &user.TotalWaterSaved, &user.TotalWasteSaved, &user.EcoCredits, &user.EcoLevel,
+		&user.RatingAvg, &user.RatingCount, &user.DeletionScheduledAt,
 		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 
@@ -113,6 +152,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 
 	user.Status = models.UserStatus(status)
 	user.AccountType = models.AccountType(accountType)
+	user.SetRoles(toRoles(roles))
 
 	// Parse JSON fields
 	json.Unmarshal(socialLinksJSON, &user.SocialLinks)
@@ -130,11 +170,11 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 		       COALESCE(fiscal_code, ''), COALESCE(sdi_code, ''), COALESCE(pec_email, ''),
 		       COALESCE(eu_vat_id, ''), COALESCE(billing_address, ''), COALESCE(billing_city, ''),
 		       COALESCE(billing_province, ''), COALESCE(billing_postal_code, ''), COALESCE(billing_country, 'IT'),
-		       status::text, email_verified, COALESCE(is_admin, false),
-		       COALESCE(avatar_url, ''), COALESCE(social_links, '{}'), COALESCE(business_photos, '[]'),
+		       status::text, email_verified, COALESCE(roles::text[], '{BUYER}'), COALESCE(totp_enabled, false),
+		       COALESCE(avatar_url, ''), COALESCE(social_links, '{}'), COALESCE(business_photos, '[]'), COALESCE(slug, ''),
 		       stripe_customer_id, stripe_account_id,
-		       COALESCE(total_co2_saved, 0), COALESCE(total_water_saved, 0), COALESCE(eco_credits, 0), COALESCE(eco_level, 'Germoglio'),
-		       COALESCE(rating_avg, 0), COALESCE(rating_count, 0),
+		       COALESCE(total_co2_saved, 0), COALESCE(total_water_saved, 0), COALESCE(total_waste_saved, 0), COALESCE(eco_credits, 0), COALESCE(eco_level, 'Germoglio'),
+		       COALESCE(rating_avg, 0), COALESCE(rating_count, 0), deletion_scheduled_at,
 		       last_login_at, created_at, updated_at
 		FROM users WHERE email = $1 AND deleted_at IS NULL
 	`
@@ -144,6 +184,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 	var accountType string
 	var socialLinksJSON []byte
 	var businessPhotosJSON []byte
+	var roles []string
 
 	err := r.pool.QueryRow(ctx, query, email).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
@@ -153,11 +194,11 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 		&user.FiscalCode, &user.SDICode, &user.PECEmail,
 		&user.EUVatID, &user.BillingAddress, &user.BillingCity,
 		&user.BillingProvince, &user.BillingPostalCode, &user.BillingCountry,
-		&status, &user.EmailVerified, &user.IsAdmin,
-		&user.AvatarURL, &socialLinksJSON, &businessPhotosJSON,
+		&status, &user.EmailVerified, &roles, &user.TOTPEnabled,
+		&user.AvatarURL, &socialLinksJSON, &businessPhotosJSON, &user.Slug,
 		&user.StripeCustomerID, &user.StripeAccountID,
-		&user.TotalCO2Saved, &user.TotalWaterSaved, &user.EcoCredits, &user.EcoLevel,
-		&user.RatingAvg, &user.RatingCount,
+		&user.TotalCO2Saved, &user.TotalWaterSaved, &user.TotalWasteSaved, &user.EcoCredits, &user.EcoLevel,
+		&user.RatingAvg, &user.RatingCount, &user.DeletionScheduledAt,
 		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 
@@ -170,6 +211,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 
 	user.Status = models.UserStatus(status)
 	user.AccountType = models.AccountType(accountType)
+	user.SetRoles(toRoles(roles))
 
 	// Parse JSON fields
 	json.Unmarshal(socialLinksJSON, &user.SocialLinks)
@@ -191,7 +233,164 @@ func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, e
 	return exists, err
 }
 
-func (r *UserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, req *models.UpdateProfileRequest) error {
+// GetIDBySlug returns the user owning a storefront slug
+func (r *UserRepository) GetIDBySlug(ctx context.Context, slug string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.pool.QueryRow(ctx,
+		"SELECT id FROM users WHERE slug = $1 AND deleted_at IS NULL", slug,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrUserNotFound
+		}
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// oauthColumns maps an OIDC provider to the column holding its subject
+var oauthColumns = map[string]string{
+	"google":   "google_id",
+	"apple":    "apple_id",
+	"facebook": "facebook_id",
+}
+
+// GetIDByOAuth returns the user linked to a provider subject
+func (r *UserRepository) GetIDByOAuth(ctx context.Context, provider, subject string) (uuid.UUID, error) {
+	column, ok := oauthColumns[provider]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("unknown oauth provider %q", provider)
+	}
+
+	var id uuid.UUID
+	err := r.pool.QueryRow(ctx,
+		"SELECT id FROM users WHERE "+column+" = $1 AND deleted_at IS NULL", subject,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrUserNotFound
+		}
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// LinkOAuth links a provider subject to a user.
+// emailVerified marks the email verified when the provider vouched for it; avatarURL only fills an empty avatar.
+// Accounts without a password record the provider they were created with.
+func (r *UserRepository) LinkOAuth(ctx context.Context, id uuid.UUID, provider, subject, avatarURL string, emailVerified bool) error {
+	column, ok := oauthColumns[provider]
+	if !ok {
+		return fmt.Errorf("unknown oauth provider %q", provider)
+	}
+
+	query := `
+		UPDATE users
+		SET ` + column + ` = $2,
+		    email_verified = email_verified OR $5,
+		    oauth_provider = CASE WHEN password_hash = '' THEN COALESCE(oauth_provider, $3) ELSE oauth_provider END,
+		    avatar_url = COALESCE(NULLIF(avatar_url, ''), NULLIF($4, '')),
+		    updated_at = NOW()
+		WHERE id = $1
+	`
+	result, err := r.pool.Exec(ctx, query, id, subject, provider, avatarURL, emailVerified)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ClearPassword removes the password so only the linked providers can sign in
+func (r *UserRepository) ClearPassword(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `UPDATE users SET password_hash = '', updated_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+// SetEmailVerificationToken stores a new verification token hash.
+// Returns ErrEmailSentRecently if the previous one was issued less than cooldown ago.
+func (r *UserRepository) SetEmailVerificationToken(ctx context.Context, id uuid.UUID, tokenHash string, expiresAt time.Time, cooldown time.Duration) error {
+	query := `
+		UPDATE users
+		SET email_verification_token = $2, email_verification_expires = $3,
+		    email_verification_sent_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		  AND (email_verification_sent_at IS NULL OR email_verification_sent_at < NOW() - make_interval(secs => $4))
+	`
+	result, err := r.pool.Exec(ctx, query, id, tokenHash, expiresAt, cooldown.Seconds())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrEmailSentRecently
+	}
+	return nil
+}
+
+// VerifyEmail consumes a verification token and marks the email as verified
+func (r *UserRepository) VerifyEmail(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	query := `
+		UPDATE users
+		SET email_verified = true, email_verification_token = NULL,
+		    email_verification_expires = NULL, updated_at = NOW()
+		WHERE email_verification_token = $1 AND email_verification_expires > NOW()
+		RETURNING id
+	`
+	var id uuid.UUID
+	if err := r.pool.QueryRow(ctx, query, tokenHash).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrInvalidEmailToken
+		}
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// SetPasswordResetToken stores a new password reset token hash.
+// Returns ErrEmailSentRecently if the previous one was issued less than cooldown ago.
+func (r *UserRepository) SetPasswordResetToken(ctx context.Context, id uuid.UUID, tokenHash string, expiresAt time.Time, cooldown time.Duration) error {
+	query := `
+		UPDATE users
+		SET password_reset_token = $2, password_reset_expires = $3,
+		    password_reset_sent_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		  AND (password_reset_sent_at IS NULL OR password_reset_sent_at < NOW() - make_interval(secs => $4))
+	`
+	result, err := r.pool.Exec(ctx, query, id, tokenHash, expiresAt, cooldown.Seconds())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrEmailSentRecently
+	}
+	return nil
+}
+
+// ResetPassword consumes a reset token and sets the new password hash.
+// Receiving the token proves control of the inbox, so the email counts as verified too.
+func (r *UserRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (uuid.UUID, error) {
+	query := `
+		UPDATE users
+		SET password_hash = $2, password_reset_token = NULL, password_reset_expires = NULL,
+		    email_verified = true, updated_at = NOW()
+		WHERE password_reset_token = $1 AND password_reset_expires > NOW() AND deleted_at IS NULL
+		RETURNING id
+	`
+	var id uuid.UUID
+	if err := r.pool.QueryRow(ctx, query, tokenHash, passwordHash).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrInvalidEmailToken
+		}
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// UpdateProfile applies the fields set in req and writes the audit records in
+// the same transaction
+func (r *UserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, req *models.UpdateProfileRequest, entries ...*models.AuditLog) error {
 	// Build dynamic update query
 	updates := []string{}
 	args := []interface{}{}
@@ -221,9 +420,6 @@ func (r *UserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, req *m
 	if req.PostalCode != nil {
 		addField("postal_code", *req.PostalCode)
 	}
-	if req.AccountType != nil {
-		addField("account_type", string(*req.AccountType))
-	}
 	if req.BusinessName != nil {
 		addField("business_name", *req.BusinessName)
 	}
@@ -273,9 +469,20 @@ func (r *UserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, req *m
 	updates = append(updates, "updated_at = NOW()")
 	args = append(args, id)
 
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d", strings.Join(updates, ", "), argNum)
-	_, err := r.pool.Exec(ctx, query, args...)
-	return err
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return err
+	}
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (r *UserRepository) UpdateAvatar(ctx context.Context, id uuid.UUID, avatarURL string) error {
@@ -291,6 +498,98 @@ func (r *UserRepository) AddBusinessPhoto(ctx context.Context, id uuid.UUID, pho
 	return err
 }
 
+// GetAccountSwitchStats counts what switching the account type affects
+func (r *UserRepository) GetAccountSwitchStats(ctx context.Context, id uuid.UUID) (*models.AccountSwitchStats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM products WHERE seller_id = $1 AND status = 'ACTIVE'),
+			(SELECT COUNT(*) FROM orders WHERE seller_id = $1 AND status::text NOT IN ` + closedOrderStatuses + `),
+			(SELECT COUNT(*) FROM orders WHERE seller_id = $1 AND paid_at IS NOT NULL),
+			(SELECT COALESCE(jsonb_array_length(business_photos), 0) FROM users WHERE id = $1)
+	`
+	stats := &models.AccountSwitchStats{}
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&stats.ActiveListings, &stats.ActiveSellerOrders, &stats.InvoicedOrders, &stats.BusinessPhotos,
+	)
+	return stats, err
+}
+
+// SwitchAccountType changes the account type.
+// Upgrading to BUSINESS stores the (validated) business data. Downgrading to PRIVATE
+// keeps it, hidden, and moves the active listings back to draft so the seller reviews
+// them; it fails with ErrActiveOrders while orders as seller are in progress.
+// Returns the number of listings unpublished; entriesFor is called with it and
+// its audit records are written in the same transaction.
+func (r *UserRepository) SwitchAccountType(ctx context.Context, id uuid.UUID, target models.AccountType, data models.BusinessData, entriesFor func(unpublished int64) []*models.AuditLog) (int64, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var current string
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(account_type::text, 'PRIVATE') FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, id).Scan(&current)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+	if models.AccountType(current) == target {
+		return 0, ErrAccountTypeSame
+	}
+
+	var unpublished int64
+	if target == models.AccountBusiness {
+		_, err = tx.Exec(ctx, `
+			UPDATE users
+			SET account_type = 'BUSINESS', business_name = $2, vat_number = NULLIF($3, ''),
+			    fiscal_code = NULLIF($4, ''), sdi_code = NULLIF($5, ''), pec_email = NULLIF($6, ''),
+			    eu_vat_id = NULLIF($7, ''), billing_address = $8, billing_city = $9,
+			    billing_province = NULLIF($10, ''), billing_postal_code = $11, billing_country = $12,
+			    updated_at = NOW()
+			WHERE id = $1
+		`, id, data.BusinessName, data.VATNumber, data.FiscalCode, data.SDICode, data.PECEmail,
+			data.EUVatID, data.BillingAddress, data.BillingCity, data.BillingProvince,
+			data.BillingPostalCode, data.BillingCountry)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		var active int
+		if err := tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM orders WHERE seller_id = $1 AND status::text NOT IN `+closedOrderStatuses,
+			id,
+		).Scan(&active); err != nil {
+			return 0, err
+		}
+		if active > 0 {
+			return 0, ErrActiveOrders
+		}
+
+		result, err := tx.Exec(ctx, `
+			UPDATE products SET status = 'DRAFT', updated_at = NOW() WHERE seller_id = $1 AND status = 'ACTIVE'
+		`, id)
+		if err != nil {
+			return 0, err
+		}
+		unpublished = result.RowsAffected()
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE users SET account_type = 'PRIVATE', updated_at = NOW() WHERE id = $1
+		`, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := appendAuditEntries(ctx, tx, entriesFor(unpublished)); err != nil {
+		return 0, err
+	}
+	return unpublished, tx.Commit(ctx)
+}
+
 // Location methods
 
 func (r *UserRepository) CreateLocation(ctx context.Context, loc *models.Location) error {
@@ -333,7 +632,7 @@ func (r *UserRepository) GetLocationsByUser(ctx context.Context, userID uuid.UUI
 		SELECT id, user_id, name, is_primary, is_active,
 		       address_street, address_city, COALESCE(address_province, ''), address_postal_code,
 		       COALESCE(phone, ''), COALESCE(email, ''), COALESCE(pickup_hours::text, ''), COALESCE(pickup_instructions, ''),
-		       created_at
+		       latitude::float8, longitude::float8, created_at
 		FROM seller_locations
 		WHERE user_id = $1 AND is_active = true
 		ORDER BY is_primary DESC, created_at ASC
@@ -352,7 +651,7 @@ func (r *UserRepository) GetLocationsByUser(ctx context.Context, userID uuid.UUI
 			&loc.ID, &loc.UserID, &loc.Name, &loc.IsPrimary, &loc.IsActive,
 			&loc.AddressStreet, &loc.AddressCity, &loc.AddressProvince, &loc.AddressPostal,
 			&loc.Phone, &loc.Email, &loc.PickupHours, &loc.PickupInstructions,
-			&loc.CreatedAt,
+			&loc.Latitude, &loc.Longitude, &loc.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -368,7 +667,7 @@ func (r *UserRepository) GetLocationByID(ctx context.Context, id uuid.UUID) (*mo
 		SELECT id, user_id, name, is_primary, is_active,
 		       address_street, address_city, COALESCE(address_province, ''), address_postal_code,
 		       COALESCE(phone, ''), COALESCE(email, ''), COALESCE(pickup_hours::text, ''), COALESCE(pickup_instructions, ''),
-		       created_at
+		       latitude::float8, longitude::float8, created_at
 		FROM seller_locations
 		WHERE id = $1
 	`
@@ -378,7 +677,7 @@ func (r *UserRepository) GetLocationByID(ctx context.Context, id uuid.UUID) (*mo
 		&loc.ID, &loc.UserID, &loc.Name, &loc.IsPrimary, &loc.IsActive,
 		&loc.AddressStreet, &loc.AddressCity, &loc.AddressProvince, &loc.AddressPostal,
 		&loc.Phone, &loc.Email, &loc.PickupHours, &loc.PickupInstructions,
-		&loc.CreatedAt,
+		&loc.Latitude, &loc.Longitude, &loc.CreatedAt,
 	)
 
 	if err != nil {
@@ -398,12 +697,22 @@ func (r *UserRepository) DeleteLocation(ctx context.Context, id uuid.UUID) error
 }
 
 func (r *UserRepository) UpdateLocation(ctx context.Context, loc *models.Location) error {
+	// A new address is geocoded again: the coordinates are cleared when it changes
 	query := `
-		UPDATE seller_locations SET
+		UPDATE seller_locations l SET
 			name = $2, is_primary = $3, address_street = $4, address_city = $5,
 			address_province = $6, address_postal_code = $7, phone = $8, email = $9,
-			pickup_hours = $10, pickup_instructions = $11, updated_at = NOW()
-		WHERE id = $1`
+			pickup_hours = $10, pickup_instructions = $11, updated_at = NOW(),
+			latitude = CASE WHEN old.moved THEN NULL ELSE l.latitude END,
+			longitude = CASE WHEN old.moved THEN NULL ELSE l.longitude END,
+			geocoded_at = CASE WHEN old.moved THEN NULL ELSE l.geocoded_at END,
+			geocode_precision = CASE WHEN old.moved THEN NULL ELSE l.geocode_precision END
+		FROM (
+			SELECT (address_street, address_city, COALESCE(address_province, ''), address_postal_code)
+			       IS DISTINCT FROM ($4::text, $5::text, $6::text, $7::text) AS moved
+			FROM seller_locations WHERE id = $1
+		) old
+		WHERE l.id = $1`
 
 	// Handle empty pickup_hours (JSONB column requires valid JSON or NULL)
 	var pickupHours interface{}
@@ -424,8 +733,121 @@ func (r *UserRepository) UpdateLocation(ctx context.Context, loc *models.Locatio
 // Admin methods
 
 func (r *UserRepository) IsAdmin(ctx context.Context, id uuid.UUID) (bool, error) {
-	query := `SELECT COALESCE(is_admin, false) FROM users WHERE id = $1`
+	query := `SELECT COALESCE('ADMIN' = ANY(roles), false) FROM users WHERE id = $1`
 	var isAdmin bool
 	err := r.pool.QueryRow(ctx, query, id).Scan(&isAdmin)
 	return isAdmin, err
 }
+
+// SetStaffRoles replaces the user's staff roles (ADMIN, MODERATOR, SUPPORT), keeping
+// the others. The legacy is_admin flag is kept in sync. entriesFor is called
+// with the resulting roles and its audit records are written in the same transaction.
+func (r *UserRepository) SetStaffRoles(ctx context.Context, id uuid.UUID, staffRoles []models.Role, entriesFor func(roles []models.Role) []*models.AuditLog) ([]models.Role, error) {
+	names := make([]string, len(staffRoles))
+	for i, role := range staffRoles {
+		names[i] = string(role)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users
+		SET roles = ARRAY(
+		        SELECT DISTINCT r FROM unnest(
+		            ARRAY(SELECT r FROM unnest(COALESCE(roles, '{BUYER}')) r WHERE r::text NOT IN ('ADMIN', 'MODERATOR', 'SUPPORT'))
+		            || $2::user_role[]
+		        ) r ORDER BY r
+		    ),
+		    is_admin = 'ADMIN' = ANY($2::text[]),
+		    updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING roles::text[]
+	`
+	var granted []string
+	if err := tx.QueryRow(ctx, query, id, names).Scan(&granted); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	roles := toRoles(granted)
+	if err := appendAuditEntries(ctx, tx, entriesFor(roles)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// SetStatus changes the account status (e.g. ban or suspension). A user who is
+// no longer active is logged out of every device; the audit records are
+// written in the same transaction.
+func (r *UserRepository) SetStatus(ctx context.Context, id uuid.UUID, status models.UserStatus, entries ...*models.AuditLog) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE users SET status = $2::user_status, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL
+	`, id, string(status))
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if status != models.UserStatusActive {
+		if _, err := tx.Exec(ctx, `
+			UPDATE sessions SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL
+		`, id); err != nil {
+			return err
+		}
+	}
+	if err := appendAuditEntries(ctx, tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListStaff returns the users holding a staff role
+func (r *UserRepository) ListStaff(ctx context.Context) ([]models.User, error) {
+	query := `
+		SELECT id, email, first_name, last_name, roles::text[], COALESCE(totp_enabled, false), last_login_at
+		FROM users
+		WHERE roles && ARRAY['ADMIN', 'MODERATOR', 'SUPPORT']::user_role[] AND deleted_at IS NULL
+		ORDER BY last_name, first_name
+	`
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staff := []models.User{}
+	for rows.Next() {
+		var u models.User
+		var roles []string
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &roles, &u.TOTPEnabled, &u.LastLoginAt); err != nil {
+			return nil, err
+		}
+		u.SetRoles(toRoles(roles))
+		staff = append(staff, u)
+	}
+	return staff, nil
+}
+
+func toRoles(names []string) []models.Role {
+	roles := make([]models.Role, len(names))
+	for i, name := range names {
+		roles[i] = models.Role(name)
+	}
+	return roles
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/storage"
+)
+
+// BillingRetentionYears is how long the billing data of deleted accounts with paid
+// orders is kept: accounting records must be preserved for 10 years (art. 2220 c.c.)
+const BillingRetentionYears = 10
+
+// AccountPurger periodically anonymises the accounts whose deletion grace
+// period is over, removes their files from storage, and drops retained
+// billing data past its retention period
+type AccountPurger struct {
+	privacyRepo *repository.PrivacyRepository
+	store       storage.Store
+	interval    time.Duration
+}
+
+// purgeBatchSize bounds the work done in a single run
+const purgeBatchSize = 50
+
+// NewAccountPurger creates a new purger. store may be nil when uploads are disabled.
+func NewAccountPurger(privacyRepo *repository.PrivacyRepository, store storage.Store, interval time.Duration) *AccountPurger {
+	return &AccountPurger{
+		privacyRepo: privacyRepo,
+		store:       store,
+		interval:    interval,
+	}
+}
+
+// Start runs the purger in the background until ctx is cancelled
+func (p *AccountPurger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.Purge(ctx)
+			}
+		}
+	}()
+}
+
+// Purge runs a single pass
+func (p *AccountPurger) Purge(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	pending, err := p.privacyRepo.GetDueDeletions(ctx, purgeBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Account purger: failed to load deletions: %v", err)
+		return
+	}
+
+	deleted := 0
+	for _, account := range pending {
+		if p.deleteAccount(ctx, account) {
+			deleted++
+		}
+	}
+
+	// Also retries the files a previous run couldn't delete
+	removed := p.deleteFiles(ctx)
+
+	expired, err := p.privacyRepo.PurgeExpiredBilling(ctx)
+	if err != nil {
+		log.Printf("⚠️  Account purger: failed to purge retained billing data: %v", err)
+	}
+
+	if deleted > 0 || removed > 0 || expired > 0 {
+		log.Printf("🗑️  Account purger: %d accounts anonymised, %d files deleted, %d expired billing records removed", deleted, removed, expired)
+	}
+}
+
+// deleteAccount anonymises the account; its files are queued in the same
+// transaction and removed from storage afterwards, so a failed anonymisation
+// never leaves the profile pointing to deleted files.
+// Accounts with orders in progress are left for a later run.
+func (p *AccountPurger) deleteAccount(ctx context.Context, account models.PendingDeletion) bool {
+	active, err := p.privacyRepo.CountActiveOrders(ctx, account.UserID)
+	if err != nil {
+		log.Printf("⚠️  Account purger: failed to check orders of %s: %v", account.UserID, err)
+		return false
+	}
+	if active > 0 {
+		return false
+	}
+
+	retainUntil := time.Now().AddDate(BillingRetentionYears, 0, 0)
+	if _, err := p.privacyRepo.Anonymize(ctx, account.UserID, retainUntil); err != nil {
+		if !errors.Is(err, repository.ErrActiveOrders) {
+			log.Printf("⚠️  Account purger: failed to anonymise %s: %v", account.UserID, err)
+		}
+		return false
+	}
+	return true
+}
+
+// deleteFiles removes the queued files of anonymised accounts from storage.
+// Failures stay queued for the next run.
+func (p *AccountPurger) deleteFiles(ctx context.Context) int {
+	if p.store == nil {
+		return 0
+	}
+
+	files, err := p.privacyRepo.GetFileDeletions(ctx, purgeBatchSize*10)
+	if err != nil {
+		log.Printf("⚠️  Account purger: failed to load queued files: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for _, f := range files {
+		if f.IsPrivate {
+			err = p.store.DeletePrivate(ctx, f.FileRef)
+		} else {
+			err = p.store.Delete(ctx, f.FileRef)
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("⚠️  Account purger: failed to delete %s (attempt %d): %v", f.FileRef, f.Attempts+1, err)
+			if err := p.privacyRepo.FailFileDeletion(ctx, f.ID, err.Error()); err != nil {
+				log.Printf("⚠️  Account purger: failed to record attempt on %s: %v", f.FileRef, err)
+			}
+			continue
+		}
+		if err := p.privacyRepo.CompleteFileDeletion(ctx, f.ID); err != nil {
+			log.Printf("⚠️  Account purger: failed to dequeue %s: %v", f.FileRef, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// CreditsExpirer periodically expires the EcoCredits earned more than lifetime
+// ago and still unspent (spending consumes the oldest credits first, see
+// eco_credit_lots), posting them as POINTS_EXPIRED ledger entries. Users are
+// emailed warning before their credits expire.
+type CreditsExpirer struct {
+	impactRepo   *repository.ImpactRepository
+	emailService *EmailService
+	lifetime     time.Duration
+	warning      time.Duration
+	interval     time.Duration
+}
+
+// expiryBatchSize bounds the work done in a single run
+const expiryBatchSize = 100
+
+// NewCreditsExpirer creates a new expiry job. A zero lifetime disables expiry,
+// a zero warning disables the warning emails.
+func NewCreditsExpirer(impactRepo *repository.ImpactRepository, emailService *EmailService, lifetime, warning, interval time.Duration) *CreditsExpirer {
+	return &CreditsExpirer{
+		impactRepo:   impactRepo,
+		emailService: emailService,
+		lifetime:     lifetime,
+		warning:      warning,
+		interval:     interval,
+	}
+}
+
+// Start runs the job in the background until ctx is cancelled
+func (e *CreditsExpirer) Start(ctx context.Context) {
+	if e.lifetime <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.Run(ctx)
+			}
+		}
+	}()
+}
+
+// Run sends the due warnings, then expires a single batch of users' credits
+func (e *CreditsExpirer) Run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	warned := 0
+	if e.warning > 0 {
+		warned = e.warn(ctx, now.Add(e.warning-e.lifetime))
+	}
+
+	expiredBefore := now.Add(-e.lifetime)
+	users, err := e.impactRepo.UsersWithExpiredCredits(ctx, expiredBefore, expiryBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Credits expiry: failed to load users: %v", err)
+		return
+	}
+
+	expired := 0
+	for _, userID := range users {
+		credits, err := e.impactRepo.ExpireCredits(ctx, userID, expiredBefore)
+		if err != nil {
+			log.Printf("⚠️  Credits expiry: failed to expire credits of %s: %v", userID, err)
+			continue
+		}
+		expired += credits
+	}
+
+	if warned > 0 || expired > 0 {
+		log.Printf("⏳ Credits expiry: %d users warned, %d EcoCredits expired", warned, expired)
+	}
+}
+
+// warn emails the users with credits earned before earnedBefore, which expire
+// within the warning period. A failed email is retried on the next run.
+func (e *CreditsExpirer) warn(ctx context.Context, earnedBefore time.Time) int {
+	notices, err := e.impactRepo.CreditsToWarn(ctx, earnedBefore, expiryBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Credits expiry: failed to load warnings: %v", err)
+		return 0
+	}
+
+	warned := 0
+	for _, n := range notices {
+		if err := e.emailService.SendCreditsExpiring(n.Email, n.FirstName, n.Credits, n.EarnedAt.Add(e.lifetime)); err != nil {
+			log.Printf("⚠️  Credits expiry: failed to warn %s: %v", n.UserID, err)
+			continue
+		}
+		if err := e.impactRepo.MarkCreditsWarned(ctx, n.UserID, earnedBefore); err != nil {
+			log.Printf("⚠️  Credits expiry: failed to mark %s as warned: %v", n.UserID, err)
+			continue
+		}
+		warned++
+	}
+	return warned
+}
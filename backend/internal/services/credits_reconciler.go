@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// CreditsReconciler periodically recomputes EcoCredits balances from the
+// ledger (impact_logs) and reports users whose cached balance drifted from it.
+// It doesn't correct balances: drift points at a bug or a manual edit, to be
+// looked at by an admin (GET /api/v1/admin/eco-credits/drift).
+type CreditsReconciler struct {
+	impactRepo *repository.ImpactRepository
+	interval   time.Duration
+}
+
+// NewCreditsReconciler creates a new reconciliation job
+func NewCreditsReconciler(impactRepo *repository.ImpactRepository, interval time.Duration) *CreditsReconciler {
+	return &CreditsReconciler{
+		impactRepo: impactRepo,
+		interval:   interval,
+	}
+}
+
+// Start runs the job in the background until ctx is cancelled
+func (r *CreditsReconciler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.Run(ctx)
+			}
+		}
+	}()
+}
+
+// Run runs a single reconciliation
+func (r *CreditsReconciler) Run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	drifting, err := r.impactRepo.ReconcileCredits(ctx)
+	if err != nil {
+		log.Printf("⚠️  EcoCredits reconciliation failed: %v", err)
+		return
+	}
+	if drifting > 0 {
+		log.Printf("⚠️  EcoCredits reconciliation: %d users' balance differs from the ledger", drifting)
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/storage"
+)
+
+// DataExporter builds the GDPR export of a user's data (art. 15 and 20):
+// a ZIP with one JSON file per kind of data and a copy of the uploaded files
+type DataExporter struct {
+	privacyRepo *repository.PrivacyRepository
+	store       storage.Store
+}
+
+// NewDataExporter creates a new exporter. store may be nil when uploads are disabled.
+func NewDataExporter(privacyRepo *repository.PrivacyRepository, store storage.Store) *DataExporter {
+	return &DataExporter{privacyRepo: privacyRepo, store: store}
+}
+
+// exportManifest describes the archive content
+type exportManifest struct {
+	UserID       uuid.UUID `json:"user_id"`
+	GeneratedAt  time.Time `json:"generated_at"`
+	Data         []string  `json:"data"`
+	Files        []string  `json:"files"`
+	MissingFiles []string  `json:"missing_files,omitempty"` // referenced but not readable from storage
+}
+
+// DataExport is the data of a user, read from the database and ready to be archived
+type DataExport struct {
+	UserID   uuid.UUID
+	Sections []models.ExportFile
+	Uploads  []models.ExportUpload
+}
+
+// Load reads the user's data. Call it before starting the response, so a
+// database error can still be reported to the client.
+func (e *DataExporter) Load(ctx context.Context, userID uuid.UUID) (*DataExport, error) {
+	sections, err := e.privacyRepo.ExportData(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	uploads, err := e.privacyRepo.GetUploadedFiles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &DataExport{UserID: userID, Sections: sections, Uploads: uploads}, nil
+}
+
+// Write streams the ZIP archive to w. Files that can't be read from storage
+// are listed in the manifest instead of failing the whole export.
+func (e *DataExporter) Write(ctx context.Context, w io.Writer, export *DataExport) error {
+	userID, sections, uploads := export.UserID, export.Sections, export.Uploads
+	manifest := exportManifest{UserID: userID, GeneratedAt: time.Now().UTC(), Data: []string{}, Files: []string{}}
+	zw := zip.NewWriter(w)
+
+	for _, section := range sections {
+		name := "data/" + section.Name + ".json"
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(section.Data); err != nil {
+			return err
+		}
+		manifest.Data = append(manifest.Data, name)
+	}
+
+	used := make(map[string]bool)
+	for _, upload := range uploads {
+		name := exportFileName(upload.Folder, upload.URL, used)
+		if e.store == nil {
+			manifest.MissingFiles = append(manifest.MissingFiles, upload.URL)
+			continue
+		}
+		if err := e.copyFile(ctx, zw, name, upload); err != nil {
+			log.Printf("⚠️  Data export %s: file %s skipped: %v", userID, upload.URL, err)
+			manifest.MissingFiles = append(manifest.MissingFiles, upload.URL)
+			continue
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// copyFile stores a file from storage into the archive
+func (e *DataExporter) copyFile(ctx context.Context, zw *zip.Writer, name string, upload models.ExportUpload) error {
+	var src io.ReadCloser
+	var err error
+	if upload.Private {
+		src, err = e.store.GetPrivate(ctx, upload.URL)
+	} else {
+		src, err = e.store.Get(ctx, upload.URL)
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Images and videos are already compressed
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// exportFileName names a file inside the archive after its folder and the last
+// element of its URL, adding a counter when two files would collide
+func exportFileName(folder, fileURL string, used map[string]bool) string {
+	base := path.Base(fileURL)
+	if u, err := url.Parse(fileURL); err == nil {
+		base = path.Base(u.Path)
+	}
+	if base == "." || base == "/" {
+		base = "file"
+	}
+
+	name := "files/" + folder + "/" + base
+	for i := 2; used[name]; i++ {
+		ext := path.Ext(base)
+		name = fmt.Sprintf("files/%s/%s-%d%s", folder, base[:len(base)-len(ext)], i, ext)
+	}
+	used[name] = true
+	return name
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net"
 	"net/smtp"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gecogreen/backend/internal/config"
 	"github.com/gecogreen/backend/internal/models"
@@ -157,6 +159,263 @@ func (s *EmailService) SendNewOrderToSeller(order *models.Order, product *models
 	return s.sendEmail(sellerEmail, subject, body)
 }
 
+// SendEmailVerification sends the link to confirm the email address
+func (s *EmailService) SendEmailVerification(email, name, token string) error {
+	subject := "Conferma il tuo indirizzo email - GecoGreen"
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.config.FrontendURL, url.QueryEscape(token))
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #22c55e, #16a34a); color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 20px; border: 1px solid #e5e7eb; }
+        .footer { text-align: center; padding: 20px; color: #6b7280; font-size: 12px; }
+        .btn { display: inline-block; background: #22c55e; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; margin-top: 15px; }
+        .note { color: #6b7280; font-size: 13px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Conferma la tua email</h1>
+        </div>
+        <div class="content">
+            <p>Ciao <strong>%s</strong>,</p>
+            <p>Benvenuto su GecoGreen! Conferma il tuo indirizzo email per completare la registrazione.</p>
+
+            <p style="margin-top: 20px;">
+                <a href="%s" class="btn">Conferma Email</a>
+            </p>
+
+            <p class="note">Il link scade tra 48 ore. Se non hai creato un account su GecoGreen, ignora questa email.</p>
+        </div>
+        <div class="footer">
+            <p>GecoGreen - La piattaforma antispreco</p>
+            <p>Insieme contro lo spreco alimentare</p>
+        </div>
+    </div>
+</body>
+</html>
+`,
+		name,
+		link,
+	)
+
+	return s.sendEmail(email, subject, body)
+}
+
+// SendPasswordReset sends the single-use password reset link
+func (s *EmailService) SendPasswordReset(email, name, token string) error {
+	subject := "Reimposta la tua password - GecoGreen"
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.config.FrontendURL, url.QueryEscape(token))
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #22c55e, #16a34a); color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 20px; border: 1px solid #e5e7eb; }
+        .footer { text-align: center; padding: 20px; color: #6b7280; font-size: 12px; }
+        .btn { display: inline-block; background: #22c55e; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; margin-top: 15px; }
+        .note { color: #6b7280; font-size: 13px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Reimposta la password</h1>
+        </div>
+        <div class="content">
+            <p>Ciao <strong>%s</strong>,</p>
+            <p>Abbiamo ricevuto una richiesta di reimpostazione della password del tuo account.</p>
+
+            <p style="margin-top: 20px;">
+                <a href="%s" class="btn">Reimposta Password</a>
+            </p>
+
+            <p class="note">Il link scade tra 1 ora e puo' essere usato una sola volta. Se non hai richiesto tu il reset, ignora questa email: la tua password resta invariata.</p>
+        </div>
+        <div class="footer">
+            <p>GecoGreen - La piattaforma antispreco</p>
+            <p>Insieme contro lo spreco alimentare</p>
+        </div>
+    </div>
+</body>
+</html>
+`,
+		name,
+		link,
+	)
+
+	return s.sendEmail(email, subject, body)
+}
+
+// SendAccountDeletionScheduled confirms a deletion request and explains how to cancel it
+func (s *EmailService) SendAccountDeletionScheduled(email, name string, scheduledAt time.Time) error {
+	subject := "Cancellazione del tuo account - GecoGreen"
+	link := fmt.Sprintf("%s/profile", s.config.FrontendURL)
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #22c55e, #16a34a); color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 20px; border: 1px solid #e5e7eb; }
+        .footer { text-align: center; padding: 20px; color: #6b7280; font-size: 12px; }
+        .btn { display: inline-block; background: #22c55e; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; margin-top: 15px; }
+        .note { color: #6b7280; font-size: 13px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Cancellazione account</h1>
+        </div>
+        <div class="content">
+            <p>Ciao <strong>%s</strong>,</p>
+            <p>Abbiamo ricevuto la tua richiesta di cancellazione dell'account. I tuoi dati personali saranno cancellati il <strong>%s</strong>.</p>
+            <p>Fino a quella data puoi cambiare idea: accedi e annulla la cancellazione dal tuo profilo.</p>
+
+            <p style="margin-top: 20px;">
+                <a href="%s" class="btn">Annulla Cancellazione</a>
+            </p>
+
+            <p class="note">Gli ordini pagati e i relativi dati di fatturazione vengono conservati per 10 anni, come previsto dalla normativa fiscale. Se non hai richiesto tu la cancellazione, accedi subito e cambia la password.</p>
+        </div>
+        <div class="footer">
+            <p>GecoGreen - La piattaforma antispreco</p>
+            <p>Insieme contro lo spreco alimentare</p>
+        </div>
+    </div>
+</body>
+</html>
+`,
+		name,
+		scheduledAt.Format("02/01/2006"),
+		link,
+	)
+
+	return s.sendEmail(email, subject, body)
+}
+
+// SendCreditsExpiring warns that some EcoCredits expire soon if not spent
+func (s *EmailService) SendCreditsExpiring(email, name string, credits int, expiresOn time.Time) error {
+	subject := "I tuoi EcoCredits stanno per scadere - GecoGreen"
+	link := fmt.Sprintf("%s/classifica", s.config.FrontendURL)
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #22c55e, #16a34a); color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 20px; border: 1px solid #e5e7eb; }
+        .footer { text-align: center; padding: 20px; color: #6b7280; font-size: 12px; }
+        .btn { display: inline-block; background: #22c55e; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; margin-top: 15px; }
+        .note { color: #6b7280; font-size: 13px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>EcoCredits in scadenza</h1>
+        </div>
+        <div class="content">
+            <p>Ciao <strong>%s</strong>,</p>
+            <p><strong>%d EcoCredits</strong> del tuo saldo scadono a partire dal <strong>%s</strong>.</p>
+            <p>Usali prima di quella data per un boost dei tuoi annunci, un badge o per piantare un albero.</p>
+
+            <p style="margin-top: 20px;">
+                <a href="%s" class="btn">Usa i tuoi EcoCredits</a>
+            </p>
+
+            <p class="note">Gli EcoCredits si usano a partire dai piu' vecchi, che sono i primi a scadere.</p>
+        </div>
+        <div class="footer">
+            <p>GecoGreen - La piattaforma antispreco</p>
+            <p>Insieme contro lo spreco alimentare</p>
+        </div>
+    </div>
+</body>
+</html>
+`,
+		name,
+		credits,
+		expiresOn.Format("02/01/2006"),
+		link,
+	)
+
+	return s.sendEmail(email, subject, body)
+}
+
+// SendTreePlanted sends the certificate of the trees a user donated with EcoCredits
+func (s *EmailService) SendTreePlanted(email, name string, trees int, certificateURL string) error {
+	subject := "Il tuo albero e' stato piantato! - GecoGreen"
+	planted := "Il tuo albero e' stato piantato"
+	if trees > 1 {
+		planted = fmt.Sprintf("I tuoi %d alberi sono stati piantati", trees)
+	}
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #22c55e, #16a34a); color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 20px; border: 1px solid #e5e7eb; }
+        .footer { text-align: center; padding: 20px; color: #6b7280; font-size: 12px; }
+        .btn { display: inline-block; background: #22c55e; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; margin-top: 15px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Albero piantato!</h1>
+        </div>
+        <div class="content">
+            <p>Ciao <strong>%s</strong>,</p>
+            <p>%s grazie ai tuoi EcoCredits.</p>
+            <p>Il certificato mostra dove cresce e quanta CO2 assorbira' negli anni.</p>
+
+            <p style="margin-top: 20px;">
+                <a href="%s" class="btn">Vedi il certificato</a>
+            </p>
+        </div>
+        <div class="footer">
+            <p>GecoGreen - La piattaforma antispreco</p>
+            <p>Insieme contro lo spreco alimentare</p>
+        </div>
+    </div>
+</body>
+</html>
+`,
+		name,
+		planted,
+		certificateURL,
+	)
+
+	return s.sendEmail(email, subject, body)
+}
+
 func (s *EmailService) getShippingInfo(order *models.Order) string {
 	if order.ShippingCost > 0 {
 		return fmt.Sprintf("<p>Spedizione: %.2f EUR</p>", order.ShippingCost)
@@ -225,7 +484,7 @@ func (s *EmailService) sendEmail(to, subject, htmlBody string) error {
 	message.WriteString("\r\n")
 	message.WriteString(htmlBody)
 
-	addr := fmt.Sprintf("%s:%s", s.config.SMTPHost, s.config.SMTPPort)
+	addr := net.JoinHostPort(s.config.SMTPHost, s.config.SMTPPort)
 	tlsConfig := &tls.Config{
 		ServerName: s.config.SMTPHost,
 	}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/geo"
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// GeocodeWorker periodically fills in the coordinates of seller locations and
+// products that don't have them yet. Addresses that can't be located are
+// retried the next day.
+type GeocodeWorker struct {
+	geoRepo  *repository.GeoRepository
+	geocoder geo.Geocoder
+	interval time.Duration
+}
+
+// geocodeBatchSize bounds the work done in a single run (a remote geocoder
+// may allow only one request per second)
+const geocodeBatchSize = 50
+
+// NewGeocodeWorker creates a new geocoding worker
+func NewGeocodeWorker(geoRepo *repository.GeoRepository, geocoder geo.Geocoder, interval time.Duration) *GeocodeWorker {
+	return &GeocodeWorker{
+		geoRepo:  geoRepo,
+		geocoder: geocoder,
+		interval: interval,
+	}
+}
+
+// Start runs the worker in the background until ctx is cancelled
+func (w *GeocodeWorker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.Run(ctx)
+			}
+		}
+	}()
+}
+
+// Run geocodes a single batch of locations and products
+func (w *GeocodeWorker) Run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	locations := w.geocode(ctx, "location", w.geoRepo.GetLocationsToGeocode,
+		w.geoRepo.SetLocationCoordinates, w.geoRepo.MarkLocationGeocodeFailed)
+	products := w.geocode(ctx, "product", w.geoRepo.GetProductsToGeocode,
+		w.geoRepo.SetProductCoordinates, w.geoRepo.MarkProductGeocodeFailed)
+
+	if locations > 0 || products > 0 {
+		log.Printf("📍 Geocoding: %d locations, %d products located", locations, products)
+	}
+}
+
+func (w *GeocodeWorker) geocode(
+	ctx context.Context,
+	kind string,
+	load func(context.Context, int) ([]models.GeocodeTarget, error),
+	save func(context.Context, uuid.UUID, *geo.Result) error,
+	markFailed func(context.Context, uuid.UUID) error,
+) int {
+	targets, err := load(ctx, geocodeBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Geocoding: failed to load %ss: %v", kind, err)
+		return 0
+	}
+
+	located := 0
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+
+		result, err := w.geocoder.Geocode(ctx, target.Address)
+		if err != nil {
+			if !errors.Is(err, geo.ErrNotFound) {
+				log.Printf("⚠️  Geocoding: %s %s: %v", kind, target.ID, err)
+			}
+			if err := markFailed(ctx, target.ID); err != nil {
+				log.Printf("⚠️  Geocoding: failed to mark %s %s: %v", kind, target.ID, err)
+			}
+			continue
+		}
+
+		if err := save(ctx, target.ID, result); err != nil {
+			log.Printf("⚠️  Geocoding: failed to save %s %s: %v", kind, target.ID, err)
+			continue
+		}
+		located++
+	}
+	return located
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/models"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+// ImpactPoster posts the EcoCredits and impact of completed orders to the
+// impact ledger (impact_logs), and reverses them when an order is refunded.
+// Handlers call Settle right after a status change; the periodic run catches up
+// on orders whose posting failed or whose status changed elsewhere.
+type ImpactPoster struct {
+	impactRepo *repository.ImpactRepository
+	interval   time.Duration
+}
+
+// impactPostBatchSize bounds the work done in a single run
+const impactPostBatchSize = 100
+
+// NewImpactPoster creates a new impact poster
+func NewImpactPoster(impactRepo *repository.ImpactRepository, interval time.Duration) *ImpactPoster {
+	return &ImpactPoster{
+		impactRepo: impactRepo,
+		interval:   interval,
+	}
+}
+
+// Start runs the poster in the background until ctx is cancelled
+func (p *ImpactPoster) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.Run(ctx)
+			}
+		}
+	}()
+}
+
+// Run settles a single batch of orders
+func (p *ImpactPoster) Run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	post, reverse, err := p.impactRepo.OrdersToSettle(ctx, impactPostBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Impact posting: failed to load orders: %v", err)
+		return
+	}
+
+	posted, reversed := 0, 0
+	for _, id := range post {
+		if p.settle(ctx, id, models.OrderCompleted) {
+			posted++
+		}
+	}
+	for _, id := range reverse {
+		if p.settle(ctx, id, models.OrderRefunded) {
+			reversed++
+		}
+	}
+
+	if posted > 0 || reversed > 0 {
+		log.Printf("🌱 Impact posting: %d orders posted, %d reversed", posted, reversed)
+	}
+}
+
+// Settle posts (COMPLETED) or reverses (REFUNDED) an order's entries after its
+// status changed to status. It's a no-op for other statuses and for orders
+// already settled.
+func (p *ImpactPoster) Settle(ctx context.Context, orderID uuid.UUID, status models.OrderStatus) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	p.settle(ctx, orderID, status)
+}
+
+func (p *ImpactPoster) settle(ctx context.Context, orderID uuid.UUID, status models.OrderStatus) bool {
+	var entries []models.ImpactLog
+	var err error
+	switch status {
+	case models.OrderCompleted:
+		entries, err = p.impactRepo.PostOrder(ctx, orderID)
+	case models.OrderRefunded:
+		entries, err = p.impactRepo.ReverseOrder(ctx, orderID)
+	default:
+		return false
+	}
+	if err != nil {
+		log.Printf("⚠️  Impact posting: order %s (%s) failed: %v", orderID, status, err)
+		return false
+	}
+	return len(entries) > 0
+}
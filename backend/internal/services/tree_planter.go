@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/trees"
+)
+
+// TreePlanter periodically sends the pending tree donations (TREE_DONATION
+// rewards) to the tree provider in batches, stores the certificates and emails
+// them to the donors. A donation is SUBMITTED before it is sent; only those the
+// partner never received are retried later, so no tree is paid for twice.
+type TreePlanter struct {
+	treeRepo     *repository.TreeRepository
+	provider     trees.Provider
+	emailService *EmailService
+	interval     time.Duration
+}
+
+// treePlantBatchSize bounds the donations sent to the provider in a single run
+const treePlantBatchSize = 50
+
+// NewTreePlanter creates a new tree planting job
+func NewTreePlanter(treeRepo *repository.TreeRepository, provider trees.Provider, emailService *EmailService, interval time.Duration) *TreePlanter {
+	return &TreePlanter{
+		treeRepo:     treeRepo,
+		provider:     provider,
+		emailService: emailService,
+		interval:     interval,
+	}
+}
+
+// Start runs the job in the background until ctx is cancelled
+func (p *TreePlanter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.Run(ctx)
+			}
+		}
+	}()
+}
+
+// Run plants a single batch of donations
+func (p *TreePlanter) Run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	donations, err := p.treeRepo.ClaimPending(ctx, treePlantBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Tree planter: failed to load donations: %v", err)
+		return
+	}
+	if len(donations) == 0 {
+		return
+	}
+
+	batch := make([]trees.Donation, len(donations))
+	for i, d := range donations {
+		batch[i] = trees.Donation{
+			ID:             d.ID,
+			Trees:          d.TreesCount,
+			RecipientName:  d.RecipientName,
+			RecipientEmail: d.RecipientEmail,
+		}
+	}
+
+	certificates, unsent, plantErr := p.provider.Plant(ctx, batch)
+	if plantErr != nil {
+		log.Printf("⚠️  Tree planter: %s planted %d of %d donations: %v", p.provider.Name(), len(certificates), len(batch), plantErr)
+	}
+
+	planted := make(map[uuid.UUID]trees.Certificate, len(certificates))
+	for _, certificate := range certificates {
+		planted[certificate.DonationID] = certificate
+	}
+	retry := make(map[uuid.UUID]bool, len(unsent))
+	for _, id := range unsent {
+		retry[id] = true
+	}
+
+	count := 0
+	for _, d := range donations {
+		certificate, ok := planted[d.ID]
+		if !ok {
+			reason := "no certificate returned"
+			if plantErr != nil {
+				reason = plantErr.Error()
+			}
+			if retry[d.ID] {
+				if err := p.treeRepo.ReleaseUnsent(ctx, d.ID, reason); err != nil {
+					log.Printf("⚠️  Tree planter: failed to release %s: %v", d.ID, err)
+				}
+				continue
+			}
+			log.Printf("⚠️  Tree planter: donation %s may have been ordered without a certificate, check it with %s", d.ID, p.provider.Name())
+			if err := p.treeRepo.MarkPlantFailed(ctx, d.ID, reason); err != nil {
+				log.Printf("⚠️  Tree planter: failed to record failure of %s: %v", d.ID, err)
+			}
+			continue
+		}
+
+		// A failure here leaves the donation SUBMITTED: it is not sent again
+		marked, err := p.treeRepo.MarkPlanted(ctx, p.provider.Name(), certificate)
+		if err != nil {
+			log.Printf("⚠️  Tree planter: failed to save certificate of %s: %v", d.ID, err)
+			continue
+		}
+		if !marked {
+			continue
+		}
+		count++
+
+		if d.RecipientEmail != "" {
+			if err := p.emailService.SendTreePlanted(d.RecipientEmail, d.RecipientName, d.TreesCount, certificate.URL); err != nil {
+				log.Printf("⚠️  Tree planter: failed to email certificate of %s: %v", d.ID, err)
+			}
+		}
+	}
+
+	if count > 0 {
+		log.Printf("🌳 Tree planter: %d donations planted", count)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gecogreen/backend/internal/auth"
+	"github.com/gecogreen/backend/internal/repository"
+)
+
+var (
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication not enabled")
+)
+
+// RecoveryCodeCount is how many recovery codes are issued at a time
+const RecoveryCodeCount = 10
+
+// TwoFactorService handles TOTP enrolment and code verification
+type TwoFactorService struct {
+	repo *repository.TwoFactorRepository
+	box  *auth.SecretBox
+}
+
+// NewTwoFactorService creates the service; box encrypts the TOTP secrets at rest
+func NewTwoFactorService(repo *repository.TwoFactorRepository, box *auth.SecretBox) *TwoFactorService {
+	return &TwoFactorService{repo: repo, box: box}
+}
+
+// Setup generates a new secret awaiting confirmation and returns it with its otpauth URI
+func (s *TwoFactorService) Setup(ctx context.Context, userID uuid.UUID, accountName string) (string, string, error) {
+	if _, enabled, err := s.repo.GetSecret(ctx, userID); err == nil && enabled {
+		return "", "", ErrTwoFactorAlreadyEnabled
+	} else if err != nil && err != repository.ErrTOTPNotSetUp {
+		return "", "", err
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := s.box.Seal(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.repo.SetPendingSecret(ctx, userID, sealed); err != nil {
+		return "", "", err
+	}
+
+	return secret, auth.TOTPURI(secret, accountName), nil
+}
+
+// Enable confirms the pending secret with a code and returns the recovery codes (shown once)
+func (s *TwoFactorService) Enable(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	sealed, enabled, err := s.repo.GetSecret(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.checkTOTP(ctx, userID, sealed, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Enable(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks a TOTP code or, failing that, consumes a recovery code.
+// usedRecovery tells the caller a recovery code was spent.
+func (s *TwoFactorService) Verify(ctx context.Context, userID uuid.UUID, code string) (usedRecovery bool, err error) {
+	sealed, enabled, err := s.repo.GetSecret(ctx, userID)
+	if err == repository.ErrTOTPNotSetUp || (err == nil && !enabled) {
+		return false, ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = s.checkTOTP(ctx, userID, sealed, code)
+	if err != ErrInvalidTwoFactorCode {
+		return false, err
+	}
+
+	ok, err := s.repo.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, ErrInvalidTwoFactorCode
+	}
+	return true, nil
+}
+
+// Disable turns 2FA off
+func (s *TwoFactorService) Disable(ctx context.Context, userID uuid.UUID) error {
+	return s.repo.Disable(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RemainingRecoveryCodes returns how many recovery codes are still unused
+func (s *TwoFactorService) RemainingRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	return s.repo.CountRecoveryCodes(ctx, userID)
+}
+
+// checkTOTP validates a code against the sealed secret, rejecting replays
+func (s *TwoFactorService) checkTOTP(ctx context.Context, userID uuid.UUID, sealed, code string) error {
+	secret, err := s.box.Open(sealed)
+	if err != nil {
+		return err
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	if err := s.repo.UseStep(ctx, userID, step); err != nil {
+		if err == repository.ErrTOTPCodeReused {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+	return nil
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gecogreen/backend/internal/repository"
+	"github.com/gecogreen/backend/internal/storage"
+)
+
+// UploadSweeper periodically deletes files nobody references anymore:
+// presigned uploads that were never finalized and images of DELETED products
+type UploadSweeper struct {
+	sessionRepo *repository.UploadSessionRepository
+	productRepo *repository.ProductRepository
+	store       storage.Store
+	interval    time.Duration
+	grace       time.Duration
+}
+
+// sweepBatchSize bounds the work done in a single run
+const sweepBatchSize = 100
+
+// NewUploadSweeper creates a new sweeper.
+// grace is how long after a session's expiry its object is kept (clients may still be finalizing).
+func NewUploadSweeper(sessionRepo *repository.UploadSessionRepository, productRepo *repository.ProductRepository, store storage.Store, interval, grace time.Duration) *UploadSweeper {
+	return &UploadSweeper{
+		sessionRepo: sessionRepo,
+		productRepo: productRepo,
+		store:       store,
+		interval:    interval,
+		grace:       grace,
+	}
+}
+
+// Start runs the sweeper in the background until ctx is cancelled
+func (s *UploadSweeper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Sweep(ctx)
+			}
+		}
+	}()
+}
+
+// Sweep runs a single cleanup pass
+func (s *UploadSweeper) Sweep(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	orphans, deletedImages := s.sweepSessions(ctx), s.sweepDeletedProducts(ctx)
+	if orphans > 0 || deletedImages > 0 {
+		log.Printf("🧹 Upload sweeper: %d orphan uploads, %d images of deleted products removed", orphans, deletedImages)
+	}
+}
+
+// sweepSessions deletes objects of PENDING sessions past expiry + grace
+func (s *UploadSweeper) sweepSessions(ctx context.Context) int {
+	sessions, err := s.sessionRepo.GetExpiredPending(ctx, time.Now().Add(-s.grace), sweepBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Upload sweeper: failed to load sessions: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for _, session := range sessions {
+		// Missing objects are fine: the client never uploaded
+		if err := s.store.Delete(ctx, session.FileURL); err != nil {
+			log.Printf("⚠️  Upload sweeper: failed to delete %s: %v", session.FileURL, err)
+			continue
+		}
+		if err := s.sessionRepo.MarkExpired(ctx, session.ID); err != nil {
+			log.Printf("⚠️  Upload sweeper: failed to expire session %s: %v", session.ID, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// sweepDeletedProducts deletes the images of soft-deleted products
+func (s *UploadSweeper) sweepDeletedProducts(ctx context.Context) int {
+	products, err := s.productRepo.GetDeletedWithImages(ctx, sweepBatchSize)
+	if err != nil {
+		log.Printf("⚠️  Upload sweeper: failed to load deleted products: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for _, product := range products {
+		failed := false
+		for _, imageURL := range product.Images {
+			if err := s.store.Delete(ctx, imageURL); err != nil {
+				log.Printf("⚠️  Upload sweeper: failed to delete %s: %v", imageURL, err)
+				failed = true
+				continue
+			}
+			removed++
+		}
+		// Keep the references if something failed, so the next run retries
+		if failed {
+			continue
+		}
+		if err := s.productRepo.ClearImages(ctx, product.ID); err != nil {
+			log.Printf("⚠️  Upload sweeper: failed to clear images of %s: %v", product.ID, err)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStorage stores files on local disk, for development and test environments.
+// Files are served by the API itself (see handlers.FileHandler):
+//
+//	<baseURL>/public/<key>   public files (static)
+//	<baseURL>/private/<key>  private files, requires a signed URL
+//	<baseURL>/upload/<key>   PUT target for presigned uploads
+type LocalStorage struct {
+	baseDir string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalStorage creates a local disk storage rooted at baseDir.
+// secret is used to sign presigned upload and private download URLs.
+func NewLocalStorage(baseDir, baseURL, secret string) (*LocalStorage, error) {
+	for _, dir := range []string{"public", "private"} {
+		if err := os.MkdirAll(filepath.Join(baseDir, dir), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create storage dir: %w", err)
+		}
+	}
+
+	return &LocalStorage{
+		baseDir: baseDir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  []byte(secret),
+	}, nil
+}
+
+// PublicDir returns the directory holding public files
+func (s *LocalStorage) PublicDir() string {
+	return filepath.Join(s.baseDir, "public")
+}
+
+// Upload writes a public file and returns its public URL
+func (s *LocalStorage) Upload(ctx context.Context, file io.Reader, filename string, contentType string, folder string) (string, error) {
+	key := newObjectKey(folder, filename)
+
+	if err := s.SavePublic(key, file); err != nil {
+		return "", err
+	}
+
+	return s.publicURL(key), nil
+}
+
+// Delete removes a public file
+func (s *LocalStorage) Delete(ctx context.Context, fileURL string) error {
+	path, err := s.path("public", strings.TrimPrefix(fileURL, s.baseURL+"/public/"))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Presign returns a signed URL the client can PUT the file to
+func (s *LocalStorage) Presign(ctx context.Context, filename string, contentType string, folder string) (string, string, error) {
+	key := newObjectKey(folder, filename)
+	uploadURL := s.signedURL("upload", "PUT", key, PresignExpiry)
+	return uploadURL, s.publicURL(key), nil
+}
+
+// Get opens a public file
+func (s *LocalStorage) Get(ctx context.Context, fileURL string) (io.ReadCloser, error) {
+	return s.open("public", strings.TrimPrefix(fileURL, s.baseURL+"/public/"))
+}
+
+// Stat returns size and content type (from the extension) of a public file
+func (s *LocalStorage) Stat(ctx context.Context, fileURL string) (*ObjectInfo, error) {
+	key := strings.TrimPrefix(fileURL, s.baseURL+"/public/")
+	path, err := s.path("public", key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+	}, nil
+}
+
+// UploadPrivate writes a private file and returns its key
+func (s *LocalStorage) UploadPrivate(ctx context.Context, file io.Reader, filename string, contentType string, folder string) (string, error) {
+	key := newObjectKey(folder, filename)
+
+	path, err := s.path("private", key)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFile(path, file); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// DeletePrivate removes a private file
+func (s *LocalStorage) DeletePrivate(ctx context.Context, key string) error {
+	path, err := s.path("private", key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// GetPrivate opens a private file
+func (s *LocalStorage) GetPrivate(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.open("private", key)
+}
+
+// SignedURL returns a temporary GET URL for a private file
+func (s *LocalStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return s.signedURL("private", "GET", key, expires), nil
+}
+
+// OpenPrivate opens a private file (the caller must have verified the signature)
+func (s *LocalStorage) OpenPrivate(key string) (io.ReadCloser, error) {
+	return s.open("private", key)
+}
+
+// SavePublic writes a public file under the given key
+func (s *LocalStorage) SavePublic(key string, file io.Reader) error {
+	path, err := s.path("public", key)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, file)
+}
+
+// VerifySignature checks a signed URL's expiry and signature
+func (s *LocalStorage) VerifySignature(method, key string, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	expected := s.sign(method, key, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (s *LocalStorage) publicURL(key string) string {
+	return fmt.Sprintf("%s/public/%s", s.baseURL, key)
+}
+
+func (s *LocalStorage) signedURL(route, method, key string, ttl time.Duration) string {
+	expires := time.Now().Add(ttl).Unix()
+	return fmt.Sprintf("%s/%s/%s?expires=%d&signature=%s", s.baseURL, route, key, expires, s.sign(method, key, expires))
+}
+
+func (s *LocalStorage) sign(method, key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d", method, key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path resolves a key inside root, rejecting keys that escape it
+func (s *LocalStorage) path(root, key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return filepath.Join(s.baseDir, root, clean), nil
+}
+
+func (s *LocalStorage) open(root, key string) (io.ReadCloser, error) {
+	path, err := s.path(root, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func writeFile(path string, file io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, file); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
@@ -3,27 +3,21 @@ package storage
 import (
 	"context"
 	"fmt"
-	"io"
-	"path/filepath"
-	"strings"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/google/uuid"
 )
 
-// R2Storage handles file uploads to Cloudflare R2
+// R2Storage handles file uploads to Cloudflare R2 (S3-compatible API)
 type R2Storage struct {
-	client     *s3.Client
-	bucketName string
-	publicURL  string
+	*S3Storage
 }
 
-// NewR2Storage creates a new R2 storage client
-func NewR2Storage(accountID, accessKeyID, secretKey, bucketName, publicURLOverride string) (*R2Storage, error) {
+// NewR2Storage creates a new R2 storage client.
+// privateBucketName defaults to "<bucketName>-private"; it must not have public access enabled.
+func NewR2Storage(accountID, accessKeyID, secretKey, bucketName, privateBucketName, publicURLOverride string) (*R2Storage, error) {
 	// R2 endpoint
 	endpoint := fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
 
@@ -52,76 +46,6 @@ func NewR2Storage(accountID, accessKeyID, secretKey, bucketName, publicURLOverri
 	}
 
 	return &R2Storage{
-		client:     client,
-		bucketName: bucketName,
-		publicURL:  publicURL,
+		S3Storage: newS3Storage(client, bucketName, privateBucketName, publicURL),
 	}, nil
 }
-
-// Upload uploads a file to R2 and returns the public URL
-func (s *R2Storage) Upload(ctx context.Context, file io.Reader, filename string, contentType string, folder string) (string, error) {
-	// Generate unique filename
-	ext := filepath.Ext(filename)
-	uniqueName := fmt.Sprintf("%s/%s%s", folder, uuid.New().String(), ext)
-
-	// Upload to R2
-	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(uniqueName),
-		Body:        file,
-		ContentType: aws.String(contentType),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
-	}
-
-	// Return public URL
-	return fmt.Sprintf("%s/%s", s.publicURL, uniqueName), nil
-}
-
-// Delete deletes a file from R2
-func (s *R2Storage) Delete(ctx context.Context, fileURL string) error {
-	// Extract key from URL
-	key := strings.TrimPrefix(fileURL, s.publicURL+"/")
-
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
-	})
-	return err
-}
-
-// GeneratePresignedURL generates a presigned URL for direct upload
-func (s *R2Storage) GeneratePresignedURL(ctx context.Context, filename string, contentType string, folder string) (string, string, error) {
-	ext := filepath.Ext(filename)
-	uniqueName := fmt.Sprintf("%s/%s%s", folder, uuid.New().String(), ext)
-
-	presignClient := s3.NewPresignClient(s.client)
-
-	request, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(uniqueName),
-		ContentType: aws.String(contentType),
-	}, s3.WithPresignExpires(15*time.Minute))
-
-	if err != nil {
-		return "", "", fmt.Errorf("failed to generate presigned URL: %w", err)
-	}
-
-	publicURL := fmt.Sprintf("%s/%s", s.publicURL, uniqueName)
-	return request.URL, publicURL, nil
-}
-
-// IsValidImageType checks if the content type is a valid image
-func IsValidImageType(contentType string) bool {
-	validTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/png":  true,
-		"image/gif":  true,
-		"image/webp": true,
-	}
-	return validTypes[contentType]
-}
-
-// MaxFileSize is the maximum file size for uploads (5MB)
-const MaxFileSize = 5 * 1024 * 1024
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Storage handles file uploads to any S3-compatible endpoint (AWS, MinIO, ...)
+type S3Storage struct {
+	client        *s3.Client
+	bucketName    string
+	privateBucket string
+	publicURL     string
+}
+
+// S3Options configures a generic S3-compatible backend
+type S3Options struct {
+	Endpoint          string // empty for AWS S3
+	Region            string
+	AccessKeyID       string
+	SecretKey         string
+	BucketName        string
+	PrivateBucketName string
+	PublicURL         string // base URL for public objects
+	UsePathStyle      bool   // required by MinIO
+}
+
+// NewS3Storage creates a new S3-compatible storage client
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretKey, "")),
+		config.WithRegion(opts.Region),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+
+	// Public URL for accessing files
+	publicURL := strings.TrimSuffix(opts.PublicURL, "/")
+	if publicURL == "" {
+		if opts.Endpoint != "" {
+			publicURL = fmt.Sprintf("%s/%s", strings.TrimSuffix(opts.Endpoint, "/"), opts.BucketName)
+		} else {
+			publicURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", opts.BucketName, opts.Region)
+		}
+	}
+
+	return newS3Storage(client, opts.BucketName, opts.PrivateBucketName, publicURL), nil
+}
+
+func newS3Storage(client *s3.Client, bucketName, privateBucket, publicURL string) *S3Storage {
+	if privateBucket == "" {
+		privateBucket = bucketName + "-private"
+	}
+	return &S3Storage{
+		client:        client,
+		bucketName:    bucketName,
+		privateBucket: privateBucket,
+		publicURL:     publicURL,
+	}
+}
+
+// Upload uploads a file and returns the public URL
+func (s *S3Storage) Upload(ctx context.Context, file io.Reader, filename string, contentType string, folder string) (string, error) {
+	key := newObjectKey(folder, filename)
+
+	if err := s.put(ctx, s.bucketName, key, file, contentType); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s", s.publicURL, key), nil
+}
+
+// Delete deletes a public file
+func (s *S3Storage) Delete(ctx context.Context, fileURL string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s.keyFromURL(fileURL)),
+	})
+	return err
+}
+
+// Presign generates a presigned URL for direct upload
+func (s *S3Storage) Presign(ctx context.Context, filename string, contentType string, folder string) (string, string, error) {
+	key := newObjectKey(folder, filename)
+
+	presignClient := s3.NewPresignClient(s.client)
+
+	request, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	}, s3.WithPresignExpires(PresignExpiry))
+
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	publicURL := fmt.Sprintf("%s/%s", s.publicURL, key)
+	return request.URL, publicURL, nil
+}
+
+// Get opens a public file
+func (s *S3Storage) Get(ctx context.Context, fileURL string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s.keyFromURL(fileURL)),
+	})
+	if err != nil {
+		var noKey *types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Stat returns size and content type of a public file
+func (s *S3Storage) Stat(ctx context.Context, fileURL string) (*ObjectInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s.keyFromURL(fileURL)),
+	})
+	if err != nil {
+		// HeadObject has no body, so a missing key surfaces as a generic 404
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: aws.ToString(out.ContentType),
+	}, nil
+}
+
+// UploadPrivate uploads a file to the private bucket and returns its key
+func (s *S3Storage) UploadPrivate(ctx context.Context, file io.Reader, filename string, contentType string, folder string) (string, error) {
+	key := newObjectKey(folder, filename)
+
+	if err := s.put(ctx, s.privateBucket, key, file, contentType); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// DeletePrivate deletes a file from the private bucket
+func (s *S3Storage) DeletePrivate(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.privateBucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// GetPrivate opens a file of the private bucket
+func (s *S3Storage) GetPrivate(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.privateBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noKey *types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// SignedURL generates a temporary GET URL for a private file
+func (s *S3Storage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.privateBucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL: %w", err)
+	}
+
+	return request.URL, nil
+}
+
+func (s *S3Storage) put(ctx context.Context, bucket, key string, file io.Reader, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        file,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+// keyFromURL extracts the object key from a public URL
+func (s *S3Storage) keyFromURL(fileURL string) string {
+	return strings.TrimPrefix(fileURL, s.publicURL+"/")
+}
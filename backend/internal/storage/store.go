@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store is implemented by every file storage backend (R2, S3/MinIO, local disk).
+//
+// Public files are addressed by their public URL, as stored in the database.
+// Private files (dispute evidence, KYC documents, ...) are addressed by their
+// object key and can only be read through a short-lived signed URL.
+type Store interface {
+	// Upload stores a public file and returns its public URL
+	Upload(ctx context.Context, file io.Reader, filename string, contentType string, folder string) (string, error)
+	// Delete removes a public file given its public URL
+	Delete(ctx context.Context, fileURL string) error
+	// Presign returns an URL the client can PUT the file to, and the public URL it will have
+	Presign(ctx context.Context, filename string, contentType string, folder string) (string, string, error)
+	// Get opens a public file given its public URL
+	Get(ctx context.Context, fileURL string) (io.ReadCloser, error)
+	// Stat returns size and content type of a public file, ErrNotFound if missing
+	Stat(ctx context.Context, fileURL string) (*ObjectInfo, error)
+
+	// UploadPrivate stores a private file and returns its object key
+	UploadPrivate(ctx context.Context, file io.Reader, filename string, contentType string, folder string) (string, error)
+	// DeletePrivate removes a private file given its object key
+	DeletePrivate(ctx context.Context, key string) error
+	// GetPrivate opens a private file given its object key, ErrNotFound if missing
+	GetPrivate(ctx context.Context, key string) (io.ReadCloser, error)
+	// SignedURL returns a temporary GET URL for a private file
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// ObjectInfo describes a stored file
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// PresignExpiry is how long a presigned upload URL stays valid
+const PresignExpiry = 15 * time.Minute
+
+// SignedURLExpiry is the default validity of signed GET URLs for private files
+const SignedURLExpiry = 15 * time.Minute
+
+// ErrNotFound is returned when a file doesn't exist in the store
+var ErrNotFound = errors.New("file not found")
+
+// newObjectKey builds a unique object key inside folder, keeping the original extension
+func newObjectKey(folder, filename string) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s/%s%s", folder, uuid.New().String(), ext)
+}
+
+// IsValidImageType checks if the content type is a valid image
+func IsValidImageType(contentType string) bool {
+	validTypes := map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+		"image/gif":  true,
+		"image/webp": true,
+	}
+	return validTypes[contentType]
+}
+
+// DetectVideoType identifies MP4 and QuickTime files by their leading box,
+// which http.DetectContentType misses for QuickTime and most MP4 brands.
+// Returns "" for anything else.
+func DetectVideoType(data []byte) string {
+	if len(data) < 12 {
+		return ""
+	}
+	switch string(data[4:8]) {
+	case "ftyp":
+		if string(data[8:12]) == "qt  " {
+			return "video/quicktime"
+		}
+		return "video/mp4"
+	case "moov", "mdat", "wide", "free", "skip", "pnot":
+		// QuickTime files predating the ftyp box
+		return "video/quicktime"
+	}
+	return ""
+}
+
+// MaxFileSize is the maximum file size for uploads (5MB)
+const MaxFileSize = 5 * 1024 * 1024
+
+// Compile-time checks that every backend implements Store
+var (
+	_ Store = (*S3Storage)(nil)
+	_ Store = (*R2Storage)(nil)
+	_ Store = (*LocalStorage)(nil)
+)
@@ -0,0 +1,41 @@
+package trees
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Fake plants trees without calling any partner, for development.
+// Certificate IDs derive from the donation, so a retried donation gets the
+// same one; the URLs point to baseURL and don't resolve to a real certificate.
+type Fake struct {
+	baseURL string
+}
+
+func NewFake(baseURL string) *Fake {
+	return &Fake{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Plant(ctx context.Context, batch []Donation) ([]Certificate, []uuid.UUID, error) {
+	certificates := make([]Certificate, 0, len(batch))
+	for i, d := range batch {
+		if err := ctx.Err(); err != nil {
+			return certificates, donationIDs(batch[i:]), err
+		}
+		treeID := "FAKE-" + strings.ToUpper(d.ID.String()[:8])
+		certificates = append(certificates, Certificate{
+			DonationID: d.ID,
+			TreeID:     treeID,
+			URL:        f.baseURL + "/" + treeID,
+			Species:    "Quercus ilex",
+			Location:   "Italia",
+		})
+	}
+	return certificates, nil, nil
+}
@@ -0,0 +1,143 @@
+package trees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TreeNation plants trees with the Tree-Nation API (https://tree-nation.com),
+// one plant request per donation, with the user as the recipient and the
+// donation ID as the Idempotency-Key, so a request the partner did receive
+// never plants twice
+type TreeNation struct {
+	baseURL    string
+	token      string
+	speciesID  int
+	httpClient *http.Client
+}
+
+// NewTreeNation creates a Tree-Nation provider. token is the planter's API
+// token, speciesID the species planted (0 = chosen by Tree-Nation).
+func NewTreeNation(baseURL, token string, speciesID int) *TreeNation {
+	return &TreeNation{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		speciesID:  speciesID,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (t *TreeNation) Name() string {
+	return "treenation"
+}
+
+type treeNationRecipient struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+type treeNationPlantRequest struct {
+	Recipients []treeNationRecipient `json:"recipients"`
+	SpeciesID  int                   `json:"species_id,omitempty"`
+	Quantity   int                   `json:"quantity"`
+	Message    string                `json:"message,omitempty"`
+}
+
+type treeNationPlantResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Trees   []struct {
+		ID             json.Number `json:"id"`
+		CertificateURL string      `json:"certificate_url"`
+		CollectURL     string      `json:"collect_url"`
+		Species        string      `json:"species"`
+		Location       string      `json:"location"`
+	} `json:"trees"`
+}
+
+// Plant stops at the first failure: the rest of the batch was never sent. The
+// failed donation itself is unsent only when the request didn't reach
+// Tree-Nation or was refused without planting.
+func (t *TreeNation) Plant(ctx context.Context, batch []Donation) ([]Certificate, []uuid.UUID, error) {
+	certificates := make([]Certificate, 0, len(batch))
+	for i, d := range batch {
+		certificate, received, err := t.plant(ctx, d)
+		if err != nil {
+			unsent := donationIDs(batch[i+1:])
+			if !received {
+				unsent = donationIDs(batch[i:])
+			}
+			return certificates, unsent, fmt.Errorf("treenation: donation %s: %w", d.ID, err)
+		}
+		certificates = append(certificates, *certificate)
+	}
+	return certificates, nil, nil
+}
+
+// plant orders the trees of a donation. received is false when Tree-Nation
+// surely planted nothing: the request wasn't sent, or was refused.
+func (t *TreeNation) plant(ctx context.Context, d Donation) (certificate *Certificate, received bool, err error) {
+	body, err := json.Marshal(treeNationPlantRequest{
+		Recipients: []treeNationRecipient{{Name: d.RecipientName, Email: d.RecipientEmail}},
+		SpeciesID:  t.speciesID,
+		Quantity:   d.Trees,
+		Message:    "Grazie per aver combattuto lo spreco con GecoGreen!",
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/plant", bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Idempotency-Key", d.ID.String())
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		// Only a failed connection proves the request never left
+		var opErr *net.OpError
+		return nil, errors.As(err, &opErr) && opErr.Op == "dial", err
+	}
+	defer resp.Body.Close()
+
+	// 409: a request with the same Idempotency-Key is already in progress
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusConflict {
+		return nil, false, fmt.Errorf("refused: status %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, true, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var result treeNationPlantResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, true, err
+	}
+	if result.Status != "ok" || len(result.Trees) == 0 {
+		return nil, false, fmt.Errorf("not planted: %s", result.Message)
+	}
+
+	tree := result.Trees[0]
+	url := tree.CertificateURL
+	if url == "" {
+		url = tree.CollectURL
+	}
+	return &Certificate{
+		DonationID: d.ID,
+		TreeID:     tree.ID.String(),
+		URL:        url,
+		Species:    tree.Species,
+		Location:   tree.Location,
+	}, true, nil
+}
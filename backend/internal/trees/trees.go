@@ -0,0 +1,48 @@
+package trees
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Provider plants the trees donated with EcoCredits through a partner.
+// Implementations: TreeNation, and Fake for development.
+type Provider interface {
+	// Name is stored with each planted donation
+	Name() string
+	// Plant orders the trees of a batch of donations. The batch is what a
+	// planter run hands over: a provider may order each donation separately.
+	// It returns the certificates of the donations planted and the IDs of
+	// those the partner never received, which are safe to send again. Any
+	// other donation of the batch may have been ordered and must not be sent
+	// again. err tells why some donations weren't planted (nil when all were).
+	// The donation ID goes to the partner as the order's idempotency key.
+	Plant(ctx context.Context, batch []Donation) (planted []Certificate, unsent []uuid.UUID, err error)
+}
+
+// Donation is a request to plant trees on behalf of a user
+type Donation struct {
+	ID             uuid.UUID
+	Trees          int
+	RecipientName  string
+	RecipientEmail string // may be empty (deleted accounts)
+}
+
+// Certificate is the partner's proof that a donation was planted
+type Certificate struct {
+	DonationID uuid.UUID
+	TreeID     string // partner ID of the (first) tree
+	URL        string
+	Species    string
+	Location   string
+}
+
+// donationIDs returns the IDs of the donations
+func donationIDs(donations []Donation) []uuid.UUID {
+	ids := make([]uuid.UUID, len(donations))
+	for i, d := range donations {
+		ids[i] = d.ID
+	}
+	return ids
+}
@@ -0,0 +1,161 @@
+// Package validation checks the business and billing data of BUSINESS accounts
+// (Italian VAT number and fiscal code checksums, SDI code, PEC, EU VAT ID).
+package validation
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/gecogreen/backend/internal/models"
+)
+
+var (
+	digits11Re    = regexp.MustCompile(`^[0-9]{11}$`)
+	fiscalCodeRe  = regexp.MustCompile(`^[A-Z]{6}[0-9LMNPQRSTUV]{2}[A-EHLMPRST][0-9LMNPQRSTUV]{2}[A-Z][0-9LMNPQRSTUV]{3}[A-Z]$`)
+	sdiCodeRe     = regexp.MustCompile(`^[A-Z0-9]{7}$`)
+	euVatIDRe     = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*]{2,12}$`)
+	postalCodeRe  = regexp.MustCompile(`^[0-9]{5}$`)
+	provinceRe    = regexp.MustCompile(`^[A-Z]{2}$`)
+	countryCodeRe = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// ItalianVATNumber checks a Partita IVA: 11 digits, the last one a Luhn-style check digit
+func ItalianVATNumber(v string) bool {
+	if !digits11Re.MatchString(v) || v == "00000000000" {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		d := int(v[i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10-sum%10)%10 == int(v[10]-'0')
+}
+
+// fiscalCodeOdd is the value of a character in an odd (1-based) position of a codice fiscale
+var fiscalCodeOdd = [36]int{
+	1, 0, 5, 7, 9, 13, 15, 17, 19, 21, // 0-9
+	1, 0, 5, 7, 9, 13, 15, 17, 19, 21, 2, 4, 18, 20, 11, 3, 6, 8, 12, 14, 16, 10, 22, 25, 24, 23, // A-Z
+}
+
+// ItalianFiscalCode checks a codice fiscale: 16 characters for people (with check
+// character), or 11 digits for companies (same rules as the VAT number)
+func ItalianFiscalCode(v string) bool {
+	if len(v) == 11 {
+		return ItalianVATNumber(v)
+	}
+	if !fiscalCodeRe.MatchString(v) {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < 15; i++ {
+		idx := int(v[i] - 'A' + 10)
+		if v[i] >= '0' && v[i] <= '9' {
+			idx = int(v[i] - '0')
+		}
+		if i%2 == 0 {
+			sum += fiscalCodeOdd[idx]
+		} else if idx < 10 {
+			sum += idx
+		} else {
+			sum += idx - 10
+		}
+	}
+	return v[15] == byte('A'+sum%26)
+}
+
+// NormalizeBusinessData trims the fields and upper-cases the codes
+func NormalizeBusinessData(d *models.BusinessData) {
+	trim := func(s *string) { *s = strings.TrimSpace(*s) }
+	code := func(s *string) { *s = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(*s), " ", "")) }
+
+	trim(&d.BusinessName)
+	trim(&d.BillingAddress)
+	trim(&d.BillingCity)
+	trim(&d.BillingPostalCode)
+	d.PECEmail = strings.ToLower(strings.TrimSpace(d.PECEmail))
+	code(&d.VATNumber)
+	code(&d.FiscalCode)
+	code(&d.SDICode)
+	code(&d.EUVatID)
+	code(&d.BillingProvince)
+	code(&d.BillingCountry)
+
+	if d.BillingCountry == "" {
+		d.BillingCountry = "IT"
+	}
+	// "IT12345678901" is a common way to write an Italian VAT number
+	if d.BillingCountry == "IT" {
+		d.VATNumber = strings.TrimPrefix(d.VATNumber, "IT")
+	}
+}
+
+// BusinessData checks the data a BUSINESS account needs for e-invoicing.
+// It returns the invalid fields with an error message (nil if valid); call
+// NormalizeBusinessData first.
+func BusinessData(d models.BusinessData) map[string]string {
+	errs := make(map[string]string)
+
+	if d.BusinessName == "" {
+		errs["business_name"] = "Ragione sociale obbligatoria"
+	} else if len(d.BusinessName) > 255 {
+		errs["business_name"] = "Ragione sociale troppo lunga"
+	}
+	if !countryCodeRe.MatchString(d.BillingCountry) {
+		errs["billing_country"] = "Paese non valido (codice ISO a 2 lettere)"
+	}
+	if d.BillingAddress == "" {
+		errs["billing_address"] = "Indirizzo di fatturazione obbligatorio"
+	}
+	if d.BillingCity == "" {
+		errs["billing_city"] = "Città di fatturazione obbligatoria"
+	}
+
+	if d.BillingCountry == "IT" {
+		if !ItalianVATNumber(d.VATNumber) {
+			errs["vat_number"] = "Partita IVA non valida"
+		}
+		if d.FiscalCode != "" && !ItalianFiscalCode(d.FiscalCode) {
+			errs["fiscal_code"] = "Codice fiscale non valido"
+		}
+		// Electronic invoices are delivered through the SDI code or the PEC
+		if d.SDICode == "" && d.PECEmail == "" {
+			errs["sdi_code"] = "Codice SDI o PEC obbligatorio per la fattura elettronica"
+		}
+		if !postalCodeRe.MatchString(d.BillingPostalCode) {
+			errs["billing_postal_code"] = "CAP non valido"
+		}
+		if !provinceRe.MatchString(d.BillingProvince) {
+			errs["billing_province"] = "Provincia non valida (sigla a 2 lettere)"
+		}
+	} else {
+		if !euVatIDRe.MatchString(d.EUVatID) {
+			errs["eu_vat_id"] = "VAT ID europeo non valido"
+		}
+		if d.BillingPostalCode == "" {
+			errs["billing_postal_code"] = "Codice postale obbligatorio"
+		}
+	}
+
+	if d.SDICode != "" && !sdiCodeRe.MatchString(d.SDICode) {
+		errs["sdi_code"] = "Codice SDI non valido (7 caratteri)"
+	}
+	if d.PECEmail != "" {
+		if addr, err := mail.ParseAddress(d.PECEmail); err != nil || addr.Address != d.PECEmail {
+			errs["pec_email"] = "PEC non valida"
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,34 @@
+-- Migration: 005_image_hashes.sql
+-- Description: Perceptual hashes of uploaded images for duplicate/stolen photo detection
+-- Date: 2026-10-18
+
+-- =====================================================
+-- IMAGE HASHES
+-- One row per uploaded image (product, avatar, business photo)
+-- =====================================================
+CREATE TABLE IF NOT EXISTS image_hashes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    product_id UUID REFERENCES products(id) ON DELETE CASCADE,
+    image_url VARCHAR(500) NOT NULL,
+    image_type VARCHAR(20) NOT NULL, -- 'PRODUCT', 'PROFILE', 'BUSINESS'
+
+    -- 64-bit dHash stored as signed BIGINT (bit pattern is what matters)
+    phash BIGINT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_hashes_user ON image_hashes(user_id);
+CREATE INDEX IF NOT EXISTS idx_image_hashes_phash ON image_hashes(phash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_image_hashes_url ON image_hashes(image_url);
+
+-- =====================================================
+-- IMAGE REVIEWS: duplicate match details
+-- =====================================================
+ALTER TABLE image_reviews ADD COLUMN IF NOT EXISTS duplicate_of_url VARCHAR(500);
+ALTER TABLE image_reviews ADD COLUMN IF NOT EXISTS duplicate_of_user_id UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE image_reviews ADD COLUMN IF NOT EXISTS duplicate_distance INT;
+
+COMMENT ON TABLE image_hashes IS 'Perceptual hashes (dHash) of uploaded images, used to detect photos reused across accounts';
+COMMENT ON COLUMN image_reviews.duplicate_distance IS 'Hamming distance to the matched image (0 = identical)';
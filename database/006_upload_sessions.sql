@@ -0,0 +1,33 @@
+-- Migration: 006_upload_sessions.sql
+-- Description: Track presigned direct uploads until they are finalized (or swept)
+-- Date: 2026-10-18
+
+-- =====================================================
+-- UPLOAD SESSIONS
+-- presign -> client PUT to bucket -> finalize
+-- =====================================================
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    product_id UUID REFERENCES products(id) ON DELETE CASCADE,
+
+    -- Object
+    file_url VARCHAR(500) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+
+    -- Status
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING'
+        CHECK (status IN ('PENDING', 'FINALIZED', 'REJECTED', 'EXPIRED')),
+    rejection_reason TEXT,
+
+    -- Timestamps
+    expires_at TIMESTAMP NOT NULL,
+    finalized_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_user ON upload_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_pending ON upload_sessions(expires_at)
+    WHERE status = 'PENDING';
+
+COMMENT ON TABLE upload_sessions IS 'Presigned direct uploads; PENDING sessions past expiry are deleted from storage by the sweeper';
@@ -0,0 +1,31 @@
+-- Migration: 007_dispute_evidence.sql
+-- Description: Dispute evidence files stored privately, with SHA-256 integrity hashes
+-- Date: 2026-10-18
+
+-- =====================================================
+-- DISPUTE EVIDENCE
+-- Uploaded by buyer (before opening) or seller (while disputed).
+-- Rows are immutable once attached to a dispute.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS dispute_evidence (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    dispute_id UUID REFERENCES disputes(id) ON DELETE CASCADE,
+    uploaded_by UUID NOT NULL REFERENCES users(id),
+    party VARCHAR(10) NOT NULL CHECK (party IN ('BUYER', 'SELLER')),
+
+    -- File (private bucket, never a public URL)
+    storage_key VARCHAR(500) NOT NULL,
+    media_type VARCHAR(10) NOT NULL CHECK (media_type IN ('PHOTO', 'VIDEO')),
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+
+    uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_dispute_evidence_order ON dispute_evidence(order_id, party);
+CREATE INDEX IF NOT EXISTS idx_dispute_evidence_dispute ON dispute_evidence(dispute_id);
+
+COMMENT ON TABLE dispute_evidence IS 'Private dispute evidence; served only via short-lived signed URLs';
+COMMENT ON COLUMN dispute_evidence.sha256 IS 'Hex SHA-256 of the file at upload time, to prove it was not altered';
@@ -0,0 +1,27 @@
+-- Migration: 008_session_rotation.sql
+-- Description: Server-side sessions with rotating, hashed refresh tokens
+-- Date: 2026-10-18
+
+-- =====================================================
+-- SESSIONS
+-- One row per issued refresh token. Rows of the same login share a
+-- family_id; a refresh revokes the current row and inserts its successor.
+-- Presenting an already rotated token revokes the whole family.
+-- =====================================================
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS replaced_by UUID;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+
+-- Sessions created before this migration held raw JWTs: drop them,
+-- affected users simply log in again
+DELETE FROM sessions WHERE family_id IS NULL;
+ALTER TABLE sessions ALTER COLUMN family_id SET NOT NULL;
+ALTER TABLE sessions ALTER COLUMN user_id SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_refresh_token ON sessions(refresh_token);
+CREATE INDEX IF NOT EXISTS idx_sessions_family ON sessions(family_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_active ON sessions(user_id) WHERE revoked_at IS NULL;
+
+COMMENT ON COLUMN sessions.refresh_token IS 'SHA-256 (hex) of the refresh token, never the token itself';
+COMMENT ON COLUMN sessions.family_id IS 'Shared by all rotations of one login (= one device)';
+COMMENT ON COLUMN sessions.replaced_by IS 'Successor row after rotation; set means the token was rotated out';
@@ -0,0 +1,20 @@
+-- Migration: 009_email_tokens.sql
+-- Description: Email verification and password reset flows
+-- Date: 2026-10-18
+
+-- =====================================================
+-- USERS
+-- Tokens are stored as SHA-256 (hex) in the existing
+-- email_verification_token / password_reset_token columns.
+-- The *_sent_at columns rate-limit resends.
+-- =====================================================
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_sent_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_sent_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_email_verification_token ON users(email_verification_token)
+    WHERE email_verification_token IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_password_reset_token ON users(password_reset_token)
+    WHERE password_reset_token IS NOT NULL;
+
+COMMENT ON COLUMN users.email_verification_token IS 'SHA-256 (hex) of the verification token';
+COMMENT ON COLUMN users.password_reset_token IS 'SHA-256 (hex) of the single-use reset token';
@@ -0,0 +1,31 @@
+-- Migration: 010_two_factor.sql
+-- Description: TOTP two-factor authentication with recovery codes
+-- Date: 2026-10-18
+
+-- =====================================================
+-- USERS
+-- totp_secret is AES-GCM encrypted; it is set at setup and only
+-- becomes active once the user confirms a code (totp_enabled).
+-- totp_last_step rejects replays of an already used code.
+-- =====================================================
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+
+-- =====================================================
+-- RECOVERY CODES
+-- Single-use, stored as SHA-256 (hex)
+-- =====================================================
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id) WHERE used_at IS NULL;
+
+COMMENT ON TABLE recovery_codes IS 'Single-use 2FA recovery codes (hashed)';
+COMMENT ON COLUMN users.totp_secret IS 'AES-256-GCM encrypted TOTP seed (base64)';
@@ -0,0 +1,13 @@
+-- Migration: 011_oauth_login.sql
+-- Description: Social login (OpenID Connect) lookups
+-- Date: 2026-10-18
+
+-- =====================================================
+-- USERS
+-- google_id / apple_id / facebook_id hold the provider "sub".
+-- Accounts created by a social login have an empty password_hash
+-- and oauth_provider set to the provider they signed up with.
+-- =====================================================
+CREATE INDEX IF NOT EXISTS idx_users_facebook ON users(facebook_id);
+
+COMMENT ON COLUMN users.oauth_provider IS 'Provider used at sign up (google, apple, facebook); NULL for email/password accounts';
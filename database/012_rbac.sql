@@ -0,0 +1,26 @@
+-- Migration: 012_rbac.sql
+-- Description: Role-based access control (staff roles replace is_admin)
+-- Date: 2026-10-18
+
+-- =====================================================
+-- ROLES
+-- MODERATOR: image and review moderation
+-- SUPPORT:   customer care (orders, disputes)
+-- ADMIN:     every permission
+-- Permissions per role are defined in the backend (models/role.go).
+-- =====================================================
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'MODERATOR';
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'SUPPORT';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles user_role[] DEFAULT '{BUYER}';
+UPDATE users SET roles = '{BUYER}' WHERE roles IS NULL;
+
+-- Existing admins get the ADMIN role
+UPDATE users
+SET roles = array_append(roles, 'ADMIN')
+WHERE is_admin = true AND NOT ('ADMIN' = ANY(roles));
+
+CREATE INDEX IF NOT EXISTS idx_users_roles ON users USING GIN(roles);
+
+COMMENT ON COLUMN users.roles IS 'Roles; staff roles (ADMIN, MODERATOR, SUPPORT) grant permissions';
+COMMENT ON COLUMN users.is_admin IS 'Deprecated: derived from roles, kept in sync for compatibility';
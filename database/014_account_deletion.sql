@@ -0,0 +1,37 @@
+-- Migration: 014_account_deletion.sql
+-- Description: GDPR self-service account deletion with grace period
+-- Date: 2026-10-18
+
+-- =====================================================
+-- USERS
+-- A deletion request is scheduled after a grace period;
+-- the account can be restored until then. Afterwards the
+-- user row is anonymised and soft-deleted (deleted_at):
+-- orders, reviews and the audit log keep pointing to it.
+-- =====================================================
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled ON users(deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL;
+
+COMMENT ON COLUMN users.deletion_requested_at IS 'When the user asked to delete the account';
+COMMENT ON COLUMN users.deletion_scheduled_at IS 'When the account will be anonymised (end of the grace period)';
+
+-- =====================================================
+-- RETAINED BILLING DATA
+-- Billing identity of deleted users with paid orders,
+-- kept apart from the anonymised user row for the
+-- 10-year retention of accounting records (art. 2220 c.c.)
+-- and purged when the retention period ends.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS retained_billing_data (
+    user_id UUID PRIMARY KEY REFERENCES users(id),
+    billing JSONB NOT NULL,
+    retain_until DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_retained_billing_until ON retained_billing_data(retain_until);
+
+COMMENT ON TABLE retained_billing_data IS 'Billing data of deleted accounts, kept only for the legal retention period';
@@ -0,0 +1,28 @@
+-- Migration: 015_seller_storefront.sql
+-- Description: Public seller storefront addressed by slug
+-- Date: 2026-10-18
+
+-- =====================================================
+-- USERS
+-- The slug is the address of the seller's storefront:
+-- the display name followed by the first 8 hex digits of
+-- the id, so it stays unique. It is assigned once and
+-- does not follow later name changes, to keep links valid.
+-- =====================================================
+ALTER TABLE users ADD COLUMN IF NOT EXISTS slug VARCHAR(80);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_slug ON users(slug) WHERE slug IS NOT NULL;
+
+-- Backfill existing accounts (same rules as the backend's sellerSlug)
+UPDATE users
+SET slug = COALESCE(NULLIF(trim(both '-' from left(regexp_replace(lower(translate(
+        CASE WHEN account_type = 'BUSINESS' AND COALESCE(business_name, '') <> ''
+             THEN business_name ELSE first_name || ' ' || last_name END,
+        'àáâäèéêëìíîïòóôöùúûüçñÀÁÂÄÈÉÊËÌÍÎÏÒÓÔÖÙÚÛÜÇÑ',
+        'aaaaeeeeiiiioooouuuucnaaaaeeeeiiiioooouuuucn')),
+        '[^a-z0-9]+', '-', 'g'), 60)), ''), 'venditore')
+        || '-' || left(replace(id::text, '-', ''), 8)
+WHERE slug IS NULL AND deleted_at IS NULL;
+
+COMMENT ON COLUMN users.slug IS 'Storefront address, assigned at registration and kept stable';
+
@@ -0,0 +1,69 @@
+-- Migration: 016_product_search.sql
+-- Description: Italian full-text product search with typo tolerance
+-- Date: 2026-10-18
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- =====================================================
+-- SEARCH VECTOR
+-- Title (A), category name (B) and description (C),
+-- stemmed with the Italian configuration ("mele" and
+-- "mela" share the same lexeme). Kept up to date by
+-- triggers, because the category name lives in another
+-- table and can't be used by a generated column.
+-- =====================================================
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION product_search_vector(p_title TEXT, p_description TEXT, p_category_id UUID)
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('italian', COALESCE(p_title, '')), 'A')
+        || setweight(to_tsvector('italian', COALESCE((SELECT name FROM categories WHERE id = p_category_id), '')), 'B')
+        || setweight(to_tsvector('italian', COALESCE(p_description, '')), 'C');
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION products_search_vector_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := product_search_vector(NEW.title, NEW.description, NEW.category_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_products_search_vector ON products;
+CREATE TRIGGER trigger_products_search_vector
+    BEFORE INSERT OR UPDATE OF title, description, category_id ON products
+    FOR EACH ROW
+    EXECUTE FUNCTION products_search_vector_update();
+
+-- Renaming a category re-indexes its products
+CREATE OR REPLACE FUNCTION categories_search_vector_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.name IS DISTINCT FROM OLD.name THEN
+        UPDATE products
+        SET search_vector = product_search_vector(title, description, category_id)
+        WHERE category_id = NEW.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_categories_search_vector ON categories;
+CREATE TRIGGER trigger_categories_search_vector
+    AFTER UPDATE OF name ON categories
+    FOR EACH ROW
+    EXECUTE FUNCTION categories_search_vector_update();
+
+UPDATE products
+SET search_vector = product_search_vector(title, description, category_id)
+WHERE search_vector IS NULL;
+
+-- =====================================================
+-- INDEXES
+-- GIN on the vector for full-text matches, trigram GIN on
+-- the title for typo-tolerant matches (word_similarity)
+-- =====================================================
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_title_trgm ON products USING GIN (title gin_trgm_ops);
+
+COMMENT ON COLUMN products.search_vector IS 'Weighted Italian full-text vector of title, category and description';
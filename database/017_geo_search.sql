@@ -0,0 +1,178 @@
+-- Migration: 017_geo_search.sql
+-- Description: Geo radius search, map clusters and offline geocoding table
+-- Date: 2026-10-18
+
+-- =====================================================
+-- GEO PLACES
+-- Offline CAP/comune lookup used to geocode addresses
+-- without calling an external service. Seeded with the
+-- province capitals; load the complete list of comuni
+-- (ISTAT codes with CAP and coordinates) with:
+--   \copy geo_places (postal_code, comune, province, latitude, longitude) FROM 'comuni.csv' CSV HEADER
+-- =====================================================
+CREATE TABLE IF NOT EXISTS geo_places (
+    postal_code CHAR(5) NOT NULL,
+    comune VARCHAR(100) NOT NULL,
+    province CHAR(2) NOT NULL,
+    latitude DECIMAL(9, 6) NOT NULL,
+    longitude DECIMAL(9, 6) NOT NULL,
+    is_capital BOOLEAN DEFAULT FALSE,
+    PRIMARY KEY (postal_code, comune)
+);
+
+CREATE INDEX IF NOT EXISTS idx_geo_places_comune ON geo_places(LOWER(comune), province);
+CREATE INDEX IF NOT EXISTS idx_geo_places_capital ON geo_places(province) WHERE is_capital = TRUE;
+
+INSERT INTO geo_places (postal_code, comune, province, latitude, longitude, is_capital) VALUES
+-- Piemonte
+('10121', 'Torino', 'TO', 45.070300, 7.686900, TRUE),
+('13100', 'Vercelli', 'VC', 45.320200, 8.418500, TRUE),
+('28100', 'Novara', 'NO', 45.446900, 8.622200, TRUE),
+('12100', 'Cuneo', 'CN', 44.384500, 7.542700, TRUE),
+('14100', 'Asti', 'AT', 44.900000, 8.206400, TRUE),
+('15121', 'Alessandria', 'AL', 44.912400, 8.615300, TRUE),
+('13900', 'Biella', 'BI', 45.566300, 8.054300, TRUE),
+('28921', 'Verbania', 'VB', 45.921600, 8.551600, TRUE),
+-- Valle d'Aosta
+('11100', 'Aosta', 'AO', 45.737000, 7.315000, TRUE),
+-- Lombardia
+('20121', 'Milano', 'MI', 45.464200, 9.190000, TRUE),
+('24121', 'Bergamo', 'BG', 45.698300, 9.677300, TRUE),
+('25121', 'Brescia', 'BS', 45.541600, 10.211800, TRUE),
+('22100', 'Como', 'CO', 45.808100, 9.085200, TRUE),
+('26100', 'Cremona', 'CR', 45.133300, 10.022700, TRUE),
+('23900', 'Lecco', 'LC', 45.856600, 9.397700, TRUE),
+('26900', 'Lodi', 'LO', 45.309700, 9.503700, TRUE),
+('46100', 'Mantova', 'MN', 45.156400, 10.791400, TRUE),
+('27100', 'Pavia', 'PV', 45.184700, 9.158200, TRUE),
+('23100', 'Sondrio', 'SO', 46.169900, 9.871500, TRUE),
+('21100', 'Varese', 'VA', 45.820600, 8.825100, TRUE),
+('20900', 'Monza', 'MB', 45.584500, 9.274400, TRUE),
+-- Trentino-Alto Adige
+('38121', 'Trento', 'TN', 46.074800, 11.121700, TRUE),
+('39100', 'Bolzano', 'BZ', 46.498300, 11.354800, TRUE),
+-- Veneto
+('30121', 'Venezia', 'VE', 45.440800, 12.315500, TRUE),
+('37121', 'Verona', 'VR', 45.438400, 10.991600, TRUE),
+('35121', 'Padova', 'PD', 45.406400, 11.876800, TRUE),
+('36100', 'Vicenza', 'VI', 45.545500, 11.535400, TRUE),
+('31100', 'Treviso', 'TV', 45.666900, 12.243000, TRUE),
+('45100', 'Rovigo', 'RO', 45.070300, 11.790000, TRUE),
+('32100', 'Belluno', 'BL', 46.142500, 12.216700, TRUE),
+-- Friuli-Venezia Giulia
+('34121', 'Trieste', 'TS', 45.649500, 13.776800, TRUE),
+('33100', 'Udine', 'UD', 46.071100, 13.234600, TRUE),
+('33170', 'Pordenone', 'PN', 45.956400, 12.661500, TRUE),
+('34170', 'Gorizia', 'GO', 45.940900, 13.621700, TRUE),
+-- Liguria
+('16121', 'Genova', 'GE', 44.405600, 8.946300, TRUE),
+('19121', 'La Spezia', 'SP', 44.102500, 9.824100, TRUE),
+('17100', 'Savona', 'SV', 44.309100, 8.477200, TRUE),
+('18100', 'Imperia', 'IM', 43.889700, 8.039400, TRUE),
+-- Emilia-Romagna
+('40121', 'Bologna', 'BO', 44.494900, 11.342600, TRUE),
+('41121', 'Modena', 'MO', 44.647100, 10.925200, TRUE),
+('43121', 'Parma', 'PR', 44.801500, 10.327900, TRUE),
+('42121', 'Reggio Emilia', 'RE', 44.698300, 10.631200, TRUE),
+('44121', 'Ferrara', 'FE', 44.838100, 11.619800, TRUE),
+('48121', 'Ravenna', 'RA', 44.418400, 12.203500, TRUE),
+('47121', 'Forlì', 'FC', 44.222700, 12.040700, TRUE),
+('47921', 'Rimini', 'RN', 44.067800, 12.569500, TRUE),
+('29121', 'Piacenza', 'PC', 45.052600, 9.693000, TRUE),
+-- Toscana
+('50121', 'Firenze', 'FI', 43.769600, 11.255800, TRUE),
+('56121', 'Pisa', 'PI', 43.722800, 10.401700, TRUE),
+('57121', 'Livorno', 'LI', 43.548500, 10.310600, TRUE),
+('55100', 'Lucca', 'LU', 43.842900, 10.502700, TRUE),
+('53100', 'Siena', 'SI', 43.318800, 11.330800, TRUE),
+('52100', 'Arezzo', 'AR', 43.463300, 11.879600, TRUE),
+('58100', 'Grosseto', 'GR', 42.763500, 11.112400, TRUE),
+('54100', 'Massa', 'MS', 44.035400, 10.139700, TRUE),
+('51100', 'Pistoia', 'PT', 43.930300, 10.907800, TRUE),
+('59100', 'Prato', 'PO', 43.877700, 11.102200, TRUE),
+-- Umbria
+('06121', 'Perugia', 'PG', 43.110700, 12.390800, TRUE),
+('05100', 'Terni', 'TR', 42.563600, 12.642700, TRUE),
+-- Marche
+('60121', 'Ancona', 'AN', 43.615800, 13.518900, TRUE),
+('61121', 'Pesaro', 'PU', 43.910000, 12.913300, TRUE),
+('62100', 'Macerata', 'MC', 43.300300, 13.453000, TRUE),
+('63100', 'Ascoli Piceno', 'AP', 42.853600, 13.574900, TRUE),
+('63900', 'Fermo', 'FM', 43.160600, 13.718100, TRUE),
+-- Lazio
+('00185', 'Roma', 'RM', 41.902800, 12.496400, TRUE),
+('04100', 'Latina', 'LT', 41.467600, 12.903700, TRUE),
+('03100', 'Frosinone', 'FR', 41.639600, 13.342600, TRUE),
+('01100', 'Viterbo', 'VT', 42.420700, 12.107700, TRUE),
+('02100', 'Rieti', 'RI', 42.404800, 12.862500, TRUE),
+-- Abruzzo
+('67100', 'L''Aquila', 'AQ', 42.349800, 13.399500, TRUE),
+('65121', 'Pescara', 'PE', 42.461800, 14.216100, TRUE),
+('66100', 'Chieti', 'CH', 42.351000, 14.167500, TRUE),
+('64100', 'Teramo', 'TE', 42.658900, 13.704400, TRUE),
+-- Molise
+('86100', 'Campobasso', 'CB', 41.560300, 14.662700, TRUE),
+('86170', 'Isernia', 'IS', 41.596000, 14.233000, TRUE),
+-- Campania
+('80121', 'Napoli', 'NA', 40.851800, 14.268100, TRUE),
+('84121', 'Salerno', 'SA', 40.682400, 14.768100, TRUE),
+('81100', 'Caserta', 'CE', 41.074200, 14.332800, TRUE),
+('83100', 'Avellino', 'AV', 40.914600, 14.790600, TRUE),
+('82100', 'Benevento', 'BN', 41.129800, 14.782600, TRUE),
+-- Puglia
+('70121', 'Bari', 'BA', 41.117100, 16.871900, TRUE),
+('73100', 'Lecce', 'LE', 40.351500, 18.175000, TRUE),
+('74121', 'Taranto', 'TA', 40.464400, 17.247000, TRUE),
+('71121', 'Foggia', 'FG', 41.462200, 15.544600, TRUE),
+('72100', 'Brindisi', 'BR', 40.632700, 17.941800, TRUE),
+('76123', 'Andria', 'BT', 41.231700, 16.291700, TRUE),
+-- Basilicata
+('85100', 'Potenza', 'PZ', 40.640400, 15.805600, TRUE),
+('75100', 'Matera', 'MT', 40.666400, 16.604300, TRUE),
+-- Calabria
+('88100', 'Catanzaro', 'CZ', 38.909800, 16.587700, TRUE),
+('89121', 'Reggio Calabria', 'RC', 38.111300, 15.647300, TRUE),
+('87100', 'Cosenza', 'CS', 39.298300, 16.253800, TRUE),
+('88900', 'Crotone', 'KR', 39.080800, 17.127100, TRUE),
+('89900', 'Vibo Valentia', 'VV', 38.676300, 16.101200, TRUE),
+-- Sicilia
+('90121', 'Palermo', 'PA', 38.115700, 13.361500, TRUE),
+('95121', 'Catania', 'CT', 37.507900, 15.083000, TRUE),
+('98121', 'Messina', 'ME', 38.193800, 15.554000, TRUE),
+('96100', 'Siracusa', 'SR', 37.075500, 15.286600, TRUE),
+('97100', 'Ragusa', 'RG', 36.926900, 14.725500, TRUE),
+('91100', 'Trapani', 'TP', 38.017600, 12.536500, TRUE),
+('92100', 'Agrigento', 'AG', 37.311100, 13.576500, TRUE),
+('93100', 'Caltanissetta', 'CL', 37.490100, 14.062900, TRUE),
+('94100', 'Enna', 'EN', 37.567700, 14.279500, TRUE),
+-- Sardegna
+('09121', 'Cagliari', 'CA', 39.223800, 9.121700, TRUE),
+('07100', 'Sassari', 'SS', 40.725900, 8.555700, TRUE),
+('08100', 'Nuoro', 'NU', 40.320900, 9.330800, TRUE),
+('09170', 'Oristano', 'OR', 39.906200, 8.588400, TRUE),
+('09013', 'Carbonia', 'SU', 39.167200, 8.522200, TRUE)
+ON CONFLICT (postal_code, comune) DO NOTHING;
+
+COMMENT ON TABLE geo_places IS 'Offline CAP/comune coordinates for geocoding';
+
+-- =====================================================
+-- COORDINATES
+-- Filled in by the geocoding job when missing. Seller
+-- locations are geocoded to the street when a remote
+-- geocoder is configured; products only to the CAP or
+-- comune, since their coordinates are public.
+-- =====================================================
+ALTER TABLE seller_locations ADD COLUMN IF NOT EXISTS geocoded_at TIMESTAMP;
+ALTER TABLE seller_locations ADD COLUMN IF NOT EXISTS geocode_precision VARCHAR(20);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS geocoded_at TIMESTAMP;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS geocode_precision VARCHAR(20);
+
+CREATE INDEX IF NOT EXISTS idx_products_coordinates ON products(latitude, longitude)
+    WHERE latitude IS NOT NULL AND status = 'ACTIVE';
+CREATE INDEX IF NOT EXISTS idx_seller_locations_geocode ON seller_locations(created_at)
+    WHERE latitude IS NULL AND is_active = TRUE;
+CREATE INDEX IF NOT EXISTS idx_products_geocode ON products(created_at)
+    WHERE latitude IS NULL AND status <> 'DELETED';
+
+COMMENT ON COLUMN seller_locations.geocoded_at IS 'Last geocoding attempt (retried daily while coordinates are missing)';
+COMMENT ON COLUMN products.geocode_precision IS 'ADDRESS, POSTAL_CODE, CITY, PROVINCE, or NULL when set by the seller';
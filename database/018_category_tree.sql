@@ -0,0 +1,32 @@
+-- Migration: 018_category_tree.sql
+-- Description: Hierarchical categories (subtree lookup, admin management)
+-- Date: 2026-10-18
+
+-- =====================================================
+-- TREE
+-- categories.parent_id already links a category to its
+-- parent. Moves are checked for cycles in the backend;
+-- the constraint only rejects the trivial one.
+-- =====================================================
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_parent_not_self;
+ALTER TABLE categories ADD CONSTRAINT categories_parent_not_self
+    CHECK (parent_id IS NULL OR parent_id <> id);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id, sort_order);
+
+-- category_subtree returns a category and all its descendants:
+-- filtering products by a parent category includes its children
+CREATE OR REPLACE FUNCTION category_subtree(p_root UUID)
+RETURNS SETOF UUID AS $$
+    WITH RECURSIVE tree AS (
+        SELECT id FROM categories WHERE id = p_root
+        UNION
+        SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+    )
+    SELECT id FROM tree;
+$$ LANGUAGE sql STABLE;
+
+COMMENT ON FUNCTION category_subtree(UUID) IS 'A category and all its descendants';
+COMMENT ON COLUMN categories.sort_order IS 'Position among siblings (same parent_id)';
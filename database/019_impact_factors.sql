@@ -0,0 +1,72 @@
+-- Migration: 019_impact_factors.sql
+-- Description: Versioned environmental impact factors per category, waste avoided metric
+-- Date: 2026-10-18
+
+-- =====================================================
+-- IMPACT FACTORS
+-- CO2, water and waste avoided by saving one typical item
+-- of a category, weighing reference_kg (kg or litres).
+-- Orders by weight/volume (KG, G, L, ML) are scaled by
+-- reference_kg; orders by piece multiply by the quantity.
+-- Editing a factor supersedes it with a new version, so
+-- every order keeps pointing at the values it used.
+-- A category without its own factor uses its parent's,
+-- then the platform default (category_id NULL).
+-- =====================================================
+CREATE TABLE IF NOT EXISTS impact_factors (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    category_id UUID, -- no FK: factors of deleted/merged categories stay for order history
+    version INT NOT NULL,
+    co2_kg DECIMAL(10,3) NOT NULL CHECK (co2_kg >= 0),
+    water_l DECIMAL(10,2) NOT NULL CHECK (water_l >= 0),
+    waste_kg DECIMAL(10,3) NOT NULL CHECK (waste_kg >= 0),
+    reference_kg DECIMAL(10,3) NOT NULL DEFAULT 1 CHECK (reference_kg > 0),
+    note TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    superseded_at TIMESTAMP -- NULL for the version in use
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_impact_factors_version
+    ON impact_factors(COALESCE(category_id, '00000000-0000-0000-0000-000000000000'), version);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_impact_factors_current
+    ON impact_factors(COALESCE(category_id, '00000000-0000-0000-0000-000000000000'))
+    WHERE superseded_at IS NULL;
+
+-- Version 1: platform default and the values of docs/07_IMPACT_SYSTEM.md
+INSERT INTO impact_factors (category_id, version, co2_kg, water_l, waste_kg, note)
+SELECT v.category_id, 1, v.co2_kg, v.water_l, v.waste_kg, 'Valori iniziali (docs/07_IMPACT_SYSTEM.md)'
+FROM (VALUES
+    (NULL::uuid, 2, 500, 1),
+    ('10000000-0000-0000-0000-000000000001'::uuid, 2, 500, 1),    -- Alimentari Freschi
+    ('10000000-0000-0000-0000-000000000002'::uuid, 1, 200, 0.5),  -- Alimentari Confezionati
+    ('10000000-0000-0000-0000-000000000003'::uuid, 0.5, 100, 0.3), -- Bevande
+    ('10000000-0000-0000-0000-000000000004'::uuid, 1, 300, 0.5),  -- Frutta e Verdura
+    ('10000000-0000-0000-0000-000000000005'::uuid, 3, 400, 1),    -- Surgelati
+    ('10000000-0000-0000-0000-000000000006'::uuid, 5, 1000, 0.5), -- Cosmetici
+    ('10000000-0000-0000-0000-000000000007'::uuid, 3, 800, 0.3),  -- Cura Persona
+    ('10000000-0000-0000-0000-000000000008'::uuid, 4, 600, 1),    -- Detergenza Casa
+    ('10000000-0000-0000-0000-000000000009'::uuid, 2, 400, 0.5),  -- Pet Food
+    ('10000000-0000-0000-0000-000000000010'::uuid, 5, 200, 2),    -- Giardinaggio
+    ('10000000-0000-0000-0000-000000000011'::uuid, 15, 500, 5),   -- Materiali Tecnici
+    ('10000000-0000-0000-0000-000000000012'::uuid, 30, 2000, 10), -- Automotive
+    ('10000000-0000-0000-0000-000000000013'::uuid, 10, 800, 3),   -- Sicurezza e DPI
+    ('10000000-0000-0000-0000-000000000014'::uuid, 3, 500, 1)     -- HORECA
+) AS v(category_id, co2_kg, water_l, waste_kg)
+WHERE v.category_id IS NULL OR EXISTS (SELECT 1 FROM categories c WHERE c.id = v.category_id)
+ON CONFLICT DO NOTHING;
+
+COMMENT ON TABLE impact_factors IS 'Versioned CO2/water/waste avoided per item, by category';
+COMMENT ON COLUMN impact_factors.reference_kg IS 'Weight (kg) or volume (L) of the item the values refer to';
+COMMENT ON COLUMN categories.estimated_co2_kg IS 'Deprecated: see impact_factors';
+
+-- =====================================================
+-- WASTE AVOIDED
+-- =====================================================
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS waste_saved DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS impact_factor_id UUID REFERENCES impact_factors(id);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS impact_factor_version INT;
+ALTER TABLE impact_logs ADD COLUMN IF NOT EXISTS waste_saved DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS total_waste_saved DECIMAL(10,2) DEFAULT 0;
+
+COMMENT ON COLUMN orders.impact_factor_id IS 'Impact factor version used to compute co2/water/waste_saved';
@@ -0,0 +1,40 @@
+-- Migration: 020_impact_postings.sql
+-- Description: Post EcoCredits and impact to impact_logs when an order completes, reverse on refund
+-- Date: 2026-10-18
+
+-- =====================================================
+-- REVERSALS
+-- A refund posts one ORDER_REVERSAL entry per entry of
+-- the order, negating its impact and taking back its
+-- credits. reverses_id links it to the original.
+-- =====================================================
+-- Outside a transaction on PostgreSQL < 12
+ALTER TYPE impact_action_type ADD VALUE IF NOT EXISTS 'ORDER_REVERSAL';
+
+ALTER TABLE impact_logs ADD COLUMN IF NOT EXISTS reverses_id UUID REFERENCES impact_logs(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_impact_logs_reverses ON impact_logs(reverses_id)
+    WHERE reverses_id IS NOT NULL;
+
+-- Each order posts each action at most once per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_impact_logs_order_action ON impact_logs(order_id, user_id, action_type)
+    WHERE order_id IS NOT NULL AND reverses_id IS NULL;
+
+COMMENT ON COLUMN impact_logs.reverses_id IS 'Entry negated by this ORDER_REVERSAL';
+
+-- =====================================================
+-- ORDER POSTING STATE
+-- Set in the same transaction as the entries: an order
+-- is posted (and reversed) exactly once. The poster job
+-- picks up orders whose posting failed or was missed.
+-- =====================================================
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS impact_posted_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS impact_reversed_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_orders_impact_unposted ON orders(updated_at)
+    WHERE status = 'COMPLETED' AND impact_posted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_orders_impact_unreversed ON orders(updated_at)
+    WHERE status = 'REFUNDED' AND impact_posted_at IS NOT NULL AND impact_reversed_at IS NULL;
+
+COMMENT ON COLUMN orders.impact_posted_at IS 'When the order credits/impact were posted to impact_logs';
+COMMENT ON COLUMN orders.impact_reversed_at IS 'When they were reversed after a refund';
@@ -0,0 +1,38 @@
+-- Migration: 021_eco_credits_ledger.sql
+-- Description: EcoCredits balance invariants, drift report of the reconciliation job
+-- Date: 2026-10-18
+
+-- =====================================================
+-- BALANCE INVARIANTS
+-- impact_logs is the EcoCredits ledger: a user's balance
+-- is SUM(eco_credits_earned - eco_credits_spent), cached
+-- in users.eco_credits and updated in the same transaction.
+-- NOT VALID: enforced on every new write; run the VALIDATE
+-- statements once the reconciliation job reports no drift.
+-- =====================================================
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_eco_credits_non_negative;
+ALTER TABLE users ADD CONSTRAINT users_eco_credits_non_negative
+    CHECK (eco_credits >= 0) NOT VALID;
+
+ALTER TABLE impact_logs DROP CONSTRAINT IF EXISTS impact_logs_credits_non_negative;
+ALTER TABLE impact_logs ADD CONSTRAINT impact_logs_credits_non_negative
+    CHECK (eco_credits_earned >= 0 AND eco_credits_spent >= 0 AND eco_credits_balance >= 0) NOT VALID;
+
+-- ALTER TABLE users VALIDATE CONSTRAINT users_eco_credits_non_negative;
+-- ALTER TABLE impact_logs VALIDATE CONSTRAINT impact_logs_credits_non_negative;
+
+-- =====================================================
+-- DRIFT
+-- Users whose users.eco_credits differs from the ledger,
+-- as of the last reconciliation run. Rows are removed once
+-- the balances match again.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS eco_credits_drift (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    ledger_balance INT NOT NULL,
+    stored_balance INT NOT NULL,
+    first_detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE eco_credits_drift IS 'Users whose cached eco_credits differs from SUM(impact_logs), from the reconciliation job';
@@ -0,0 +1,38 @@
+-- Migration: 022_eco_credit_lots.sql
+-- Description: EcoCredits lots for FIFO expiry of earned credits
+-- Date: 2026-10-18
+
+-- =====================================================
+-- CREDIT LOTS
+-- Every ledger entry that earns credits opens a lot;
+-- spending consumes the oldest lots first (FIFO). Lots
+-- expire ECO_CREDITS_LIFETIME after earned_at: what's
+-- left of them is posted as a POINTS_EXPIRED entry.
+-- SUM(remaining) of a user's lots is their balance.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS eco_credit_lots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    impact_log_id UUID REFERENCES impact_logs(id) ON DELETE SET NULL, -- entry that earned it
+    amount INT NOT NULL CHECK (amount > 0),
+    remaining INT NOT NULL,
+    earned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    warned_at TIMESTAMP,  -- expiry warning email sent
+    expired_at TIMESTAMP, -- remaining credits expired
+    CONSTRAINT eco_credit_lots_remaining CHECK (remaining >= 0 AND remaining <= amount)
+);
+
+CREATE INDEX IF NOT EXISTS idx_eco_credit_lots_open ON eco_credit_lots(user_id, earned_at)
+    WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS idx_eco_credit_lots_earned ON eco_credit_lots(earned_at)
+    WHERE remaining > 0;
+
+-- Existing balances become a single lot earned today, so they get
+-- a full lifetime before expiring
+INSERT INTO eco_credit_lots (user_id, amount, remaining)
+SELECT u.id, u.eco_credits, u.eco_credits
+FROM users u
+WHERE u.eco_credits > 0
+    AND NOT EXISTS (SELECT 1 FROM eco_credit_lots l WHERE l.user_id = u.id);
+
+COMMENT ON TABLE eco_credit_lots IS 'Earned EcoCredits, consumed oldest first, expiring after ECO_CREDITS_LIFETIME';
@@ -0,0 +1,126 @@
+-- Migration: 023_eco_rewards.sql
+-- Description: EcoCredits reward catalogue and fulfilment (boosts, category pins, badges, commission waivers)
+-- Date: 2026-10-18
+
+-- =====================================================
+-- CATALOGUE
+-- code identifies a reward in the API (e.g. BOOST_24H);
+-- reward_type selects how it's fulfilled, config its
+-- parameters: {"duration_hours"} for VISIBILITY_BOOST and
+-- TOP_CATEGORY, {"badge_name", "badge_icon"} for BADGE,
+-- {"max_amount", "valid_days"} for COMMISSION_WAIVER,
+-- {"tree_count"} for TREE_DONATION.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS eco_rewards (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(200) NOT NULL,
+    description TEXT,
+    icon VARCHAR(50),
+    eco_credits_cost INT NOT NULL,
+    reward_type VARCHAR(50) NOT NULL,
+    config JSONB,
+    is_active BOOLEAN DEFAULT TRUE,
+    stock INT, -- NULL = unlimited
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE eco_rewards ADD COLUMN IF NOT EXISTS code VARCHAR(50);
+ALTER TABLE eco_rewards ADD COLUMN IF NOT EXISTS sort_order INT DEFAULT 0;
+ALTER TABLE eco_rewards ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE eco_rewards DROP CONSTRAINT IF EXISTS eco_rewards_cost_positive;
+ALTER TABLE eco_rewards ADD CONSTRAINT eco_rewards_cost_positive CHECK (eco_credits_cost > 0);
+ALTER TABLE eco_rewards DROP CONSTRAINT IF EXISTS eco_rewards_stock_non_negative;
+ALTER TABLE eco_rewards ADD CONSTRAINT eco_rewards_stock_non_negative CHECK (stock IS NULL OR stock >= 0);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_eco_rewards_code ON eco_rewards(code);
+CREATE INDEX IF NOT EXISTS idx_eco_rewards_active ON eco_rewards(is_active, sort_order);
+
+-- The rewards RedeemReward offered so far, same costs. The rows seeded by
+-- schemas/database.sql predate code and carry older prices and config
+-- (BOOST_24H at 200, BADGE at 1000): they take the catalogue values here,
+-- once, as only rows without a code are updated.
+WITH seed (code, name, description, icon, eco_credits_cost, reward_type, config, sort_order) AS (
+    VALUES
+    ('BOOST_24H', 'Boost Visibilità 24h', 'Il tuo prodotto in evidenza negli annunci per 24 ore', '🚀', 100, 'VISIBILITY_BOOST', '{"duration_hours": 24}'::jsonb, 1),
+    ('BOOST_7D', 'Boost Visibilità 7 giorni', 'Il tuo prodotto in evidenza negli annunci per una settimana', '🚀', 500, 'VISIBILITY_BOOST', '{"duration_hours": 168}'::jsonb, 2),
+    ('TOP_CATEGORY', 'Primo nella Categoria', 'Il tuo prodotto in cima alla sua categoria per 3 giorni', '📌', 200, 'TOP_CATEGORY', '{"duration_hours": 72}'::jsonb, 3),
+    ('BADGE', 'Badge Eco-Master', 'Un badge esclusivo sul tuo profilo', '🏅', 150, 'BADGE', '{"badge_name": "Eco-Master", "badge_icon": "🏅"}'::jsonb, 4),
+    ('COMMISSION_WAIVER', 'Zero Commissioni', 'Nessuna commissione GecoGreen sulla tua prossima vendita (fino a 20€)', '💸', 800, 'COMMISSION_WAIVER', '{"max_amount": 20, "valid_days": 90}'::jsonb, 5),
+    ('TREE', 'Pianta un Albero', 'Donazione per piantare un albero a tuo nome', '🌳', 300, 'TREE_DONATION', '{"tree_count": 1}'::jsonb, 6)
+),
+legacy AS (
+    UPDATE eco_rewards r SET
+        code = s.code,
+        name = s.name,
+        description = s.description,
+        icon = s.icon,
+        eco_credits_cost = s.eco_credits_cost,
+        config = s.config,
+        sort_order = s.sort_order,
+        updated_at = CURRENT_TIMESTAMP
+    FROM seed s
+    WHERE r.code IS NULL
+        AND s.code = CASE r.reward_type
+            WHEN 'VISIBILITY_BOOST' THEN 'BOOST_24H'
+            WHEN 'TREE_DONATION' THEN 'TREE'
+            ELSE r.reward_type
+        END
+    RETURNING r.code
+)
+INSERT INTO eco_rewards (code, name, description, icon, eco_credits_cost, reward_type, config, sort_order)
+SELECT code, name, description, icon, eco_credits_cost, reward_type, config, sort_order
+FROM seed
+WHERE code NOT IN (SELECT code FROM legacy)
+ON CONFLICT (code) DO NOTHING;
+
+-- Any other row predating code is named after its type
+UPDATE eco_rewards SET code = reward_type WHERE code IS NULL;
+
+COMMENT ON TABLE eco_rewards IS 'Catalogue of rewards redeemable with EcoCredits';
+COMMENT ON COLUMN eco_rewards.code IS 'Stable identifier used by the API (RedeemRequest.reward_type)';
+
+-- =====================================================
+-- REDEMPTIONS
+-- status: ACTIVE until expires_at (boosts, pins, badges,
+-- unused waivers; a waiver reserved by a pending order has
+-- applied_to_order_id set), USED once that order is paid,
+-- PENDING while a tree donation awaits fulfilment.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS redeemed_rewards (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    reward_id UUID REFERENCES eco_rewards(id),
+    eco_credits_spent INT NOT NULL,
+    status VARCHAR(20) DEFAULT 'PENDING',
+    used_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    applied_to_order_id UUID REFERENCES orders(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE redeemed_rewards ADD COLUMN IF NOT EXISTS product_id UUID REFERENCES products(id) ON DELETE SET NULL;
+ALTER TABLE redeemed_rewards ADD COLUMN IF NOT EXISTS impact_log_id UUID REFERENCES impact_logs(id) ON DELETE SET NULL;
+ALTER TABLE redeemed_rewards ADD COLUMN IF NOT EXISTS config JSONB; -- reward config at redemption time
+
+CREATE INDEX IF NOT EXISTS idx_redeemed_rewards_user ON redeemed_rewards(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_redeemed_rewards_status ON redeemed_rewards(status);
+CREATE INDEX IF NOT EXISTS idx_redeemed_rewards_order ON redeemed_rewards(applied_to_order_id)
+    WHERE applied_to_order_id IS NOT NULL;
+
+-- Outside a transaction on PostgreSQL < 12
+ALTER TYPE impact_action_type ADD VALUE IF NOT EXISTS 'REDEEM_COMMISSION_WAIVER';
+
+-- =====================================================
+-- FULFILMENT
+-- =====================================================
+-- Boosted products rank first in listings, pinned ones first in their category
+ALTER TABLE products ADD COLUMN IF NOT EXISTS boosted_until TIMESTAMP;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS pinned_until TIMESTAMP;
+
+-- Fee waived by a COMMISSION_WAIVER
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS platform_fee_waived DECIMAL(10,2) DEFAULT 0;
+
+COMMENT ON COLUMN products.boosted_until IS 'VISIBILITY_BOOST reward: ranks first in listings until then';
+COMMENT ON COLUMN products.pinned_until IS 'TOP_CATEGORY reward: ranks first in its category until then';
+COMMENT ON COLUMN orders.platform_fee_waived IS 'Platform fee not charged thanks to a COMMISSION_WAIVER reward';
@@ -0,0 +1,68 @@
+-- Migration: 024_tree_donations.sql
+-- Description: Tree donations ledger (TREE_DONATION rewards planted by a partner) and community impact totals
+-- Date: 2026-10-18
+
+-- =====================================================
+-- TREE DONATIONS
+-- Every TREE_DONATION redemption adds a PENDING row to
+-- trees_planted; the tree planter claims them in batches,
+-- marks them SUBMITTED, sends them to the partner
+-- (TREE_PROVIDER) and stores the certificate, then the
+-- row is PLANTED. Rows the partner never received go back
+-- to PENDING and are retried with a growing delay; rows
+-- it may have received stay SUBMITTED, never sent twice.
+-- =====================================================
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS redeemed_reward_id UUID REFERENCES redeemed_rewards(id) ON DELETE SET NULL;
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS trees_count INT NOT NULL DEFAULT 1;
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'PLANTED'; -- rows before this migration were planted
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS provider VARCHAR(50);
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS last_attempt_at TIMESTAMP;
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE trees_planted ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+-- planted_at is set when the partner confirms the tree
+ALTER TABLE trees_planted ALTER COLUMN planted_at DROP DEFAULT;
+
+ALTER TABLE trees_planted DROP CONSTRAINT IF EXISTS trees_planted_trees_count;
+ALTER TABLE trees_planted ADD CONSTRAINT trees_planted_trees_count CHECK (trees_count > 0);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trees_redeemed_reward ON trees_planted(redeemed_reward_id)
+    WHERE redeemed_reward_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_trees_pending ON trees_planted(created_at)
+    WHERE status = 'PENDING';
+
+COMMENT ON TABLE trees_planted IS 'Tree donations, planted by the partner selected with TREE_PROVIDER';
+COMMENT ON COLUMN trees_planted.tree_nation_id IS 'Certificate ID from the tree provider';
+COMMENT ON COLUMN trees_planted.tree_nation_url IS 'Certificate URL from the tree provider';
+COMMENT ON COLUMN trees_planted.status IS 'PENDING until sent to the provider, SUBMITTED until it confirms it, then PLANTED';
+
+-- =====================================================
+-- COMMUNITY IMPACT
+-- Single row. trees_target is the next milestone shown
+-- with the trees planted: it moves up by 100 when reached.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS community_impact (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    total_co2_saved DECIMAL(12,2) DEFAULT 0,
+    total_water_saved DECIMAL(12,2) DEFAULT 0,
+    total_waste_avoided DECIMAL(12,2) DEFAULT 0,
+    total_orders_completed INT DEFAULT 0,
+    total_items_saved INT DEFAULT 0,
+    trees_planted INT DEFAULT 0,
+    trees_target INT DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO community_impact (trees_planted, trees_target)
+SELECT 0, 100
+WHERE NOT EXISTS (SELECT 1 FROM community_impact);
+
+-- Trees planted before this migration
+UPDATE community_impact SET
+    trees_planted = t.planted,
+    trees_target = (t.planted / 100 + 1) * 100,
+    updated_at = CURRENT_TIMESTAMP
+FROM (SELECT COALESCE(SUM(trees_count), 0)::int AS planted FROM trees_planted WHERE status = 'PLANTED') t;
+
+COMMENT ON TABLE community_impact IS 'Community totals; trees_planted and trees_target are kept up to date by the tree planter';
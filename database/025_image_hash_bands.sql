@@ -0,0 +1,28 @@
+-- Migration: 025_image_hash_bands.sql
+-- Description: Hash bands for indexed near-duplicate image lookups
+-- Date: 2026-10-18
+
+-- =====================================================
+-- HASH BANDS
+-- The 64-bit dHash is split in 11 bands (nine of 6 bits,
+-- then two of 5 bits, from the high bits down). Two hashes
+-- within Hamming distance 10 differ in at most 10 bands, so
+-- they share at least one band value: lookups only compare
+-- the rows sharing a band (GIN index on phash_bands).
+-- Each element is band * 64 + value.
+-- =====================================================
+ALTER TABLE image_hashes ADD COLUMN IF NOT EXISTS phash_bands INT[];
+
+UPDATE image_hashes SET phash_bands = ARRAY(
+    SELECT b.band * 64 + ((phash >> b.shift) & b.mask)::int
+    FROM (VALUES
+        (0, 58, 63), (1, 52, 63), (2, 46, 63), (3, 40, 63), (4, 34, 63), (5, 28, 63),
+        (6, 22, 63), (7, 16, 63), (8, 10, 63), (9, 5, 31), (10, 0, 31)
+    ) AS b(band, shift, mask)
+    ORDER BY b.band
+)
+WHERE phash_bands IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_image_hashes_bands ON image_hashes USING GIN (phash_bands);
+
+COMMENT ON COLUMN image_hashes.phash_bands IS 'phash split in 11 bands (band * 64 + value), for indexed lookups within distance 10';
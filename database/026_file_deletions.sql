@@ -0,0 +1,28 @@
+-- Migration: 026_file_deletions.sql
+-- Description: Queue of stored files to delete once the account that referenced them is anonymised
+-- Date: 2026-10-18
+
+-- =====================================================
+-- FILE DELETIONS
+-- Filled in the same transaction that anonymises a user,
+-- so the database never points to files already deleted
+-- and no file is forgotten if storage is down: the account
+-- purger deletes them afterwards and retries the failures.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS file_deletions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id),
+
+    -- Public URL, or object key when is_private (dispute evidence)
+    file_ref VARCHAR(1000) NOT NULL,
+    is_private BOOLEAN NOT NULL DEFAULT FALSE,
+
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_deletions_attempt ON file_deletions(last_attempt_at NULLS FIRST);
+
+COMMENT ON TABLE file_deletions IS 'Files of anonymised accounts still to be removed from storage';
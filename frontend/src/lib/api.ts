@@ -7,6 +7,17 @@ const API_BASE = PUBLIC_API_URL !== undefined ? `${PUBLIC_API_URL}/api/v1` : 'ht
 interface ApiError {
 	error: string;
 	code?: number;
+	fields?: Record<string, string>;
+}
+
+// RequestError carries the per-field validation errors of a rejected request
+export class RequestError extends Error {
+	fields: Record<string, string>;
+
+	constructor(message: string, fields: Record<string, string> = {}) {
+		super(message);
+		this.fields = fields;
+	}
 }
 
 class ApiClient {
@@ -63,7 +74,8 @@ class ApiClient {
 		const data = await response.json();
 
 		if (!response.ok) {
-			throw new Error((data as ApiError).error || 'Errore sconosciuto');
+			const apiError = data as ApiError;
+			throw new RequestError(apiError.error || 'Errore sconosciuto', apiError.fields);
 		}
 
 		return data as T;
@@ -95,6 +107,72 @@ class ApiClient {
 		});
 	}
 
+	async logout() {
+		return this.request<{ success: boolean }>('/auth/logout', { method: 'POST' });
+	}
+
+	// Social login: the browser goes to the start URL, the provider comes back to /auth/oidc/callback
+	async getOIDCProviders() {
+		return this.request<{ providers: string[] }>('/auth/oidc/providers');
+	}
+
+	oidcStartURL(provider: string) {
+		return `${API_BASE}/auth/oidc/${encodeURIComponent(provider)}/start`;
+	}
+
+	// One-time code from the callback: tokens, a 2FA challenge or the onboarding of a new account
+	async oidcExchange(code: string) {
+		return this.request<OIDCExchangeResponse>('/auth/oidc/exchange', {
+			method: 'POST',
+			body: JSON.stringify({ code })
+		});
+	}
+
+	async oidcComplete(data: OIDCCompleteRequest) {
+		return this.request<AuthResponse | TwoFactorChallengeResponse>('/auth/oidc/complete', {
+			method: 'POST',
+			body: JSON.stringify(data)
+		});
+	}
+
+	// Second login step for accounts with 2FA (TOTP or recovery code)
+	async verifyTwoFactor(challengeToken: string, code: string) {
+		return this.request<AuthResponse>('/auth/2fa/verify', {
+			method: 'POST',
+			body: JSON.stringify({ challenge_token: challengeToken, code })
+		});
+	}
+
+	// Token from the link in the verification email
+	async verifyEmail(token: string) {
+		return this.request<{ success: boolean; message: string }>('/auth/verify-email', {
+			method: 'POST',
+			body: JSON.stringify({ token })
+		});
+	}
+
+	async resendVerification() {
+		return this.request<{ success: boolean; message: string }>('/auth/resend-verification', {
+			method: 'POST'
+		});
+	}
+
+	// Always succeeds, whether or not the email is registered
+	async forgotPassword(email: string) {
+		return this.request<{ success: boolean; message: string }>('/auth/forgot-password', {
+			method: 'POST',
+			body: JSON.stringify({ email })
+		});
+	}
+
+	// Token from the link in the reset email; logs out every device
+	async resetPassword(token: string, password: string) {
+		return this.request<{ success: boolean; message: string }>('/auth/reset-password', {
+			method: 'POST',
+			body: JSON.stringify({ token, password })
+		});
+	}
+
 	// Profile
 	async getProfile() {
 		return this.request<{ user: User; locations: Location[] }>('/profile');
@@ -107,6 +185,14 @@ class ApiClient {
 		});
 	}
 
+	// Without confirm nothing changes: the response lists the effects to show before confirming
+	async switchAccountType(data: SwitchAccountTypeRequest) {
+		return this.request<AccountSwitchResponse>('/profile/account-type', {
+			method: 'POST',
+			body: JSON.stringify(data)
+		});
+	}
+
 	async getLocations() {
 		return this.request<Location[]>('/profile/locations');
 	}
@@ -172,6 +258,11 @@ class ApiClient {
 		return this.request<Category[]>('/categories');
 	}
 
+	// Filtering products by a category includes its subcategories
+	async getCategoryTree() {
+		return this.request<CategoryNode[]>('/categories/tree');
+	}
+
 	// Products
 	async getProducts(params?: {
 		page?: number;
@@ -182,7 +273,13 @@ class ApiClient {
 		max_price?: number;
 		province?: string;
 		region?: string;
-		sort_by?: string;
+		listing_type?: 'SALE' | 'GIFT';
+		shipping_method?: Product['shipping_method'];
+		facets?: 'all' | string; // comma-separated ProductFacet names
+		lat?: number; // with lng: products within radius_km (default 25, max 200)
+		lng?: number;
+		radius_km?: number;
+		sort_by?: 'created_at' | 'price' | 'view_count' | 'relevance' | 'distance'; // relevance when searching, distance with lat/lng
 		sort_order?: string;
 	}) {
 		const searchParams = new URLSearchParams();
@@ -197,6 +294,43 @@ class ApiClient {
 		return this.request<ProductListResponse>(`/products${query ? `?${query}` : ''}`);
 	}
 
+	// Map markers in the visible area, grouped by zoom level (3-18)
+	async getProductMap(params: {
+		min_lat: number;
+		min_lng: number;
+		max_lat: number;
+		max_lng: number;
+		zoom: number;
+		search?: string;
+		category_id?: string;
+		min_price?: number;
+		max_price?: number;
+	}) {
+		const searchParams = new URLSearchParams();
+		Object.entries(params).forEach(([key, value]) => {
+			if (value !== undefined && value !== '') searchParams.append(key, String(value));
+		});
+		return this.request<ProductMapResponse>(`/products/map?${searchParams.toString()}`);
+	}
+
+	// Seller storefronts (contacts only for buyers with a paid order)
+	async getSeller(id: string) {
+		return this.request<SellerStorefront>(`/sellers/${id}`);
+	}
+
+	async getStorefront(slug: string) {
+		return this.request<SellerStorefront>(`/stores/${encodeURIComponent(slug)}`);
+	}
+
+	async getSellerProducts(id: string, params?: { page?: number; per_page?: number; sort_by?: string; sort_order?: string }) {
+		const searchParams = new URLSearchParams();
+		Object.entries(params || {}).forEach(([key, value]) => {
+			if (value !== undefined) searchParams.append(key, String(value));
+		});
+		const query = searchParams.toString();
+		return this.request<ProductListResponse>(`/sellers/${id}/products${query ? `?${query}` : ''}`);
+	}
+
 	async getProduct(id: string) {
 		return this.request<Product>(`/products/${id}`);
 	}
@@ -215,6 +349,21 @@ class ApiClient {
 		});
 	}
 
+	// New listings are drafts until they have MIN_PRODUCT_IMAGES photos
+	async publishProduct(id: string) {
+		return this.request<Product>(`/products/${id}`, {
+			method: 'PUT',
+			body: JSON.stringify({ status: 'ACTIVE' })
+		});
+	}
+
+	async deleteProductImage(id: string, url: string) {
+		return this.request<{ images: string[] }>(`/products/${id}/images`, {
+			method: 'DELETE',
+			body: JSON.stringify({ url })
+		});
+	}
+
 	async deleteProduct(id: string) {
 		return this.request<{ message: string }>(`/products/${id}`, {
 			method: 'DELETE'
@@ -321,6 +470,20 @@ export const api = new ApiClient();
 
 // Types
 export type AccountType = 'PRIVATE' | 'BUSINESS';
+export type UserRole = 'BUYER' | 'SELLER' | 'MODERATOR' | 'SUPPORT' | 'ADMIN';
+export type Permission =
+	| 'images:review'
+	| 'reviews:moderate'
+	| 'products:manage_any'
+	| 'orders:read_any'
+	| 'orders:override_status'
+	| 'disputes:resolve'
+	| 'awards:manage'
+	| 'users:manage'
+	| 'audit:read'
+	| 'categories:manage'
+	| 'impact_factors:manage'
+	| 'rewards:manage';
 
 export interface SocialLinks {
 	instagram?: string;
@@ -356,11 +519,16 @@ export interface User {
 	avatar_url?: string;
 	social_links?: SocialLinks;
 	business_photos?: string[];
+	slug?: string; // storefront address
 	status: string;
 	email_verified: boolean;
+	roles: UserRole[];
+	permissions: Permission[];
 	is_admin: boolean;
+	deletion_scheduled_at?: string; // account deletion requested, can still be cancelled
 	total_co2_saved: number;
 	total_water_saved: number;
+	total_waste_saved: number;
 	eco_credits: number;
 	eco_level: string;
 	rating_avg: number;
@@ -383,6 +551,8 @@ export interface Location {
 	email?: string;
 	pickup_hours?: string;
 	pickup_instructions?: string;
+	latitude?: number; // filled in by geocoding
+	longitude?: number;
 	created_at: string;
 }
 
@@ -432,6 +602,30 @@ export interface UpdateProfileRequest {
 	billing_country?: string;
 }
 
+export interface SwitchAccountTypeRequest extends Omit<UpdateProfileRequest, 'account_type'> {
+	account_type: AccountType;
+	confirm?: boolean;
+}
+
+export interface AccountSwitchEffect {
+	code:
+		| 'BUSINESS_DATA_PUBLIC'
+		| 'BUSINESS_DATA_HIDDEN'
+		| 'BUSINESS_PHOTOS_SHOWN'
+		| 'BUSINESS_PHOTOS_HIDDEN'
+		| 'LISTINGS_UNPUBLISHED'
+		| 'INVOICES_KEPT';
+	message: string;
+	count?: number;
+}
+
+export interface AccountSwitchResponse {
+	account_type: AccountType;
+	applied: boolean;
+	effects: AccountSwitchEffect[];
+	user?: User;
+}
+
 export interface CreateLocationRequest {
 	name: string;
 	address_street: string;
@@ -452,6 +646,36 @@ export interface AuthResponse {
 	expires_in: number;
 }
 
+export interface TwoFactorChallengeResponse {
+	two_factor_required: true;
+	challenge_token: string;
+	expires_in: number;
+}
+
+export interface OIDCOnboardingResponse {
+	onboarding_required: true;
+	onboarding_token: string;
+	provider: string;
+	email: string;
+	first_name: string;
+	last_name: string;
+}
+
+export type OIDCExchangeResponse = AuthResponse | TwoFactorChallengeResponse | OIDCOnboardingResponse;
+
+export interface OIDCCompleteRequest {
+	onboarding_token: string;
+	first_name: string;
+	last_name: string;
+	account_type: AccountType;
+	business_name?: string;
+	vat_number?: string;
+	has_multiple_locations: boolean;
+	city: string;
+	province?: string;
+	postal_code?: string;
+}
+
 export interface UserProfile {
 	id: string;
 	first_name: string;
@@ -471,9 +695,16 @@ export interface Category {
 	id: string;
 	name: string;
 	slug: string;
+	description?: string;
 	icon?: string;
 	parent_id?: string;
-	sort_order: number;
+	sort_order: number; // position among siblings
+	is_active: boolean;
+}
+
+export interface CategoryNode extends Category {
+	product_count: number; // active products in the category and its subcategories
+	children: CategoryNode[];
 }
 
 export interface Product {
@@ -509,6 +740,12 @@ export interface Product {
 	created_at: string;
 	updated_at: string;
 	seller?: UserProfile;
+	// Search results only: HTML-escaped text with <mark> around the matched words
+	highlight?: { title?: string; description?: string; rank: number };
+	// Geo search only: km from the requested point
+	distance_km?: number;
+	// Visibility boost redeemed with EcoCredits running
+	boosted?: boolean;
 }
 
 export interface ProductListResponse {
@@ -517,8 +754,77 @@ export interface ProductListResponse {
 	page: number;
 	per_page: number;
 	total_pages: number;
+	// With the facets parameter: counts under the other filters
+	facets?: Partial<Record<ProductFacet, FacetValue[]>>;
+}
+
+export type ProductFacet = 'category' | 'province' | 'listing_type' | 'shipping_method' | 'price';
+
+export interface FacetValue {
+	value: string;
+	label?: string; // category name
+	count: number;
+	min?: number; // price buckets: min_price/max_price to filter on it
+	max?: number;
+}
+
+export interface ProductMapResponse {
+	zoom: number;
+	total: number;
+	clusters: MapCluster[];
+	truncated: boolean;
 }
 
+// A marker: single products carry their summary, groups only the count
+export interface MapCluster {
+	lat: number;
+	lng: number;
+	count: number;
+	product?: {
+		id: string;
+		title: string;
+		price: number;
+		listing_type: 'SALE' | 'GIFT';
+		image?: string;
+	};
+}
+
+export interface SellerReview {
+	id: string;
+	order_id: string;
+	rating: number;
+	comment?: string;
+	is_anonymous: boolean;
+	created_at: string;
+	reviewer?: UserProfile;
+}
+
+export interface SellerStorefront {
+	profile: UserProfile & {
+		phone?: string;
+		social_links?: SocialLinks;
+		business_photos?: string[];
+		vat_number?: string;
+	};
+	slug: string;
+	badges: {
+		verified: boolean;
+		verified_business: boolean;
+		top_rated: boolean;
+		rewards: { name: string; icon?: string; awarded_at: string }[];
+	};
+	ratings: { average: number; count: number; stars: Record<string, number> };
+	recent_reviews: SellerReview[];
+	listings: ProductListResponse;
+	pickup_areas: { city: string; province?: string }[];
+	impact: { co2_saved: number; water_saved: number; waste_saved: number; items_sold: number; orders_completed: number };
+	contact_visible: boolean;
+}
+
+// Photos required to publish a listing, and the gallery cap (models.MinProductImages/MaxProductImages)
+export const MIN_PRODUCT_IMAGES = 3;
+export const MAX_PRODUCT_IMAGES = 10;
+
 export interface CreateProductRequest {
 	title: string;
 	description: string;
@@ -1,5 +1,5 @@
 import { writable, derived } from 'svelte/store';
-import { api, type User, type RegisterRequest } from '$lib/api';
+import { api, type User, type RegisterRequest, type AuthResponse } from '$lib/api';
 import { browser } from '$app/environment';
 
 interface AuthState {
@@ -66,7 +66,18 @@ function createAuthStore() {
 			}
 		},
 
+		// Session from a login that didn't go through login() (social login, 2FA)
+		setSession(response: AuthResponse) {
+			api.setToken(response.access_token);
+			localStorage.setItem('refresh_token', response.refresh_token);
+			set({ user: response.user, loading: false, initialized: true });
+		},
+
 		logout() {
+			// Revoke the server-side session; local logout proceeds regardless
+			if (api.getToken()) {
+				api.logout().catch(() => {});
+			}
 			api.setToken(null);
 			if (browser) {
 				localStorage.removeItem('refresh_token');
@@ -86,4 +97,8 @@ export const auth = createAuthStore();
 export const isAuthenticated = derived(auth, ($auth) => !!$auth.user);
 export const isBusiness = derived(auth, ($auth) => $auth.user?.account_type === 'BUSINESS');
 export const isAdmin = derived(auth, ($auth) => $auth.user?.is_admin === true);
+export const canReviewImages = derived(
+	auth,
+	($auth) => $auth.user?.permissions?.includes('images:review') === true
+);
 export const currentUser = derived(auth, ($auth) => $auth.user);
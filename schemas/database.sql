@@ -13,7 +13,9 @@
 CREATE TYPE user_role AS ENUM (
     'BUYER',      -- Cliente che compra
     'SELLER',     -- Venditore verificato
-    'ADMIN'       -- Amministratore
+    'ADMIN',      -- Amministratore (tutti i permessi)
+    'MODERATOR',  -- Moderazione immagini e recensioni
+    'SUPPORT'     -- Assistenza clienti: ordini e contestazioni
 );
 
 -- Stato utente